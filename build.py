@@ -384,6 +384,7 @@ class Builder:
         # 编译命令
         cmd = [
             'go', 'build',
+            '-tags', 'sqlite_fts5',  # 启用 SQLite FTS5，用于消息全文搜索
             '-ldflags', ldflags_str,
             '-trimpath',
             '-o', str(output_path),
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/models"
+	"chat-backend/pkg/database"
+	"chat-backend/services"
+	"chat-backend/services/interfaces"
+	"chat-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AssistantHandler 处理助手相关的HTTP请求。
+type AssistantHandler struct {
+	assistantService interfaces.AssistantServiceInterface
+	promptTemplates  interfaces.PromptTemplateServiceInterface
+}
+
+// NewAssistantHandler 创建并返回一个新的助手处理器实例。
+func NewAssistantHandler(assistantService interfaces.AssistantServiceInterface, promptTemplates interfaces.PromptTemplateServiceInterface) *AssistantHandler {
+	return &AssistantHandler{
+		assistantService: assistantService,
+		promptTemplates:  promptTemplates,
+	}
+}
+
+// NewAssistantHandlerFromGlobal 使用全局服务创建助手处理器实例
+func NewAssistantHandlerFromGlobal() *AssistantHandler {
+	return &AssistantHandler{
+		assistantService: services.GetGlobalAssistantService(),
+		promptTemplates:  services.GetGlobalPromptTemplateService(),
+	}
+}
+
+// ListAssistants 返回助手列表。
+//
+// swagger:route GET /assistants Assistants listAssistants
+//
+// 获取助手列表
+//
+// 按名称排列返回全部助手及从各助手创建的对话数量
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//
+//	200: AssistantListResponse
+//	500: ResponseBody
+func (h *AssistantHandler) ListAssistants(c *gin.Context) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	assistants, err := h.assistantService.ListAssistants(ctx)
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInternalServer, err)
+	}
+
+	return assistants, nil
+}
+
+// CreateAssistant 创建助手。
+//
+// swagger:route POST /assistants Assistants createAssistant
+//
+// 创建助手
+//
+// 以对话设置创建一个可复用的助手，包括模型、参数、系统提示词、知识库和工具；
+// 设置了 prompt_template_id 时以模板内容作为系统提示词。创建对话时指定 assistant_id 即可从助手创建对话
+//
+// Consumes:
+// - application/json
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: body
+//     in: body
+//     description: 助手设置，name 为助手名称
+//     required: true
+//     type: ConversationSettings
+//
+// Responses:
+//
+//	200: Assistant
+//	400: ResponseBody
+func (h *AssistantHandler) CreateAssistant(c *gin.Context) (interface{}, error) {
+	settings, err := h.bindSettings(c)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.applyPromptTemplate(ctx, settings); err != nil {
+		return nil, err
+	}
+
+	assistant, err := h.assistantService.CreateAssistant(ctx, settings)
+	if err != nil {
+		return nil, assistantError(err)
+	}
+
+	return assistant, nil
+}
+
+// GetAssistant 返回指定的助手。
+//
+// swagger:route GET /assistants/{id} Assistants getAssistant
+//
+// 获取助手
+//
+// 获取助手的设置及从助手创建的对话数量
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: id
+//     in: path
+//     description: 助手ID
+//     required: true
+//     type: integer
+//
+// Responses:
+//
+//	200: Assistant
+//	400: ResponseBody
+//	404: ResponseBody
+func (h *AssistantHandler) GetAssistant(c *gin.Context) (interface{}, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	assistant, err := h.assistantService.GetAssistant(ctx, id)
+	if err != nil {
+		return nil, assistantError(err)
+	}
+
+	return assistant, nil
+}
+
+// UpdateAssistant 修改助手。
+//
+// swagger:route PUT /assistants/{id} Assistants updateAssistant
+//
+// 修改助手
+//
+// 修改助手的设置，对从助手创建的全部对话之后的提问生效，这些对话的名称和描述保持不变
+//
+// Consumes:
+// - application/json
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: id
+//     in: path
+//     description: 助手ID
+//     required: true
+//     type: integer
+//   - +name: body
+//     in: body
+//     description: 助手设置，name 为助手名称
+//     required: true
+//     type: ConversationSettings
+//
+// Responses:
+//
+//	200: Assistant
+//	400: ResponseBody
+//	404: ResponseBody
+func (h *AssistantHandler) UpdateAssistant(c *gin.Context) (interface{}, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	settings, err := h.bindSettings(c)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.applyPromptTemplate(ctx, settings); err != nil {
+		return nil, err
+	}
+
+	assistant, err := h.assistantService.UpdateAssistant(ctx, id, settings)
+	if err != nil {
+		return nil, assistantError(err)
+	}
+
+	return assistant, nil
+}
+
+// DeleteAssistant 删除助手。
+//
+// swagger:route DELETE /assistants/{id} Assistants deleteAssistant
+//
+// 删除助手
+//
+// 删除助手，助手下仍有对话时返回错误，需先删除这些对话
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: id
+//     in: path
+//     description: 助手ID
+//     required: true
+//     type: integer
+//
+// Responses:
+//
+//	200: MessageOnlyResponse
+//	400: ResponseBody
+//	404: ResponseBody
+func (h *AssistantHandler) DeleteAssistant(c *gin.Context) (interface{}, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.assistantService.DeleteAssistant(ctx, id); err != nil {
+		return nil, assistantError(err)
+	}
+
+	return models.MessageOnlyResponse{
+		Message: "助手删除成功",
+	}, nil
+}
+
+// bindSettings 解析助手设置，助手名称不能为空
+func (h *AssistantHandler) bindSettings(c *gin.Context) (*models.ConversationSettings, error) {
+	var settings models.ConversationSettings
+	// 使用 BindJSON 避免 validate 标签验证
+	if err := c.BindJSON(&settings); err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+	settings.Name = strings.TrimSpace(settings.Name)
+	if settings.Name == "" {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, errors.New("助手名称不能为空"))
+	}
+	settings.AssistantID = 0
+	return &settings, nil
+}
+
+// applyPromptTemplate 助手设置引用提示词模板时，以模板内容作为系统提示词
+func (h *AssistantHandler) applyPromptTemplate(ctx context.Context, settings *models.ConversationSettings) error {
+	if err := h.promptTemplates.ApplyTemplate(ctx, settings); err != nil {
+		if errors.Is(err, database.ErrNotFound) || errors.Is(err, models.ErrPromptVarsMissing) {
+			return utils.NewAPIError(utils.ErrInvalidRequest, err)
+		}
+		return utils.NewAPIError(utils.ErrInternalServer, err)
+	}
+	return nil
+}
+
+// assistantError 将助手服务的错误转换为API错误
+func assistantError(err error) error {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return utils.NewAPIError(utils.ErrNotFound, err)
+	case errors.Is(err, models.ErrAssistantInUse):
+		return utils.NewAPIError(utils.ErrInvalidRequest, err)
+	default:
+		return utils.NewAPIError(utils.ErrInternalServer, err)
+	}
+}
@@ -2,13 +2,16 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"chat-backend/models"
+	"chat-backend/pkg/database"
 	"chat-backend/services"
 	"chat-backend/services/interfaces"
 	"chat-backend/utils"
@@ -20,13 +23,17 @@ import (
 type ChatHandler struct {
 	chatService            interfaces.ChatServiceInterface
 	defaultSettingsService interfaces.DefaultSettingsServiceInterface
+	generations            *services.GenerationRegistry
+	promptTemplates        interfaces.PromptTemplateServiceInterface
 }
 
 // NewChatHandler 创建并返回一个新的聊天处理器实例。
-func NewChatHandler(chatService interfaces.ChatServiceInterface, defaultSettingsService interfaces.DefaultSettingsServiceInterface) *ChatHandler {
+func NewChatHandler(chatService interfaces.ChatServiceInterface, defaultSettingsService interfaces.DefaultSettingsServiceInterface, generations *services.GenerationRegistry, promptTemplates interfaces.PromptTemplateServiceInterface) *ChatHandler {
 	return &ChatHandler{
 		chatService:            chatService,
 		defaultSettingsService: defaultSettingsService,
+		generations:            generations,
+		promptTemplates:        promptTemplates,
 	}
 }
 
@@ -35,6 +42,8 @@ func NewChatHandlerFromGlobal() *ChatHandler {
 	return &ChatHandler{
 		chatService:            services.GetGlobalChatService(),
 		defaultSettingsService: services.GetGlobalDefaultSettingsService(),
+		generations:            services.GetGlobalGenerationRegistry(),
+		promptTemplates:        services.GetGlobalPromptTemplateService(),
 	}
 }
 
@@ -42,7 +51,8 @@ func NewChatHandlerFromGlobal() *ChatHandler {
 //
 // 创建对话
 //
-// 根据配置创建一个新的对话
+// 根据配置创建一个新的对话，设置了 prompt_template_id 时以模板内容作为系统提示词；
+// 设置了 assistant_id 时从助手创建对话，除 name 和 desc 外的设置均取自助手
 //
 // Consumes:
 // - application/json
@@ -71,228 +81,1065 @@ func (h *ChatHandler) CreateConversation(c *gin.Context) (interface{}, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if err := h.applyPromptTemplate(ctx, &settings); err != nil {
+		return nil, err
+	}
+
 	conversation, err := h.chatService.CreateConversation(ctx, &settings)
 	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, utils.NewAPIError(utils.ErrInvalidRequest, fmt.Errorf("助手不存在: %w", err))
+		}
+		return nil, utils.NewAPIError(utils.ErrConversationCreate, err)
+	}
+
+	return conversation, nil
+}
+
+// ImportConversations 从 ChatGPT/OpenAI 导出数据导入对话。
+//
+// swagger:route POST /chat/conversations/import Chat importConversations
+//
+// 导入对话
+//
+// 解析 ChatGPT 的 conversations.json 或 OpenAI 的 messages 数组，为其中每个对话创建带历史记录的新对话，导入后可继续对话
+// 任一对话导入失败时撤销本次已创建的对话。导入数据为空、格式有误或没有可导入的消息时返回 400
+//
+// Consumes:
+// - application/json
+//
+// Produces:
+// - application/json
+//
+// parameters:
+//   - +name: body
+//     in: body
+//     description: 导入请求
+//     required: true
+//     type: ConversationImportRequest
+//
+// Responses:
+//
+//	200: ConversationImportResponse
+//	400: ResponseBody
+//	500: ResponseBody
+func (h *ChatHandler) ImportConversations(c *gin.Context) (interface{}, error) {
+	var req models.ConversationImportRequest
+	if err := c.BindJSON(&req); err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	// 导出数据可能包含大量对话，每个对话都需要创建会话
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	result, err := services.ImportConversations(ctx, h.chatService, h.defaultSettingsService, &req)
+	switch {
+	case errors.Is(err, models.ErrImportData):
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	case err != nil:
 		return nil, utils.NewAPIError(utils.ErrConversationCreate, err)
 	}
 
-	return conversation, nil
+	return result, nil
+}
+
+// ForkConversation 从指定消息创建对话分支。
+//
+// swagger:route POST /chat/conversations/{id}/fork Chat forkConversation
+//
+// 创建对话分支
+//
+// 以相同的对话设置创建新对话，历史截至指定消息（含），用于从该处尝试不同的提问方向
+//
+// Consumes:
+// - application/json
+//
+// Produces:
+// - application/json
+//
+// parameters:
+//   - +name: id
+//     in: path
+//     description: 对话ID
+//     required: true
+//     type: integer
+//   - +name: body
+//     in: body
+//     description: 分支请求
+//     required: true
+//     type: ConversationForkRequest
+//
+// Responses:
+//
+//	200: Conversation
+//	400: ResponseBody
+func (h *ChatHandler) ForkConversation(c *gin.Context) (interface{}, error) {
+	conversationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	var req models.ConversationForkRequest
+	if err := c.BindJSON(&req); err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+	if req.MessageID <= 0 {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, fmt.Errorf("消息ID不能为空"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	conversation, err := h.chatService.ForkConversation(ctx, conversationID, req.MessageID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, utils.NewAPIError(utils.ErrConversationNotFound, err)
+		}
+		return nil, utils.NewAPIError(utils.ErrConversationCreate, err)
+	}
+
+	return conversation, nil
+}
+
+// GetConversations 返回分页的对话列表。
+//
+// swagger:route GET /chat/conversations Chat getConversations
+//
+// 获取对话列表
+//
+// 分页获取用户的对话列表，支持按关键字、知识库、模型、助手和时间范围过滤以及排序
+//
+// produces:
+// - application/json
+// parameters:
+//   - +name: page
+//     in: query
+//     description: 页码
+//     required: false
+//     type: integer
+//     default: 1
+//   - +name: page_size
+//     in: query
+//     description: 每页数量
+//     required: false
+//     type: integer
+//     default: 20
+//   - +name: keyword
+//     in: query
+//     description: 标题或描述关键字
+//     required: false
+//     type: string
+//   - +name: knowledge_base_id
+//     in: query
+//     description: 关联的知识库ID
+//     required: false
+//     type: integer
+//   - +name: model_id
+//     in: query
+//     description: 模型ID
+//     required: false
+//     type: integer
+//   - +name: assistant_id
+//     in: query
+//     description: 助手ID，只返回从该助手创建的对话
+//     required: false
+//     type: integer
+//   - +name: created_after
+//     in: query
+//     description: 创建时间起（RFC3339）
+//     required: false
+//     type: string
+//   - +name: created_before
+//     in: query
+//     description: 创建时间止（RFC3339）
+//     required: false
+//     type: string
+//   - +name: updated_after
+//     in: query
+//     description: 更新时间起（RFC3339）
+//     required: false
+//     type: string
+//   - +name: updated_before
+//     in: query
+//     description: 更新时间止（RFC3339）
+//     required: false
+//     type: string
+//   - +name: sort_by
+//     in: query
+//     description: 排序字段 created_at/updated_at/name
+//     required: false
+//     type: string
+//     default: created_at
+//   - +name: sort_order
+//     in: query
+//     description: 排序方向 asc/desc
+//     required: false
+//     type: string
+//     default: desc
+//
+// responses:
+//
+//	200: ConversationListResponse
+//	400: ResponseBody
+func (h *ChatHandler) GetConversations(c *gin.Context) (interface{}, error) {
+	var req models.ConversationListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+	if err := req.Normalize(); err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conversations, err := h.chatService.GetConversations(ctx, &req)
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInternalServer, err)
+	}
+
+	return conversations, nil
+}
+
+// DeleteConversation 根据ID删除指定的对话。
+//
+// swagger:route DELETE /chat/conversations/{id} Chat deleteConversation
+//
+// 删除对话
+//
+// 根据对话ID删除指定的对话记录和相关数据
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: id
+//     in: path
+//     description: 对话ID
+//     required: true
+//     type: integer
+//
+// Responses:
+//
+//	200: MessageOnlyResponse
+//	400: ResponseBody
+func (h *ChatHandler) DeleteConversation(c *gin.Context) (interface{}, error) {
+	conversationIDStr := c.Param("id")
+	if conversationIDStr == "" {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, nil)
+	}
+
+	conversationID, err := strconv.Atoi(conversationIDStr)
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = h.chatService.DeleteConversation(ctx, conversationID)
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrConversationNotFound, err)
+	}
+
+	return gin.H{
+		"message": "对话删除成功",
+	}, nil
+}
+
+// 聊天附件上传限制
+const (
+	chatFileMaxSize      = 20 << 20 // 聊天附件的最大字节数
+	chatFileFormOverhead = 1 << 20  // 请求体中附件之外的表单字段和分隔符的余量
+)
+
+// UploadChatFile 上传聊天附件。
+//
+// swagger:route POST /chat/files Chat uploadChatFile
+//
+// 上传聊天附件
+//
+// 上传文档或图片作为单轮提问的上下文，返回的附件ID在发送消息时通过 files 字段引用。
+// Flowy 后端由文件分析插件解析附件；langchaingo 后端支持 UTF-8 文本文件和 PDF、Word、PowerPoint、Excel 文档，提取的内容注入提示词
+//
+// Consumes:
+// - multipart/form-data
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: file
+//     in: formData
+//     description: 附件，最大 20MB
+//     required: true
+//     type: file
+//
+// Responses:
+//
+//	200: ChatFile
+//	400: ResponseBody
+func (h *ChatHandler) UploadChatFile(c *gin.Context) (interface{}, error) {
+	// 解析表单前限制请求体大小，超限时不再读取剩余内容
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, chatFileMaxSize+chatFileFormOverhead)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, utils.NewAPIError(utils.ErrFileSize, fmt.Errorf("附件超过 %dMB", chatFileMaxSize>>20))
+		}
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, fmt.Errorf("没有找到上传的文件: %w", err))
+	}
+	if fileHeader.Size > chatFileMaxSize {
+		return nil, utils.NewAPIError(utils.ErrFileSize, fmt.Errorf("附件 %s 超过 %dMB", fileHeader.Filename, chatFileMaxSize>>20))
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrFileUpload, fmt.Errorf("打开文件失败: %w", err))
+	}
+	defer file.Close()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+	defer cancel()
+
+	chatFile, err := h.chatService.UploadChatFile(ctx, fileHeader.Filename, file)
+	if err != nil {
+		if errors.Is(err, models.ErrChatFileType) {
+			return nil, utils.NewAPIError(utils.ErrFileType, err)
+		}
+		return nil, utils.NewAPIError(utils.ErrFileUpload, err)
+	}
+
+	return chatFile, nil
+}
+
+// SendMessage 向对话发送消息并返回SSE流式响应。
+//
+// swagger:route POST /chat/messages Chat sendMessage
+//
+// 发送消息
+//
+// 向指定对话发送消息并以SSE流式方式返回AI响应。
+// 每个事件带有递增的 id；携带 requestId 时生成不随连接断开而中止，可通过 GET /chat/messages/{requestId}/stream 恢复。
+// Accept 为 application/json，或未指定 Accept 且对话设置 stream 为 false 时，等待生成结束后以 ChatResponse 返回完整回答
+//
+// Consumes:
+// - application/json
+//
+// Produces:
+// - text/event-stream
+// - application/json
+//
+// Parameters:
+//   - +name: Accept
+//     in: header
+//     description: text/event-stream 为流式输出，application/json 为非流式输出，未指定时取对话设置
+//     required: false
+//     type: string
+//   - +name: body
+//     in: body
+//     description: 聊天请求
+//     required: true
+//     type: ChatRequest
+//
+// Responses:
+//
+//	200: ChatResponse
+//	400: ResponseBody
+//	409: ResponseBody
+//	500: ResponseBody
+func (h *ChatHandler) SendMessage(c *gin.Context) {
+	var req models.ChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据解析失败", "details": err.Error()})
+		return
+	}
+
+	if req.Content == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "消息内容不能为空"})
+		return
+	}
+
+	if req.ConversationID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "会话ID不能为空"})
+		return
+	}
+
+	h.streamMessage(c, &req)
+}
+
+// RegenerateMessage 重新生成最后一轮对话的回答。
+//
+// swagger:route POST /chat/messages/{id}/regenerate Chat regenerateMessage
+//
+// 重新生成回答
+//
+// 将消息所在的最后一轮对话归档为历史版本，以原提问重新生成回答，SSE 协议与发送消息相同。
+// Flowy 后端无法删除会话记录，对话在新的 Flowy 会话中继续，对话ID不变
+//
+// Consumes:
+// - application/json
+//
+// Produces:
+// - text/event-stream
+//
+// Parameters:
+//   - +name: id
+//     in: path
+//     description: 最后一轮对话中的任一消息ID
+//     required: true
+//     type: integer
+//   - +name: body
+//     in: body
+//     description: 重新生成请求
+//     required: false
+//     type: MessageRegenerateRequest
+//
+// Responses:
+//
+//	200:
+//	  description: SSE流式数据
+//	400: ResponseBody
+//	404: ResponseBody
+//	409: ResponseBody
+func (h *ChatHandler) RegenerateMessage(c *gin.Context) {
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	var body models.MessageRegenerateRequest
+	if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据解析失败", "details": err.Error()})
+		return
+	}
+
+	h.rewindMessage(c, body.RequestID, "重新生成回答失败", func(ctx context.Context) (*models.ChatRequest, error) {
+		return h.chatService.RegenerateMessage(ctx, messageID)
+	})
+}
+
+// EditMessage 编辑最后一轮对话的提问并重新生成回答。
+//
+// swagger:route PUT /chat/messages/{id} Chat editMessage
+//
+// 编辑消息
+//
+// 将最后一轮对话归档为历史版本，以新内容重新提问，SSE 协议与发送消息相同。
+// Flowy 后端无法删除会话记录，对话在新的 Flowy 会话中继续，对话ID不变
+//
+// Consumes:
+// - application/json
+//
+// Produces:
+// - text/event-stream
+//
+// Parameters:
+//   - +name: id
+//     in: path
+//     description: 最后一轮对话中的用户消息ID
+//     required: true
+//     type: integer
+//   - +name: body
+//     in: body
+//     description: 编辑请求
+//     required: true
+//     type: MessageEditRequest
+//
+// Responses:
+//
+//	200:
+//	  description: SSE流式数据
+//	400: ResponseBody
+//	404: ResponseBody
+//	409: ResponseBody
+func (h *ChatHandler) EditMessage(c *gin.Context) {
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	var body models.MessageEditRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据解析失败", "details": err.Error()})
+		return
+	}
+	if body.Content == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "消息内容不能为空"})
+		return
+	}
+
+	h.rewindMessage(c, body.RequestID, "编辑消息失败", func(ctx context.Context) (*models.ChatRequest, error) {
+		return h.chatService.EditMessage(ctx, messageID, body.Content)
+	})
+}
+
+// rewindMessage 归档最后一轮对话并以返回的请求重新生成
+// 先登记 RequestID 再归档，RequestID 正在生成中时直接返回 409，不会丢失原有的轮次
+func (h *ChatHandler) rewindMessage(c *gin.Context, requestID, failure string, rewind func(ctx context.Context) (*models.ChatRequest, error)) {
+	ctx, generation, err := h.generations.Start(c.Request.Context(), requestID, 0)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "请求正在处理中", "details": err.Error()})
+		return
+	}
+
+	req, err := rewind(c.Request.Context())
+	if err != nil {
+		h.generations.Abort(generation)
+		utils.ErrorWith(failure, "request_id", requestID, "error", err)
+		c.JSON(rewindErrorStatus(err), gin.H{"error": failure, "details": err.Error()})
+		return
+	}
+	req.RequestID = requestID
+	h.generations.Bind(generation, req.ConversationID)
+
+	h.respondMessage(ctx, c, generation, req)
+}
+
+// rewindErrorStatus 返回重新生成或编辑消息失败时的HTTP状态码
+func rewindErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrMessageNotLatest), errors.Is(err, models.ErrMessageNotEditable):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// streamMessage 发送消息并将AI响应写回客户端
+// 默认以SSE事件流输出；客户端要求JSON或对话设置为非流式输出时，等待生成结束后返回完整回答
+func (h *ChatHandler) streamMessage(c *gin.Context, req *models.ChatRequest) {
+	ctx, generation, err := h.generations.Start(c.Request.Context(), req.RequestID, req.ConversationID)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "请求正在处理中", "details": err.Error()})
+		return
+	}
+
+	h.respondMessage(ctx, c, generation, req)
+}
+
+// respondMessage 在已登记的生成中发送消息，并按客户端要求以SSE事件流或JSON返回
+func (h *ChatHandler) respondMessage(ctx context.Context, c *gin.Context, generation *services.Generation, req *models.ChatRequest) {
+	blocking := h.wantsBlockingResponse(c, req.ConversationID)
+	runGeneration(ctx, h.chatService, h.generations, generation, req)
+
+	if blocking {
+		h.respondGeneration(c, generation)
+		return
+	}
+	tailGeneration(c, generation, 0)
+}
+
+// wantsBlockingResponse 判断是否以JSON返回完整回答：Accept 请求头明确时以其为准，否则取对话设置的 Stream
+func (h *ChatHandler) wantsBlockingResponse(c *gin.Context, conversationID int) bool {
+	if wantsJSON(c) {
+		return true
+	}
+	if wantsEventStream(c) {
+		return false
+	}
+
+	settings, err := h.chatService.GetConversationSettings(c.Request.Context(), conversationID)
+	if err != nil {
+		return false // 对话不存在等错误由发送消息时以错误事件返回
+	}
+	return !settings.Stream
+}
+
+// respondGeneration 等待生成结束，将事件聚合为完整回答以JSON返回
+func (h *ChatHandler) respondGeneration(c *gin.Context, generation *services.Generation) {
+	if err := generation.Wait(c.Request.Context()); err != nil {
+		return // 客户端已断开
+	}
+
+	events, _, _ := generation.EventsAfter(0)
+	response, errMessage := newChatResponse(generation, events)
+	if response.Status == models.FinishReasonError {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成失败", "details": errMessage})
+		return
+	}
+
+	// 以本次请求保存的回答补充消息ID，以及事件中未携带的引用和用量；未找到时消息ID保持为 RequestID
+	history, err := h.chatService.GetConversationHistory(c.Request.Context(), generation.ConversationID)
+	if err != nil {
+		utils.WarnWith("获取回答消息失败", "conversation_id", generation.ConversationID, "error", err)
+	} else if message := findGeneratedMessage(history.Messages, generation.RequestID); message != nil {
+		response.ID = fmt.Sprintf("%d", message.ID)
+		response.CreatedAt = message.CreatedAt
+		if len(response.References) == 0 && len(message.References) > 0 {
+			response.References = message.References
+		}
+		if response.TokenCount == 0 && message.Usage != nil {
+			response.TokenCount = message.Usage.TotalTokens
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// findGeneratedMessage 查找请求生成的回答，同一对话中可能有其他请求在此之后完成，不能直接取最后一条消息
+func findGeneratedMessage(messages []models.MessageRecord, requestID string) *models.MessageRecord {
+	if requestID == "" {
+		return nil
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "assistant" && messages[i].RequestID == requestID {
+			return &messages[i]
+		}
+	}
+	return nil
+}
+
+// newChatResponse 聚合生成的事件为完整回答，同时返回错误事件中的错误信息
+// 消息ID暂以 RequestID 填充，Status 为结束原因
+func newChatResponse(generation *services.Generation, events []services.GenerationEvent) (*models.ChatResponse, string) {
+	response := &models.ChatResponse{
+		ID:             generation.RequestID,
+		ConversationID: fmt.Sprintf("%d", generation.ConversationID),
+		Role:           "assistant",
+		References:     []models.Reference{},
+		CreatedAt:      generation.StartedAt,
+	}
+
+	var content strings.Builder
+	var errMessage string
+	for _, event := range events {
+		switch event.Type {
+		case models.ChatEventDelta:
+			if text, ok := event.Event.Data.(string); ok {
+				content.WriteString(text)
+			}
+		case models.ChatEventReferences:
+			if references, ok := event.Event.Data.([]models.Reference); ok {
+				response.References = references
+			}
+		case models.ChatEventUsage:
+			if usage, ok := event.Event.Data.(models.TokenUsage); ok {
+				response.TokenCount = usage.TotalTokens
+			}
+		case models.ChatEventError:
+			errMessage = event.Event.Error
+		case models.ChatEventFinish:
+			response.Status = event.Event.FinishReason
+			if text, ok := event.Event.Data.(string); ok && errMessage == "" && response.Status == models.FinishReasonError {
+				errMessage = text
+			}
+		}
+	}
+	response.Content = content.String()
+	return response, errMessage
+}
+
+// startGeneration 登记生成并在后台发送消息，事件缓冲在生成中，供当前连接输出和断线重连回放
+// 带 RequestID 的生成不随客户端断开而取消
+func startGeneration(parent context.Context, chatService interfaces.ChatServiceInterface, generations *services.GenerationRegistry, req *models.ChatRequest) (*services.Generation, error) {
+	ctx, generation, err := generations.Start(parent, req.RequestID, req.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	runGeneration(ctx, chatService, generations, generation, req)
+	return generation, nil
+}
+
+// runGeneration 在已登记的生成中后台发送消息，ctx 为登记时返回的上下文
+func runGeneration(ctx context.Context, chatService interfaces.ChatServiceInterface, generations *services.GenerationRegistry, generation *services.Generation, req *models.ChatRequest) {
+	// 创建事件通道
+	eventChan := make(chan models.SSEChatEvent, 10)
+
+	// 在goroutine中发送消息
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				utils.ErrorWith("SendMessage panic", "error", r)
+			}
+		}()
+
+		if err := chatService.SendMessage(ctx, req, eventChan); err != nil {
+			utils.ErrorWith("流式发送消息失败", "error", err)
+		}
+	}()
+
+	// 将事件写入生成的缓冲，直至结束事件、通道关闭或生成被取消
+	go func() {
+		defer generations.Finish(generation)
+
+		for {
+			select {
+			case event, ok := <-eventChan:
+				if !ok {
+					break
+				}
+				event.Type = chatEventType(event)
+				generation.Publish(event.Type, event)
+				if event.Type == models.ChatEventFinish {
+					return
+				}
+				continue
+			case <-ctx.Done():
+			}
+
+			if ctx.Err() != nil {
+				publishStoppedFinish(generation, eventChan, context.Cause(ctx))
+			} else {
+				// 服务未发送结束事件即关闭了通道
+				generation.Publish(models.ChatEventFinish, models.SSEChatEvent{
+					Type:         models.ChatEventFinish,
+					Data:         "生成失败",
+					ID:           fmt.Sprintf("%d", generation.ConversationID),
+					FinishReason: models.FinishReasonError,
+				})
+			}
+			return
+		}
+	}()
+}
+
+// chatEventType 返回聊天事件的类型，兼容未设置类型的事件
+func chatEventType(event models.SSEChatEvent) string {
+	switch {
+	case event.Type != "":
+		return event.Type
+	case event.Error != "":
+		return models.ChatEventError
+	default:
+		return models.ChatEventDelta
+	}
+}
+
+// publishStoppedFinish 写入取消前已缓冲的事件，并以 finish_reason=stopped 的结束事件收尾
+func publishStoppedFinish(generation *services.Generation, eventChan <-chan models.SSEChatEvent, cause error) {
+	for drained := false; !drained; {
+		select {
+		case event, ok := <-eventChan:
+			if !ok || chatEventType(event) == models.ChatEventFinish {
+				drained = true
+				continue
+			}
+			event.Type = chatEventType(event)
+			generation.Publish(event.Type, event)
+		default:
+			drained = true
+		}
+	}
+
+	finish := models.SSEChatEvent{
+		Type:         models.ChatEventFinish,
+		Data:         "已停止生成",
+		ID:           fmt.Sprintf("%d", generation.ConversationID),
+		FinishReason: models.FinishReasonStopped,
+	}
+	if !errors.Is(cause, services.ErrGenerationStopped) {
+		finish.Data = cause.Error() // 超时或客户端断开（无 RequestID 时）
+	}
+	generation.Publish(finish.Type, finish)
+}
+
+// tailGeneration 输出生成中ID大于 lastEventID 的事件，然后持续输出新事件，直至生成结束或客户端断开
+func tailGeneration(c *gin.Context, generation *services.Generation, lastEventID int64) {
+	// 设置SSE响应头
+	setSSEHeaders(c)
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "不支持流式响应"})
+		return
+	}
+
+	followGeneration(c.Request.Context(), generation, lastEventID, func(event services.GenerationEvent) error {
+		// 按照SSE格式输出: id字段 + event字段 + data字段
+		return writeSSEEventWithID(c, flusher, event.ID, event.Type, event.Event)
+	})
+}
+
+// followGeneration 依次输出生成中ID大于 lastEventID 的事件及后续的新事件，直至生成结束、输出失败或 ctx 取消（客户端断开）
+func followGeneration(ctx context.Context, generation *services.Generation, lastEventID int64, write func(event services.GenerationEvent) error) {
+	for {
+		events, changed, done := generation.EventsAfter(lastEventID)
+		for _, event := range events {
+			if err := write(event); err != nil {
+				utils.ErrorWith("写入SSE事件失败", "request_id", generation.RequestID, "error", err)
+				return
+			}
+			lastEventID = event.ID
+		}
+		if done {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
-// GetConversations 返回分页的对话列表。
+// ResumeMessageStream 断线重连后继续接收生成的SSE事件。
 //
-// swagger:route GET /chat/conversations Chat getConversations
+// swagger:route GET /chat/messages/{requestId}/stream Chat resumeMessageStream
 //
-// 获取对话列表
+// 恢复SSE流
 //
-// 分页获取用户的对话列表，支持页码和每页数量参数
+// 回放 Last-Event-ID 之后的事件，然后继续输出进行中的生成的新事件；生成结束后事件保留 5 分钟
 //
-// produces:
-// - application/json
-// parameters:
-//   - +name: page
-//     in: query
-//     description: 页码
+// Produces:
+// - text/event-stream
+//
+// Parameters:
+//   - +name: requestId
+//     in: path
+//     description: 发送消息时的请求ID
+//     required: true
+//     type: string
+//   - +name: Last-Event-ID
+//     in: header
+//     description: 已收到的最后一个事件ID，为空时从头回放
 //     required: false
 //     type: integer
-//     default: 1
-//   - +name: page_size
+//   - +name: last_event_id
 //     in: query
-//     description: 每页数量
+//     description: 同 Last-Event-ID，供无法设置请求头的客户端使用
 //     required: false
 //     type: integer
-//     default: 20
 //
-// responses:
+// Responses:
 //
-//	200: ConversationListResponse
+//	200:
+//	  description: SSE流式数据
 //	400: ResponseBody
-func (h *ChatHandler) GetConversations(c *gin.Context) (interface{}, error) {
-	page := 1
-	pageSize := 20
+//	404: ResponseBody
+func (h *ChatHandler) ResumeMessageStream(c *gin.Context) {
+	requestID := c.Param("id") // 与同级路由共用参数名
 
-	if p := c.Query("page"); p != "" {
-		if pInt, err := strconv.Atoi(p); err == nil && pInt > 0 {
-			page = pInt
+	lastEventID := int64(0)
+	if value := c.GetHeader("Last-Event-ID"); value != "" || c.Query("last_event_id") != "" {
+		if value == "" {
+			value = c.Query("last_event_id")
 		}
-	}
-
-	if ps := c.Query("page_size"); ps != "" {
-		if psInt, err := strconv.Atoi(ps); err == nil && psInt > 0 && psInt <= 100 {
-			pageSize = psInt
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 Last-Event-ID", "details": value})
+			return
 		}
+		lastEventID = id
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	conversations, err := h.chatService.GetConversations(ctx, page, pageSize)
-	if err != nil {
-		return nil, utils.NewAPIError(utils.ErrInternalServer, err)
+	generation, ok := h.generations.Get(requestID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "生成不存在或已过期", "details": requestID})
+		return
 	}
 
-	return conversations, nil
+	utils.InfoWith("恢复SSE流", "request_id", requestID, "last_event_id", lastEventID)
+	tailGeneration(c, generation, lastEventID)
 }
 
-// DeleteConversation 根据ID删除指定的对话。
+// StopMessage 停止进行中的消息生成。
 //
-// swagger:route DELETE /chat/conversations/{id} Chat deleteConversation
+// swagger:route POST /chat/messages/{requestId}/stop Chat stopMessage
 //
-// 删除对话
+// 停止生成
 //
-// 根据对话ID删除指定的对话记录和相关数据
+// 取消以 requestId 发起的进行中的生成，SSE 流以 finish_reason 为 stopped 的 resp_finish 事件结束，已生成的部分回答会被保存
 //
 // Produces:
 // - application/json
 //
 // Parameters:
-//   - +name: id
+//   - +name: requestId
 //     in: path
-//     description: 对话ID
+//     description: 发送消息时的请求ID
 //     required: true
-//     type: integer
+//     type: string
 //
 // Responses:
 //
 //	200: MessageOnlyResponse
-//	400: ResponseBody
-func (h *ChatHandler) DeleteConversation(c *gin.Context) (interface{}, error) {
-	conversationIDStr := c.Param("id")
-	if conversationIDStr == "" {
+//	404: ResponseBody
+func (h *ChatHandler) StopMessage(c *gin.Context) (interface{}, error) {
+	requestID := c.Param("id") // 与同级路由共用参数名
+	if requestID == "" {
 		return nil, utils.NewAPIError(utils.ErrInvalidRequest, nil)
 	}
 
-	conversationID, err := strconv.Atoi(conversationIDStr)
+	if !h.generations.Stop(requestID) {
+		return nil, utils.NewAPIError(utils.ErrNotFound, fmt.Errorf("请求 %s 不在生成中", requestID))
+	}
+
+	return gin.H{
+		"message": "已停止生成",
+	}, nil
+}
+
+// GetMessageAlternates 获取消息所在轮次的全部版本。
+//
+// swagger:route GET /chat/messages/{id}/alternates Chat getMessageAlternates
+//
+// 获取消息的历史版本
+//
+// 返回消息所在轮次被重新生成或编辑前的各个版本及当前版本，用于在界面上切换查看
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: id
+//     in: path
+//     description: 消息ID
+//     required: true
+//     type: integer
+//
+// Responses:
+//
+//	200: MessageAlternatesResponse
+//	404: ResponseBody
+func (h *ChatHandler) GetMessageAlternates(c *gin.Context) (interface{}, error) {
+	messageID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	err = h.chatService.DeleteConversation(ctx, conversationID)
+	alternates, err := h.chatService.GetMessageAlternates(ctx, messageID)
 	if err != nil {
-		return nil, utils.NewAPIError(utils.ErrConversationNotFound, err)
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, utils.NewAPIError(utils.ErrNotFound, err)
+		}
+		return nil, utils.NewAPIError(utils.ErrInternalServer, err)
 	}
 
-	return gin.H{
-		"message": "对话删除成功",
-	}, nil
+	return alternates, nil
 }
 
-// SendMessage 向对话发送消息并返回SSE流式响应。
+// SubmitFeedback 评价助手的回答。
 //
-// swagger:route POST /chat/messages Chat sendMessage
+// swagger:route POST /chat/messages/{id}/feedback Chat submitFeedback
 //
-// 发送消息
+// 评价回答
 //
-// 向指定对话发送消息并以SSE流式方式返回AI响应
+// 对回答点赞或点踩，可附带说明；再次评价时覆盖之前的评价。
+// 评价保存在本地并记录回答所用的模型和知识库，Flowy 后端同时同步到 Flowy 的赞/踩
 //
 // Consumes:
 // - application/json
 //
 // Produces:
-// - text/event-stream
+// - application/json
 //
 // Parameters:
+//   - +name: id
+//     in: path
+//     description: 助手回答的消息ID
+//     required: true
+//     type: integer
 //   - +name: body
 //     in: body
-//     description: 聊天请求
+//     description: 评价
 //     required: true
-//     type: ChatRequest
+//     type: MessageFeedbackRequest
 //
 // Responses:
 //
-//	200:
-//	  description: SSE流式数据
+//	200: MessageFeedback
 //	400: ResponseBody
-func (h *ChatHandler) SendMessage(c *gin.Context) {
-	var req models.ChatRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据解析失败", "details": err.Error()})
-		return
+//	404: ResponseBody
+func (h *ChatHandler) SubmitFeedback(c *gin.Context) (interface{}, error) {
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
 	}
 
-	if req.Content == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "消息内容不能为空"})
-		return
+	var req models.MessageFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
 	}
-
-	if req.ConversationID == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "会话ID不能为空"})
-		return
+	if req.Rating != models.FeedbackLike && req.Rating != models.FeedbackDislike {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, fmt.Errorf("评价只能为 1（赞）或 -1（踩）"))
 	}
 
-	// 设置SSE响应头
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("Access-Control-Allow-Origin", "*")
-
-	// 创建事件通道
-	eventChan := make(chan models.SSEChatEvent, 10)
-
-	// 使用请求的上下文，当客户端断开连接时自动取消
-	ctx := c.Request.Context()
-
-	// 在goroutine中发送消息
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				utils.ErrorWith("SendMessage panic", "error", r)
-			}
-		}()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-		if err := h.chatService.SendMessage(ctx, &req, eventChan); err != nil {
-			utils.ErrorWith("流式发送消息失败", "error", err)
+	feedback, err := h.chatService.SubmitFeedback(ctx, messageID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			return nil, utils.NewAPIError(utils.ErrNotFound, err)
+		case errors.Is(err, models.ErrMessageNotRatable):
+			return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+		default:
+			return nil, utils.NewAPIError(utils.ErrInternalServer, err)
 		}
-	}()
-
-	// 发送SSE事件
-	flusher, ok := c.Writer.(http.Flusher)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "不支持流式响应"})
-		return
 	}
 
-	for {
-		select {
-		case event, ok := <-eventChan:
-			if !ok {
-				return
-			}
-
-			eventData, err := json.Marshal(event)
-			if err != nil {
-				utils.ErrorWith("序列化事件失败", "error", err)
-				continue
-			}
-
-			// 使用事件类型
-			eventType := event.Type
-			// 根据事件内容推断类型（兼容逻辑）
-			if eventType == "resp_finish" || (eventType == "" && event.Error != "") {
-				eventType = "resp_finish"
-			} else if eventType == "resp_splash" {
-				// 保持为 splash 事件
-			} else {
-				// 默认为增量响应
-				eventType = "resp_increment"
-			}
+	return feedback, nil
+}
 
-			// 按照SSE格式输出: event字段 + data字段
-			fmt.Fprintf(c.Writer, "event:%s\ndata: %s\n\n", eventType, eventData)
-			flusher.Flush()
+// GetFeedbackReport 汇总回答的评价。
+//
+// swagger:route GET /feedback Chat getFeedbackReport
+//
+// 评价统计
+//
+// 按模型、知识库和日期汇总时间范围内的评价，并返回最近的差评，用于发现模型和知识库的薄弱环节
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: since
+//     in: query
+//     description: 开始时间（RFC3339），默认为 30 天前
+//     required: false
+//     type: string
+//   - +name: until
+//     in: query
+//     description: 结束时间（RFC3339），默认为当前时间
+//     required: false
+//     type: string
+//   - +name: model_id
+//     in: query
+//     description: 仅统计指定模型
+//     required: false
+//     type: integer
+//   - +name: knowledge_base_id
+//     in: query
+//     description: 仅统计使用了指定知识库的回答
+//     required: false
+//     type: integer
+//
+// Responses:
+//
+//	200: FeedbackReport
+//	400: ResponseBody
+func (h *ChatHandler) GetFeedbackReport(c *gin.Context) (interface{}, error) {
+	var req models.FeedbackReportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+	if err := req.Normalize(); err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
 
-			// 根据事件类型或错误状态判断是否结束
-			if eventType == "resp_finish" || event.Error != "" {
-				return
-			}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-		case <-ctx.Done():
-			return
-		}
+	report, err := h.chatService.GetFeedbackReport(ctx, &req)
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInternalServer, err)
 	}
+
+	return report, nil
 }
 
 // GetConversationSettings 获取指定对话的设置信息。
@@ -345,7 +1192,9 @@ func (h *ChatHandler) GetConversationSettings(c *gin.Context) (interface{}, erro
 //
 // 更新对话设置
 //
-// 根据对话ID更新该对话的设置信息，如模型配置、参数等
+// 根据对话ID更新该对话的设置信息，如模型配置、参数、系统提示词及其变量和开场白，修改对之后的提问生效。
+// 引用提示词模板且未指定版本时，每次更新设置都会使用模板的最新版本。
+// 从助手创建的对话只能修改名称和描述，其他设置与助手不一致时返回 400
 //
 // Consumes:
 // - application/json
@@ -385,12 +1234,21 @@ func (h *ChatHandler) UpdateConversationSettings(c *gin.Context) (interface{}, e
 	if err := c.BindJSON(&settings); err != nil {
 		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
 	}
+	// 对话所属的助手只能在创建时指定
+	settings.AssistantID = 0
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if err := h.applyPromptTemplate(ctx, &settings); err != nil {
+		return nil, err
+	}
+
 	err = h.chatService.UpdateConversationSettings(ctx, conversationID, &settings)
-	if err != nil {
+	switch {
+	case errors.Is(err, models.ErrAssistantSettings):
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	case err != nil:
 		return nil, utils.NewAPIError(utils.ErrSettingsUpdate, err)
 	}
 
@@ -442,3 +1300,130 @@ func (h *ChatHandler) GetConversationHistory(c *gin.Context) (interface{}, error
 
 	return history, nil
 }
+
+// ExportConversation 导出指定对话的完整记录。
+//
+// swagger:route GET /chat/conversations/{id}/export Chat exportConversation
+//
+// 导出对话
+//
+// 导出对话设置和完整消息历史（含角色、时间、引用和 Token 用量），以附件形式下载
+//
+// Produces:
+// - text/markdown
+// - application/json
+// - text/html
+//
+// Parameters:
+//   - +name: id
+//     in: path
+//     description: 对话ID
+//     required: true
+//     type: integer
+//   - +name: format
+//     in: query
+//     description: 导出格式 md/json/html
+//     required: false
+//     type: string
+//     default: md
+//
+// Responses:
+//
+//	200: ConversationExport
+//	400: ResponseBody
+//	404: ResponseBody
+//	500: ResponseBody
+func (h *ChatHandler) ExportConversation(c *gin.Context) {
+	conversationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的对话ID"})
+		return
+	}
+
+	format := c.DefaultQuery("format", models.ExportFormatMarkdown)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	data, contentType, err := services.ExportConversation(ctx, h.chatService, conversationID, format)
+	if err != nil {
+		utils.ErrorWith("导出对话失败", "conversation_id", conversationID, "format", format, "error", err)
+		c.JSON(exportErrorStatus(err), gin.H{"error": "导出对话失败", "details": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="conversation-%d.%s"`, conversationID, format))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// exportErrorStatus 返回导出对话失败时的HTTP状态码
+func exportErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrExportFormat):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// SearchMessages 在所有对话的消息中搜索关键字。
+//
+// swagger:route GET /chat/search Chat searchMessages
+//
+// 搜索消息
+//
+// 在所有对话的消息内容中全文搜索，返回命中消息所属的对话ID、消息ID、高亮片段和时间
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: q
+//     in: query
+//     description: 搜索关键字，多个关键字以空格分隔，需全部命中
+//     required: true
+//     type: string
+//   - +name: limit
+//     in: query
+//     description: 返回数量，最大 100
+//     required: false
+//     type: integer
+//     default: 20
+//
+// Responses:
+//
+//	200: MessageSearchSuccessResponse
+//	400: ResponseBody
+func (h *ChatHandler) SearchMessages(c *gin.Context) (interface{}, error) {
+	var req models.MessageSearchRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+	if err := req.Normalize(); err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	// Flowy 搜索前可能需要镜像尚未同步的会话记录
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	results, err := h.chatService.SearchMessages(ctx, &req)
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInternalServer, err)
+	}
+
+	return results, nil
+}
+
+// applyPromptTemplate 对话设置引用提示词模板时，以模板内容作为系统提示词
+func (h *ChatHandler) applyPromptTemplate(ctx context.Context, settings *models.ConversationSettings) error {
+	if err := h.promptTemplates.ApplyTemplate(ctx, settings); err != nil {
+		if errors.Is(err, database.ErrNotFound) || errors.Is(err, models.ErrPromptVarsMissing) {
+			return utils.NewAPIError(utils.ErrInvalidRequest, err)
+		}
+		return utils.NewAPIError(utils.ErrInternalServer, err)
+	}
+	return nil
+}
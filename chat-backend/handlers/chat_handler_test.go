@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"chat-backend/models"
+	"chat-backend/services"
+	"chat-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// generationEvents 将聊天事件包装为生成事件
+func generationEvents(events ...models.SSEChatEvent) []services.GenerationEvent {
+	result := make([]services.GenerationEvent, 0, len(events))
+	for i, event := range events {
+		result = append(result, services.GenerationEvent{ID: int64(i + 1), Type: event.Type, Event: event})
+	}
+	return result
+}
+
+func TestNewChatResponse(t *testing.T) {
+	startedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	generation := &services.Generation{RequestID: "req-1", ConversationID: 9, StartedAt: startedAt}
+	references := []models.Reference{{DocumentID: "1", DocumentTitle: "手册"}}
+
+	response, errMessage := newChatResponse(generation, generationEvents(
+		models.SSEChatEvent{Type: models.ChatEventSplash, Data: "开始"},
+		models.SSEChatEvent{Type: models.ChatEventDelta, Data: "你"},
+		models.SSEChatEvent{Type: models.ChatEventReferences, Data: references},
+		models.SSEChatEvent{Type: models.ChatEventDelta, Data: "好"},
+		models.SSEChatEvent{Type: models.ChatEventUsage, Data: models.TokenUsage{TotalTokens: 12}},
+		models.SSEChatEvent{Type: models.ChatEventFinish, Data: "处理完成", FinishReason: models.FinishReasonStop},
+	))
+
+	if errMessage != "" {
+		t.Errorf("errMessage = %q, want 空", errMessage)
+	}
+	want := &models.ChatResponse{
+		ID:             "req-1",
+		ConversationID: "9",
+		Content:        "你好",
+		Role:           "assistant",
+		Status:         models.FinishReasonStop,
+		References:     references,
+		TokenCount:     12,
+		CreatedAt:      startedAt,
+	}
+	if !reflect.DeepEqual(response, want) {
+		t.Errorf("newChatResponse() = %+v, want %+v", response, want)
+	}
+}
+
+func TestNewChatResponseError(t *testing.T) {
+	generation := &services.Generation{RequestID: "req-1", ConversationID: 9}
+
+	tests := []struct {
+		name   string
+		events []services.GenerationEvent
+		want   string
+	}{
+		{
+			name: "错误事件",
+			events: generationEvents(
+				models.SSEChatEvent{Type: models.ChatEventError, Error: "模型不可用"},
+				models.SSEChatEvent{Type: models.ChatEventFinish, Data: "生成失败", FinishReason: models.FinishReasonError},
+			),
+			want: "模型不可用",
+		},
+		{
+			name: "仅结束事件",
+			events: generationEvents(
+				models.SSEChatEvent{Type: models.ChatEventFinish, Data: "生成失败", FinishReason: models.FinishReasonError},
+			),
+			want: "生成失败",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, errMessage := newChatResponse(generation, tt.events)
+			if response.Status != models.FinishReasonError {
+				t.Errorf("Status = %q, want %q", response.Status, models.FinishReasonError)
+			}
+			if errMessage != tt.want {
+				t.Errorf("errMessage = %q, want %q", errMessage, tt.want)
+			}
+			if response.References == nil {
+				t.Error("References = nil, want 空数组")
+			}
+		})
+	}
+}
+
+func TestFindGeneratedMessage(t *testing.T) {
+	messages := []models.MessageRecord{
+		{ID: 1, Role: "user", Content: "问题一", RequestID: "req-1"},
+		{ID: 2, Role: "assistant", Content: "回答一", RequestID: "req-1"},
+		{ID: 3, Role: "user", Content: "问题二", RequestID: "req-2"},
+		{ID: 4, Role: "assistant", Content: "回答二", RequestID: "req-2"},
+		{ID: 5, Role: "assistant", Content: "没有请求ID"},
+	}
+
+	tests := []struct {
+		requestID string
+		want      int
+	}{
+		{requestID: "req-1", want: 2}, // 之后还有其他请求的回答
+		{requestID: "req-2", want: 4},
+		{requestID: "req-3", want: 0},
+		{requestID: "", want: 0},
+	}
+	for _, tt := range tests {
+		message := findGeneratedMessage(messages, tt.requestID)
+		got := 0
+		if message != nil {
+			got = message.ID
+		}
+		if got != tt.want {
+			t.Errorf("findGeneratedMessage(%q) = 消息 %d, want %d", tt.requestID, got, tt.want)
+		}
+	}
+}
+
+// countingReader 记录已读取的字节数
+type countingReader struct {
+	r    *bytes.Reader
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.read += n
+	return n, err
+}
+
+func TestUploadChatFileTooLarge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "大文件.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(bytes.Repeat([]byte("a"), 2*chatFileMaxSize)); err != nil {
+		t.Fatal(err)
+	}
+	form.Close()
+
+	reader := &countingReader{r: bytes.NewReader(body.Bytes())}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/chat/files", reader)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+
+	// 超限时在读完请求体和调用聊天服务之前返回
+	_, err = (&ChatHandler{}).UploadChatFile(c)
+	var apiErr *utils.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode != utils.ErrFileSize {
+		t.Errorf("UploadChatFile() error = %v, want ErrFileSize", err)
+	}
+	if limit := chatFileMaxSize + chatFileFormOverhead + 64<<10; reader.read > limit {
+		t.Errorf("读取了 %d 字节, want <= %d", reader.read, limit)
+	}
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"chat-backend/models"
+	"chat-backend/services"
+	"chat-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// webSocketMaxMessageSize 客户端单条消息的最大字节数
+const webSocketMaxMessageSize = 1 << 20
+
+// webSocketConn 聊天WebSocket连接，多个请求的事件并发写入时加锁
+type webSocketConn struct {
+	ws *websocket.Conn
+	mu sync.Mutex
+}
+
+// send 写入一条消息
+func (c *webSocketConn) send(message models.WebSocketMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return websocket.JSON.Send(c.ws, message)
+}
+
+// sendError 写入请求处理失败的消息
+func (c *webSocketConn) sendError(requestID string, message string) {
+	if err := c.send(models.WebSocketMessage{Type: models.WebSocketMessageError, ID: requestID, Error: message}); err != nil {
+		utils.WarnWith("写入WebSocket消息失败", "request_id", requestID, "error", err)
+	}
+}
+
+// ChatWebSocket 通过WebSocket长连接收发聊天消息。
+//
+// swagger:route GET /chat/ws Chat chatWebSocket
+//
+// WebSocket 聊天
+//
+// 在一个连接上并发处理多个请求，消息格式为 WebSocketMessage，以 id（RequestID）区分请求：
+// 客户端发送 send（data 为 ChatRequest）、stop、ping；服务端推送与SSE接口相同的聊天事件（type 为事件类型，data 为 SSEChatEvent），
+// 以及 pong 和 error。连接断开后生成继续进行，可通过 GET /chat/messages/{requestId}/stream 恢复。
+// 浏览器页面仅允许同源或 CORS_ALLOWED_ORIGINS 中的来源连接，不携带 Origin 的客户端不受限制
+//
+// Responses:
+//
+//	101:
+//	  description: 切换为WebSocket协议
+//	400: ResponseBody
+//	403:
+//	  description: 来源不允许连接
+func (h *ChatHandler) ChatWebSocket(c *gin.Context) {
+	server := websocket.Server{
+		// 校验来源防止跨站 WebSocket 劫持，桌面客户端通常不携带 Origin
+		Handshake: func(_ *websocket.Config, r *http.Request) error {
+			if !utils.OriginAllowed(r) {
+				utils.WarnWith("拒绝WebSocket连接", "origin", r.Header.Get("Origin"))
+				return fmt.Errorf("不允许的来源: %s", r.Header.Get("Origin"))
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			ws.MaxPayloadBytes = webSocketMaxMessageSize
+			h.serveWebSocket(c.Request.Context(), ws)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// serveWebSocket 读取客户端消息并分发，连接关闭后停止推送事件
+func (h *ChatHandler) serveWebSocket(parent context.Context, ws *websocket.Conn) {
+	ctx, cancel := context.WithCancel(parent)
+	var followers sync.WaitGroup
+	defer func() {
+		cancel()
+		followers.Wait()
+		ws.Close()
+	}()
+
+	conn := &webSocketConn{ws: ws}
+	utils.InfoWith("WebSocket连接建立", "remote_addr", ws.Request().RemoteAddr)
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			if !errors.Is(err, io.EOF) {
+				utils.WarnWith("读取WebSocket消息失败", "error", err)
+			}
+			utils.InfoWith("WebSocket连接关闭", "remote_addr", ws.Request().RemoteAddr)
+			return
+		}
+
+		var message struct {
+			Type string          `json:"type"`
+			ID   string          `json:"id"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &message); err != nil {
+			conn.sendError("", "消息解析失败: "+err.Error())
+			continue
+		}
+
+		switch message.Type {
+		case models.WebSocketMessagePing:
+			if err := conn.send(models.WebSocketMessage{Type: models.WebSocketMessagePong, ID: message.ID}); err != nil {
+				return
+			}
+		case models.WebSocketMessageStop:
+			if !h.generations.Stop(message.ID) {
+				conn.sendError(message.ID, fmt.Sprintf("请求 %s 不在生成中", message.ID))
+			}
+		case models.WebSocketMessageSend:
+			generation, err := h.startWebSocketGeneration(ctx, message.ID, message.Data)
+			if err != nil {
+				conn.sendError(message.ID, err.Error())
+				continue
+			}
+
+			followers.Add(1)
+			go func() {
+				defer followers.Done()
+				followGeneration(ctx, generation, 0, func(event services.GenerationEvent) error {
+					return conn.send(models.WebSocketMessage{
+						Type:    event.Type,
+						Data:    event.Event,
+						ID:      generation.RequestID,
+						EventID: event.ID,
+					})
+				})
+			}()
+		default:
+			conn.sendError(message.ID, "不支持的消息类型: "+message.Type)
+		}
+	}
+}
+
+// startWebSocketGeneration 校验 send 消息并开始生成，RequestID 必填以区分同一连接上的请求
+func (h *ChatHandler) startWebSocketGeneration(ctx context.Context, requestID string, data json.RawMessage) (*services.Generation, error) {
+	if requestID == "" {
+		return nil, errors.New("消息ID（RequestID）不能为空")
+	}
+
+	var req models.ChatRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("请求数据解析失败: %w", err)
+	}
+	if req.Content == "" {
+		return nil, errors.New("消息内容不能为空")
+	}
+	if req.ConversationID == 0 {
+		return nil, errors.New("会话ID不能为空")
+	}
+	req.RequestID = requestID
+
+	return startGeneration(ctx, h.chatService, h.generations, &req)
+}
@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"mime/multipart"
+	"net/http"
 	"strconv"
 	"time"
 
 	"chat-backend/models"
+	"chat-backend/pkg/database"
 	"chat-backend/services"
 	"chat-backend/services/interfaces"
 	"chat-backend/utils"
@@ -17,12 +21,14 @@ import (
 // KnowledgeHandler 处理知识库相关的HTTP请求。
 type KnowledgeHandler struct {
 	knowledgeService interfaces.KnowledgeServiceInterface
+	statusTracker    *services.KnowledgeStatusTracker
 }
 
 // NewKnowledgeHandler 创建并返回一个新的知识库处理器实例。
-func NewKnowledgeHandler(knowledgeService interfaces.KnowledgeServiceInterface) *KnowledgeHandler {
+func NewKnowledgeHandler(knowledgeService interfaces.KnowledgeServiceInterface, statusTracker *services.KnowledgeStatusTracker) *KnowledgeHandler {
 	return &KnowledgeHandler{
 		knowledgeService: knowledgeService,
+		statusTracker:    statusTracker,
 	}
 }
 
@@ -30,6 +36,7 @@ func NewKnowledgeHandler(knowledgeService interfaces.KnowledgeServiceInterface)
 func NewKnowledgeHandlerFromGlobal() *KnowledgeHandler {
 	return &KnowledgeHandler{
 		knowledgeService: services.GetGlobalKnowledgeService(),
+		statusTracker:    services.GetGlobalKnowledgeStatusTracker(),
 	}
 }
 
@@ -261,6 +268,11 @@ func (h *KnowledgeHandler) GetKnowledgeBaseFiles(c *gin.Context) (interface{}, e
 		return nil, utils.NewAPIError(utils.ErrFlowyAPI, err)
 	}
 
+	// 顺带刷新状态跟踪缓存
+	for _, file := range files {
+		h.statusTracker.Track(kbID, file)
+	}
+
 	return models.KnowledgeFiles{
 		KnowledgeFiles: files,
 	}, nil
@@ -280,8 +292,11 @@ func (h *KnowledgeHandler) GetKnowledgeBaseFiles(c *gin.Context) (interface{}, e
 // - multipart/form-data
 // - application/json
 //
+// 请求头 Accept 包含 text/event-stream 时以SSE流式返回每个文件的上传与索引进度（UploadProgressEvent）
+//
 // Produces:
 // - application/json
+// - text/event-stream
 //
 // Parameters:
 //   - +name: id
@@ -343,66 +358,211 @@ func (h *KnowledgeHandler) uploadFilesFromStream(c *gin.Context, kbID int) {
 		return
 	}
 
+	// 客户端请求SSE时流式返回上传进度
+	if wantsEventStream(c) {
+		names := make([]string, len(files))
+		sizes := make([]int64, len(files))
+		for i, fileHeader := range files {
+			names[i] = fileHeader.Filename
+			sizes[i] = fileHeader.Size
+		}
+		h.streamBatchUpload(c, kbID, names, sizes, func(ctx context.Context, i int) (*models.KnowledgeFile, error) {
+			return h.uploadFileHeader(ctx, kbID, files[i])
+		})
+		return
+	}
+
 	// 多个文件，返回批量上传结果
 	h.uploadMultipleFilesFromStream(c, kbID, files)
 }
 
 // uploadMultipleFilesFromStream 上传多个文件流
 func (h *KnowledgeHandler) uploadMultipleFilesFromStream(c *gin.Context, kbID int, fileHeaders []*multipart.FileHeader) {
-	response := &models.BatchUploadResponse{
-		Total:   len(fileHeaders),
-		Results: make([]models.BatchUploadResult, 0, len(fileHeaders)),
+	filenames := make([]string, len(fileHeaders))
+	sizes := make([]int64, len(fileHeaders))
+	for i, fileHeader := range fileHeaders {
+		filenames[i] = fileHeader.Filename
+		sizes[i] = fileHeader.Size
 	}
 
-	// 创建超时上下文，根据文件数量调整超时时间
-	timeoutSeconds := len(fileHeaders) * 60
-	batchCtx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds)*time.Second)
-	defer cancel()
+	// 客户端断开时取消尚未完成的上传
+	response := utils.RunBatchUpload(c.Request.Context(), filenames, sizes, func(ctx context.Context, i int) (*models.KnowledgeFile, error) {
+		return h.uploadFileHeader(ctx, kbID, fileHeaders[i])
+	})
+	h.trackUploadedFiles(kbID, response)
+
+	c.JSON(200, response)
+}
 
-	// 上传每个文件
-	for _, fileHeader := range fileHeaders {
-		result := models.BatchUploadResult{
-			FilePath: fileHeader.Filename,
+// uploadFileHeader 打开表单文件并上传到知识库
+func (h *KnowledgeHandler) uploadFileHeader(ctx context.Context, kbID int, fileHeader *multipart.FileHeader) (*models.KnowledgeFile, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer file.Close()
+
+	// 上传文件，直接传递文件 reader
+	return h.knowledgeService.UploadFile(ctx, kbID, fileHeader.Filename, file)
+}
+
+// trackUploadedFiles 将上传成功的文件加入状态跟踪
+func (h *KnowledgeHandler) trackUploadedFiles(kbID int, response *models.BatchUploadResponse) {
+	for _, result := range response.Results {
+		if result.Success && result.File != nil {
+			h.statusTracker.Track(kbID, *result.File)
 		}
+	}
+}
 
-		// 为每个文件单独设置超时
-		fileCtx, fileCancel := context.WithTimeout(batchCtx, 60*time.Second)
-
-		// 打开文件
-		file, err := fileHeader.Open()
-		if err != nil {
-			result.Success = false
-			result.Message = "打开文件失败"
-			result.Error = err.Error()
-			response.FailureCount++
-			fileCancel()
-			response.Results = append(response.Results, result)
-			continue
+// 流式上传等待索引完成的参数
+const (
+	indexWatchTimeout  = 30 * time.Minute // 等待索引完成的最长时间
+	indexWatchInterval = 5 * time.Second  // 重新读取状态缓存的间隔
+)
+
+// streamBatchUpload 执行批量上传并以SSE流式返回每个文件的上传与索引进度
+func (h *KnowledgeHandler) streamBatchUpload(c *gin.Context, kbID int, names []string, sizes []int64, upload utils.BatchUploadFunc) {
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "不支持流式响应"})
+		return
+	}
+
+	setSSEHeaders(c)
+
+	// 使用请求的上下文，当客户端断开连接时自动取消
+	ctx := c.Request.Context()
+	eventChan := make(chan models.UploadProgressEvent, len(names)+1)
+
+	emit := func(event models.UploadProgressEvent) {
+		select {
+		case eventChan <- event:
+		case <-ctx.Done():
 		}
+	}
 
-		// 上传文件，直接传递文件 reader
-		uploadedFile, err := h.knowledgeService.UploadFile(fileCtx, kbID, fileHeader.Filename, file)
-		file.Close()
-		fileCancel()
-
-		if err != nil {
-			result.Success = false
-			result.Message = "上传失败"
-			result.Error = err.Error()
-			response.FailureCount++
-			utils.ErrorWith("批量上传文件失败", "filename", fileHeader.Filename, "error", err)
-		} else {
-			result.Success = true
-			result.Message = "上传成功"
-			result.File = uploadedFile
-			response.SuccessCount++
-			utils.InfoWith("批量上传文件成功", "filename", fileHeader.Filename, "file_id", uploadedFile.ID)
+	go func() {
+		defer close(eventChan)
+		defer func() {
+			if r := recover(); r != nil {
+				utils.ErrorWith("streamBatchUpload panic", "error", r)
+			}
+		}()
+
+		for i, name := range names {
+			event := models.UploadProgressEvent{Type: models.UploadEventReceived, Index: i, Filename: name}
+			if sizes != nil && sizes[i] >= 0 {
+				event.Size = sizes[i]
+			}
+			emit(event)
 		}
 
-		response.Results = append(response.Results, result)
+		response := utils.RunBatchUpload(ctx, names, sizes, func(fileCtx context.Context, i int) (*models.KnowledgeFile, error) {
+			file, err := upload(fileCtx, i)
+			if err != nil {
+				emit(models.UploadProgressEvent{Type: models.UploadEventFailed, Index: i, Filename: names[i], Error: err.Error()})
+				return nil, err
+			}
+			emit(models.UploadProgressEvent{Type: models.UploadEventUploaded, Index: i, Filename: names[i], FileID: file.ID, IndexPercent: file.IndexPercent})
+			return file, nil
+		})
+
+		h.trackUploadedFiles(kbID, response)
+		h.watchIndexProgress(ctx, kbID, response, emit)
+
+		emit(models.UploadProgressEvent{Type: models.UploadEventDone, Index: -1, Summary: response})
+	}()
+
+	for {
+		select {
+		case event, ok := <-eventChan:
+			if !ok {
+				return
+			}
+			if err := writeSSEEvent(c, flusher, event.Type, event); err != nil {
+				utils.ErrorWith("写入SSE事件失败", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
 	}
+}
 
-	c.JSON(200, response)
+// watchIndexProgress 订阅文件状态跟踪器，推送已上传文件的索引进度直到全部完成或失败
+func (h *KnowledgeHandler) watchIndexProgress(ctx context.Context, kbID int, response *models.BatchUploadResponse, emit func(models.UploadProgressEvent)) {
+	// 先订阅再读取缓存，避免遗漏两者之间的状态变化
+	statusChan, unsubscribe := h.statusTracker.Subscribe(kbID)
+	defer unsubscribe()
+
+	// 文件ID -> 批次下标
+	pending := make(map[int]int)
+	percents := make(map[int]int)
+
+	// report 推送单个文件的状态，返回文件是否已结束
+	report := func(index int, file models.KnowledgeFile) bool {
+		name := response.Results[index].FilePath
+		switch file.Status {
+		case services.FileStatusFinished:
+			emit(models.UploadProgressEvent{Type: models.UploadEventFinished, Index: index, Filename: name, FileID: file.ID, IndexPercent: 100})
+			return true
+		case services.FileStatusFailed:
+			emit(models.UploadProgressEvent{Type: models.UploadEventFailed, Index: index, Filename: name, FileID: file.ID, IndexPercent: file.IndexPercent, Error: file.ErrorMessage})
+			return true
+		default:
+			if file.IndexPercent != percents[file.ID] {
+				percents[file.ID] = file.IndexPercent
+				emit(models.UploadProgressEvent{Type: models.UploadEventIndexing, Index: index, Filename: name, FileID: file.ID, IndexPercent: file.IndexPercent})
+			}
+			return false
+		}
+	}
+
+	for i, result := range response.Results {
+		if !result.Success || result.File == nil {
+			continue
+		}
+		file := *result.File
+		if cached, err := h.statusTracker.GetFileStatus(ctx, file.ID); err == nil {
+			file = *cached
+		}
+		percents[file.ID] = result.File.IndexPercent
+		if !report(i, file) {
+			pending[file.ID] = i
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, indexWatchTimeout)
+	defer cancel()
+
+	// 除推送的事件外，定时重新读取状态缓存，确保不会因遗漏事件而等待到超时
+	ticker := time.NewTicker(indexWatchInterval)
+	defer ticker.Stop()
+
+	for len(pending) > 0 {
+		select {
+		case file := <-statusChan:
+			index, ok := pending[file.ID]
+			if ok && report(index, file) {
+				delete(pending, file.ID)
+			}
+		case <-ticker.C:
+			for fileID, index := range pending {
+				file, ok := h.statusTracker.CachedFileStatus(fileID)
+				if !ok {
+					// 文件已不在跟踪中（如被删除），视为失败
+					file = *response.Results[index].File
+					file.Status = services.FileStatusFailed
+					file.ErrorMessage = "文件不存在"
+				}
+				if report(index, file) {
+					delete(pending, fileID)
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
 // uploadFilesFromPath 从文件路径上传文件（支持单文件和多文件，统一使用 file_paths）
@@ -418,16 +578,21 @@ func (h *KnowledgeHandler) uploadFilesFromPath(c *gin.Context, kbID int) {
 		return
 	}
 
-	// 统一处理：直接调用批量上传，遍历处理所有文件
-	timeoutSeconds := len(req.FilePaths) * 60
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds)*time.Second)
-	defer cancel()
+	// 客户端请求SSE时流式返回上传进度
+	if wantsEventStream(c) {
+		h.streamBatchUpload(c, kbID, req.FilePaths, utils.FileSizes(req.FilePaths), func(ctx context.Context, i int) (*models.KnowledgeFile, error) {
+			return h.knowledgeService.UploadFileFromPath(ctx, kbID, req.FilePaths[i])
+		})
+		return
+	}
 
-	response, err := h.knowledgeService.BatchUploadFilesFromPath(ctx, kbID, req.FilePaths)
+	// 统一处理：直接调用批量上传，单文件超时由批量上传配置控制
+	response, err := h.knowledgeService.BatchUploadFilesFromPath(c.Request.Context(), kbID, req.FilePaths)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "上传文件失败"})
 		return
 	}
+	h.trackUploadedFiles(kbID, response)
 
 	c.JSON(200, response)
 }
@@ -469,6 +634,7 @@ func (h *KnowledgeHandler) DeleteFile(c *gin.Context) (interface{}, error) {
 	if err != nil {
 		return nil, utils.NewAPIError(utils.ErrFileNotFound, err)
 	}
+	h.statusTracker.Forget(id)
 
 	return models.MessageOnlyResponse{
 		Message: "文件删除成功",
@@ -539,3 +705,218 @@ func (h *KnowledgeHandler) ToggleFileEnable(c *gin.Context) (interface{}, error)
 		Message: message,
 	}, nil
 }
+
+// GetFileStatus 返回知识库文件的索引状态。
+//
+// swagger:route GET /knowledge/files/{file_id}/status Knowledge getFileStatus
+//
+// 获取文件索引状态
+//
+// 从状态跟踪器缓存中获取文件的索引状态和进度，构建中的文件由后台定时刷新。
+// 未缓存的文件按本地记录的所属知识库加载，未知的文件返回 404
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: file_id
+//     in: path
+//     description: 文件ID
+//     required: true
+//     type: integer
+//
+// Responses:
+//
+//	200: KnowledgeFile
+//	400: ResponseBody
+//	404: ResponseBody
+//	500: ResponseBody
+func (h *KnowledgeHandler) GetFileStatus(c *gin.Context) (interface{}, error) {
+	fileID := c.Param("file_id")
+
+	id, err := strconv.Atoi(fileID)
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	file, err := h.statusTracker.GetFileStatus(ctx, id)
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return nil, utils.NewAPIError(utils.ErrFileNotFound, err)
+	case err != nil:
+		return nil, utils.NewAPIError(utils.ErrInternalServer, err)
+	}
+
+	return file, nil
+}
+
+// StreamKnowledgeBaseStatus 以SSE流式推送知识库文件的索引状态。
+//
+// swagger:route GET /knowledge/bases/{id}/files/status Knowledge streamKnowledgeBaseStatus
+//
+// 订阅知识库文件状态
+//
+// 连接建立后先推送知识库中所有文件的当前状态，之后每当文件索引状态或进度变化时推送 file_status 事件
+//
+// Produces:
+// - text/event-stream
+//
+// Parameters:
+//   - +name: id
+//     in: path
+//     description: 知识库ID
+//     required: true
+//     type: integer
+//
+// Responses:
+//
+//	200: KnowledgeFile
+//	400: ResponseBody
+func (h *KnowledgeHandler) StreamKnowledgeBaseStatus(c *gin.Context) {
+	kbID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的知识库ID"})
+		return
+	}
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "不支持流式响应"})
+		return
+	}
+
+	// 先订阅再拉取快照，避免遗漏两者之间的状态变化
+	statusChan, unsubscribe := h.statusTracker.Subscribe(kbID)
+	defer unsubscribe()
+
+	ctx := c.Request.Context()
+	loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	files, err := h.statusTracker.LoadKnowledgeBase(loadCtx, kbID)
+	cancel()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取知识库文件失败"})
+		return
+	}
+
+	setSSEHeaders(c)
+
+	for _, file := range files {
+		if err := writeSSEEvent(c, flusher, "file_status", file); err != nil {
+			utils.ErrorWith("写入SSE事件失败", "error", err)
+			return
+		}
+	}
+
+	for {
+		select {
+		case file := <-statusChan:
+			if err := writeSSEEvent(c, flusher, "file_status", file); err != nil {
+				utils.ErrorWith("写入SSE事件失败", "error", err)
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ReindexFile 重建知识库文件的索引。
+//
+// swagger:route POST /knowledge/files/{file_id}/reindex Knowledge reindexFile
+//
+// 重建文件索引
+//
+// 在更换向量模型或切片配置后重新提取、切片并向量化文件，重建进度可通过文件状态接口查询。
+// 文件正在重建时返回 400；文件不存在时返回 404；后端调用失败或未能开始重建时返回 500
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: file_id
+//     in: path
+//     description: 文件ID
+//     required: true
+//     type: integer
+//
+// Responses:
+//
+//	200: KnowledgeFile
+//	400: ResponseBody
+//	404: ResponseBody
+//	500: ResponseBody
+func (h *KnowledgeHandler) ReindexFile(c *gin.Context) (interface{}, error) {
+	fileID := c.Param("file_id")
+
+	id, err := strconv.Atoi(fileID)
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	file, err := h.knowledgeService.ReindexFile(ctx, id)
+	switch {
+	case errors.Is(err, models.ErrFileReindexing):
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	case errors.Is(err, database.ErrNotFound):
+		return nil, utils.NewAPIError(utils.ErrFileNotFound, err)
+	case err != nil:
+		return nil, utils.NewAPIError(utils.ErrInternalServer, err)
+	}
+
+	// 加入状态跟踪，后续进度由后台轮询刷新
+	if err := h.statusTracker.TrackFile(ctx, *file); err != nil {
+		utils.WarnWith("跟踪文件重建状态失败", "file_id", id, "error", err)
+	}
+
+	return file, nil
+}
+
+// ReindexKnowledgeBase 重建知识库中所有文件的索引。
+//
+// swagger:route POST /knowledge/bases/{id}/reindex Knowledge reindexKnowledgeBase
+//
+// 重建知识库索引
+//
+// 对知识库中的所有文件重新提取、切片并向量化，重建进度可通过知识库文件状态流订阅。
+// 单个文件未能开始重建不影响其他文件，失败的文件及原因在 failures 中返回
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: id
+//     in: path
+//     description: 知识库ID
+//     required: true
+//     type: integer
+//
+// Responses:
+//
+//	200: ReindexKnowledgeBaseResponse
+//	400: ResponseBody
+func (h *KnowledgeHandler) ReindexKnowledgeBase(c *gin.Context) (interface{}, error) {
+	kbID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	response, err := h.knowledgeService.ReindexKnowledgeBase(ctx, kbID)
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrKnowledgeBaseNotFound, err)
+	}
+
+	for _, file := range response.KnowledgeFiles {
+		h.statusTracker.Track(kbID, file)
+	}
+
+	return response, nil
+}
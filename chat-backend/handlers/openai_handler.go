@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/models"
+	"chat-backend/pkg/database"
+	"chat-backend/services"
+	"chat-backend/services/interfaces"
+	"chat-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAI 兼容接口的扩展请求头
+const (
+	headerConversationID   = "X-Conversation-ID"    // 继续的对话ID，响应中返回实际使用的对话ID
+	headerKnowledgeBaseIDs = "X-Knowledge-Base-IDs" // 新对话使用的知识库ID，逗号分隔
+)
+
+// OpenAIHandler 处理 OpenAI 兼容接口的HTTP请求。
+// 响应格式与 OpenAI API 一致，不使用统一的响应包装，供现有的 OpenAI SDK 和插件直接调用
+type OpenAIHandler struct {
+	chatService            interfaces.ChatServiceInterface
+	modelService           interfaces.ModelServiceInterface
+	defaultSettingsService interfaces.DefaultSettingsServiceInterface
+	generations            *services.GenerationRegistry
+	conversations          *services.OpenAIConversationCache
+}
+
+// NewOpenAIHandler 创建并返回一个新的 OpenAI 兼容接口处理器实例。
+func NewOpenAIHandler(chatService interfaces.ChatServiceInterface, modelService interfaces.ModelServiceInterface, defaultSettingsService interfaces.DefaultSettingsServiceInterface, generations *services.GenerationRegistry, conversations *services.OpenAIConversationCache) *OpenAIHandler {
+	return &OpenAIHandler{
+		chatService:            chatService,
+		modelService:           modelService,
+		defaultSettingsService: defaultSettingsService,
+		generations:            generations,
+		conversations:          conversations,
+	}
+}
+
+// NewOpenAIHandlerFromGlobal 使用全局服务创建 OpenAI 兼容接口处理器实例
+func NewOpenAIHandlerFromGlobal() *OpenAIHandler {
+	return &OpenAIHandler{
+		chatService:            services.GetGlobalChatService(),
+		modelService:           services.GetGlobalModelService(),
+		defaultSettingsService: services.GetGlobalDefaultSettingsService(),
+		generations:            services.GetGlobalGenerationRegistry(),
+		conversations:          services.GetGlobalOpenAIConversationCache(),
+	}
+}
+
+// ChatCompletions 以 OpenAI Chat Completions 格式对话。
+//
+// POST /v1/chat/completions
+//
+// 未指定对话时以 model 对应的模型创建新对话，messages 中最后一条用户消息之前、上下文限制内的最近消息作为历史导入；
+// messages 是之前某次回答后的完整消息列表加上新的提问时，在该次回答所在的对话中继续，不再创建新对话。
+// 通过 X-Conversation-ID 请求头或 conversation_id 字段可在已有对话中继续，此时仅发送最后一条用户消息，
+// 请求中的 model 和采样参数写入该对话的设置。
+// 新对话的知识库通过 X-Knowledge-Base-IDs 请求头或 knowledge_base_ids 字段指定。
+// 响应头 X-Conversation-ID 返回实际使用的对话ID。stream 为 true 时以 chat.completion.chunk 分片流式输出，以 [DONE] 结束。
+// 回答被停止生成接口或超时中断时 finish_reason 为 stopped，内容不完整
+func (h *OpenAIHandler) ChatCompletions(c *gin.Context) {
+	var req models.OpenAIChatCompletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "", "请求数据解析失败: "+err.Error())
+		return
+	}
+
+	if value := c.GetHeader(headerConversationID); value != "" && req.ConversationID == 0 {
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			writeOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "", "无效的 "+headerConversationID+": "+value)
+			return
+		}
+		req.ConversationID = id
+	}
+	if value := c.GetHeader(headerKnowledgeBaseIDs); value != "" && len(req.KnowledgeBaseIDs) == 0 {
+		for _, part := range strings.Split(value, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || id <= 0 {
+				writeOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "", "无效的 "+headerKnowledgeBaseIDs+": "+value)
+				return
+			}
+			req.KnowledgeBaseIDs = append(req.KnowledgeBaseIDs, id)
+		}
+	}
+
+	chatReq, model, err := services.PrepareOpenAIChat(c.Request.Context(), h.chatService, h.modelService, h.defaultSettingsService, h.conversations, &req)
+	if err != nil {
+		utils.ErrorWith("OpenAI 兼容接口请求失败", "model", req.Model, "conversation_id", req.ConversationID, "error", err)
+		switch {
+		case errors.Is(err, services.ErrOpenAIInvalidRequest), errors.Is(err, models.ErrAssistantSettings):
+			writeOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+		case errors.Is(err, services.ErrOpenAIModelNotFound):
+			writeOpenAIError(c, http.StatusNotFound, "invalid_request_error", "model_not_found", err.Error())
+		case errors.Is(err, database.ErrNotFound):
+			writeOpenAIError(c, http.StatusNotFound, "invalid_request_error", "conversation_not_found", err.Error())
+		default:
+			writeOpenAIError(c, http.StatusInternalServerError, "server_error", "", err.Error())
+		}
+		return
+	}
+	c.Header(headerConversationID, strconv.Itoa(chatReq.ConversationID))
+
+	// 不设置 RequestID，生成随客户端断开而取消
+	generation, err := startGeneration(c.Request.Context(), h.chatService, h.generations, chatReq)
+	if err != nil {
+		writeOpenAIError(c, http.StatusConflict, "invalid_request_error", "", err.Error())
+		return
+	}
+	go h.rememberConversation(generation, &req, model.ID)
+
+	completion := &models.OpenAIChatCompletionResponse{
+		ID:      newOpenAICompletionID(),
+		Created: generation.StartedAt.Unix(),
+		Model:   model.OpenAIModelID(),
+	}
+	if req.Stream {
+		streamOpenAICompletion(c, generation, completion)
+		return
+	}
+
+	if err := generation.Wait(c.Request.Context()); err != nil {
+		return // 客户端已断开
+	}
+	events, _, _ := generation.EventsAfter(0)
+	response, errMessage := newChatResponse(generation, events)
+	if response.Status == models.FinishReasonError {
+		writeOpenAIError(c, http.StatusInternalServerError, "server_error", "", errMessage)
+		return
+	}
+
+	finishReason := openAIFinishReason(response.Status)
+	completion.Object = models.OpenAIObjectChatCompletion
+	completion.Choices = []models.OpenAIChatCompletionChoice{{
+		Message:      &models.OpenAIChatMessage{Role: "assistant", Content: response.Content},
+		FinishReason: &finishReason,
+	}}
+	completion.Usage = openAIUsage(events)
+	completion.References = response.References
+	c.JSON(http.StatusOK, completion)
+}
+
+// rememberConversation 生成正常结束后登记对话，携带本次回答的后续请求将在同一对话中继续
+func (h *OpenAIHandler) rememberConversation(generation *services.Generation, req *models.OpenAIChatCompletionRequest, modelID int) {
+	if h.conversations == nil {
+		return
+	}
+	if err := generation.Wait(context.Background()); err != nil {
+		return
+	}
+	events, _, _ := generation.EventsAfter(0)
+	response, _ := newChatResponse(generation, events)
+	if response.Status != models.FinishReasonStop {
+		return // 出错或被中断的回答不会被客户端原样带回
+	}
+	h.conversations.Remember(req, modelID, response.Content, generation.ConversationID)
+}
+
+// streamOpenAICompletion 将生成的事件以 chat.completion.chunk 分片输出，以 [DONE] 结束
+func streamOpenAICompletion(c *gin.Context, generation *services.Generation, completion *models.OpenAIChatCompletionResponse) {
+	setSSEHeaders(c)
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		writeOpenAIError(c, http.StatusInternalServerError, "server_error", "", "不支持流式响应")
+		return
+	}
+
+	completion.Object = models.OpenAIObjectChatCompletionChunk
+	chunk := func(delta models.OpenAIChatDelta, finishReason *string) models.OpenAIChatCompletionResponse {
+		result := *completion
+		result.Choices = []models.OpenAIChatCompletionChoice{{Delta: &delta, FinishReason: finishReason}}
+		return result
+	}
+
+	if err := writeSSEData(c, flusher, chunk(models.OpenAIChatDelta{Role: "assistant"}, nil)); err != nil {
+		return
+	}
+
+	var references []models.Reference
+	var usage *models.OpenAIUsage
+	var errMessage string
+	followGeneration(c.Request.Context(), generation, 0, func(event services.GenerationEvent) error {
+		switch event.Type {
+		case models.ChatEventDelta:
+			text, _ := event.Event.Data.(string)
+			if text == "" {
+				return nil
+			}
+			return writeSSEData(c, flusher, chunk(models.OpenAIChatDelta{Content: text}, nil))
+		case models.ChatEventReferences:
+			references, _ = event.Event.Data.([]models.Reference)
+		case models.ChatEventUsage:
+			usage = openAIUsage([]services.GenerationEvent{event})
+		case models.ChatEventError:
+			errMessage = event.Event.Error
+		case models.ChatEventFinish:
+			if event.Event.FinishReason == models.FinishReasonError {
+				if errMessage == "" {
+					errMessage, _ = event.Event.Data.(string)
+				}
+				if err := writeSSEData(c, flusher, models.OpenAIErrorResponse{
+					Error: models.OpenAIError{Message: errMessage, Type: "server_error"},
+				}); err != nil {
+					return err
+				}
+				return writeSSEData(c, flusher, "[DONE]")
+			}
+
+			finishReason := openAIFinishReason(event.Event.FinishReason)
+			last := chunk(models.OpenAIChatDelta{}, &finishReason)
+			last.Usage = usage
+			last.References = references
+			if err := writeSSEData(c, flusher, last); err != nil {
+				return err
+			}
+			return writeSSEData(c, flusher, "[DONE]")
+		}
+		return nil
+	})
+}
+
+// openAIFinishReason 将聊天的结束原因转换为 OpenAI 响应的 finish_reason，未给出时为 stop
+// 被中断的回答保留 stopped，以便客户端区分不完整的回答
+func openAIFinishReason(reason string) string {
+	if reason == "" {
+		return models.FinishReasonStop
+	}
+	return reason
+}
+
+// ListModels 以 OpenAI 格式返回可用的聊天模型。
+//
+// GET /v1/models
+//
+// 模型ID为 ModelInfo 的名称，可用作 /v1/chat/completions 的 model
+func (h *OpenAIHandler) ListModels(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	chatModels, err := h.modelService.ListAvailableChatModels(ctx)
+	if err != nil {
+		utils.ErrorWith("获取聊天模型列表失败", "error", err)
+		writeOpenAIError(c, http.StatusInternalServerError, "server_error", "", err.Error())
+		return
+	}
+
+	list := models.OpenAIModelList{
+		Object: models.OpenAIObjectList,
+		Data:   make([]models.OpenAIModel, 0, len(chatModels)),
+	}
+	for _, model := range chatModels {
+		list.Data = append(list.Data, models.OpenAIModel{
+			ID:      model.OpenAIModelID(),
+			Object:  models.OpenAIObjectModel,
+			OwnedBy: "system",
+		})
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// openAIUsage 返回生成事件中最后一次的 Token 用量，没有用量事件时返回 nil
+func openAIUsage(events []services.GenerationEvent) *models.OpenAIUsage {
+	var usage *models.OpenAIUsage
+	for _, event := range events {
+		if event.Type != models.ChatEventUsage {
+			continue
+		}
+		if tokens, ok := event.Event.Data.(models.TokenUsage); ok {
+			usage = &models.OpenAIUsage{
+				PromptTokens:     tokens.PromptTokens,
+				CompletionTokens: tokens.CompletionTokens,
+				TotalTokens:      tokens.TotalTokens,
+			}
+		}
+	}
+	return usage
+}
+
+// newOpenAICompletionID 生成 chatcmpl- 前缀的随机ID
+func newOpenAICompletionID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "chatcmpl-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return "chatcmpl-" + hex.EncodeToString(buf)
+}
+
+// writeOpenAIError 以 OpenAI 错误格式返回错误
+func writeOpenAIError(c *gin.Context, status int, errType, code, message string) {
+	c.JSON(status, models.OpenAIErrorResponse{
+		Error: models.OpenAIError{
+			Message: message,
+			Type:    errType,
+			Code:    code,
+		},
+	})
+}
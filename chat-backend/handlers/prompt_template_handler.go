@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"chat-backend/models"
+	"chat-backend/pkg/database"
+	"chat-backend/services"
+	"chat-backend/services/interfaces"
+	"chat-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PromptTemplateHandler 处理提示词模板相关的HTTP请求。
+type PromptTemplateHandler struct {
+	promptTemplateService interfaces.PromptTemplateServiceInterface
+}
+
+// NewPromptTemplateHandler 创建并返回一个新的提示词模板处理器实例。
+func NewPromptTemplateHandler(promptTemplateService interfaces.PromptTemplateServiceInterface) *PromptTemplateHandler {
+	return &PromptTemplateHandler{
+		promptTemplateService: promptTemplateService,
+	}
+}
+
+// NewPromptTemplateHandlerFromGlobal 使用全局服务创建提示词模板处理器实例
+func NewPromptTemplateHandlerFromGlobal() *PromptTemplateHandler {
+	return &PromptTemplateHandler{
+		promptTemplateService: services.GetGlobalPromptTemplateService(),
+	}
+}
+
+// ListPromptTemplates 返回提示词模板列表。
+//
+// swagger:route GET /prompts Prompts listPromptTemplates
+//
+// 获取提示词模板列表
+//
+// 按名称排列返回提示词模板，可按分类和关键字过滤，同时返回全部分类
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: category
+//     in: query
+//     description: 分类
+//     required: false
+//     type: string
+//   - +name: keyword
+//     in: query
+//     description: 名称或说明关键字
+//     required: false
+//     type: string
+//
+// Responses:
+//
+//	200: PromptTemplateListResponse
+//	400: ResponseBody
+func (h *PromptTemplateHandler) ListPromptTemplates(c *gin.Context) (interface{}, error) {
+	var req models.PromptTemplateListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	templates, err := h.promptTemplateService.ListTemplates(ctx, &req)
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInternalServer, err)
+	}
+
+	return templates, nil
+}
+
+// CreatePromptTemplate 创建提示词模板。
+//
+// swagger:route POST /prompts Prompts createPromptTemplate
+//
+// 创建提示词模板
+//
+// 创建一个提示词模板，内容中可通过 {{变量名}} 引用变量，创建后为第 1 版
+//
+// Consumes:
+// - application/json
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: body
+//     in: body
+//     description: 模板信息
+//     required: true
+//     type: PromptTemplateRequest
+//
+// Responses:
+//
+//	200: PromptTemplate
+//	400: ResponseBody
+func (h *PromptTemplateHandler) CreatePromptTemplate(c *gin.Context) (interface{}, error) {
+	var req models.PromptTemplateRequest
+	if err := c.BindJSON(&req); err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+	if err := req.Validate(); err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	template, err := h.promptTemplateService.CreateTemplate(ctx, &req)
+	if err != nil {
+		return nil, promptTemplateError(err)
+	}
+
+	return template, nil
+}
+
+// GetPromptTemplate 返回指定的提示词模板。
+//
+// swagger:route GET /prompts/{id} Prompts getPromptTemplate
+//
+// 获取提示词模板
+//
+// 获取提示词模板的最新版本及其引用的变量
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: id
+//     in: path
+//     description: 模板ID
+//     required: true
+//     type: integer
+//
+// Responses:
+//
+//	200: PromptTemplate
+//	400: ResponseBody
+//	404: ResponseBody
+func (h *PromptTemplateHandler) GetPromptTemplate(c *gin.Context) (interface{}, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	template, err := h.promptTemplateService.GetTemplate(ctx, id)
+	if err != nil {
+		return nil, promptTemplateError(err)
+	}
+
+	return template, nil
+}
+
+// UpdatePromptTemplate 修改提示词模板。
+//
+// swagger:route PUT /prompts/{id} Prompts updatePromptTemplate
+//
+// 修改提示词模板
+//
+// 修改模板的名称、分类、说明和内容，内容变化时版本号加一，历史版本保留并可用于预览和对话设置
+//
+// Consumes:
+// - application/json
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: id
+//     in: path
+//     description: 模板ID
+//     required: true
+//     type: integer
+//   - +name: body
+//     in: body
+//     description: 模板信息
+//     required: true
+//     type: PromptTemplateRequest
+//
+// Responses:
+//
+//	200: PromptTemplate
+//	400: ResponseBody
+//	404: ResponseBody
+func (h *PromptTemplateHandler) UpdatePromptTemplate(c *gin.Context) (interface{}, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	var req models.PromptTemplateRequest
+	if err := c.BindJSON(&req); err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+	if err := req.Validate(); err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	template, err := h.promptTemplateService.UpdateTemplate(ctx, id, &req)
+	if err != nil {
+		return nil, promptTemplateError(err)
+	}
+
+	return template, nil
+}
+
+// DeletePromptTemplate 删除提示词模板。
+//
+// swagger:route DELETE /prompts/{id} Prompts deletePromptTemplate
+//
+// 删除提示词模板
+//
+// 删除模板及其历史版本，已引用该模板的对话保留当时的系统提示词
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: id
+//     in: path
+//     description: 模板ID
+//     required: true
+//     type: integer
+//
+// Responses:
+//
+//	200: MessageOnlyResponse
+//	400: ResponseBody
+//	404: ResponseBody
+func (h *PromptTemplateHandler) DeletePromptTemplate(c *gin.Context) (interface{}, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.promptTemplateService.DeleteTemplate(ctx, id); err != nil {
+		return nil, promptTemplateError(err)
+	}
+
+	return models.MessageOnlyResponse{
+		Message: "提示词模板删除成功",
+	}, nil
+}
+
+// ListPromptTemplateVersions 返回提示词模板的历史版本。
+//
+// swagger:route GET /prompts/{id}/versions Prompts listPromptTemplateVersions
+//
+// 获取提示词模板的历史版本
+//
+// 按版本号从新到旧返回模板的全部版本
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: id
+//     in: path
+//     description: 模板ID
+//     required: true
+//     type: integer
+//
+// Responses:
+//
+//	200: PromptTemplateVersionListResponse
+//	400: ResponseBody
+//	404: ResponseBody
+func (h *PromptTemplateHandler) ListPromptTemplateVersions(c *gin.Context) (interface{}, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	versions, err := h.promptTemplateService.ListTemplateVersions(ctx, id)
+	if err != nil {
+		return nil, promptTemplateError(err)
+	}
+
+	return models.PromptTemplateVersionListResponse{
+		Versions: versions,
+	}, nil
+}
+
+// RenderPromptTemplate 预览代入变量后的提示词。
+//
+// swagger:route POST /prompts/{id}/render Prompts renderPromptTemplate
+//
+// 预览提示词模板
+//
+// 以给定变量渲染模板的指定版本，返回最终的提示词以及未提供值的变量，不修改模板
+//
+// Consumes:
+// - application/json
+//
+// Produces:
+// - application/json
+//
+// Parameters:
+//   - +name: id
+//     in: path
+//     description: 模板ID
+//     required: true
+//     type: integer
+//   - +name: body
+//     in: body
+//     description: 变量的值及版本号
+//     required: false
+//     type: PromptRenderRequest
+//
+// Responses:
+//
+//	200: PromptRenderResponse
+//	400: ResponseBody
+//	404: ResponseBody
+func (h *PromptTemplateHandler) RenderPromptTemplate(c *gin.Context) (interface{}, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	var req models.PromptRenderRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		return nil, utils.NewAPIError(utils.ErrInvalidRequest, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := h.promptTemplateService.RenderTemplate(ctx, id, &req)
+	if err != nil {
+		return nil, promptTemplateError(err)
+	}
+
+	return result, nil
+}
+
+// promptTemplateError 将提示词模板服务的错误转换为API错误
+func promptTemplateError(err error) error {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return utils.NewAPIError(utils.ErrNotFound, err)
+	case errors.Is(err, models.ErrPromptTemplateNameExists):
+		return utils.NewAPIError(utils.ErrInvalidRequest, err)
+	default:
+		return utils.NewAPIError(utils.ErrInternalServer, err)
+	}
+}
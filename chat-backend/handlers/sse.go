@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setSSEHeaders 设置SSE响应头
+func setSSEHeaders(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+}
+
+// wantsEventStream 判断客户端是否通过 Accept 请求头要求SSE流式响应
+func wantsEventStream(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+}
+
+// wantsJSON 判断客户端是否通过 Accept 请求头要求JSON响应（同时接受SSE时仍为流式）
+func wantsJSON(c *gin.Context) bool {
+	accept := c.GetHeader("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/event-stream")
+}
+
+// writeSSEEvent 按照SSE格式输出一个事件（event字段 + data字段）并立即刷新
+func writeSSEEvent(c *gin.Context, flusher http.Flusher, eventType string, data interface{}) error {
+	eventData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(c.Writer, "event:%s\ndata: %s\n\n", eventType, eventData); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
+
+// writeSSEEventWithID 按照SSE格式输出带 id 字段的事件并立即刷新，客户端重连时通过 Last-Event-ID 回传
+func writeSSEEventWithID(c *gin.Context, flusher http.Flusher, id int64, eventType string, data interface{}) error {
+	if _, err := fmt.Fprintf(c.Writer, "id:%d\n", id); err != nil {
+		return err
+	}
+	return writeSSEEvent(c, flusher, eventType, data)
+}
+
+// writeSSEData 按照SSE格式输出仅含 data 字段的事件并立即刷新，data 为字符串时原样输出
+func writeSSEData(c *gin.Context, flusher http.Flusher, data interface{}) error {
+	payload, ok := data.(string)
+	if !ok {
+		eventData, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		payload = string(eventData)
+	}
+
+	if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", payload); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
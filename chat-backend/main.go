@@ -66,10 +66,13 @@ func NewServer() *Server {
 	settingsHandler := handlers.NewSettingsHandlerFromGlobal()
 	knowledgeHandler := handlers.NewKnowledgeHandlerFromGlobal()
 	modelHandler := handlers.NewModelHandlerFromGlobal()
+	promptHandler := handlers.NewPromptTemplateHandlerFromGlobal()
+	assistantHandler := handlers.NewAssistantHandlerFromGlobal()
+	openAIHandler := handlers.NewOpenAIHandlerFromGlobal()
 	versionHandler := handlers.NewVersionHandler(Version, BuildTime, GitCommit, GitBranch, GitTag)
 
 	// 创建路由，传入嵌入的文件系统
-	router := routes.NewRouter(chatHandler, settingsHandler, knowledgeHandler, modelHandler, versionHandler, staticFiles, docsFiles)
+	router := routes.NewRouter(chatHandler, settingsHandler, knowledgeHandler, modelHandler, promptHandler, assistantHandler, openAIHandler, versionHandler, staticFiles, docsFiles)
 
 	return &Server{
 		router: router,
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrAssistantInUse 助手下仍有对话，不能删除
+var ErrAssistantInUse = errors.New("助手下仍有对话，请先删除这些对话")
+
+// ErrAssistantSettings 从助手创建的对话只能修改名称和描述
+var ErrAssistantSettings = errors.New("从助手创建的对话只能修改名称和描述，其他设置请修改助手")
+
+// Assistant 助手，可复用的对话设置预设
+// 从助手创建的对话共用助手的设置，修改助手对这些对话之后的提问生效
+// swagger:model
+type Assistant struct {
+	// 助手ID
+	// required: true
+	ID int `json:"id"`
+	// 助手设置，name 和 desc 为助手的名称和描述
+	ConversationSettings `json:"settings"`
+	// 从助手创建的对话数量
+	// required: true
+	ConversationCount int `json:"conversation_count"`
+	// 创建时间
+	// required: false
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	// 更新时间
+	// required: false
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// AssistantListResponse 助手列表响应
+// swagger:model
+type AssistantListResponse struct {
+	// 助手列表，按名称排列
+	// required: true
+	Assistants []Assistant `json:"assistants"`
+}
@@ -0,0 +1,282 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// 消息评价
+const (
+	FeedbackLike    = 1  // 赞
+	FeedbackDislike = -1 // 踩
+)
+
+// feedbackReportDefaultDays 评价统计默认的时间范围（天）
+const feedbackReportDefaultDays = 30
+
+// feedbackReportRecentDislikes 评价统计中返回的最近差评数量
+const feedbackReportRecentDislikes = 20
+
+// ErrMessageNotRatable 消息不支持评价
+var ErrMessageNotRatable = errors.New("只能评价助手的回答")
+
+// MessageFeedbackRequest 消息评价请求
+// swagger:model
+type MessageFeedbackRequest struct {
+	// 评价: 1 赞，-1 踩；再次评价时覆盖之前的评价
+	// required: true
+	Rating int `json:"rating" example:"1"`
+	// 评价说明，如回答缺失或错误的内容
+	// required: false
+	Comment string `json:"comment,omitempty"`
+}
+
+// MessageFeedback 消息评价，保存评价时回答所用的模型和知识库
+// swagger:model
+type MessageFeedback struct {
+	// 被评价的回答ID
+	// required: true
+	MessageID int `json:"message_id"`
+	// 对话ID
+	// required: true
+	ConversationID int `json:"conversation_id"`
+	// 评价: 1 赞，-1 踩
+	// required: true
+	Rating int `json:"rating"`
+	// 评价说明
+	// required: false
+	Comment string `json:"comment,omitempty"`
+	// 回答所用的模型ID
+	// required: true
+	ModelID int `json:"model_id"`
+	// 回答所用的知识库ID列表
+	// required: true
+	KnowledgeBaseIDs []int `json:"knowledge_base_ids"`
+	// 对应的提问
+	// required: true
+	Question string `json:"question"`
+	// 被评价的回答
+	// required: true
+	Answer string `json:"answer"`
+	// 评价时间
+	// required: true
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FeedbackReportRequest 评价统计请求
+// swagger:model
+type FeedbackReportRequest struct {
+	// 统计开始时间，默认为 30 天前
+	// required: false
+	Since time.Time `json:"since" form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	// 统计结束时间，默认为当前时间
+	// required: false
+	Until time.Time `json:"until" form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	// 仅统计指定模型
+	// required: false
+	ModelID int `json:"model_id" form:"model_id"`
+	// 仅统计使用了指定知识库的回答
+	// required: false
+	KnowledgeBaseID int `json:"knowledge_base_id" form:"knowledge_base_id"`
+}
+
+// Normalize 校验并补全评价统计的时间范围
+// SQLite 以文本比较时间，评价时间按服务器时区保存，因此将时间范围转换为本地时间
+func (r *FeedbackReportRequest) Normalize() error {
+	if r.Until.IsZero() {
+		r.Until = time.Now()
+	}
+	if r.Since.IsZero() {
+		r.Since = r.Until.AddDate(0, 0, -feedbackReportDefaultDays)
+	}
+	r.Since, r.Until = r.Since.Local(), r.Until.Local()
+	if r.Since.After(r.Until) {
+		return errors.New("开始时间不能晚于结束时间")
+	}
+	return nil
+}
+
+// FeedbackStats 评价计数
+// swagger:model
+type FeedbackStats struct {
+	// 赞的数量
+	// required: true
+	Likes int `json:"likes"`
+	// 踩的数量
+	// required: true
+	Dislikes int `json:"dislikes"`
+	// 评价总数
+	// required: true
+	Total int `json:"total"`
+	// 好评率，0 到 1
+	// required: true
+	LikeRate float64 `json:"like_rate"`
+}
+
+// add 计入一条评价
+func (s *FeedbackStats) add(rating int) {
+	if rating == FeedbackLike {
+		s.Likes++
+	} else {
+		s.Dislikes++
+	}
+	s.Total++
+	s.LikeRate = float64(s.Likes) / float64(s.Total)
+}
+
+// ModelFeedbackStats 按模型统计的评价
+// swagger:model
+type ModelFeedbackStats struct {
+	// 模型ID
+	// required: true
+	ModelID int `json:"model_id"`
+	FeedbackStats
+}
+
+// KnowledgeBaseFeedbackStats 按知识库统计的评价，一条回答使用多个知识库时分别计入
+// swagger:model
+type KnowledgeBaseFeedbackStats struct {
+	// 知识库ID，0 表示未使用知识库
+	// required: true
+	KnowledgeBaseID int `json:"knowledge_base_id"`
+	FeedbackStats
+}
+
+// DailyFeedbackStats 按天统计的评价
+// swagger:model
+type DailyFeedbackStats struct {
+	// 日期（服务器时区），格式 2006-01-02
+	// required: true
+	Date string `json:"date"`
+	FeedbackStats
+}
+
+// FeedbackReport 评价统计报告
+// swagger:model
+type FeedbackReport struct {
+	// 统计开始时间
+	// required: true
+	Since time.Time `json:"since"`
+	// 统计结束时间
+	// required: true
+	Until time.Time `json:"until"`
+	// 总体评价
+	// required: true
+	Summary FeedbackStats `json:"summary"`
+	// 按模型统计，按差评数从多到少排列
+	// required: true
+	ByModel []ModelFeedbackStats `json:"by_model"`
+	// 按知识库统计，按差评数从多到少排列，用于发现知识库的薄弱环节
+	// required: true
+	ByKnowledgeBase []KnowledgeBaseFeedbackStats `json:"by_knowledge_base"`
+	// 按天统计，按日期排列
+	// required: true
+	ByDay []DailyFeedbackStats `json:"by_day"`
+	// 最近的差评，包含提问、回答和评价说明
+	// required: true
+	RecentDislikes []MessageFeedback `json:"recent_dislikes"`
+}
+
+// NewFeedbackReport 汇总评价，feedback 须按评价时间从新到旧排列
+func NewFeedbackReport(req *FeedbackReportRequest, feedback []MessageFeedbackGORM) *FeedbackReport {
+	report := &FeedbackReport{
+		Since:           req.Since,
+		Until:           req.Until,
+		ByModel:         []ModelFeedbackStats{},
+		ByKnowledgeBase: []KnowledgeBaseFeedbackStats{},
+		ByDay:           []DailyFeedbackStats{},
+		RecentDislikes:  []MessageFeedback{},
+	}
+
+	byModel := make(map[int]*FeedbackStats)
+	byKnowledgeBase := make(map[int]*FeedbackStats)
+	byDay := make(map[string]*FeedbackStats)
+	stats := func(m map[int]*FeedbackStats, key int) *FeedbackStats {
+		if m[key] == nil {
+			m[key] = &FeedbackStats{}
+		}
+		return m[key]
+	}
+
+	for i := range feedback {
+		item := feedback[i].ToMessageFeedback()
+		if req.KnowledgeBaseID != 0 && !containsInt(item.KnowledgeBaseIDs, req.KnowledgeBaseID) {
+			continue
+		}
+
+		report.Summary.add(item.Rating)
+		stats(byModel, item.ModelID).add(item.Rating)
+		if len(item.KnowledgeBaseIDs) == 0 {
+			stats(byKnowledgeBase, 0).add(item.Rating)
+		}
+		for _, kbID := range item.KnowledgeBaseIDs {
+			stats(byKnowledgeBase, kbID).add(item.Rating)
+		}
+		day := item.UpdatedAt.Local().Format("2006-01-02")
+		if byDay[day] == nil {
+			byDay[day] = &FeedbackStats{}
+		}
+		byDay[day].add(item.Rating)
+
+		if item.Rating == FeedbackDislike && len(report.RecentDislikes) < feedbackReportRecentDislikes {
+			report.RecentDislikes = append(report.RecentDislikes, *item)
+		}
+	}
+
+	for id, s := range byModel {
+		report.ByModel = append(report.ByModel, ModelFeedbackStats{ModelID: id, FeedbackStats: *s})
+	}
+	sort.Slice(report.ByModel, func(i, j int) bool {
+		return moreDislikes(&report.ByModel[i].FeedbackStats, &report.ByModel[j].FeedbackStats, report.ByModel[i].ModelID, report.ByModel[j].ModelID)
+	})
+	for id, s := range byKnowledgeBase {
+		report.ByKnowledgeBase = append(report.ByKnowledgeBase, KnowledgeBaseFeedbackStats{KnowledgeBaseID: id, FeedbackStats: *s})
+	}
+	sort.Slice(report.ByKnowledgeBase, func(i, j int) bool {
+		return moreDislikes(&report.ByKnowledgeBase[i].FeedbackStats, &report.ByKnowledgeBase[j].FeedbackStats, report.ByKnowledgeBase[i].KnowledgeBaseID, report.ByKnowledgeBase[j].KnowledgeBaseID)
+	})
+	for day, s := range byDay {
+		report.ByDay = append(report.ByDay, DailyFeedbackStats{Date: day, FeedbackStats: *s})
+	}
+	sort.Slice(report.ByDay, func(i, j int) bool { return report.ByDay[i].Date < report.ByDay[j].Date })
+
+	return report
+}
+
+// moreDislikes 统计项排序：差评多的在前，差评数相同时好评率低的在前，最后按ID排列
+func moreDislikes(a, b *FeedbackStats, idA, idB int) bool {
+	if a.Dislikes != b.Dislikes {
+		return a.Dislikes > b.Dislikes
+	}
+	if a.LikeRate != b.LikeRate {
+		return a.LikeRate < b.LikeRate
+	}
+	return idA < idB
+}
+
+// ApplyMessageFeedback 为消息标注用户评价
+func ApplyMessageFeedback(messages []MessageRecord, feedback []MessageFeedbackGORM) {
+	if len(feedback) == 0 {
+		return
+	}
+	ratings := make(map[int]int, len(feedback))
+	for i := range feedback {
+		ratings[feedback[i].MessageID] = feedback[i].Rating
+	}
+	for i := range messages {
+		if !messages[i].Imported {
+			messages[i].Rating = ratings[messages[i].ID]
+		}
+	}
+}
+
+// containsInt 判断切片是否包含指定值
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
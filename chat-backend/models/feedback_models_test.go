@@ -0,0 +1,160 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// feedbackAt 构造一条评价，knowledgeBaseIDs 为 JSON 数组
+func feedbackAt(messageID, rating, modelID int, knowledgeBaseIDs string, updatedAt time.Time) MessageFeedbackGORM {
+	return MessageFeedbackGORM{
+		MessageID:        messageID,
+		ConversationID:   1,
+		Rating:           rating,
+		ModelID:          modelID,
+		KnowledgeBaseIDs: knowledgeBaseIDs,
+		UpdatedAt:        updatedAt,
+	}
+}
+
+// dislikeIDs 返回差评的消息ID
+func dislikeIDs(feedback []MessageFeedback) []int {
+	ids := []int{}
+	for _, item := range feedback {
+		ids = append(ids, item.MessageID)
+	}
+	return ids
+}
+
+func TestNewFeedbackReport(t *testing.T) {
+	day1 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	day2 := time.Date(2024, 5, 2, 10, 0, 0, 0, time.Local)
+	// 按评价时间从新到旧排列
+	feedback := []MessageFeedbackGORM{
+		feedbackAt(6, FeedbackDislike, 2, `[1,2]`, day2.Add(time.Hour)),
+		feedbackAt(5, FeedbackLike, 1, `[1]`, day2),
+		feedbackAt(4, FeedbackDislike, 1, `[]`, day1.Add(2*time.Hour)),
+		feedbackAt(3, FeedbackLike, 2, `[2]`, day1.Add(time.Hour)),
+		feedbackAt(2, FeedbackLike, 1, `[1]`, day1),
+	}
+	req := &FeedbackReportRequest{Since: day1.AddDate(0, 0, -1), Until: day2.AddDate(0, 0, 1)}
+
+	report := NewFeedbackReport(req, feedback)
+
+	if report.Since != req.Since || report.Until != req.Until {
+		t.Errorf("时间范围 = %v ~ %v, want %v ~ %v", report.Since, report.Until, req.Since, req.Until)
+	}
+	if want := (FeedbackStats{Likes: 3, Dislikes: 2, Total: 5, LikeRate: 0.6}); report.Summary != want {
+		t.Errorf("Summary = %+v, want %+v", report.Summary, want)
+	}
+
+	// 差评数相同，好评率低的在前
+	wantByModel := []ModelFeedbackStats{
+		{ModelID: 2, FeedbackStats: FeedbackStats{Likes: 1, Dislikes: 1, Total: 2, LikeRate: 0.5}},
+		{ModelID: 1, FeedbackStats: FeedbackStats{Likes: 2, Dislikes: 1, Total: 3, LikeRate: 2.0 / 3}},
+	}
+	if !reflect.DeepEqual(report.ByModel, wantByModel) {
+		t.Errorf("ByModel = %+v, want %+v", report.ByModel, wantByModel)
+	}
+
+	// 使用多个知识库的回答分别计入，未使用知识库的计入 0
+	wantByKnowledgeBase := []KnowledgeBaseFeedbackStats{
+		{KnowledgeBaseID: 0, FeedbackStats: FeedbackStats{Dislikes: 1, Total: 1}},
+		{KnowledgeBaseID: 2, FeedbackStats: FeedbackStats{Likes: 1, Dislikes: 1, Total: 2, LikeRate: 0.5}},
+		{KnowledgeBaseID: 1, FeedbackStats: FeedbackStats{Likes: 2, Dislikes: 1, Total: 3, LikeRate: 2.0 / 3}},
+	}
+	if !reflect.DeepEqual(report.ByKnowledgeBase, wantByKnowledgeBase) {
+		t.Errorf("ByKnowledgeBase = %+v, want %+v", report.ByKnowledgeBase, wantByKnowledgeBase)
+	}
+
+	wantByDay := []DailyFeedbackStats{
+		{Date: "2024-05-01", FeedbackStats: FeedbackStats{Likes: 2, Dislikes: 1, Total: 3, LikeRate: 2.0 / 3}},
+		{Date: "2024-05-02", FeedbackStats: FeedbackStats{Likes: 1, Dislikes: 1, Total: 2, LikeRate: 0.5}},
+	}
+	if !reflect.DeepEqual(report.ByDay, wantByDay) {
+		t.Errorf("ByDay = %+v, want %+v", report.ByDay, wantByDay)
+	}
+
+	if got, want := dislikeIDs(report.RecentDislikes), []int{6, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RecentDislikes = %v, want %v", got, want)
+	}
+}
+
+// TestNewFeedbackReportKnowledgeBaseFilter 指定知识库时仅统计使用了该知识库的回答
+func TestNewFeedbackReportKnowledgeBaseFilter(t *testing.T) {
+	now := time.Now()
+	feedback := []MessageFeedbackGORM{
+		feedbackAt(3, FeedbackDislike, 1, `[1,2]`, now),
+		feedbackAt(2, FeedbackDislike, 1, `[1]`, now),
+		feedbackAt(1, FeedbackLike, 1, `[2]`, now),
+	}
+
+	report := NewFeedbackReport(&FeedbackReportRequest{KnowledgeBaseID: 2}, feedback)
+
+	if want := (FeedbackStats{Likes: 1, Dislikes: 1, Total: 2, LikeRate: 0.5}); report.Summary != want {
+		t.Errorf("Summary = %+v, want %+v", report.Summary, want)
+	}
+	if got, want := dislikeIDs(report.RecentDislikes), []int{3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RecentDislikes = %v, want %v", got, want)
+	}
+}
+
+// TestNewFeedbackReportRecentDislikes 最近差评数量有上限，保留最新的差评
+func TestNewFeedbackReportRecentDislikes(t *testing.T) {
+	now := time.Now()
+	var feedback []MessageFeedbackGORM
+	for id := feedbackReportRecentDislikes + 5; id > 0; id-- {
+		feedback = append(feedback, feedbackAt(id, FeedbackDislike, 1, `[]`, now))
+	}
+
+	report := NewFeedbackReport(&FeedbackReportRequest{}, feedback)
+
+	if report.Summary.Dislikes != len(feedback) {
+		t.Errorf("Summary.Dislikes = %d, want %d", report.Summary.Dislikes, len(feedback))
+	}
+	if len(report.RecentDislikes) != feedbackReportRecentDislikes {
+		t.Fatalf("RecentDislikes 数量 = %d, want %d", len(report.RecentDislikes), feedbackReportRecentDislikes)
+	}
+	if report.RecentDislikes[0].MessageID != len(feedback) {
+		t.Errorf("第一条差评 = %d, want 最新的 %d", report.RecentDislikes[0].MessageID, len(feedback))
+	}
+}
+
+// TestNewFeedbackReportEmpty 没有评价时各统计项为空数组
+func TestNewFeedbackReportEmpty(t *testing.T) {
+	report := NewFeedbackReport(&FeedbackReportRequest{}, nil)
+
+	if report.ByModel == nil || report.ByKnowledgeBase == nil || report.ByDay == nil || report.RecentDislikes == nil {
+		t.Errorf("NewFeedbackReport() = %+v, want 空数组而不是 nil", report)
+	}
+	if report.Summary != (FeedbackStats{}) {
+		t.Errorf("Summary = %+v, want 零值", report.Summary)
+	}
+}
+
+func TestFeedbackReportRequestNormalize(t *testing.T) {
+	req := &FeedbackReportRequest{}
+	if err := req.Normalize(); err != nil {
+		t.Fatalf("Normalize() error = %v", err)
+	}
+	if got := req.Until.Sub(req.Since); got != req.Until.Sub(req.Until.AddDate(0, 0, -feedbackReportDefaultDays)) {
+		t.Errorf("默认时间范围 = %v, want %d 天", got, feedbackReportDefaultDays)
+	}
+
+	// 其他时区的时间转换为本地时间
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.FixedZone("UTC+9", 9*3600))
+	req = &FeedbackReportRequest{Since: since, Until: since.Add(time.Hour)}
+	if err := req.Normalize(); err != nil {
+		t.Fatalf("Normalize() error = %v", err)
+	}
+	if req.Since.Location() != time.Local || req.Until.Location() != time.Local || !req.Since.Equal(since) {
+		t.Errorf("Normalize() = %v ~ %v, want 本地时间的 %v", req.Since, req.Until, since)
+	}
+
+	now := time.Now()
+	req = &FeedbackReportRequest{Since: now, Until: now.Add(-time.Hour)}
+	if err := req.Normalize(); err == nil {
+		t.Error("Normalize() error = nil, want 开始时间晚于结束时间")
+	}
+}
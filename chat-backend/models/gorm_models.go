@@ -1,6 +1,9 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -56,6 +59,7 @@ type KnowledgeBaseFileGORM struct {
 	UploadedAt     time.Time `gorm:"autoCreateTime"`
 	IndexPercent   int    `gorm:"default:0;column:index_percent"`
 	ErrorMessage   string `gorm:"type:text"`
+	StoragePath    string `gorm:"size:1024;column:storage_path"` // 原始文件在本地磁盘上的保存路径
 }
 
 // TableName 指定表名
@@ -63,6 +67,242 @@ func (KnowledgeBaseFileGORM) TableName() string {
 	return "knowledge_base_files"
 }
 
+// FlowySessionGORM Flowy 会话索引表对应的GORM结构
+// 记录会话与 Agent、配置、模型的对应关系以及对话设置快照，避免逐个遍历 Flowy 的 Agent 和配置
+type FlowySessionGORM struct {
+	GORMModel
+	SessionID int    `gorm:"not null;uniqueIndex;column:session_id"`
+	AgentID   int    `gorm:"not null;index;column:agent_id"`
+	SettingID int    `gorm:"not null;column:setting_id"`
+	ModelID   int    `gorm:"column:model_id"`
+	Name      string `gorm:"size:255"`
+	Desc      string `gorm:"type:text"`
+	Settings  string `gorm:"type:text"` // ConversationSettings 的 JSON 快照
+
+	MessagesSyncedAt *time.Time `gorm:"column:messages_synced_at"` // 最近一次镜像会话记录的时间，为空表示尚未镜像
+
+	// Flowy 不提供会话时间，从 Flowy 重建的索引记录的创建、更新时间未知，不参与时间过滤和排序
+	CreatedAtUnknown bool `gorm:"not null;default:false;column:created_at_unknown"`
+	UpdatedAtUnknown bool `gorm:"not null;default:false;column:updated_at_unknown"` // 重建后出现新消息时清除
+}
+
+// TableName 指定表名
+func (FlowySessionGORM) TableName() string {
+	return "flowy_sessions"
+}
+
+// FlowySessionSegmentGORM 对话在 Flowy 中的后续会话
+// Flowy 无法删除会话记录，重新生成或编辑时在同一配置下创建后续会话继续对话，对话ID仍为最初的会话ID；
+// 保留的历史作为后续会话第一条提问的前缀发送，查询历史时从记录中去除
+type FlowySessionSegmentGORM struct {
+	SessionID      int       `gorm:"primaryKey;autoIncrement:false;column:session_id"`
+	ConversationID int       `gorm:"not null;index;column:conversation_id"`
+	HistoryPrompt  string    `gorm:"type:text;column:history_prompt"`
+	Seeded         bool      `gorm:"not null;default:false"` // 第一条提问已带上保留的历史发送
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName 指定表名
+func (FlowySessionSegmentGORM) TableName() string {
+	return "flowy_session_segments"
+}
+
+// MetadataGORM 键值元数据表对应的GORM结构，记录一次性任务的完成状态等
+type MetadataGORM struct {
+	Key       string `gorm:"primaryKey;size:128"`
+	Value     string `gorm:"type:text"`
+	UpdatedAt time.Time
+}
+
+// TableName 指定表名
+func (MetadataGORM) TableName() string {
+	return "metadata"
+}
+
+// ConversationGORM 对话表对应的GORM结构（langchaingo）
+type ConversationGORM struct {
+	GORMModel
+	ModelID  int    `gorm:"column:model_id;index"`
+	Name     string `gorm:"size:255"`
+	Desc     string `gorm:"type:text"`
+	Settings string `gorm:"type:text"` // ConversationSettings 的 JSON 快照
+}
+
+// TableName 指定表名
+func (ConversationGORM) TableName() string {
+	return "conversations"
+}
+
+// MessageGORM 消息表对应的GORM结构
+// langchaingo 在此保存对话消息；Flowy 在此镜像会话记录，ID 与 Flowy 的记录ID一致
+type MessageGORM struct {
+	ID               uint      `gorm:"primaryKey"`
+	ConversationID   int       `gorm:"not null;index;column:conversation_id"`
+	Role             string    `gorm:"not null;size:32"`
+	Content          string    `gorm:"type:text"`
+	FinishReason     string    `gorm:"size:32"`                   // 回答被中断时为 stopped
+	Files            string    `gorm:"type:text"`                 // 用户消息携带的附件ID列表（JSON）
+	RequestID        string    `gorm:"size:64;column:request_id"` // 生成该回答的请求ID
+	ModelID          int       `gorm:"column:model_id"`           // 生成该回答时使用的模型ID
+	KnowledgeBaseIDs string    `gorm:"column:knowledge_base_ids"` // 生成该回答时检索的知识库ID列表（JSON）
+	CreatedAt        time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName 指定表名
+func (MessageGORM) TableName() string {
+	return "messages"
+}
+
+// FlowyKnowledgeFileGORM Flowy 知识库文件索引，记录文件所属的知识库
+// Flowy 只能按知识库列出文件，按文件ID查找时据此确定知识库，避免遍历全部知识库
+type FlowyKnowledgeFileGORM struct {
+	FileID          int       `gorm:"primaryKey;autoIncrement:false;column:file_id"`
+	KnowledgeBaseID int       `gorm:"not null;index;column:knowledge_base_id"`
+	UpdatedAt       time.Time `gorm:"autoUpdateTime"`
+}
+
+// TableName 指定表名
+func (FlowyKnowledgeFileGORM) TableName() string {
+	return "flowy_knowledge_files"
+}
+
+// FlowyHistoryOverlayGORM Flowy 会话的本地历史覆盖层
+// Flowy 无法写入既有的会话记录，导入的历史消息保存在本地，查询历史时排在 Flowy 记录之前
+type FlowyHistoryOverlayGORM struct {
+	ID        uint      `gorm:"primaryKey"`
+	SessionID int       `gorm:"not null;index;column:session_id"`
+	Role      string    `gorm:"not null;size:32"`
+	Content   string    `gorm:"type:text"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName 指定表名
+func (FlowyHistoryOverlayGORM) TableName() string {
+	return "flowy_history_overlays"
+}
+
+// MessageVariantGORM 对话轮次被重新生成或编辑前的历史版本
+// langchaingo 归档后删除原消息；Flowy 无法删除会话记录，查询历史时隐藏 [FirstMessageID, LastMessageID] 范围内的记录，
+// 对话在后续会话（FlowySessionSegmentGORM）中继续
+type MessageVariantGORM struct {
+	ID             uint      `gorm:"primaryKey"`
+	ConversationID int       `gorm:"not null;index;column:conversation_id"`
+	Turn           int       `gorm:"not null"` // 轮次序号，从 0 开始
+	FirstMessageID int       `gorm:"not null"`
+	LastMessageID  int       `gorm:"not null"`
+	Question       string    `gorm:"type:text"`
+	Answer         string    `gorm:"type:text"`
+	AskedAt        time.Time
+	AnsweredAt     time.Time
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName 指定表名
+func (MessageVariantGORM) TableName() string {
+	return "message_variants"
+}
+
+// Hides 判断消息ID是否属于该历史版本
+func (v *MessageVariantGORM) Hides(messageID int) bool {
+	return messageID >= v.FirstMessageID && messageID <= v.LastMessageID
+}
+
+// ChatFileGORM langchaingo 的聊天附件，保存提取的文本，发送消息时注入提示词
+type ChatFileGORM struct {
+	ID          string    `gorm:"primaryKey;size:32"`
+	Name        string    `gorm:"not null"`
+	ContentType string
+	Size        int64
+	Content     string    `gorm:"type:text"` // 提取的文本
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName 指定表名
+func (ChatFileGORM) TableName() string {
+	return "chat_files"
+}
+
+// OpenAIConversationGORM OpenAI 兼容接口按消息前缀复用的对话
+// 回答结束后以「请求消息 + 回答」的摘要登记，之后携带该前缀的请求在登记的对话中继续
+type OpenAIConversationGORM struct {
+	Key            string    `gorm:"primaryKey;size:64"`
+	ConversationID int       `gorm:"not null;index;column:conversation_id"`
+	ExpiresAt      time.Time `gorm:"not null;index"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName 指定表名
+func (OpenAIConversationGORM) TableName() string {
+	return "openai_conversations"
+}
+
+// MessageFeedbackGORM 用户对回答的评价，每条回答保留最后一次评价
+// 保存评价时回答所用的模型和知识库，便于按模型和知识库统计
+type MessageFeedbackGORM struct {
+	ID               uint      `gorm:"primaryKey"`
+	MessageID        int       `gorm:"not null;uniqueIndex;column:message_id"`
+	ConversationID   int       `gorm:"not null;index;column:conversation_id"`
+	Rating           int       `gorm:"not null"` // 1=赞, -1=踩
+	Comment          string    `gorm:"type:text"`
+	ModelID          int       `gorm:"index;column:model_id"`
+	KnowledgeBaseIDs string    `gorm:"column:knowledge_base_ids"` // JSON 数组
+	Question         string    `gorm:"type:text"`
+	Answer           string    `gorm:"type:text"`
+	CreatedAt        time.Time `gorm:"autoCreateTime"`
+	UpdatedAt        time.Time `gorm:"autoUpdateTime;index"`
+}
+
+// TableName 指定表名
+func (MessageFeedbackGORM) TableName() string {
+	return "message_feedback"
+}
+
+// AssistantGORM 助手表对应的GORM结构
+// Flowy 为每个助手创建一个 Agent 和配置，从助手创建的对话均为该配置下的会话
+type AssistantGORM struct {
+	GORMModel
+	ModelID        int    `gorm:"column:model_id;index"`
+	Name           string `gorm:"size:255"`
+	Desc           string `gorm:"type:text"`
+	Settings       string `gorm:"type:text"` // ConversationSettings 的 JSON
+	FlowyAgentID   int    `gorm:"column:flowy_agent_id"`
+	FlowySettingID int    `gorm:"column:flowy_setting_id;index"`
+}
+
+// TableName 指定表名
+func (AssistantGORM) TableName() string {
+	return "assistants"
+}
+
+// PromptTemplateGORM 提示词模板，Content 和 Version 为最新版本
+type PromptTemplateGORM struct {
+	GORMModel
+	Name        string `gorm:"not null;size:255;index"`
+	Category    string `gorm:"size:100;index"`
+	Description string `gorm:"type:text"`
+	Content     string `gorm:"type:text"`
+	Version     int    `gorm:"not null;default:1"`
+}
+
+// TableName 指定表名
+func (PromptTemplateGORM) TableName() string {
+	return "prompt_templates"
+}
+
+// PromptTemplateVersionGORM 提示词模板的历史版本，每次内容变化保存一条
+type PromptTemplateVersionGORM struct {
+	ID         uint      `gorm:"primaryKey"`
+	TemplateID int       `gorm:"not null;uniqueIndex:idx_prompt_template_version;column:template_id"`
+	Version    int       `gorm:"not null;uniqueIndex:idx_prompt_template_version"`
+	Content    string    `gorm:"type:text"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName 指定表名
+func (PromptTemplateVersionGORM) TableName() string {
+	return "prompt_template_versions"
+}
+
 // 转换函数：GORM模型 -> API模型
 
 // ToModelInfo 将GORM模型转换为ModelInfo
@@ -119,8 +359,162 @@ func (kf *KnowledgeBaseFileGORM) ToKnowledgeFile() *KnowledgeFile {
 	}
 }
 
+// ToConversation 将GORM模型转换为Conversation
+func (fs *FlowySessionGORM) ToConversation() *Conversation {
+	settings := NewDefaultConversationSettings()
+	if fs.Settings != "" {
+		_ = json.Unmarshal([]byte(fs.Settings), settings)
+	}
+	settings.Name = fs.Name
+	settings.Desc = fs.Desc
+	settings.ModelID = fs.ModelID
+
+	conversation := &Conversation{
+		ID:                   fs.SessionID,
+		ConversationSettings: *settings,
+	}
+	// 未知的时间保留零值，避免把索引写入时间当作对话时间
+	if !fs.CreatedAtUnknown {
+		conversation.CreatedAt = fs.CreatedAt
+	}
+	if !fs.UpdatedAtUnknown {
+		conversation.UpdatedAt = fs.UpdatedAt
+	}
+	return conversation
+}
+
+// ToConversation 将GORM模型转换为Conversation
+func (c *ConversationGORM) ToConversation() *Conversation {
+	settings := NewDefaultConversationSettings()
+	if c.Settings != "" {
+		_ = json.Unmarshal([]byte(c.Settings), settings)
+	}
+	settings.Name = c.Name
+	settings.Desc = c.Desc
+	settings.ModelID = c.ModelID
+
+	return &Conversation{
+		ID:                   int(c.ID),
+		ConversationSettings: *settings,
+		CreatedAt:            c.CreatedAt,
+		UpdatedAt:            c.UpdatedAt,
+	}
+}
+
+// ToMessageRecord 将GORM模型转换为MessageRecord
+func (m *MessageGORM) ToMessageRecord() *MessageRecord {
+	record := &MessageRecord{
+		ID:           int(m.ID),
+		Role:         m.Role,
+		Content:      m.Content,
+		CreatedAt:    m.CreatedAt,
+		FinishReason: m.FinishReason,
+		RequestID:    m.RequestID,
+		ModelID:      m.ModelID,
+	}
+	if m.Files != "" {
+		_ = json.Unmarshal([]byte(m.Files), &record.Files)
+	}
+	if m.KnowledgeBaseIDs != "" {
+		_ = json.Unmarshal([]byte(m.KnowledgeBaseIDs), &record.KnowledgeBaseIDs)
+	}
+	return record
+}
+
+// MessageFilesJSON 将附件ID列表编码为 MessageGORM.Files 的存储格式，没有附件时为空字符串
+func MessageFilesJSON(files []string) string {
+	if len(files) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(files)
+	return string(data)
+}
+
+// ToMessageRecord 将GORM模型转换为MessageRecord
+func (o *FlowyHistoryOverlayGORM) ToMessageRecord() *MessageRecord {
+	return &MessageRecord{
+		Role:      o.Role,
+		Content:   o.Content,
+		CreatedAt: o.CreatedAt,
+		Imported:  true,
+	}
+}
+
+// ToMessageVersion 将GORM模型转换为MessageVersion
+func (v *MessageVariantGORM) ToMessageVersion(version int) MessageVersion {
+	result := MessageVersion{
+		Version:  version,
+		Question: MessageRecord{Role: "user", Content: v.Question, CreatedAt: v.AskedAt},
+	}
+	if v.Answer != "" {
+		result.Answer = &MessageRecord{Role: "assistant", Content: v.Answer, CreatedAt: v.AnsweredAt}
+	}
+	return result
+}
+
 // 转换函数：API模型 -> GORM模型
 
+// NewMessageVariantGORM 从消息列表中的一轮对话创建历史版本，多条回复的内容合并保存
+func NewMessageVariantGORM(conversationID int, messages []MessageRecord, turn *MessageTurn) *MessageVariantGORM {
+	question := messages[turn.Start]
+	variant := &MessageVariantGORM{
+		ConversationID: conversationID,
+		Turn:           turn.Index,
+		FirstMessageID: question.ID,
+		LastMessageID:  question.ID,
+		Question:       question.Content,
+		AskedAt:        question.CreatedAt,
+	}
+
+	var answers []string
+	for _, message := range messages[turn.Start+1 : turn.End] {
+		answers = append(answers, message.Content)
+		variant.LastMessageID = message.ID
+		variant.AnsweredAt = message.CreatedAt
+	}
+	variant.Answer = strings.Join(answers, "\n\n")
+	return variant
+}
+
+// MessageKnowledgeBasesJSON 将知识库ID列表编码为 MessageGORM.KnowledgeBaseIDs 的存储格式，没有知识库时为空字符串
+func MessageKnowledgeBasesJSON(ids []int) string {
+	if len(ids) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(ids)
+	return string(data)
+}
+
+// NewMessageFeedbackGORM 为一轮对话中的回答创建评价，记录生成回答时使用的模型和知识库
+// 回答未记录模型时（记录之前生成的回答）使用对话当前的设置
+func NewMessageFeedbackGORM(conversationID int, settings *ConversationSettings, messages []MessageRecord, turn *MessageTurn, messageID int, req *MessageFeedbackRequest) (*MessageFeedbackGORM, error) {
+	for _, message := range messages[turn.Start:turn.End] {
+		if message.ID != messageID || message.Imported {
+			continue
+		}
+		if message.Role != "assistant" {
+			return nil, ErrMessageNotRatable
+		}
+
+		modelID, knowledgeBases := message.ModelID, message.KnowledgeBaseIDs
+		if modelID == 0 {
+			modelID, knowledgeBases = settings.ModelID, settings.KnowledgeBaseIDs
+		}
+		knowledgeBaseIDs, _ := json.Marshal(append([]int{}, knowledgeBases...))
+		return &MessageFeedbackGORM{
+			MessageID:        messageID,
+			ConversationID:   conversationID,
+			Rating:           req.Rating,
+			Comment:          req.Comment,
+			ModelID:          modelID,
+			KnowledgeBaseIDs: string(knowledgeBaseIDs),
+			Question:         messages[turn.Start].Content,
+			Answer:           message.Content,
+		}, nil
+	}
+	return nil, ErrMessageNotRatable
+}
+
 // NewModelGORM 从ModelInfo创建GORM模型
 func NewModelGORM(mi *ModelInfo) *ModelGORM {
 	// 将 int 类型的 Type 转换为 string 类型
@@ -164,14 +558,181 @@ func UpdateKnowledgeBaseGORM(gormModel *KnowledgeBaseGORM, req *UpdateKnowledgeB
 }
 
 // NewKnowledgeBaseFileGORM 创建新的知识库文件GORM模型
-func NewKnowledgeBaseFileGORM(knowledgeBaseID int, filename string, size int64) *KnowledgeBaseFileGORM {
+func NewKnowledgeBaseFileGORM(knowledgeBaseID int, filename string, size int64, storagePath string) *KnowledgeBaseFileGORM {
 	return &KnowledgeBaseFileGORM{
 		KnowledgeBaseID: knowledgeBaseID,
 		Name:           filename,
 		Size:           size,
+		StoragePath:    storagePath,
 		Enable:         true,
 		Status:         1, // 完成
 		IndexPercent:    100,
 		ErrorMessage:   "",
 	}
 }
+
+// NewFlowySessionGORM 从会话关联信息和对话设置创建GORM模型
+func NewFlowySessionGORM(sessionID, agentID, settingID int, settings *ConversationSettings) *FlowySessionGORM {
+	data, _ := json.Marshal(settings)
+	return &FlowySessionGORM{
+		SessionID: sessionID,
+		AgentID:   agentID,
+		SettingID: settingID,
+		ModelID:   settings.ModelID,
+		Name:      settings.Name,
+		Desc:      settings.Desc,
+		Settings:  string(data),
+	}
+}
+
+// NewConversationGORM 从对话设置创建GORM模型
+func NewConversationGORM(settings *ConversationSettings) *ConversationGORM {
+	data, _ := json.Marshal(settings)
+	return &ConversationGORM{
+		ModelID:  settings.ModelID,
+		Name:     settings.Name,
+		Desc:     settings.Desc,
+		Settings: string(data),
+	}
+}
+
+// NewAssistantGORM 从设置创建助手GORM模型，agentID 和 settingID 为 Flowy 中对应的 Agent 和配置
+func NewAssistantGORM(settings *ConversationSettings, agentID, settingID int) *AssistantGORM {
+	assistant := &AssistantGORM{
+		FlowyAgentID:   agentID,
+		FlowySettingID: settingID,
+	}
+	UpdateAssistantGORM(assistant, settings)
+	return assistant
+}
+
+// UpdateAssistantGORM 用设置更新助手GORM模型
+func UpdateAssistantGORM(assistant *AssistantGORM, settings *ConversationSettings) {
+	stored := *settings
+	stored.AssistantID = 0
+	data, _ := json.Marshal(&stored)
+	assistant.ModelID = settings.ModelID
+	assistant.Name = settings.Name
+	assistant.Desc = settings.Desc
+	assistant.Settings = string(data)
+}
+
+// ToChatFile 将GORM模型转换为ChatFile
+func (f *ChatFileGORM) ToChatFile() *ChatFile {
+	return &ChatFile{
+		ID:          f.ID,
+		Name:        f.Name,
+		Size:        f.Size,
+		ContentType: f.ContentType,
+	}
+}
+
+// ToMessageFeedback 将GORM模型转换为MessageFeedback
+func (f *MessageFeedbackGORM) ToMessageFeedback() *MessageFeedback {
+	feedback := &MessageFeedback{
+		MessageID:        f.MessageID,
+		ConversationID:   f.ConversationID,
+		Rating:           f.Rating,
+		Comment:          f.Comment,
+		ModelID:          f.ModelID,
+		KnowledgeBaseIDs: []int{},
+		Question:         f.Question,
+		Answer:           f.Answer,
+		UpdatedAt:        f.UpdatedAt,
+	}
+	_ = json.Unmarshal([]byte(f.KnowledgeBaseIDs), &feedback.KnowledgeBaseIDs)
+	return feedback
+}
+
+// ToAssistant 将GORM模型转换为Assistant
+func (a *AssistantGORM) ToAssistant(conversationCount int) *Assistant {
+	return &Assistant{
+		ID:                   int(a.ID),
+		ConversationSettings: *a.settings(),
+		ConversationCount:    conversationCount,
+		CreatedAt:            a.CreatedAt,
+		UpdatedAt:            a.UpdatedAt,
+	}
+}
+
+// ConversationSettings 返回从助手创建的对话的设置，name 为空时使用助手的名称
+func (a *AssistantGORM) ConversationSettings(name, desc string) *ConversationSettings {
+	settings := a.settings()
+	if name != "" {
+		settings.Name = name
+	}
+	settings.Desc = desc
+	settings.AssistantID = int(a.ID)
+	return settings
+}
+
+// UpdateConversationSettings 返回从助手创建的对话以 settings 更新后的设置，name 为空时保留 currentName
+// 只有名称和描述可以修改，其他设置须与助手一致，否则返回 ErrAssistantSettings
+func (a *AssistantGORM) UpdateConversationSettings(currentName string, settings *ConversationSettings) (*ConversationSettings, error) {
+	name := settings.Name
+	if name == "" {
+		name = currentName
+	}
+	updated := a.ConversationSettings(name, settings.Desc)
+	if !sameAssistantSettings(updated, settings) {
+		return nil, fmt.Errorf("%w: 助手ID %d", ErrAssistantSettings, a.ID)
+	}
+	return updated, nil
+}
+
+// sameAssistantSettings 比较名称、描述和所属助手以外的设置，空列表与未设置视为相同
+func sameAssistantSettings(a, b *ConversationSettings) bool {
+	normalize := func(settings *ConversationSettings) string {
+		s := *settings
+		s.Name, s.Desc, s.AssistantID = "", "", 0
+		if len(s.KnowledgeBaseIDs) == 0 {
+			s.KnowledgeBaseIDs = nil
+		}
+		if len(s.PromptVars) == 0 {
+			s.PromptVars = nil
+		}
+		if len(s.Tools) == 0 {
+			s.Tools = nil
+		}
+		data, _ := json.Marshal(&s)
+		return string(data)
+	}
+	return normalize(a) == normalize(b)
+}
+
+// settings 解析助手的设置
+func (a *AssistantGORM) settings() *ConversationSettings {
+	settings := NewDefaultConversationSettings()
+	if a.Settings != "" {
+		_ = json.Unmarshal([]byte(a.Settings), settings)
+	}
+	settings.Name = a.Name
+	settings.Desc = a.Desc
+	settings.ModelID = a.ModelID
+	return settings
+}
+
+// ToPromptTemplate 将GORM模型转换为PromptTemplate
+func (t *PromptTemplateGORM) ToPromptTemplate() *PromptTemplate {
+	return &PromptTemplate{
+		ID:          int(t.ID),
+		Name:        t.Name,
+		Category:    t.Category,
+		Description: t.Description,
+		Content:     t.Content,
+		Variables:   ExtractPromptVars(t.Content),
+		Version:     t.Version,
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+	}
+}
+
+// ToPromptTemplateVersion 将GORM模型转换为PromptTemplateVersion
+func (v *PromptTemplateVersionGORM) ToPromptTemplateVersion() *PromptTemplateVersion {
+	return &PromptTemplateVersion{
+		Version:   v.Version,
+		Content:   v.Content,
+		Variables: ExtractPromptVars(v.Content),
+		CreatedAt: v.CreatedAt,
+	}
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAssistantUpdateConversationSettings(t *testing.T) {
+	assistant := NewAssistantGORM(&ConversationSettings{
+		Name:             "客服助手",
+		ModelID:          2,
+		Temperature:      0.3,
+		TopP:             1,
+		KnowledgeBaseIDs: []int{},
+		SystemPrompt:     "你是客服",
+	}, 0, 0)
+	assistant.ID = 7
+
+	current := assistant.ConversationSettings("售后咨询", "")
+
+	tests := []struct {
+		name     string
+		modify   func(s *ConversationSettings)
+		wantName string
+		wantErr  bool
+	}{
+		{name: "修改名称和描述", modify: func(s *ConversationSettings) { s.Name, s.Desc = "退货咨询", "订单 123" }, wantName: "退货咨询"},
+		{name: "名称为空时保留", modify: func(s *ConversationSettings) { s.Name = "" }, wantName: "售后咨询"},
+		{name: "空列表与未设置相同", modify: func(s *ConversationSettings) { s.KnowledgeBaseIDs, s.AssistantID = nil, 0 }, wantName: "售后咨询"},
+		{name: "修改模型", modify: func(s *ConversationSettings) { s.ModelID = 3 }, wantErr: true},
+		{name: "修改采样参数", modify: func(s *ConversationSettings) { s.Temperature = 0.9 }, wantErr: true},
+		{name: "修改系统提示词", modify: func(s *ConversationSettings) { s.SystemPrompt = "你是翻译" }, wantErr: true},
+		{name: "添加知识库", modify: func(s *ConversationSettings) { s.KnowledgeBaseIDs = []int{1} }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := *current
+			tt.modify(&settings)
+
+			updated, err := assistant.UpdateConversationSettings("售后咨询", &settings)
+			if tt.wantErr {
+				if !errors.Is(err, ErrAssistantSettings) {
+					t.Errorf("UpdateConversationSettings() error = %v, want ErrAssistantSettings", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdateConversationSettings() error = %v", err)
+			}
+			if updated.Name != tt.wantName || updated.Desc != settings.Desc || updated.AssistantID != 7 || updated.ModelID != 2 {
+				t.Errorf("UpdateConversationSettings() = %+v", updated)
+			}
+		})
+	}
+}
+
+func TestNewMessageFeedbackGORM(t *testing.T) {
+	// 对话当前的设置已在回答生成后修改
+	settings := &ConversationSettings{ModelID: 5, KnowledgeBaseIDs: []int{9}}
+	messages := []MessageRecord{
+		{ID: 1, Role: "user", Content: "退货流程"},
+		{ID: 2, Role: "assistant", Content: "请在订单页申请", ModelID: 2, KnowledgeBaseIDs: []int{3, 4}},
+		{ID: 3, Role: "user", Content: "运费谁出"},
+		{ID: 4, Role: "assistant", Content: "由卖家承担"},
+	}
+
+	tests := []struct {
+		name      string
+		messageID int
+		turn      *MessageTurn
+		wantModel int
+		wantKBs   string
+		wantErr   bool
+	}{
+		{name: "使用回答记录的模型和知识库", messageID: 2, turn: &MessageTurn{Index: 0, Start: 0, End: 2}, wantModel: 2, wantKBs: "[3,4]"},
+		{name: "回答未记录时使用对话设置", messageID: 4, turn: &MessageTurn{Index: 1, Start: 2, End: 4}, wantModel: 5, wantKBs: "[9]"},
+		{name: "用户消息不可评价", messageID: 3, turn: &MessageTurn{Index: 1, Start: 2, End: 4}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feedback, err := NewMessageFeedbackGORM(1, settings, messages, tt.turn, tt.messageID, &MessageFeedbackRequest{Rating: FeedbackLike})
+			if tt.wantErr {
+				if !errors.Is(err, ErrMessageNotRatable) {
+					t.Errorf("NewMessageFeedbackGORM() error = %v, want ErrMessageNotRatable", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewMessageFeedbackGORM() error = %v", err)
+			}
+			if feedback.ModelID != tt.wantModel || feedback.KnowledgeBaseIDs != tt.wantKBs {
+				t.Errorf("ModelID = %d, KnowledgeBaseIDs = %s, want %d, %s", feedback.ModelID, feedback.KnowledgeBaseIDs, tt.wantModel, tt.wantKBs)
+			}
+			if feedback.Question != messages[tt.turn.Start].Content {
+				t.Errorf("Question = %q, want %q", feedback.Question, messages[tt.turn.Start].Content)
+			}
+		})
+	}
+}
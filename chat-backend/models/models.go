@@ -1,6 +1,11 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -16,6 +21,9 @@ type ChatRequest struct {
 	// 请求唯一uuid
 	// required: true
 	RequestID string `json:"requestId" example:"uuid-v4-string"`
+	// 附件ID列表（可选），由 POST /chat/files 上传获得，仅作为本轮提问的上下文
+	// required: false
+	Files []string `json:"files,omitempty"`
 }
 
 // ChatMessageRequest 聊天消息请求（用于Swagger文档）
@@ -27,12 +35,33 @@ type ChatMessageRequest struct {
 	// 消息内容
 	// required: true
 	Content string `json:"content" example:"你好"`
-	// 文件列表（可选）
-	// required: true
+	// 附件ID列表（可选），由 POST /chat/files 上传获得
+	// required: false
 	Files []string `json:"files" example:"[]"`
 }
 
+// ChatFile 聊天附件，上传后在发送消息时通过 ChatRequest.Files 引用
+// swagger:model
+type ChatFile struct {
+	// 附件ID
+	// required: true
+	ID string `json:"id"`
+	// 文件名
+	// required: true
+	Name string `json:"name"`
+	// 文件大小（字节）
+	// required: true
+	Size int64 `json:"size"`
+	// 文件类型
+	// required: false
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// ErrChatFileType 附件类型不受支持
+var ErrChatFileType = errors.New("不支持的附件类型")
+
 // SSEChatEvent SSE聊天事件
+// Data 的类型由 Type 决定，见 ChatEvent* 常量；协议说明见 docs/sse_protocol.md
 // swagger:model
 type SSEChatEvent struct {
 	// 事件类型
@@ -41,12 +70,69 @@ type SSEChatEvent struct {
 	// 事件数据
 	// required: true
 	Data interface{} `json:"data"`
-	// 消息ID
+	// 会话ID
 	// required: true
 	ID string `json:"id"`
-	// 错误信息
+	// 事件在本次生成中的序号（来自上游，可能为空）
+	// required: false
+	Index int `json:"index,omitempty"`
+	// 错误信息，仅 resp_error 事件携带
 	// required: false
 	Error string `json:"error,omitempty"`
+	// 结束原因，仅 resp_finish 事件携带: stop/stopped/error
+	// required: false
+	FinishReason string `json:"finish_reason,omitempty"`
+}
+
+// 聊天SSE事件类型及其 Data 类型
+const (
+	ChatEventSplash      = "resp_splash"      // 开始生成，Data 为提示文本
+	ChatEventDelta       = "resp_increment"   // 回答增量，Data 为新增的文本
+	ChatEventReferences  = "resp_references"  // 知识库引用，Data 为 []Reference
+	ChatEventToolCall    = "resp_tool_call"   // 工具调用，Data 为 []ChatToolCall
+	ChatEventUsage       = "resp_usage"       // Token 用量，Data 为 TokenUsage
+	ChatEventSuggestions = "resp_suggestions" // 推荐的后续问题，Data 为 []string
+	ChatEventChart       = "resp_chart"       // 图表及结构化数据，Data 为 ChatChart
+	ChatEventFinish      = "resp_finish"      // 生成结束（最后一个事件），Data 为提示文本
+	ChatEventError       = "resp_error"       // 错误，Error 为错误信息
+)
+
+// 回答的结束原因
+const (
+	FinishReasonStop    = "stop"    // 正常生成完毕
+	FinishReasonStopped = "stopped" // 被停止接口或客户端断开中断，回答不完整
+	FinishReasonError   = "error"   // 生成出错
+)
+
+// ChatToolCall resp_tool_call 事件中的一次工具调用
+// swagger:model
+type ChatToolCall struct {
+	// 工具名称
+	// required: false
+	Name string `json:"name,omitempty"`
+	// 调用参数
+	// required: false
+	Arguments interface{} `json:"arguments,omitempty"`
+	// 调用结果
+	// required: false
+	Result interface{} `json:"result,omitempty"`
+}
+
+// ChatChart resp_chart 事件的数据
+// swagger:model
+type ChatChart struct {
+	// 图表数据
+	// required: false
+	Chart interface{} `json:"chart,omitempty"`
+	// 结构化 JSON 数据
+	// required: false
+	JSON interface{} `json:"json,omitempty"`
+	// 代码数据
+	// required: false
+	Code interface{} `json:"code,omitempty"`
+	// 思维导图数据
+	// required: false
+	MarkMap interface{} `json:"mark_map,omitempty"`
 }
 
 // ChatResponse 聊天响应
@@ -113,6 +199,97 @@ type MessageRecord struct {
 	// 创建时间
 	// required: true
 	CreatedAt time.Time `json:"created_at"`
+	// 引用信息列表（知识库检索结果）
+	// required: false
+	References []Reference `json:"references,omitempty"`
+	// Token 用量
+	// required: false
+	Usage *TokenUsage `json:"usage,omitempty"`
+	// 是否为导入的历史消息（Flowy 中仅保存在本地，ID 为 0）
+	// required: false
+	Imported bool `json:"imported,omitempty"`
+	// 结束原因，回答被中断时为 stopped
+	// required: false
+	FinishReason string `json:"finish_reason,omitempty"`
+	// 所在轮次的版本总数，仅在该轮被重新生成或编辑过时返回，当前消息总是最新版本
+	// required: false
+	Versions int `json:"versions,omitempty"`
+	// 用户评价: 1 赞，-1 踩，未评价时不返回
+	// required: false
+	Rating int `json:"rating,omitempty"`
+	// 用户消息携带的附件ID列表，重新生成或编辑时随新的提问一起发送
+	// required: false
+	Files []string `json:"files,omitempty"`
+	// 生成该消息的请求ID，未记录时为空
+	// required: false
+	RequestID string `json:"request_id,omitempty"`
+	// 生成该回答时使用的模型ID，未记录时为 0
+	// required: false
+	ModelID int `json:"model_id,omitempty"`
+	// 生成该回答时检索的知识库ID列表
+	// required: false
+	KnowledgeBaseIDs []int `json:"knowledge_base_ids,omitempty"`
+}
+
+// TokenUsage Token 用量
+// swagger:model
+type TokenUsage struct {
+	// 提示词 Token 数
+	// required: true
+	PromptTokens int `json:"prompt_tokens"`
+	// 生成 Token 数
+	// required: true
+	CompletionTokens int `json:"completion_tokens"`
+	// 总 Token 数
+	// required: true
+	TotalTokens int `json:"total_tokens"`
+	// 耗时（秒）
+	// required: false
+	Duration int `json:"duration,omitempty"`
+}
+
+// Add 累加 Token 用量
+func (u *TokenUsage) Add(other *TokenUsage) {
+	if other == nil {
+		return
+	}
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+	u.Duration += other.Duration
+}
+
+// 对话导出格式
+const (
+	ExportFormatMarkdown = "md"
+	ExportFormatJSON     = "json"
+	ExportFormatHTML     = "html"
+)
+
+// ErrExportFormat 导出格式不受支持
+var ErrExportFormat = errors.New("不支持的导出格式")
+
+// ErrImportData 导入数据为空、格式无法识别或无法解析
+var ErrImportData = errors.New("导入数据有误")
+
+// ConversationExport 对话导出内容（JSON 格式导出的结构，也是 Markdown/HTML 渲染的数据源）
+// swagger:model
+type ConversationExport struct {
+	// 对话ID
+	// required: true
+	ConversationID int `json:"conversation_id"`
+	// 对话设置
+	// required: true
+	Settings ConversationSettings `json:"settings"`
+	// 消息列表
+	// required: true
+	Messages []MessageRecord `json:"messages"`
+	// 全部消息的 Token 用量合计
+	// required: true
+	Usage TokenUsage `json:"usage"`
+	// 导出时间
+	// required: true
+	ExportedAt time.Time `json:"exported_at"`
 }
 
 // ConversationHistoryResponse 对话历史响应
@@ -129,6 +306,247 @@ type ConversationHistoryResponse struct {
 	Total int `json:"total"`
 }
 
+// 对话导入格式
+const (
+	ImportFormatChatGPT = "chatgpt" // ChatGPT 导出的 conversations.json
+	ImportFormatOpenAI  = "openai"  // OpenAI Chat Completions 的 messages 数组
+)
+
+// ConversationImportRequest 对话导入请求
+// swagger:model
+type ConversationImportRequest struct {
+	// 导入格式: chatgpt/openai，为空时自动识别
+	// required: false
+	Format string `json:"format"`
+	// 导入后对话使用的设置，为空时使用默认设置；导出数据中的标题优先作为对话名称
+	// required: false
+	Settings *ConversationSettings `json:"settings"`
+	// 导出数据：ChatGPT 的 conversations.json（对话数组或单个对话），
+	// 或 OpenAI 的 messages 数组（也可为 {"messages": [...]}）
+	// required: true
+	Data json.RawMessage `json:"data"`
+}
+
+// ImportedConversation 导入的对话
+// swagger:model
+type ImportedConversation struct {
+	Conversation
+	// 导入的消息数量
+	// required: true
+	MessageCount int `json:"message_count"`
+}
+
+// ConversationImportResponse 对话导入响应
+// swagger:model
+type ConversationImportResponse struct {
+	// 导入的对话列表
+	// required: true
+	Conversations []ImportedConversation `json:"conversations"`
+}
+
+// ConversationForkRequest 对话分支请求
+// swagger:model
+type ConversationForkRequest struct {
+	// 分支点消息ID，新对话保留截至该消息（含）的历史
+	// required: true
+	MessageID int `json:"message_id"`
+}
+
+// MessageRegenerateRequest 重新生成回答请求
+// swagger:model
+type MessageRegenerateRequest struct {
+	// 请求唯一uuid
+	// required: false
+	RequestID string `json:"requestId"`
+}
+
+// MessageEditRequest 编辑消息请求
+// swagger:model
+type MessageEditRequest struct {
+	// 新的消息内容
+	// required: true
+	Content string `json:"content"`
+	// 请求唯一uuid
+	// required: false
+	RequestID string `json:"requestId"`
+}
+
+// MessageVersion 对话轮次的一个版本
+// swagger:model
+type MessageVersion struct {
+	// 版本号，从 1 开始
+	// required: true
+	Version int `json:"version"`
+	// 是否为当前显示的版本
+	// required: true
+	Current bool `json:"current"`
+	// 用户消息（历史版本的消息ID为 0）
+	// required: true
+	Question MessageRecord `json:"question"`
+	// 助手回复，生成失败时为空
+	// required: false
+	Answer *MessageRecord `json:"answer,omitempty"`
+}
+
+// MessageAlternatesResponse 对话轮次的全部版本
+// swagger:model
+type MessageAlternatesResponse struct {
+	// 对话ID
+	// required: true
+	ConversationID int `json:"conversation_id"`
+	// 轮次序号，从 0 开始
+	// required: true
+	Turn int `json:"turn"`
+	// 按时间顺序排列的版本，最后一个为当前版本
+	// required: true
+	Versions []MessageVersion `json:"versions"`
+	// 版本总数
+	// required: true
+	Total int `json:"total"`
+}
+
+// 重新生成和编辑消息的错误
+var (
+	ErrMessageNotLatest   = errors.New("只能重新生成或编辑最后一轮对话")
+	ErrMessageNotEditable = errors.New("消息不支持编辑")
+)
+
+// MessageTurn 对话中的一轮：一条用户消息及其后的回复，对应消息列表中的 [Start, End)
+type MessageTurn struct {
+	Index int // 轮次序号，按用户消息计数，从 0 开始
+	Start int
+	End   int
+}
+
+// FindMessageTurn 在消息列表中查找包含指定消息的轮次，导入的历史消息不参与匹配
+func FindMessageTurn(messages []MessageRecord, messageID int) (*MessageTurn, bool) {
+	index, start, found := -1, -1, false
+	for i, message := range messages {
+		if message.Role == "user" {
+			if found {
+				return &MessageTurn{Index: index, Start: start, End: i}, true
+			}
+			index++
+			start = i
+		}
+		if start >= 0 && !message.Imported && message.ID == messageID {
+			found = true
+		}
+	}
+	if found {
+		return &MessageTurn{Index: index, Start: start, End: len(messages)}, true
+	}
+	return nil, false
+}
+
+// NewMessageAlternatesResponse 由一轮对话的历史版本和当前消息生成版本列表
+func NewMessageAlternatesResponse(conversationID int, messages []MessageRecord, turn *MessageTurn, variants []MessageVariantGORM) *MessageAlternatesResponse {
+	response := &MessageAlternatesResponse{
+		ConversationID: conversationID,
+		Turn:           turn.Index,
+		Versions:       make([]MessageVersion, 0, len(variants)+1),
+	}
+	for i := range variants {
+		if variants[i].Turn == turn.Index {
+			response.Versions = append(response.Versions, variants[i].ToMessageVersion(len(response.Versions)+1))
+		}
+	}
+
+	current := MessageVersion{
+		Version:  len(response.Versions) + 1,
+		Current:  true,
+		Question: messages[turn.Start],
+	}
+	if turn.End > turn.Start+1 {
+		answer := messages[turn.End-1]
+		current.Answer = &answer
+	}
+	response.Versions = append(response.Versions, current)
+	response.Total = len(response.Versions)
+	return response
+}
+
+// ApplyMessageVersions 按各轮次的历史版本数为消息标注版本总数
+func ApplyMessageVersions(messages []MessageRecord, variants []MessageVariantGORM) {
+	if len(variants) == 0 {
+		return
+	}
+	archived := make(map[int]int)
+	for i := range variants {
+		archived[variants[i].Turn]++
+	}
+
+	index := -1
+	for i := range messages {
+		if messages[i].Role == "user" {
+			index++
+		}
+		if index >= 0 && archived[index] > 0 {
+			messages[i].Versions = archived[index] + 1
+		}
+	}
+}
+
+// MessageSearchRequest 消息搜索请求
+// swagger:model
+type MessageSearchRequest struct {
+	// 搜索关键字，多个关键字以空格分隔，需全部命中
+	// required: true
+	Query string `json:"q" form:"q"`
+	// 返回数量，默认 20，最大 100
+	// required: false
+	Limit int `json:"limit" form:"limit"`
+}
+
+// Normalize 校验并补全消息搜索请求参数
+func (r *MessageSearchRequest) Normalize() error {
+	r.Query = strings.TrimSpace(r.Query)
+	if r.Query == "" {
+		return fmt.Errorf("搜索关键字不能为空")
+	}
+	if r.Limit <= 0 {
+		r.Limit = 20
+	}
+	if r.Limit > 100 {
+		r.Limit = 100
+	}
+	return nil
+}
+
+// MessageSearchResult 消息搜索结果
+// swagger:model
+type MessageSearchResult struct {
+	// 对话ID
+	// required: true
+	ConversationID int `json:"conversation_id"`
+	// 消息ID
+	// required: true
+	MessageID int `json:"message_id"`
+	// 角色: user/assistant
+	// required: true
+	Role string `json:"role"`
+	// 命中片段，匹配内容以 <mark></mark> 包裹
+	// required: true
+	Snippet string `json:"snippet"`
+	// 消息时间
+	// required: true
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MessageSearchResponse 消息搜索响应
+// swagger:model
+type MessageSearchResponse struct {
+	// 搜索关键字
+	// required: true
+	Query string `json:"query"`
+	// 搜索结果
+	// required: true
+	Results []MessageSearchResult `json:"results"`
+	// 命中总数
+	// required: true
+	Total int `json:"total"`
+}
+
 // Conversation 对话信息
 // swagger:model
 type Conversation struct {
@@ -137,6 +555,12 @@ type Conversation struct {
 	ID int `json:"id"`
 	// 对话设置
 	ConversationSettings `json:"settings"`
+	// 创建时间，从 Flowy 重建索引的对话时间未知，为零值
+	// required: false
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	// 更新时间，时间未知时为零值
+	// required: false
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
 }
 
 // ConversationListRequest 对话列表请求
@@ -148,6 +572,73 @@ type ConversationListRequest struct {
 	// 每页数量
 	// required: true
 	PageSize int `json:"page_size" form:"page_size"`
+	// 标题或描述关键字
+	// required: false
+	Keyword string `json:"keyword" form:"keyword"`
+	// 关联的知识库ID
+	// required: false
+	KnowledgeBaseID int `json:"knowledge_base_id" form:"knowledge_base_id"`
+	// 所属的助手ID
+	// required: false
+	AssistantID int `json:"assistant_id" form:"assistant_id"`
+	// 模型ID
+	// required: false
+	ModelID int `json:"model_id" form:"model_id"`
+	// 创建时间起（RFC3339）
+	// required: false
+	CreatedAfter time.Time `json:"created_after" form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	// 创建时间止（RFC3339）
+	// required: false
+	CreatedBefore time.Time `json:"created_before" form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	// 更新时间起（RFC3339）
+	// required: false
+	UpdatedAfter time.Time `json:"updated_after" form:"updated_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	// 更新时间止（RFC3339）
+	// required: false
+	UpdatedBefore time.Time `json:"updated_before" form:"updated_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	// 排序字段: created_at/updated_at/name，默认 created_at
+	// required: false
+	SortBy string `json:"sort_by" form:"sort_by"`
+	// 排序方向: asc/desc，默认 desc
+	// required: false
+	SortOrder string `json:"sort_order" form:"sort_order"`
+}
+
+// 对话列表排序字段
+const (
+	ConversationSortByCreatedAt = "created_at"
+	ConversationSortByUpdatedAt = "updated_at"
+	ConversationSortByName      = "name"
+)
+
+// Normalize 校验并补全对话列表请求的分页和排序参数
+func (r *ConversationListRequest) Normalize() error {
+	if r.Page <= 0 {
+		r.Page = 1
+	}
+	if r.PageSize <= 0 {
+		r.PageSize = 20
+	}
+	if r.PageSize > 100 {
+		r.PageSize = 100
+	}
+
+	switch r.SortBy {
+	case "":
+		r.SortBy = ConversationSortByCreatedAt
+	case ConversationSortByCreatedAt, ConversationSortByUpdatedAt, ConversationSortByName:
+	default:
+		return fmt.Errorf("不支持的排序字段: %s", r.SortBy)
+	}
+
+	switch r.SortOrder {
+	case "":
+		r.SortOrder = "desc"
+	case "asc", "desc":
+	default:
+		return fmt.Errorf("不支持的排序方向: %s", r.SortOrder)
+	}
+	return nil
 }
 
 // ConversationListResponse 对话列表响应
@@ -219,6 +710,12 @@ type KnowledgeBaseCreateRequest = KnowledgeBaseConfig
 // swagger:model
 type UpdateKnowledgeBaseRequest = KnowledgeBaseConfig
 
+// 知识库文件重建索引的错误
+var (
+	ErrFileReindexing    = errors.New("文件正在重建索引")
+	ErrReindexNotStarted = errors.New("文件索引重建未开始")
+)
+
 // KnowledgeFile 知识库文件
 // swagger:model
 type KnowledgeFile struct {
@@ -254,6 +751,31 @@ type KnowledgeFiles struct {
 	KnowledgeFiles []KnowledgeFile `json:"knowledge_files"`
 }
 
+// ReindexFailure 未能开始重建索引的文件
+// swagger:model
+type ReindexFailure struct {
+	// 文件ID
+	// required: true
+	FileID int `json:"file_id"`
+	// 文件名
+	// required: true
+	Name string `json:"name"`
+	// 失败原因
+	// required: true
+	Error string `json:"error"`
+}
+
+// ReindexKnowledgeBaseResponse 重建知识库索引响应
+// swagger:model
+type ReindexKnowledgeBaseResponse struct {
+	// 知识库中的文件及其当前状态
+	// required: true
+	KnowledgeFiles []KnowledgeFile `json:"knowledge_files"`
+	// 未能开始重建的文件，为空表示全部文件均已开始重建
+	// required: true
+	Failures []ReindexFailure `json:"failures"`
+}
+
 // BatchUploadFilesRequest 批量上传文件请求
 // swagger:model
 type BatchUploadFilesRequest struct {
@@ -299,6 +821,45 @@ type BatchUploadResponse struct {
 	Results []BatchUploadResult `json:"results"`
 }
 
+// 批量上传进度事件类型
+const (
+	UploadEventReceived = "received" // 文件已被服务端接收
+	UploadEventUploaded = "uploaded" // 文件已上传到知识库，开始建立索引
+	UploadEventIndexing = "indexing" // 索引进度更新
+	UploadEventFinished = "finished" // 索引完成
+	UploadEventFailed   = "failed"   // 上传或索引失败
+	UploadEventDone     = "done"     // 整个批次结束，附带汇总结果
+)
+
+// UploadProgressEvent 批量上传进度事件（SSE）
+// swagger:model
+type UploadProgressEvent struct {
+	// 事件类型: received/uploaded/indexing/finished/failed/done
+	// required: true
+	Type string `json:"type"`
+	// 文件在本次上传中的下标
+	// required: true
+	Index int `json:"index"`
+	// 文件名或文件路径
+	// required: false
+	Filename string `json:"filename,omitempty"`
+	// 文件大小（字节）
+	// required: false
+	Size int64 `json:"size,omitempty"`
+	// 知识库文件ID（上传成功后返回）
+	// required: false
+	FileID int `json:"file_id,omitempty"`
+	// 索引进度百分比
+	// required: false
+	IndexPercent int `json:"index_percent,omitempty"`
+	// 错误信息
+	// required: false
+	Error string `json:"error,omitempty"`
+	// 批量上传汇总（仅 done 事件）
+	// required: false
+	Summary *BatchUploadResponse `json:"summary,omitempty"`
+}
+
 // APIResponse 通用API响应（成功和错误都使用这个结构）
 // swagger:model
 type APIResponse struct {
@@ -323,6 +884,8 @@ type APIResponse struct {
 }
 
 // WebSocketMessage WebSocket消息
+// 客户端发送 send/stop/ping，ID 为请求的 RequestID；服务端以聊天事件类型（见 ChatEvent* 常量）推送生成事件，
+// Data 为 SSEChatEvent，ID 为所属请求的 RequestID
 // swagger:model
 type WebSocketMessage struct {
 	// 消息类型
@@ -337,8 +900,20 @@ type WebSocketMessage struct {
 	// 错误信息
 	// required: true
 	Error string `json:"error"`
+	// 生成事件在所属请求中的序号，与SSE的 id 字段相同，可用于 GET /chat/messages/{requestId}/stream 恢复
+	// required: false
+	EventID int64 `json:"event_id,omitempty"`
 }
 
+// WebSocket 消息类型
+const (
+	WebSocketMessageSend  = "send"  // 客户端：发送消息，Data 为 ChatRequest
+	WebSocketMessageStop  = "stop"  // 客户端：停止生成
+	WebSocketMessagePing  = "ping"  // 客户端：心跳
+	WebSocketMessagePong  = "pong"  // 服务端：心跳响应
+	WebSocketMessageError = "error" // 服务端：请求处理失败，Error 为错误信息
+)
+
 // StreamChatResponse 流式聊天响应
 // swagger:model
 type StreamChatResponse struct {
@@ -392,6 +967,78 @@ type ConversationSettings struct {
 	// 上下文限制（消息数量）
 	// required: true
 	ContextLimit int `json:"contextLimit"`
+	// 系统提示词，可通过 {{变量名}} 引用提示词变量，为空时使用默认提示词
+	// required: false
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	// 提示词变量的值，按变量名代入系统提示词
+	// required: false
+	PromptVars map[string]string `json:"prompt_vars,omitempty"`
+	// 引用的提示词模板ID，设置后以模板内容作为系统提示词，变量值取自 prompt_vars
+	// required: false
+	PromptTemplateID int `json:"prompt_template_id,omitempty"`
+	// 引用的模板版本号，0 表示每次保存设置时使用模板的最新版本
+	// required: false
+	PromptTemplateVersion int `json:"prompt_template_version,omitempty"`
+	// 开场白
+	// required: false
+	Prologue *ConversationPrologue `json:"prologue,omitempty"`
+	// 启用的工具：内置工具 data2chart、python、datetime，其他名称为 Flowy 中配置的工具；langchaingo 暂不支持工具
+	// required: false
+	Tools []string `json:"tools,omitempty"`
+	// 对话所属的助手ID，创建对话时指定后除名称和描述外的设置均取自助手，修改助手对之后的提问生效
+	// required: false
+	AssistantID int `json:"assistant_id,omitempty"`
+}
+
+// DefaultSystemPrompt 对话未设置系统提示词时使用的默认提示词
+const DefaultSystemPrompt = "你是一个有帮助的AI助手。"
+
+// ConversationPrologue 对话开场白，在对话开始前展示
+// swagger:model
+type ConversationPrologue struct {
+	// 开场白文本
+	// required: true
+	Text string `json:"text"`
+	// 示例问题
+	// required: false
+	SampleQuestions []string `json:"sample_questions,omitempty"`
+}
+
+// promptVarPattern 提示词中的变量引用，形如 {{name}}，变量名两侧可有空白
+var promptVarPattern = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// RenderPromptVars 将文本中的 {{变量名}} 替换为变量值，未提供值的变量保持原样
+func RenderPromptVars(text string, vars map[string]string) string {
+	if len(vars) == 0 {
+		return text
+	}
+	return promptVarPattern.ReplaceAllStringFunc(text, func(ref string) string {
+		if value, ok := vars[promptVarPattern.FindStringSubmatch(ref)[1]]; ok {
+			return value
+		}
+		return ref
+	})
+}
+
+// ExtractPromptVars 按首次出现的顺序返回文本中引用的变量名
+func ExtractPromptVars(text string) []string {
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, match := range promptVarPattern.FindAllStringSubmatch(text, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// SystemPromptText 返回代入提示词变量后的系统提示词，未设置时返回默认提示词
+func (s *ConversationSettings) SystemPromptText() string {
+	if strings.TrimSpace(s.SystemPrompt) == "" {
+		return DefaultSystemPrompt
+	}
+	return RenderPromptVars(s.SystemPrompt, s.PromptVars)
 }
 
 // NewDefaultConversationSettings 创建默认的对话设置
@@ -602,6 +1249,27 @@ type ConversationHistorySuccessResponse struct {
 	}
 }
 
+// MessageSearchSuccessResponse 消息搜索成功响应
+// swagger:response MessageSearchSuccessResponse
+type MessageSearchSuccessResponse struct {
+	// 消息搜索响应
+	// in: body
+	Body struct {
+		// 请求是否成功
+		// required: true
+		Success bool `json:"success"`
+		// 响应消息
+		// required: true
+		Message string `json:"message"`
+		// 消息搜索数据
+		// required: true
+		Data MessageSearchResponse `json:"data"`
+		// 时间戳
+		// required: true
+		Timestamp string `json:"timestamp"`
+	}
+}
+
 // KnowledgeBaseListSuccessResponse 知识库列表成功响应
 // swagger:response KnowledgeBaseListSuccessResponse
 type KnowledgeBaseListSuccessResponse struct {
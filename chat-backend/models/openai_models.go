@@ -0,0 +1,122 @@
+package models
+
+import "strings"
+
+// OpenAI 兼容接口的请求和响应，字段与 OpenAI Chat Completions API 保持一致
+
+// OpenAI 响应对象类型
+const (
+	OpenAIObjectChatCompletion      = "chat.completion"
+	OpenAIObjectChatCompletionChunk = "chat.completion.chunk"
+	OpenAIObjectModel               = "model"
+	OpenAIObjectList                = "list"
+)
+
+// OpenAIChatMessage OpenAI 消息
+type OpenAIChatMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"` // 字符串，或 [{"type":"text","text":"..."}] 形式的内容数组
+}
+
+// Text 返回消息的文本内容，内容数组中的非文本部分被忽略
+func (m OpenAIChatMessage) Text() string {
+	switch v := m.Content.(type) {
+	case string:
+		return v
+	case []interface{}:
+		var parts []string
+		for _, item := range v {
+			part, ok := item.(map[string]interface{})
+			if !ok || part["type"] != "text" {
+				continue
+			}
+			if text, ok := part["text"].(string); ok && text != "" {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	default:
+		return ""
+	}
+}
+
+// OpenAIChatCompletionRequest OpenAI Chat Completions 请求
+// 除标准字段外，可通过 conversation_id 继续已有对话，或通过 knowledge_base_ids 指定新对话使用的知识库
+type OpenAIChatCompletionRequest struct {
+	Model            string              `json:"model"`                        // 模型，对应 ModelInfo 的 name、symbol 或 id
+	Messages         []OpenAIChatMessage `json:"messages"`                     // 消息列表，最后一条须为用户消息
+	Stream           bool                `json:"stream"`                       // 是否流式输出
+	Temperature      *float64            `json:"temperature,omitempty"`        // 多样性
+	TopP             *float64            `json:"top_p,omitempty"`              // 采样范围
+	PresencePenalty  *float64            `json:"presence_penalty,omitempty"`   // 词汇控制
+	FrequencyPenalty *float64            `json:"frequency_penalty,omitempty"`  // 重复控制
+	User             string              `json:"user,omitempty"`               // 终端用户标识
+	ConversationID   int                 `json:"conversation_id,omitempty"`    // 扩展：继续的对话ID
+	KnowledgeBaseIDs []int               `json:"knowledge_base_ids,omitempty"` // 扩展：新对话使用的知识库ID列表
+}
+
+// OpenAIChatDelta 流式响应中的增量消息
+type OpenAIChatDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// OpenAIChatCompletionChoice 回答选项
+type OpenAIChatCompletionChoice struct {
+	Index        int                `json:"index"`
+	Message      *OpenAIChatMessage `json:"message,omitempty"` // 非流式响应的完整消息
+	Delta        *OpenAIChatDelta   `json:"delta,omitempty"`   // 流式响应的增量消息
+	FinishReason *string            `json:"finish_reason"`     // 结束原因，流式响应中未结束时为 null
+}
+
+// OpenAIUsage Token 用量
+type OpenAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// OpenAIChatCompletionResponse OpenAI Chat Completions 响应，流式响应的每个分片也使用此结构
+type OpenAIChatCompletionResponse struct {
+	ID         string                       `json:"id"`
+	Object     string                       `json:"object"`
+	Created    int64                        `json:"created"`
+	Model      string                       `json:"model"`
+	Choices    []OpenAIChatCompletionChoice `json:"choices"`
+	Usage      *OpenAIUsage                 `json:"usage,omitempty"`
+	References []Reference                  `json:"references,omitempty"` // 扩展：知识库引用
+}
+
+// OpenAIModel OpenAI 模型
+type OpenAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// OpenAIModelList OpenAI 模型列表
+type OpenAIModelList struct {
+	Object string        `json:"object"`
+	Data   []OpenAIModel `json:"data"`
+}
+
+// OpenAIError OpenAI 错误信息
+type OpenAIError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+}
+
+// OpenAIErrorResponse OpenAI 错误响应
+type OpenAIErrorResponse struct {
+	Error OpenAIError `json:"error"`
+}
+
+// OpenAIModelID 返回模型在 OpenAI 兼容接口中的ID，即模型名称（模型符号不保证唯一），名称为空时使用符号
+func (m ModelInfo) OpenAIModelID() string {
+	if m.Name != "" {
+		return m.Name
+	}
+	return m.Symbol
+}
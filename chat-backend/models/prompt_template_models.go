@@ -0,0 +1,166 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrPromptTemplateNameExists 提示词模板名称重复
+var ErrPromptTemplateNameExists = errors.New("提示词模板名称已存在")
+
+// ErrPromptVarsMissing 引用模板时缺少变量的值
+var ErrPromptVarsMissing = errors.New("缺少提示词变量的值")
+
+// PromptTemplateRequest 创建或修改提示词模板请求
+// swagger:model
+type PromptTemplateRequest struct {
+	// 模板名称，不可重复
+	// required: true
+	Name string `json:"name" example:"翻译助手"`
+	// 分类
+	// required: false
+	Category string `json:"category,omitempty" example:"翻译"`
+	// 模板说明
+	// required: false
+	Description string `json:"description,omitempty"`
+	// 模板内容，可通过 {{变量名}} 引用变量；内容变化时生成新版本
+	// required: true
+	Content string `json:"content" example:"你是一名专业译者，请将用户的输入翻译为{{language}}。"`
+}
+
+// Validate 校验并整理模板请求
+func (r *PromptTemplateRequest) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Category = strings.TrimSpace(r.Category)
+	if r.Name == "" {
+		return errors.New("模板名称不能为空")
+	}
+	if strings.TrimSpace(r.Content) == "" {
+		return errors.New("模板内容不能为空")
+	}
+	return nil
+}
+
+// PromptTemplate 提示词模板
+// swagger:model
+type PromptTemplate struct {
+	// 模板ID
+	// required: true
+	ID int `json:"id"`
+	// 模板名称
+	// required: true
+	Name string `json:"name"`
+	// 分类
+	// required: true
+	Category string `json:"category"`
+	// 模板说明
+	// required: true
+	Description string `json:"description"`
+	// 最新版本的内容
+	// required: true
+	Content string `json:"content"`
+	// 内容中引用的变量名，按首次出现的顺序排列
+	// required: true
+	Variables []string `json:"variables"`
+	// 最新版本号，从 1 开始
+	// required: true
+	Version int `json:"version"`
+	// 创建时间
+	// required: true
+	CreatedAt time.Time `json:"created_at"`
+	// 更新时间
+	// required: true
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PromptTemplateListRequest 提示词模板列表请求
+// swagger:model
+type PromptTemplateListRequest struct {
+	// 分类
+	// required: false
+	Category string `json:"category" form:"category"`
+	// 名称或说明关键字
+	// required: false
+	Keyword string `json:"keyword" form:"keyword"`
+}
+
+// PromptTemplateListResponse 提示词模板列表响应
+// swagger:model
+type PromptTemplateListResponse struct {
+	// 模板列表，按名称排列
+	// required: true
+	Templates []PromptTemplate `json:"templates"`
+	// 全部模板的分类，按名称排列
+	// required: true
+	Categories []string `json:"categories"`
+}
+
+// PromptTemplateVersion 提示词模板的历史版本
+// swagger:model
+type PromptTemplateVersion struct {
+	// 版本号
+	// required: true
+	Version int `json:"version"`
+	// 该版本的内容
+	// required: true
+	Content string `json:"content"`
+	// 内容中引用的变量名
+	// required: true
+	Variables []string `json:"variables"`
+	// 创建时间
+	// required: true
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PromptTemplateVersionListResponse 提示词模板历史版本列表响应
+// swagger:model
+type PromptTemplateVersionListResponse struct {
+	// 历史版本，按版本号从新到旧排列
+	// required: true
+	Versions []PromptTemplateVersion `json:"versions"`
+}
+
+// PromptRenderRequest 提示词模板预览请求
+// swagger:model
+type PromptRenderRequest struct {
+	// 变量的值
+	// required: false
+	Variables map[string]string `json:"variables,omitempty"`
+	// 使用的版本号，0 表示最新版本
+	// required: false
+	Version int `json:"version,omitempty"`
+}
+
+// PromptRenderResponse 提示词模板预览结果
+// swagger:model
+type PromptRenderResponse struct {
+	// 使用的版本号
+	// required: true
+	Version int `json:"version"`
+	// 代入变量后的提示词，未提供值的变量保持原样
+	// required: true
+	Prompt string `json:"prompt"`
+	// 模板引用的变量名
+	// required: true
+	Variables []string `json:"variables"`
+	// 未提供值的变量名
+	// required: true
+	Missing []string `json:"missing"`
+}
+
+// RenderPromptTemplate 以给定变量渲染模板内容
+func RenderPromptTemplate(version int, content string, vars map[string]string) *PromptRenderResponse {
+	resp := &PromptRenderResponse{
+		Version:   version,
+		Prompt:    RenderPromptVars(content, vars),
+		Variables: ExtractPromptVars(content),
+		Missing:   []string{},
+	}
+	for _, name := range resp.Variables {
+		if _, ok := vars[name]; !ok {
+			resp.Missing = append(resp.Missing, name)
+		}
+	}
+	return resp
+}
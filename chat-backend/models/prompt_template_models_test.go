@@ -0,0 +1,70 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenderPromptTemplate(t *testing.T) {
+	const content = "你是{{ company }}的{{role}}，用{{language}}回答。{{company}}的客户优先。"
+
+	tests := []struct {
+		name        string
+		vars        map[string]string
+		wantPrompt  string
+		wantMissing []string
+	}{
+		{
+			name:        "提供全部变量",
+			vars:        map[string]string{"company": "示例公司", "role": "客服", "language": "中文"},
+			wantPrompt:  "你是示例公司的客服，用中文回答。示例公司的客户优先。",
+			wantMissing: []string{},
+		},
+		{
+			name:        "缺少变量时保持原样",
+			vars:        map[string]string{"role": "客服"},
+			wantPrompt:  "你是{{ company }}的客服，用{{language}}回答。{{company}}的客户优先。",
+			wantMissing: []string{"company", "language"},
+		},
+		{
+			name:        "空值视为已提供",
+			vars:        map[string]string{"company": "", "role": "", "language": "", "unused": "忽略"},
+			wantPrompt:  "你是的，用回答。的客户优先。",
+			wantMissing: []string{},
+		},
+		{
+			name:        "未提供变量",
+			wantPrompt:  content,
+			wantMissing: []string{"company", "role", "language"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := RenderPromptTemplate(3, content, tt.vars)
+			if resp.Version != 3 {
+				t.Errorf("Version = %d, want 3", resp.Version)
+			}
+			if resp.Prompt != tt.wantPrompt {
+				t.Errorf("Prompt = %q, want %q", resp.Prompt, tt.wantPrompt)
+			}
+			if want := []string{"company", "role", "language"}; !reflect.DeepEqual(resp.Variables, want) {
+				t.Errorf("Variables = %v, want %v", resp.Variables, want)
+			}
+			if !reflect.DeepEqual(resp.Missing, tt.wantMissing) {
+				t.Errorf("Missing = %v, want %v", resp.Missing, tt.wantMissing)
+			}
+		})
+	}
+}
+
+// TestRenderPromptTemplateWithoutVariables 不含变量的模板返回空数组
+func TestRenderPromptTemplateWithoutVariables(t *testing.T) {
+	resp := RenderPromptTemplate(1, "请简洁地回答 {单层花括号} 不是变量", map[string]string{"x": "1"})
+
+	if resp.Prompt != "请简洁地回答 {单层花括号} 不是变量" {
+		t.Errorf("Prompt = %q, want 原文", resp.Prompt)
+	}
+	if resp.Variables == nil || len(resp.Variables) != 0 || resp.Missing == nil || len(resp.Missing) != 0 {
+		t.Errorf("Variables = %v, Missing = %v, want 空数组", resp.Variables, resp.Missing)
+	}
+}
@@ -2,18 +2,27 @@ package database
 
 import (
 	"fmt"
+	"strings"
 	"time"
+	"unicode"
 
 	"chat-backend/models"
 	"chat-backend/utils"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrNotFound 记录不存在
+var ErrNotFound = gorm.ErrRecordNotFound
+
 // Database 数据库封装结构
 type Database struct {
 	db *gorm.DB
+
+	// ftsEnabled 消息全文索引（FTS5）是否可用，不可用时搜索退化为 LIKE 匹配
+	ftsEnabled bool
 }
 
 // NewDatabase 创建新的数据库连接
@@ -41,6 +50,11 @@ func NewDatabase(dbPath string) (*Database, error) {
 		return nil, fmt.Errorf("自动迁移失败: %w", err)
 	}
 
+	// 初始化消息全文索引
+	if err := database.initMessageSearch(); err != nil {
+		utils.WarnWith("消息全文索引不可用，搜索将使用 LIKE 匹配（编译时需添加 -tags sqlite_fts5）", "error", err.Error())
+	}
+
 	// 初始化默认数据
 	if err := database.initDefaultData(); err != nil {
 		utils.WarnWith("初始化默认数据失败", "error", err.Error())
@@ -56,9 +70,65 @@ func (d *Database) AutoMigrate() error {
 		&models.ModelGORM{},
 		&models.KnowledgeBaseGORM{},
 		&models.KnowledgeBaseFileGORM{},
+		&models.FlowySessionGORM{},
+		&models.FlowySessionSegmentGORM{},
+		&models.FlowyKnowledgeFileGORM{},
+		&models.ConversationGORM{},
+		&models.MessageGORM{},
+		&models.FlowyHistoryOverlayGORM{},
+		&models.MessageVariantGORM{},
+		&models.ChatFileGORM{},
+		&models.MessageFeedbackGORM{},
+		&models.OpenAIConversationGORM{},
+		&models.PromptTemplateGORM{},
+		&models.PromptTemplateVersionGORM{},
+		&models.AssistantGORM{},
+		&models.MetadataGORM{},
 	)
 }
 
+// initMessageSearch 创建消息表的 FTS5 全文索引及同步触发器
+// 使用 trigram 分词器，使中文等无空格分词的文本也能按子串检索
+func (d *Database) initMessageSearch() error {
+	// 触发器不存在说明索引未与消息表同步（首次创建或此前 FTS5 不可用），需要重建
+	var synced int64
+	if err := d.db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'messages_fts_insert'").Scan(&synced).Error; err != nil {
+		return fmt.Errorf("查询全文索引失败: %w", err)
+	}
+
+	statements := []string{
+		"CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(content, content='messages', content_rowid='id', tokenize='trigram')",
+		// 索引表已存在时 CREATE 不会检查 FTS5 模块，查询一次以确认其可用
+		"SELECT rowid FROM messages_fts LIMIT 0",
+		`CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+			INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+			INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE ON messages BEGIN
+			INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+			INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+		END`,
+	}
+	if synced == 0 {
+		statements = append(statements, "INSERT INTO messages_fts(messages_fts) VALUES ('rebuild')")
+	}
+
+	for _, stmt := range statements {
+		if err := d.db.Exec(stmt).Error; err != nil {
+			// 移除触发器，避免 FTS5 不可用时写入消息失败
+			for _, trigger := range []string{"messages_fts_insert", "messages_fts_delete", "messages_fts_update"} {
+				d.db.Exec("DROP TRIGGER IF EXISTS " + trigger)
+			}
+			return fmt.Errorf("创建全文索引失败: %w", err)
+		}
+	}
+
+	d.ftsEnabled = true
+	return nil
+}
+
 // GetDB 获取GORM数据库实例
 func (d *Database) GetDB() *gorm.DB {
 	return d.db
@@ -426,8 +496,8 @@ func (d *Database) DeleteKnowledgeBase(id int) error {
 // === 知识库文件相关操作 ===
 
 // CreateKnowledgeBaseFile 创建知识库文件
-func (d *Database) CreateKnowledgeBaseFile(knowledgeBaseID int, filename string, size int64) (*models.KnowledgeFile, error) {
-	gormFile := models.NewKnowledgeBaseFileGORM(knowledgeBaseID, filename, size)
+func (d *Database) CreateKnowledgeBaseFile(knowledgeBaseID int, filename string, size int64, storagePath string) (*models.KnowledgeFile, error) {
+	gormFile := models.NewKnowledgeBaseFileGORM(knowledgeBaseID, filename, size, storagePath)
 	if err := d.db.Create(gormFile).Error; err != nil {
 		return nil, fmt.Errorf("创建知识库文件失败: %w", err)
 	}
@@ -450,6 +520,47 @@ func (d *Database) GetKnowledgeBaseFiles(knowledgeBaseID int) ([]models.Knowledg
 	return knowledgeFiles, nil
 }
 
+// GetKnowledgeBaseFileByID 根据ID获取知识库文件记录（包含原件存储路径）
+func (d *Database) GetKnowledgeBaseFileByID(fileID int) (*models.KnowledgeBaseFileGORM, error) {
+	var gormFile models.KnowledgeBaseFileGORM
+	if err := d.db.First(&gormFile, fileID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("文件ID %d 不存在: %w", fileID, ErrNotFound)
+		}
+		return nil, fmt.Errorf("查询文件失败: %w", err)
+	}
+
+	return &gormFile, nil
+}
+
+// GetKnowledgeBaseFileRecords 获取知识库的所有文件记录（包含原件存储路径）
+func (d *Database) GetKnowledgeBaseFileRecords(knowledgeBaseID int) ([]models.KnowledgeBaseFileGORM, error) {
+	var gormFiles []models.KnowledgeBaseFileGORM
+	if err := d.db.Where("knowledge_base_id = ?", knowledgeBaseID).Order("uploaded_at DESC").Find(&gormFiles).Error; err != nil {
+		return nil, fmt.Errorf("查询知识库文件列表失败: %w", err)
+	}
+
+	return gormFiles, nil
+}
+
+// UpdateKnowledgeBaseFileStatus 更新文件索引状态和进度
+func (d *Database) UpdateKnowledgeBaseFileStatus(fileID int, status int, indexPercent int, errorMessage string) error {
+	result := d.db.Model(&models.KnowledgeBaseFileGORM{}).Where("id = ?", fileID).Updates(map[string]interface{}{
+		"status":        status,
+		"index_percent": indexPercent,
+		"error_message": errorMessage,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("更新文件索引状态失败: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("文件ID %d 不存在", fileID)
+	}
+
+	return nil
+}
+
 // DeleteKnowledgeBaseFile 删除知识库文件
 func (d *Database) DeleteKnowledgeBaseFile(fileID int) error {
 	// 使用事务删除
@@ -491,3 +602,1224 @@ func (d *Database) ToggleKnowledgeBaseFileEnable(fileID int, enable bool) error
 
 	return nil
 }
+
+// === 元数据相关操作 ===
+
+// GetMetadata 获取元数据的值，不存在时返回 ErrNotFound
+func (d *Database) GetMetadata(key string) (string, error) {
+	var metadata models.MetadataGORM
+	if err := d.db.Where("`key` = ?", key).First(&metadata).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return "", fmt.Errorf("元数据 %s 不存在: %w", key, ErrNotFound)
+		}
+		return "", fmt.Errorf("查询元数据失败: %w", err)
+	}
+	return metadata.Value, nil
+}
+
+// SetMetadata 保存元数据，已存在时覆盖
+func (d *Database) SetMetadata(key, value string) error {
+	err := d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&models.MetadataGORM{Key: key, Value: value}).Error
+	if err != nil {
+		return fmt.Errorf("保存元数据失败: %w", err)
+	}
+	return nil
+}
+
+// === Flowy 会话索引相关操作 ===
+
+// pruneBatchSize 批量删除会话索引时每条语句包含的会话数，避免超出 SQLite 的参数数量限制
+const pruneBatchSize = 500
+
+// SaveFlowySession 保存会话索引，已存在时覆盖
+func (d *Database) SaveFlowySession(session *models.FlowySessionGORM) error {
+	err := d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "session_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"agent_id", "setting_id", "model_id", "name", "desc", "settings", "updated_at", "deleted_at"}),
+	}).Create(session).Error
+	if err != nil {
+		return fmt.Errorf("保存会话索引失败: %w", err)
+	}
+	return nil
+}
+
+// SaveRebuiltFlowySession 保存从 Flowy 重建的会话索引，已存在的索引保持不变
+// Flowy 不提供会话时间，新增的索引记录标记为创建、更新时间未知
+func (d *Database) SaveRebuiltFlowySession(session *models.FlowySessionGORM) error {
+	session.CreatedAtUnknown = true
+	session.UpdatedAtUnknown = true
+	err := d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "session_id"}},
+		DoNothing: true,
+	}).Create(session).Error
+	if err != nil {
+		return fmt.Errorf("保存会话索引失败: %w", err)
+	}
+	return nil
+}
+
+// PruneFlowySessions 删除 before 之前写入且不在 existing 中的会话索引，以及这些会话的后续会话、记录镜像、历史覆盖层和历史版本
+// existing 为 Flowy 中现存的全部会话ID，返回删除的会话数
+func (d *Database) PruneFlowySessions(existing map[int]bool, before time.Time) (int, error) {
+	var sessionIDs []int
+	// 同时按更新时间判断，避免误删遍历期间新建或更新的会话
+	if err := d.db.Model(&models.FlowySessionGORM{}).Where("created_at < ? AND updated_at < ?", before, before).Pluck("session_id", &sessionIDs).Error; err != nil {
+		return 0, fmt.Errorf("查询会话索引失败: %w", err)
+	}
+
+	stale := make([]int, 0)
+	for _, sessionID := range sessionIDs {
+		if !existing[sessionID] {
+			stale = append(stale, sessionID)
+		}
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(stale); start += pruneBatchSize {
+			end := start + pruneBatchSize
+			if end > len(stale) {
+				end = len(stale)
+			}
+			batch := stale[start:end]
+			if err := tx.Unscoped().Where("session_id IN ?", batch).Delete(&models.FlowySessionGORM{}).Error; err != nil {
+				return fmt.Errorf("删除会话索引失败: %w", err)
+			}
+			if err := tx.Where("conversation_id IN ?", batch).Delete(&models.FlowySessionSegmentGORM{}).Error; err != nil {
+				return fmt.Errorf("删除后续会话失败: %w", err)
+			}
+			if err := tx.Where("conversation_id IN ?", batch).Delete(&models.MessageGORM{}).Error; err != nil {
+				return fmt.Errorf("删除会话记录镜像失败: %w", err)
+			}
+			if err := tx.Where("session_id IN ?", batch).Delete(&models.FlowyHistoryOverlayGORM{}).Error; err != nil {
+				return fmt.Errorf("删除历史覆盖层失败: %w", err)
+			}
+			if err := tx.Where("conversation_id IN ?", batch).Delete(&models.MessageVariantGORM{}).Error; err != nil {
+				return fmt.Errorf("删除消息历史版本失败: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(stale), nil
+}
+
+// GetFlowySession 根据会话ID获取会话索引，不存在时返回 ErrNotFound
+func (d *Database) GetFlowySession(sessionID int) (*models.FlowySessionGORM, error) {
+	var session models.FlowySessionGORM
+	if err := d.db.Where("session_id = ?", sessionID).First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("会话 %d 不存在: %w", sessionID, ErrNotFound)
+		}
+		return nil, fmt.Errorf("查询会话索引失败: %w", err)
+	}
+	return &session, nil
+}
+
+// ListFlowySessions 按过滤条件分页获取会话索引，同时返回总数
+func (d *Database) ListFlowySessions(req *models.ConversationListRequest) ([]models.FlowySessionGORM, int64, error) {
+	query := filterConversations(d.db.Model(&models.FlowySessionGORM{}), "flowy_sessions", req)
+	// 时间未知的会话不参与对应的时间过滤，按时间排序时排在最后
+	if !req.CreatedAfter.IsZero() || !req.CreatedBefore.IsZero() {
+		query = query.Where("created_at_unknown = ?", false)
+	}
+	if !req.UpdatedAfter.IsZero() || !req.UpdatedBefore.IsZero() {
+		query = query.Where("updated_at_unknown = ?", false)
+	}
+	query = query.Session(&gorm.Session{})
+	page := query
+	switch req.SortBy {
+	case models.ConversationSortByCreatedAt:
+		page = query.Order("created_at_unknown")
+	case models.ConversationSortByUpdatedAt:
+		page = query.Order("updated_at_unknown")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询会话数量失败: %w", err)
+	}
+
+	var sessions []models.FlowySessionGORM
+	if err := pageConversations(page, "session_id", req).Find(&sessions).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询会话索引失败: %w", err)
+	}
+	return sessions, total, nil
+}
+
+// MarkFlowySessionSynced 记录会话记录的镜像时间，有新消息时同时刷新会话更新时间
+// 更新时间未知的会话首次镜像得到的是已有记录，不刷新更新时间
+func (d *Database) MarkFlowySessionSynced(sessionID int, hasNewMessages bool) error {
+	now := time.Now()
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if hasNewMessages {
+			err := tx.Model(&models.FlowySessionGORM{}).
+				Where("session_id = ? AND (updated_at_unknown = ? OR messages_synced_at IS NOT NULL)", sessionID, false).
+				UpdateColumns(map[string]interface{}{"updated_at": now, "updated_at_unknown": false}).Error
+			if err != nil {
+				return fmt.Errorf("更新会话更新时间失败: %w", err)
+			}
+		}
+		if err := tx.Model(&models.FlowySessionGORM{}).Where("session_id = ?", sessionID).UpdateColumn("messages_synced_at", now).Error; err != nil {
+			return fmt.Errorf("更新会话镜像时间失败: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListUnsyncedFlowySessionIDs 获取尚未镜像会话记录的会话ID，最多返回 limit 个
+func (d *Database) ListUnsyncedFlowySessionIDs(limit int) ([]int, error) {
+	var sessionIDs []int
+	if err := d.db.Model(&models.FlowySessionGORM{}).Where("messages_synced_at IS NULL").Order("updated_at DESC").Limit(limit).Pluck("session_id", &sessionIDs).Error; err != nil {
+		return nil, fmt.Errorf("查询会话索引失败: %w", err)
+	}
+	return sessionIDs, nil
+}
+
+// DeleteFlowySession 删除会话索引
+func (d *Database) DeleteFlowySession(sessionID int) error {
+	if err := d.db.Unscoped().Where("session_id = ?", sessionID).Delete(&models.FlowySessionGORM{}).Error; err != nil {
+		return fmt.Errorf("删除会话索引失败: %w", err)
+	}
+	return nil
+}
+
+// SaveFlowySessionSegment 保存对话的后续会话
+func (d *Database) SaveFlowySessionSegment(segment *models.FlowySessionSegmentGORM) error {
+	if err := d.db.Create(segment).Error; err != nil {
+		return fmt.Errorf("保存后续会话失败: %w", err)
+	}
+	return nil
+}
+
+// ListFlowySessionSegments 按创建顺序获取对话的全部后续会话
+func (d *Database) ListFlowySessionSegments(conversationID int) ([]models.FlowySessionSegmentGORM, error) {
+	var segments []models.FlowySessionSegmentGORM
+	if err := d.db.Where("conversation_id = ?", conversationID).Order("created_at, session_id").Find(&segments).Error; err != nil {
+		return nil, fmt.Errorf("查询后续会话失败: %w", err)
+	}
+	return segments, nil
+}
+
+// ListFlowySessionSegmentIDs 获取全部后续会话的会话ID
+func (d *Database) ListFlowySessionSegmentIDs() ([]int, error) {
+	var sessionIDs []int
+	if err := d.db.Model(&models.FlowySessionSegmentGORM{}).Pluck("session_id", &sessionIDs).Error; err != nil {
+		return nil, fmt.Errorf("查询后续会话失败: %w", err)
+	}
+	return sessionIDs, nil
+}
+
+// MarkFlowySessionSegmentSeeded 记录后续会话的第一条提问已带上保留的历史发送
+func (d *Database) MarkFlowySessionSegmentSeeded(sessionID int) error {
+	if err := d.db.Model(&models.FlowySessionSegmentGORM{}).Where("session_id = ?", sessionID).UpdateColumn("seeded", true).Error; err != nil {
+		return fmt.Errorf("更新后续会话失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteFlowySessionSegment 删除后续会话
+func (d *Database) DeleteFlowySessionSegment(sessionID int) error {
+	if err := d.db.Where("session_id = ?", sessionID).Delete(&models.FlowySessionSegmentGORM{}).Error; err != nil {
+		return fmt.Errorf("删除后续会话失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteFlowySessionSegments 删除对话的全部后续会话
+func (d *Database) DeleteFlowySessionSegments(conversationID int) error {
+	if err := d.db.Where("conversation_id = ?", conversationID).Delete(&models.FlowySessionSegmentGORM{}).Error; err != nil {
+		return fmt.Errorf("删除后续会话失败: %w", err)
+	}
+	return nil
+}
+
+// === Flowy 知识库文件索引相关操作 ===
+
+// ReplaceFlowyKnowledgeFiles 以知识库当前的文件列表替换其文件索引
+func (d *Database) ReplaceFlowyKnowledgeFiles(knowledgeBaseID int, fileIDs []int) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("knowledge_base_id = ?", knowledgeBaseID).Delete(&models.FlowyKnowledgeFileGORM{}).Error; err != nil {
+			return fmt.Errorf("删除知识库文件索引失败: %w", err)
+		}
+		if len(fileIDs) == 0 {
+			return nil
+		}
+		files := make([]models.FlowyKnowledgeFileGORM, 0, len(fileIDs))
+		for _, fileID := range fileIDs {
+			files = append(files, models.FlowyKnowledgeFileGORM{FileID: fileID, KnowledgeBaseID: knowledgeBaseID})
+		}
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "file_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"knowledge_base_id", "updated_at"}),
+		}).CreateInBatches(files, pruneBatchSize).Error
+		if err != nil {
+			return fmt.Errorf("保存知识库文件索引失败: %w", err)
+		}
+		return nil
+	})
+}
+
+// SaveFlowyKnowledgeFile 记录文件所属的知识库
+func (d *Database) SaveFlowyKnowledgeFile(knowledgeBaseID, fileID int) error {
+	err := d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"knowledge_base_id", "updated_at"}),
+	}).Create(&models.FlowyKnowledgeFileGORM{FileID: fileID, KnowledgeBaseID: knowledgeBaseID}).Error
+	if err != nil {
+		return fmt.Errorf("保存知识库文件索引失败: %w", err)
+	}
+	return nil
+}
+
+// GetFlowyFileKnowledgeBaseID 获取文件所属的知识库ID，未记录时返回 ErrNotFound
+func (d *Database) GetFlowyFileKnowledgeBaseID(fileID int) (int, error) {
+	var file models.FlowyKnowledgeFileGORM
+	if err := d.db.Where("file_id = ?", fileID).First(&file).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return 0, fmt.Errorf("文件ID %d 不存在: %w", fileID, ErrNotFound)
+		}
+		return 0, fmt.Errorf("查询知识库文件索引失败: %w", err)
+	}
+	return file.KnowledgeBaseID, nil
+}
+
+// DeleteFlowyKnowledgeFile 删除文件的知识库索引
+func (d *Database) DeleteFlowyKnowledgeFile(fileID int) error {
+	if err := d.db.Where("file_id = ?", fileID).Delete(&models.FlowyKnowledgeFileGORM{}).Error; err != nil {
+		return fmt.Errorf("删除知识库文件索引失败: %w", err)
+	}
+	return nil
+}
+
+// === Flowy 历史覆盖层相关操作 ===
+
+// SaveFlowyHistoryOverlay 按顺序保存会话的本地历史消息，保留消息原有的创建时间
+func (d *Database) SaveFlowyHistoryOverlay(sessionID int, records []models.MessageRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	overlays := make([]models.FlowyHistoryOverlayGORM, 0, len(records))
+	for _, record := range records {
+		overlays = append(overlays, models.FlowyHistoryOverlayGORM{
+			SessionID: sessionID,
+			Role:      record.Role,
+			Content:   record.Content,
+			CreatedAt: record.CreatedAt,
+		})
+	}
+	if err := d.db.Create(&overlays).Error; err != nil {
+		return fmt.Errorf("保存历史覆盖层失败: %w", err)
+	}
+	return nil
+}
+
+// ListFlowyHistoryOverlay 按顺序获取会话的本地历史消息
+func (d *Database) ListFlowyHistoryOverlay(sessionID int) ([]models.MessageRecord, error) {
+	var overlays []models.FlowyHistoryOverlayGORM
+	if err := d.db.Where("session_id = ?", sessionID).Order("id").Find(&overlays).Error; err != nil {
+		return nil, fmt.Errorf("查询历史覆盖层失败: %w", err)
+	}
+
+	messages := make([]models.MessageRecord, 0, len(overlays))
+	for i := range overlays {
+		messages = append(messages, *overlays[i].ToMessageRecord())
+	}
+	return messages, nil
+}
+
+// DeleteFlowyHistoryOverlay 删除会话的本地历史消息
+func (d *Database) DeleteFlowyHistoryOverlay(sessionID int) error {
+	if err := d.db.Where("session_id = ?", sessionID).Delete(&models.FlowyHistoryOverlayGORM{}).Error; err != nil {
+		return fmt.Errorf("删除历史覆盖层失败: %w", err)
+	}
+	return nil
+}
+
+// === 消息历史版本相关操作 ===
+
+// SaveMessageVariant 保存对话轮次的历史版本
+func (d *Database) SaveMessageVariant(variant *models.MessageVariantGORM) error {
+	if err := d.db.Create(variant).Error; err != nil {
+		return fmt.Errorf("保存消息历史版本失败: %w", err)
+	}
+	return nil
+}
+
+// ListMessageVariants 按归档顺序获取对话的全部历史版本
+func (d *Database) ListMessageVariants(conversationID int) ([]models.MessageVariantGORM, error) {
+	var variants []models.MessageVariantGORM
+	if err := d.db.Where("conversation_id = ?", conversationID).Order("id").Find(&variants).Error; err != nil {
+		return nil, fmt.Errorf("查询消息历史版本失败: %w", err)
+	}
+	return variants, nil
+}
+
+// DeleteMessageVariants 删除对话的全部历史版本
+func (d *Database) DeleteMessageVariants(conversationID int) error {
+	if err := d.db.Where("conversation_id = ?", conversationID).Delete(&models.MessageVariantGORM{}).Error; err != nil {
+		return fmt.Errorf("删除消息历史版本失败: %w", err)
+	}
+	return nil
+}
+
+// === 聊天附件相关操作 ===
+
+// SaveChatFile 保存聊天附件
+func (d *Database) SaveChatFile(file *models.ChatFileGORM) error {
+	if err := d.db.Create(file).Error; err != nil {
+		return fmt.Errorf("保存聊天附件失败: %w", err)
+	}
+	return nil
+}
+
+// GetChatFiles 按给定顺序获取聊天附件，任一附件不存在时返回 ErrNotFound
+func (d *Database) GetChatFiles(ids []string) ([]models.ChatFileGORM, error) {
+	var files []models.ChatFileGORM
+	if err := d.db.Where("id IN ?", ids).Find(&files).Error; err != nil {
+		return nil, fmt.Errorf("查询聊天附件失败: %w", err)
+	}
+
+	byID := make(map[string]models.ChatFileGORM, len(files))
+	for _, file := range files {
+		byID[file.ID] = file
+	}
+	result := make([]models.ChatFileGORM, 0, len(ids))
+	for _, id := range ids {
+		file, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("附件 %s 不存在: %w", id, ErrNotFound)
+		}
+		result = append(result, file)
+	}
+	return result, nil
+}
+
+// DeleteConversationChatFiles 删除对话消息携带的聊天附件，返回删除的数量
+// 分支对话复制了原对话的消息，仍被其他对话的消息引用的附件保留；须在删除对话消息之前调用
+func (d *Database) DeleteConversationChatFiles(conversationID int) (int64, error) {
+	var messages []models.MessageGORM
+	if err := d.db.Select("files").Where("conversation_id = ? AND files <> ''", conversationID).Find(&messages).Error; err != nil {
+		return 0, fmt.Errorf("查询消息附件失败: %w", err)
+	}
+
+	var deleted int64
+	seen := make(map[string]bool)
+	for i := range messages {
+		for _, id := range messages[i].ToMessageRecord().Files {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			var refs int64
+			if err := d.db.Model(&models.MessageGORM{}).Where("conversation_id <> ? AND files LIKE ?", conversationID, "%\""+id+"\"%").Count(&refs).Error; err != nil {
+				return deleted, fmt.Errorf("查询消息附件失败: %w", err)
+			}
+			if refs > 0 {
+				continue
+			}
+			result := d.db.Where("id = ?", id).Delete(&models.ChatFileGORM{})
+			if result.Error != nil {
+				return deleted, fmt.Errorf("删除聊天附件失败: %w", result.Error)
+			}
+			deleted += result.RowsAffected
+		}
+	}
+	return deleted, nil
+}
+
+// === OpenAI 兼容接口相关操作 ===
+
+// SaveOpenAIConversation 登记摘要对应的对话，已登记时覆盖
+func (d *Database) SaveOpenAIConversation(key string, conversationID int, expiresAt time.Time) error {
+	err := d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"conversation_id", "expires_at"}),
+	}).Create(&models.OpenAIConversationGORM{Key: key, ConversationID: conversationID, ExpiresAt: expiresAt}).Error
+	if err != nil {
+		return fmt.Errorf("登记对话失败: %w", err)
+	}
+	return nil
+}
+
+// TakeOpenAIConversation 取出摘要对应的对话并删除登记，未登记或已过期时返回 ErrNotFound
+func (d *Database) TakeOpenAIConversation(key string, now time.Time) (int, error) {
+	var entry models.OpenAIConversationGORM
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("key = ?", key).First(&entry).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&entry).Error
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return 0, fmt.Errorf("摘要未登记对话: %w", ErrNotFound)
+		}
+		return 0, fmt.Errorf("查询登记的对话失败: %w", err)
+	}
+	if now.After(entry.ExpiresAt) {
+		return 0, fmt.Errorf("登记的对话已过期: %w", ErrNotFound)
+	}
+	return entry.ConversationID, nil
+}
+
+// PruneOpenAIConversations 删除已过期的登记，返回删除的数量
+func (d *Database) PruneOpenAIConversations(now time.Time) (int64, error) {
+	result := d.db.Where("expires_at < ?", now).Delete(&models.OpenAIConversationGORM{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("清理过期的登记失败: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// === 消息评价相关操作 ===
+
+// SaveMessageFeedback 保存回答的评价，已有评价时覆盖
+func (d *Database) SaveMessageFeedback(feedback *models.MessageFeedbackGORM) error {
+	err := d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"conversation_id", "rating", "comment", "model_id", "knowledge_base_ids", "question", "answer", "updated_at"}),
+	}).Create(feedback).Error
+	if err != nil {
+		return fmt.Errorf("保存消息评价失败: %w", err)
+	}
+	return nil
+}
+
+// ListConversationFeedback 获取对话中全部回答的评价
+func (d *Database) ListConversationFeedback(conversationID int) ([]models.MessageFeedbackGORM, error) {
+	var feedback []models.MessageFeedbackGORM
+	if err := d.db.Where("conversation_id = ?", conversationID).Find(&feedback).Error; err != nil {
+		return nil, fmt.Errorf("查询消息评价失败: %w", err)
+	}
+	return feedback, nil
+}
+
+// ListMessageFeedback 按评价时间从新到旧获取时间范围内的评价，可按模型过滤
+func (d *Database) ListMessageFeedback(since, until time.Time, modelID int) ([]models.MessageFeedbackGORM, error) {
+	query := d.db.Where("updated_at >= ? AND updated_at <= ?", since, until)
+	if modelID > 0 {
+		query = query.Where("model_id = ?", modelID)
+	}
+
+	var feedback []models.MessageFeedbackGORM
+	if err := query.Order("updated_at DESC").Find(&feedback).Error; err != nil {
+		return nil, fmt.Errorf("查询消息评价失败: %w", err)
+	}
+	return feedback, nil
+}
+
+// === 助手相关操作 ===
+
+// assistantConversationCondition 对话类表中属于指定助手的对话，助手ID保存在设置快照的 JSON 中
+const assistantConversationCondition = "json_extract(settings, '$.assistant_id') = ?"
+
+// CreateAssistant 创建助手
+func (d *Database) CreateAssistant(settings *models.ConversationSettings, agentID, settingID int) (*models.AssistantGORM, error) {
+	assistant := models.NewAssistantGORM(settings, agentID, settingID)
+	if err := d.db.Create(assistant).Error; err != nil {
+		return nil, fmt.Errorf("创建助手失败: %w", err)
+	}
+	return assistant, nil
+}
+
+// GetAssistant 根据ID获取助手，不存在时返回 ErrNotFound
+func (d *Database) GetAssistant(id int) (*models.AssistantGORM, error) {
+	var assistant models.AssistantGORM
+	if err := d.db.First(&assistant, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("助手ID %d 不存在: %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("查询助手失败: %w", err)
+	}
+	return &assistant, nil
+}
+
+// GetAssistantBySettingID 根据 Flowy 配置ID获取助手，不存在时返回 ErrNotFound
+func (d *Database) GetAssistantBySettingID(settingID int) (*models.AssistantGORM, error) {
+	var assistant models.AssistantGORM
+	if err := d.db.Where("flowy_setting_id = ?", settingID).First(&assistant).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("配置 %d 不属于任何助手: %w", settingID, ErrNotFound)
+		}
+		return nil, fmt.Errorf("查询助手失败: %w", err)
+	}
+	return &assistant, nil
+}
+
+// ListAssistants 按名称排列获取全部助手
+func (d *Database) ListAssistants() ([]models.AssistantGORM, error) {
+	var assistants []models.AssistantGORM
+	if err := d.db.Order("name").Order("id").Find(&assistants).Error; err != nil {
+		return nil, fmt.Errorf("查询助手列表失败: %w", err)
+	}
+	return assistants, nil
+}
+
+// UpdateAssistant 更新助手设置，并同步从助手创建的对话的设置快照（保留对话的名称和描述）
+func (d *Database) UpdateAssistant(assistant *models.AssistantGORM, settings *models.ConversationSettings) error {
+	models.UpdateAssistantGORM(assistant, settings)
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(assistant).Error; err != nil {
+			return fmt.Errorf("更新助手失败: %w", err)
+		}
+
+		var sessions []models.FlowySessionGORM
+		if err := tx.Where(assistantConversationCondition, assistant.ID).Find(&sessions).Error; err != nil {
+			return fmt.Errorf("查询助手的会话失败: %w", err)
+		}
+		for i := range sessions {
+			current := sessions[i].ToConversation()
+			synced := models.NewFlowySessionGORM(sessions[i].SessionID, sessions[i].AgentID, sessions[i].SettingID, assistant.ConversationSettings(current.Name, current.Desc))
+			err := tx.Model(&sessions[i]).Updates(map[string]interface{}{
+				"model_id": synced.ModelID,
+				"settings": synced.Settings,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("同步会话索引失败: %w", err)
+			}
+		}
+
+		var conversations []models.ConversationGORM
+		if err := tx.Where(assistantConversationCondition, assistant.ID).Find(&conversations).Error; err != nil {
+			return fmt.Errorf("查询助手的对话失败: %w", err)
+		}
+		for i := range conversations {
+			current := conversations[i].ToConversation()
+			synced := models.NewConversationGORM(assistant.ConversationSettings(current.Name, current.Desc))
+			err := tx.Model(&conversations[i]).Updates(map[string]interface{}{
+				"model_id": synced.ModelID,
+				"settings": synced.Settings,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("同步对话设置失败: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteAssistant 删除助手
+func (d *Database) DeleteAssistant(id int) error {
+	result := d.db.Delete(&models.AssistantGORM{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("删除助手失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("助手ID %d 不存在: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// CountAssistantConversations 统计从助手创建的对话数量
+func (d *Database) CountAssistantConversations(id int) (int64, error) {
+	var sessions, conversations int64
+	if err := d.db.Model(&models.FlowySessionGORM{}).Where(assistantConversationCondition, id).Count(&sessions).Error; err != nil {
+		return 0, fmt.Errorf("查询助手的会话数量失败: %w", err)
+	}
+	if err := d.db.Model(&models.ConversationGORM{}).Where(assistantConversationCondition, id).Count(&conversations).Error; err != nil {
+		return 0, fmt.Errorf("查询助手的对话数量失败: %w", err)
+	}
+	return sessions + conversations, nil
+}
+
+// === 提示词模板相关操作 ===
+
+// CreatePromptTemplate 创建提示词模板，同时保存第一个版本
+func (d *Database) CreatePromptTemplate(req *models.PromptTemplateRequest) (*models.PromptTemplateGORM, error) {
+	template := &models.PromptTemplateGORM{
+		Name:        req.Name,
+		Category:    req.Category,
+		Description: req.Description,
+		Content:     req.Content,
+		Version:     1,
+	}
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(template).Error; err != nil {
+			return fmt.Errorf("创建提示词模板失败: %w", err)
+		}
+		return savePromptTemplateVersion(tx, template)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// GetPromptTemplate 根据ID获取提示词模板，不存在时返回 ErrNotFound
+func (d *Database) GetPromptTemplate(id int) (*models.PromptTemplateGORM, error) {
+	var template models.PromptTemplateGORM
+	if err := d.db.First(&template, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("提示词模板ID %d 不存在: %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("查询提示词模板失败: %w", err)
+	}
+	return &template, nil
+}
+
+// ListPromptTemplates 按名称排列获取提示词模板，可按分类和关键字过滤
+func (d *Database) ListPromptTemplates(req *models.PromptTemplateListRequest) ([]models.PromptTemplateGORM, error) {
+	query := d.db.Model(&models.PromptTemplateGORM{})
+	if req.Category != "" {
+		query = query.Where("category = ?", req.Category)
+	}
+	if req.Keyword != "" {
+		keyword := likePattern(req.Keyword)
+		query = query.Where(`(name LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\')`, keyword, keyword)
+	}
+
+	var templates []models.PromptTemplateGORM
+	if err := query.Order("name").Order("id").Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("查询提示词模板列表失败: %w", err)
+	}
+	return templates, nil
+}
+
+// ListPromptTemplateCategories 获取提示词模板的全部分类
+func (d *Database) ListPromptTemplateCategories() ([]string, error) {
+	categories := []string{}
+	err := d.db.Model(&models.PromptTemplateGORM{}).
+		Where("category <> ''").
+		Distinct().
+		Order("category").
+		Pluck("category", &categories).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询提示词模板分类失败: %w", err)
+	}
+	return categories, nil
+}
+
+// PromptTemplateNameExists 判断是否已有同名模板，excludeID 为修改中的模板
+func (d *Database) PromptTemplateNameExists(name string, excludeID int) (bool, error) {
+	var count int64
+	err := d.db.Model(&models.PromptTemplateGORM{}).
+		Where("name = ? AND id <> ?", name, excludeID).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("查询提示词模板失败: %w", err)
+	}
+	return count > 0, nil
+}
+
+// UpdatePromptTemplate 修改提示词模板，内容变化时版本号加一并保存新版本
+func (d *Database) UpdatePromptTemplate(id int, req *models.PromptTemplateRequest) (*models.PromptTemplateGORM, error) {
+	template, err := d.GetPromptTemplate(id)
+	if err != nil {
+		return nil, err
+	}
+
+	contentChanged := template.Content != req.Content
+	template.Name = req.Name
+	template.Category = req.Category
+	template.Description = req.Description
+	if contentChanged {
+		template.Content = req.Content
+		template.Version++
+	}
+
+	err = d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(template).Error; err != nil {
+			return fmt.Errorf("更新提示词模板失败: %w", err)
+		}
+		if !contentChanged {
+			return nil
+		}
+		return savePromptTemplateVersion(tx, template)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// DeletePromptTemplate 删除提示词模板及其历史版本
+func (d *Database) DeletePromptTemplate(id int) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.PromptTemplateGORM{}, id)
+		if result.Error != nil {
+			return fmt.Errorf("删除提示词模板失败: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("提示词模板ID %d 不存在: %w", id, ErrNotFound)
+		}
+		if err := tx.Where("template_id = ?", id).Delete(&models.PromptTemplateVersionGORM{}).Error; err != nil {
+			return fmt.Errorf("删除提示词模板版本失败: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListPromptTemplateVersions 按版本号从新到旧获取模板的历史版本
+func (d *Database) ListPromptTemplateVersions(templateID int) ([]models.PromptTemplateVersionGORM, error) {
+	var versions []models.PromptTemplateVersionGORM
+	if err := d.db.Where("template_id = ?", templateID).Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("查询提示词模板版本失败: %w", err)
+	}
+	return versions, nil
+}
+
+// GetPromptTemplateVersion 获取模板的指定版本，不存在时返回 ErrNotFound
+func (d *Database) GetPromptTemplateVersion(templateID, version int) (*models.PromptTemplateVersionGORM, error) {
+	var v models.PromptTemplateVersionGORM
+	if err := d.db.Where("template_id = ? AND version = ?", templateID, version).First(&v).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("提示词模板 %d 不存在版本 %d: %w", templateID, version, ErrNotFound)
+		}
+		return nil, fmt.Errorf("查询提示词模板版本失败: %w", err)
+	}
+	return &v, nil
+}
+
+// savePromptTemplateVersion 将模板的当前内容保存为历史版本
+func savePromptTemplateVersion(tx *gorm.DB, template *models.PromptTemplateGORM) error {
+	version := &models.PromptTemplateVersionGORM{
+		TemplateID: int(template.ID),
+		Version:    template.Version,
+		Content:    template.Content,
+	}
+	if err := tx.Create(version).Error; err != nil {
+		return fmt.Errorf("保存提示词模板版本失败: %w", err)
+	}
+	return nil
+}
+
+// === 对话相关操作 ===
+
+// CreateConversation 创建对话
+func (d *Database) CreateConversation(settings *models.ConversationSettings) (*models.Conversation, error) {
+	gormConv := models.NewConversationGORM(settings)
+	if err := d.db.Create(gormConv).Error; err != nil {
+		return nil, fmt.Errorf("创建对话失败: %w", err)
+	}
+	return gormConv.ToConversation(), nil
+}
+
+// GetConversation 根据ID获取对话，不存在时返回 ErrNotFound
+func (d *Database) GetConversation(id int) (*models.Conversation, error) {
+	var gormConv models.ConversationGORM
+	if err := d.db.First(&gormConv, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("对话ID %d 不存在: %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("查询对话失败: %w", err)
+	}
+	return gormConv.ToConversation(), nil
+}
+
+// ListConversations 按过滤条件分页获取对话，同时返回总数
+func (d *Database) ListConversations(req *models.ConversationListRequest) ([]models.Conversation, int64, error) {
+	query := filterConversations(d.db.Model(&models.ConversationGORM{}), "conversations", req)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询对话数量失败: %w", err)
+	}
+
+	var gormConvs []models.ConversationGORM
+	if err := pageConversations(query, "id", req).Find(&gormConvs).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询对话列表失败: %w", err)
+	}
+
+	conversations := make([]models.Conversation, 0, len(gormConvs))
+	for i := range gormConvs {
+		conversations = append(conversations, *gormConvs[i].ToConversation())
+	}
+	return conversations, total, nil
+}
+
+// UpdateConversation 更新对话设置
+func (d *Database) UpdateConversation(id int, settings *models.ConversationSettings) error {
+	gormConv := models.NewConversationGORM(settings)
+	result := d.db.Model(&models.ConversationGORM{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"model_id": gormConv.ModelID,
+		"name":     gormConv.Name,
+		"desc":     gormConv.Desc,
+		"settings": gormConv.Settings,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("更新对话失败: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("对话ID %d 不存在: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteConversation 删除对话
+func (d *Database) DeleteConversation(id int) error {
+	result := d.db.Delete(&models.ConversationGORM{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("删除对话失败: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("对话ID %d 不存在: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// === 消息相关操作 ===
+
+// 搜索片段参数
+const (
+	snippetContext  = 30 // 命中位置前后保留的字符数
+	snippetMark     = "<mark>"
+	snippetUnmark   = "</mark>"
+	snippetEllipsis = "…"
+)
+
+// CreateMessage 保存一条对话消息，files 为用户消息携带的附件ID
+func (d *Database) CreateMessage(conversationID int, role, content string, files []string) (*models.MessageRecord, error) {
+	message := &models.MessageGORM{
+		ConversationID: conversationID,
+		Role:           role,
+		Content:        content,
+		Files:          models.MessageFilesJSON(files),
+	}
+	if err := d.db.Create(message).Error; err != nil {
+		return nil, fmt.Errorf("保存消息失败: %w", err)
+	}
+	return message.ToMessageRecord(), nil
+}
+
+// SaveMessages 按消息ID批量保存消息，已存在时覆盖角色和内容（用于镜像外部会话记录）
+func (d *Database) SaveMessages(messages []models.MessageGORM) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	err := d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"conversation_id", "role", "content", "finish_reason"}),
+	}).Create(&messages).Error
+	if err != nil {
+		return fmt.Errorf("保存消息失败: %w", err)
+	}
+	return nil
+}
+
+// ListMessages 按时间顺序获取对话的全部消息
+func (d *Database) ListMessages(conversationID int) ([]models.MessageRecord, error) {
+	var gormMessages []models.MessageGORM
+	if err := d.db.Where("conversation_id = ?", conversationID).Order("id").Find(&gormMessages).Error; err != nil {
+		return nil, fmt.Errorf("查询消息失败: %w", err)
+	}
+
+	messages := make([]models.MessageRecord, 0, len(gormMessages))
+	for i := range gormMessages {
+		messages = append(messages, *gormMessages[i].ToMessageRecord())
+	}
+	return messages, nil
+}
+
+// GetMessage 获取对话中的指定消息，不存在时返回 ErrNotFound
+func (d *Database) GetMessage(conversationID, messageID int) (*models.MessageRecord, error) {
+	var message models.MessageGORM
+	if err := d.db.Where("conversation_id = ? AND id = ?", conversationID, messageID).First(&message).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("对话 %d 中不存在消息 %d: %w", conversationID, messageID, ErrNotFound)
+		}
+		return nil, fmt.Errorf("查询消息失败: %w", err)
+	}
+	return message.ToMessageRecord(), nil
+}
+
+// CopyMessages 将对话中截至 untilMessageID（含）的消息复制到另一个对话，返回复制的数量
+func (d *Database) CopyMessages(fromConversationID, toConversationID, untilMessageID int) (int64, error) {
+	result := d.db.Exec(
+		"INSERT INTO messages (conversation_id, role, content, finish_reason, files, model_id, knowledge_base_ids, created_at) SELECT ?, role, content, finish_reason, files, model_id, knowledge_base_ids, created_at FROM messages WHERE conversation_id = ? AND id <= ? ORDER BY id",
+		toConversationID, fromConversationID, untilMessageID,
+	)
+	if result.Error != nil {
+		return 0, fmt.Errorf("复制消息失败: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// SetMessageFiles 保存用户消息携带的附件ID
+func (d *Database) SetMessageFiles(messageID int, files []string) error {
+	if err := d.db.Model(&models.MessageGORM{}).Where("id = ?", messageID).Update("files", models.MessageFilesJSON(files)).Error; err != nil {
+		return fmt.Errorf("保存消息附件失败: %w", err)
+	}
+	return nil
+}
+
+// SetMessageSettings 保存生成回答时使用的模型和知识库
+func (d *Database) SetMessageSettings(messageID, modelID int, knowledgeBaseIDs []int) error {
+	err := d.db.Model(&models.MessageGORM{}).Where("id = ?", messageID).Updates(map[string]interface{}{
+		"model_id":           modelID,
+		"knowledge_base_ids": models.MessageKnowledgeBasesJSON(knowledgeBaseIDs),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("保存消息的模型和知识库失败: %w", err)
+	}
+	return nil
+}
+
+// GetMessageConversationID 获取消息所属的对话ID，不存在时返回 ErrNotFound
+func (d *Database) GetMessageConversationID(messageID int) (int, error) {
+	var message models.MessageGORM
+	if err := d.db.Select("conversation_id").Where("id = ?", messageID).First(&message).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return 0, fmt.Errorf("消息 %d 不存在: %w", messageID, ErrNotFound)
+		}
+		return 0, fmt.Errorf("查询消息失败: %w", err)
+	}
+	return message.ConversationID, nil
+}
+
+// ListStoppedMessageIDs 获取对话中被中断的回答的消息ID
+func (d *Database) ListStoppedMessageIDs(conversationID int) (map[int]bool, error) {
+	var ids []int
+	if err := d.db.Model(&models.MessageGORM{}).Where("conversation_id = ? AND finish_reason = ?", conversationID, models.FinishReasonStopped).Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("查询消息失败: %w", err)
+	}
+	stopped := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		stopped[id] = true
+	}
+	return stopped, nil
+}
+
+// GetLastMessageID 获取对话中最大的消息ID，没有消息时返回 0
+func (d *Database) GetLastMessageID(conversationID int) (int, error) {
+	var lastID int
+	if err := d.db.Model(&models.MessageGORM{}).Where("conversation_id = ?", conversationID).Select("COALESCE(MAX(id), 0)").Scan(&lastID).Error; err != nil {
+		return 0, fmt.Errorf("查询消息失败: %w", err)
+	}
+	return lastID, nil
+}
+
+// CreateMessages 按顺序保存一批对话消息，保留消息原有的创建时间
+func (d *Database) CreateMessages(conversationID int, records []models.MessageRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	messages := make([]models.MessageGORM, 0, len(records))
+	for _, record := range records {
+		messages = append(messages, models.MessageGORM{
+			ConversationID:   conversationID,
+			Role:             record.Role,
+			Content:          record.Content,
+			FinishReason:     record.FinishReason,
+			Files:            models.MessageFilesJSON(record.Files),
+			RequestID:        record.RequestID,
+			ModelID:          record.ModelID,
+			KnowledgeBaseIDs: models.MessageKnowledgeBasesJSON(record.KnowledgeBaseIDs),
+			CreatedAt:        record.CreatedAt,
+		})
+	}
+	if err := d.db.Create(&messages).Error; err != nil {
+		return fmt.Errorf("保存消息失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteMessages 删除对话的全部消息
+func (d *Database) DeleteMessages(conversationID int) error {
+	if err := d.db.Where("conversation_id = ?", conversationID).Delete(&models.MessageGORM{}).Error; err != nil {
+		return fmt.Errorf("删除消息失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteMessageRange 删除对话中ID位于 [fromID, toID] 范围内的消息
+func (d *Database) DeleteMessageRange(conversationID, fromID, toID int) error {
+	if err := d.db.Where("conversation_id = ? AND id BETWEEN ? AND ?", conversationID, fromID, toID).Delete(&models.MessageGORM{}).Error; err != nil {
+		return fmt.Errorf("删除消息失败: %w", err)
+	}
+	return nil
+}
+
+// SearchMessages 在全部消息中搜索关键字，返回按相关度（LIKE 匹配时按时间）排序的结果和命中总数
+// 多个关键字以空格分隔，需全部命中
+func (d *Database) SearchMessages(query string, limit int) ([]models.MessageSearchResult, int64, error) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return []models.MessageSearchResult{}, 0, nil
+	}
+
+	var (
+		search     *gorm.DB
+		rankColumn string
+	)
+	if d.ftsEnabled && allTrigrams(terms) {
+		// trigram 分词器只能匹配不少于 3 个字符的关键字
+		quoted := make([]string, 0, len(terms))
+		for _, term := range terms {
+			quoted = append(quoted, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+		}
+		search = d.db.Table("messages_fts").
+			Joins("JOIN messages ON messages.id = messages_fts.rowid").
+			Where("messages_fts MATCH ?", strings.Join(quoted, " "))
+		rankColumn = "messages_fts.rank"
+	} else {
+		search = d.db.Table("messages")
+		for _, term := range terms {
+			search = search.Where(`messages.content LIKE ? ESCAPE '\'`, likePattern(term))
+		}
+	}
+	search = search.Session(&gorm.Session{})
+
+	var total int64
+	if err := search.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("搜索消息失败: %w", err)
+	}
+
+	var gormMessages []models.MessageGORM
+	find := search.Select("messages.*")
+	if rankColumn != "" {
+		find = find.Order(rankColumn)
+	}
+	if err := find.Order("messages.created_at DESC").Order("messages.id DESC").Limit(limit).Find(&gormMessages).Error; err != nil {
+		return nil, 0, fmt.Errorf("搜索消息失败: %w", err)
+	}
+
+	results := make([]models.MessageSearchResult, 0, len(gormMessages))
+	for _, message := range gormMessages {
+		results = append(results, models.MessageSearchResult{
+			ConversationID: message.ConversationID,
+			MessageID:      int(message.ID),
+			Role:           message.Role,
+			Snippet:        buildSnippet(message.Content, terms),
+			CreatedAt:      message.CreatedAt,
+		})
+	}
+	return results, total, nil
+}
+
+// allTrigrams 判断关键字是否都不少于 3 个字符
+func allTrigrams(terms []string) bool {
+	for _, term := range terms {
+		if len([]rune(term)) < 3 {
+			return false
+		}
+	}
+	return true
+}
+
+// buildSnippet 截取首个命中位置附近的内容，并以 <mark></mark> 标记所有命中的关键字（忽略大小写）
+func buildSnippet(content string, terms []string) string {
+	text := []rune(content)
+	lower := []rune(strings.ToLower(content))
+	if len(lower) != len(text) {
+		// 极少数字符转小写后长度变化，此时按原文匹配
+		lower = text
+	}
+
+	needles := make([][]rune, 0, len(terms))
+	for _, term := range terms {
+		needles = append(needles, []rune(strings.ToLower(term)))
+	}
+
+	// matchAt 返回从 i 开始命中的最长关键字长度
+	matchAt := func(i int) int {
+		longest := 0
+		for _, needle := range needles {
+			if len(needle) > longest && i+len(needle) <= len(lower) && string(lower[i:i+len(needle)]) == string(needle) {
+				longest = len(needle)
+			}
+		}
+		return longest
+	}
+
+	first := -1
+	for i := range lower {
+		if matchAt(i) > 0 {
+			first = i
+			break
+		}
+	}
+
+	start, end := 0, len(text)
+	if first >= 0 {
+		start = max(0, first-snippetContext)
+		end = min(len(text), first+snippetContext*2)
+	} else if end > snippetContext*2 {
+		end = snippetContext * 2
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString(snippetEllipsis)
+	}
+	for i := start; i < end; {
+		if n := matchAt(i); n > 0 {
+			b.WriteString(snippetMark)
+			b.WriteString(string(text[i : i+n]))
+			b.WriteString(snippetUnmark)
+			i += n
+			continue
+		}
+		if unicode.IsSpace(text[i]) {
+			b.WriteRune(' ')
+		} else {
+			b.WriteRune(text[i])
+		}
+		i++
+	}
+	if end < len(text) {
+		b.WriteString(snippetEllipsis)
+	}
+	return b.String()
+}
+
+// likeEscaper 转义 LIKE 中的通配符，配合 ESCAPE '\' 使用
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// likePattern 生成按字面包含 term 匹配的 LIKE 模式
+func likePattern(term string) string {
+	return "%" + likeEscaper.Replace(term) + "%"
+}
+
+// filterConversations 为对话类表（name/desc/model_id/settings 列）添加列表过滤条件
+func filterConversations(query *gorm.DB, table string, req *models.ConversationListRequest) *gorm.DB {
+	if req.Keyword != "" {
+		keyword := likePattern(req.Keyword)
+		query = query.Where("(name LIKE ? ESCAPE '\\' OR `desc` LIKE ? ESCAPE '\\')", keyword, keyword)
+	}
+	if req.ModelID > 0 {
+		query = query.Where("model_id = ?", req.ModelID)
+	}
+	if req.AssistantID > 0 {
+		query = query.Where(assistantConversationCondition, req.AssistantID)
+	}
+	if req.KnowledgeBaseID > 0 {
+		// 知识库ID列表保存在设置快照的 JSON 中
+		query = query.Where("EXISTS (SELECT 1 FROM json_each("+table+".settings, '$.knowledge_base_ids') WHERE json_each.value = ?)", req.KnowledgeBaseID)
+	}
+	// SQLite 以文本比较时间，时间按服务器时区保存，比较前将其他时区的边界转换为本地时间
+	if !req.CreatedAfter.IsZero() {
+		query = query.Where("created_at >= ?", req.CreatedAfter.Local())
+	}
+	if !req.CreatedBefore.IsZero() {
+		query = query.Where("created_at <= ?", req.CreatedBefore.Local())
+	}
+	if !req.UpdatedAfter.IsZero() {
+		query = query.Where("updated_at >= ?", req.UpdatedAfter.Local())
+	}
+	if !req.UpdatedBefore.IsZero() {
+		query = query.Where("updated_at <= ?", req.UpdatedBefore.Local())
+	}
+	// 开启新会话，使同一查询可以分别用于计数和分页
+	return query.Session(&gorm.Session{})
+}
+
+// pageConversations 为对话类表添加排序和分页，idColumn 用于同值时的稳定排序
+func pageConversations(query *gorm.DB, idColumn string, req *models.ConversationListRequest) *gorm.DB {
+	desc := req.SortOrder != "asc"
+	return query.
+		Order(clause.OrderByColumn{Column: clause.Column{Name: req.SortBy}, Desc: desc}).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: idColumn}, Desc: desc}).
+		Offset((req.Page - 1) * req.PageSize).
+		Limit(req.PageSize)
+}
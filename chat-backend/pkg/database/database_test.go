@@ -0,0 +1,52 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"chat-backend/models"
+)
+
+func TestDeleteConversationChatFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	for _, id := range []string{"a1", "b2", "c3"} {
+		if err := db.SaveChatFile(&models.ChatFileGORM{ID: id, Name: id + ".txt"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 对话 2 由对话 1 分支而来，复制了携带 b2 的消息
+	messages := []struct {
+		conversationID int
+		files          []string
+	}{
+		{1, []string{"a1", "b2"}},
+		{1, nil},
+		{2, []string{"b2"}},
+		{3, []string{"c3"}},
+	}
+	for _, m := range messages {
+		if _, err := db.CreateMessage(m.conversationID, "user", "问题", m.files); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := db.DeleteConversationChatFiles(1)
+	if err != nil {
+		t.Fatalf("DeleteConversationChatFiles() error = %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("deleted = %d, want 1", deleted)
+	}
+	if _, err := db.GetChatFiles([]string{"a1"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetChatFiles(a1) error = %v, want ErrNotFound", err)
+	}
+	if _, err := db.GetChatFiles([]string{"b2", "c3"}); err != nil {
+		t.Errorf("GetChatFiles(b2, c3) error = %v, 仍被引用的附件应保留", err)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build sqlite_fts5
+
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestMessageSearchFTS5 以 sqlite_fts5 标签编译时消息全文索引应可用
+func TestMessageSearchFTS5(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "fts5.db"))
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	if !db.ftsEnabled {
+		t.Fatal("已添加 sqlite_fts5 编译标签，但消息全文索引不可用")
+	}
+}
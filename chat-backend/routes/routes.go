@@ -20,6 +20,9 @@ type Router struct {
 	settingsHandler  *handlers.SettingsHandler
 	knowledgeHandler *handlers.KnowledgeHandler
 	modelHandler     *handlers.ModelHandler
+	promptHandler    *handlers.PromptTemplateHandler
+	assistantHandler *handlers.AssistantHandler
+	openAIHandler    *handlers.OpenAIHandler
 	versionHandler   *handlers.VersionHandler
 	staticFS         embed.FS
 	docsFS           embed.FS
@@ -31,6 +34,9 @@ func NewRouter(
 	settingsHandler *handlers.SettingsHandler,
 	knowledgeHandler *handlers.KnowledgeHandler,
 	modelHandler *handlers.ModelHandler,
+	promptHandler *handlers.PromptTemplateHandler,
+	assistantHandler *handlers.AssistantHandler,
+	openAIHandler *handlers.OpenAIHandler,
 	versionHandler *handlers.VersionHandler,
 	staticFS embed.FS,
 	docsFS embed.FS,
@@ -44,18 +50,7 @@ func NewRouter(
 	engine.Use(utils.ResponseHandlerMiddleware()) // 添加响应处理中间件
 
 	// CORS中间件
-	engine.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "*")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-
-		c.Next()
-	})
+	engine.Use(utils.CORSMiddleware())
 
 	router := &Router{
 		engine:           engine,
@@ -63,6 +58,9 @@ func NewRouter(
 		settingsHandler:  settingsHandler,
 		knowledgeHandler: knowledgeHandler,
 		modelHandler:     modelHandler,
+		promptHandler:    promptHandler,
+		assistantHandler: assistantHandler,
+		openAIHandler:    openAIHandler,
 		versionHandler:   versionHandler,
 		staticFS:         staticFS,
 		docsFS:           docsFS,
@@ -81,13 +79,28 @@ func (r *Router) setupRoutes() {
 	{
 		chat.POST("/conversations", utils.WrapHandler(r.chatHandler.CreateConversation))
 		chat.GET("/conversations", utils.WrapHandler(r.chatHandler.GetConversations))
+		chat.POST("/conversations/import", utils.WrapHandler(r.chatHandler.ImportConversations))
 		chat.DELETE("/conversations/:id", utils.WrapHandler(r.chatHandler.DeleteConversation))
 		chat.GET("/conversations/:id/history", utils.WrapHandler(r.chatHandler.GetConversationHistory))
-		chat.POST("/messages", r.chatHandler.SendMessage) // SendMessage 保持原样，使用SSE
+		chat.GET("/conversations/:id/export", r.chatHandler.ExportConversation) // 以附件形式返回导出文件
+		chat.POST("/conversations/:id/fork", utils.WrapHandler(r.chatHandler.ForkConversation))
+		chat.POST("/messages", r.chatHandler.SendMessage)                      // 默认使用SSE，要求JSON或对话非流式时返回完整回答
+		chat.POST("/messages/:id/regenerate", r.chatHandler.RegenerateMessage) // 与 SendMessage 相同的SSE协议
+		chat.PUT("/messages/:id", r.chatHandler.EditMessage)                   // 与 SendMessage 相同的SSE协议
+		chat.GET("/messages/:id/alternates", utils.WrapHandler(r.chatHandler.GetMessageAlternates))
+		chat.POST("/messages/:id/feedback", utils.WrapHandler(r.chatHandler.SubmitFeedback))
+		chat.POST("/messages/:id/stop", utils.WrapHandler(r.chatHandler.StopMessage)) // :id 为发送消息时的 RequestID
+		chat.GET("/messages/:id/stream", r.chatHandler.ResumeMessageStream)           // :id 为发送消息时的 RequestID，SSE
+		chat.GET("/ws", r.chatHandler.ChatWebSocket)                                  // WebSocket，多个请求以 RequestID 复用同一连接
+		chat.POST("/files", utils.WrapHandler(r.chatHandler.UploadChatFile))
 		chat.GET("/conversations/:id/settings", utils.WrapHandler(r.chatHandler.GetConversationSettings))
 		chat.PUT("/conversations/:id/settings", utils.WrapHandler(r.chatHandler.UpdateConversationSettings))
+		chat.GET("/search", utils.WrapHandler(r.chatHandler.SearchMessages))
 	}
 
+	// 回答评价统计
+	api.GET("/feedback", utils.WrapHandler(r.chatHandler.GetFeedbackReport))
+
 	// 默认配置相关路由
 	settings := api.Group("/settings")
 	{
@@ -96,6 +109,28 @@ func (r *Router) setupRoutes() {
 		settings.POST("/defaults/reset", utils.WrapHandler(r.settingsHandler.ResetDefaultSettings))
 	}
 
+	// 提示词模板相关路由
+	prompts := api.Group("/prompts")
+	{
+		prompts.GET("", utils.WrapHandler(r.promptHandler.ListPromptTemplates))
+		prompts.POST("", utils.WrapHandler(r.promptHandler.CreatePromptTemplate))
+		prompts.GET("/:id", utils.WrapHandler(r.promptHandler.GetPromptTemplate))
+		prompts.PUT("/:id", utils.WrapHandler(r.promptHandler.UpdatePromptTemplate))
+		prompts.DELETE("/:id", utils.WrapHandler(r.promptHandler.DeletePromptTemplate))
+		prompts.GET("/:id/versions", utils.WrapHandler(r.promptHandler.ListPromptTemplateVersions))
+		prompts.POST("/:id/render", utils.WrapHandler(r.promptHandler.RenderPromptTemplate))
+	}
+
+	// 助手相关路由
+	assistants := api.Group("/assistants")
+	{
+		assistants.GET("", utils.WrapHandler(r.assistantHandler.ListAssistants))
+		assistants.POST("", utils.WrapHandler(r.assistantHandler.CreateAssistant))
+		assistants.GET("/:id", utils.WrapHandler(r.assistantHandler.GetAssistant))
+		assistants.PUT("/:id", utils.WrapHandler(r.assistantHandler.UpdateAssistant))
+		assistants.DELETE("/:id", utils.WrapHandler(r.assistantHandler.DeleteAssistant))
+	}
+
 	// 知识库相关路由
 	knowledge := api.Group("/knowledge")
 	{
@@ -105,10 +140,14 @@ func (r *Router) setupRoutes() {
 		knowledge.DELETE("/bases/:id", utils.WrapHandler(r.knowledgeHandler.DeleteKnowledgeBase))
 		knowledge.GET("/bases/:id/files", utils.WrapHandler(r.knowledgeHandler.GetKnowledgeBaseFiles))
 		knowledge.POST("/bases/:id/files", r.knowledgeHandler.UploadFile) // UploadFile 保持原样，使用复杂逻辑
+		knowledge.GET("/bases/:id/files/status", r.knowledgeHandler.StreamKnowledgeBaseStatus) // SSE 流式推送文件状态
+		knowledge.POST("/bases/:id/reindex", utils.WrapHandler(r.knowledgeHandler.ReindexKnowledgeBase))
 
 		// 文件操作路由（只需要文件ID）
 		knowledge.DELETE("/files/:file_id", utils.WrapHandler(r.knowledgeHandler.DeleteFile))
 		knowledge.PUT("/files/:file_id/toggle", utils.WrapHandler(r.knowledgeHandler.ToggleFileEnable))
+		knowledge.GET("/files/:file_id/status", utils.WrapHandler(r.knowledgeHandler.GetFileStatus))
+		knowledge.POST("/files/:file_id/reindex", utils.WrapHandler(r.knowledgeHandler.ReindexFile))
 	}
 
 	// 模型相关路由
@@ -129,6 +168,13 @@ func (r *Router) setupRoutes() {
 		models.PUT("/:id/status", utils.WrapHandler(r.modelHandler.SetModelStatus))
 	}
 
+	// OpenAI 兼容路由 - 与 OpenAI API 路径和响应格式一致，不使用统一响应包装
+	openai := r.engine.Group("/v1")
+	{
+		openai.POST("/chat/completions", r.openAIHandler.ChatCompletions)
+		openai.GET("/models", r.openAIHandler.ListModels)
+	}
+
 
 	// 系统信息路由 - 为swag创建直接路由
 	api.GET("/version", func(c *gin.Context) {
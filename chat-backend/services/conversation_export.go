@@ -0,0 +1,229 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/models"
+	"chat-backend/services/interfaces"
+)
+
+// exportTimeLayout 导出内容中的时间格式
+const exportTimeLayout = "2006-01-02 15:04:05"
+
+// ExportConversation 导出对话的设置和完整历史，返回渲染后的内容及其 Content-Type
+func ExportConversation(ctx context.Context, chatService interfaces.ChatServiceInterface, conversationID int, format string) ([]byte, string, error) {
+	switch format {
+	case models.ExportFormatMarkdown, models.ExportFormatJSON, models.ExportFormatHTML:
+	default:
+		return nil, "", fmt.Errorf("%w: %s", models.ErrExportFormat, format)
+	}
+
+	settings, err := chatService.GetConversationSettings(ctx, conversationID)
+	if err != nil {
+		return nil, "", fmt.Errorf("获取对话设置失败: %w", err)
+	}
+
+	history, err := chatService.GetConversationHistory(ctx, conversationID)
+	if err != nil {
+		return nil, "", fmt.Errorf("获取对话历史失败: %w", err)
+	}
+
+	export := &models.ConversationExport{
+		ConversationID: conversationID,
+		Settings:       *settings,
+		Messages:       history.Messages,
+		ExportedAt:     time.Now(),
+	}
+	if export.Messages == nil {
+		export.Messages = []models.MessageRecord{}
+	}
+	for _, message := range export.Messages {
+		export.Usage.Add(message.Usage)
+	}
+
+	switch format {
+	case models.ExportFormatJSON:
+		data, err := json.MarshalIndent(export, "", "  ")
+		if err != nil {
+			return nil, "", fmt.Errorf("序列化对话失败: %w", err)
+		}
+		return data, "application/json; charset=utf-8", nil
+	case models.ExportFormatHTML:
+		var buf bytes.Buffer
+		if err := exportHTMLTemplate.Execute(&buf, export); err != nil {
+			return nil, "", fmt.Errorf("渲染对话失败: %w", err)
+		}
+		return buf.Bytes(), "text/html; charset=utf-8", nil
+	default:
+		return renderMarkdown(export), "text/markdown; charset=utf-8", nil
+	}
+}
+
+// renderMarkdown 将对话渲染为 Markdown
+func renderMarkdown(export *models.ConversationExport) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n\n", conversationTitle(export))
+	if export.Settings.Desc != "" {
+		fmt.Fprintf(&b, "> %s\n\n", export.Settings.Desc)
+	}
+
+	b.WriteString("| 设置 | 值 |\n| --- | --- |\n")
+	for _, item := range settingItems(export) {
+		fmt.Fprintf(&b, "| %s | %s |\n", item.Name, strings.ReplaceAll(item.Value, "|", "\\|"))
+	}
+
+	for _, message := range export.Messages {
+		fmt.Fprintf(&b, "\n---\n\n### %s · %s\n\n", roleLabel(message.Role), message.CreatedAt.Format(exportTimeLayout))
+		b.WriteString(message.Content)
+		b.WriteString("\n")
+
+		if len(message.References) > 0 {
+			b.WriteString("\n**引用**\n\n")
+			for i, ref := range message.References {
+				fmt.Fprintf(&b, "%d. %s\n", i+1, referenceLabel(ref))
+				if ref.Content != "" {
+					fmt.Fprintf(&b, "   > %s\n", strings.ReplaceAll(ref.Content, "\n", "\n   > "))
+				}
+			}
+		}
+
+		if message.Usage != nil {
+			fmt.Fprintf(&b, "\n*Token：%s*\n", usageLabel(message.Usage))
+		}
+	}
+
+	return []byte(b.String())
+}
+
+// settingItem 导出头部的设置项
+type settingItem struct {
+	Name  string
+	Value string
+}
+
+// settingItems 返回导出头部展示的对话设置
+func settingItems(export *models.ConversationExport) []settingItem {
+	settings := export.Settings
+
+	knowledgeBases := "无"
+	if len(settings.KnowledgeBaseIDs) > 0 {
+		ids := make([]string, 0, len(settings.KnowledgeBaseIDs))
+		for _, id := range settings.KnowledgeBaseIDs {
+			ids = append(ids, strconv.Itoa(id))
+		}
+		knowledgeBases = strings.Join(ids, ", ")
+	}
+
+	return []settingItem{
+		{"对话ID", strconv.Itoa(export.ConversationID)},
+		{"模型ID", strconv.Itoa(settings.ModelID)},
+		{"Temperature", strconv.FormatFloat(settings.Temperature, 'f', -1, 64)},
+		{"Top P", strconv.FormatFloat(settings.TopP, 'f', -1, 64)},
+		{"Presence Penalty", strconv.FormatFloat(settings.PresencePenalty, 'f', -1, 64)},
+		{"Frequency Penalty", strconv.FormatFloat(settings.FrequencyPenalty, 'f', -1, 64)},
+		{"响应类型", settings.ResponseType},
+		{"流式输出", strconv.FormatBool(settings.Stream)},
+		{"上下文限制", strconv.Itoa(settings.ContextLimit)},
+		{"知识库", knowledgeBases},
+		{"消息数", strconv.Itoa(len(export.Messages))},
+		{"Token 用量", usageLabel(&export.Usage)},
+		{"导出时间", export.ExportedAt.Format(exportTimeLayout)},
+	}
+}
+
+// conversationTitle 返回对话标题，未命名时使用对话ID
+func conversationTitle(export *models.ConversationExport) string {
+	if export.Settings.Name != "" {
+		return export.Settings.Name
+	}
+	return fmt.Sprintf("对话 %d", export.ConversationID)
+}
+
+// roleLabel 返回角色的展示名称
+func roleLabel(role string) string {
+	switch role {
+	case "user":
+		return "用户"
+	case "assistant":
+		return "助手"
+	case "system":
+		return "系统"
+	default:
+		return role
+	}
+}
+
+// referenceLabel 返回引用的展示名称
+func referenceLabel(ref models.Reference) string {
+	title := ref.DocumentTitle
+	if title == "" {
+		title = ref.DocumentID
+	}
+	if ref.Similarity > 0 {
+		return fmt.Sprintf("%s（相似度 %.2f）", title, ref.Similarity)
+	}
+	return title
+}
+
+// usageLabel 返回 Token 用量的展示文本
+func usageLabel(usage *models.TokenUsage) string {
+	return fmt.Sprintf("提示 %d / 生成 %d / 合计 %d", usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens)
+}
+
+// exportHTMLTemplate 对话导出的 HTML 模板
+var exportHTMLTemplate = template.Must(template.New("conversation").Funcs(template.FuncMap{
+	"title":     conversationTitle,
+	"settings":  settingItems,
+	"role":      roleLabel,
+	"reference": referenceLabel,
+	"usage":     usageLabel,
+	"time": func(t time.Time) string {
+		return t.Format(exportTimeLayout)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{title .}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "PingFang SC", "Microsoft YaHei", sans-serif; max-width: 880px; margin: 32px auto; padding: 0 16px; color: #1f2328; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+td, th { border: 1px solid #d0d7de; padding: 4px 12px; text-align: left; }
+.message { border-top: 1px solid #d0d7de; padding: 12px 0; }
+.meta { color: #57606a; font-size: 14px; margin-bottom: 8px; }
+.role-user .meta strong { color: #0969da; }
+.role-assistant .meta strong { color: #1a7f37; }
+.content { white-space: pre-wrap; }
+.references { font-size: 14px; margin-top: 8px; }
+.references blockquote { margin: 4px 0 8px 0; padding-left: 8px; border-left: 3px solid #d0d7de; color: #57606a; white-space: pre-wrap; }
+.usage { color: #57606a; font-size: 13px; font-style: italic; margin-top: 8px; }
+</style>
+</head>
+<body>
+<h1>{{title .}}</h1>
+{{if .Settings.Desc}}<p>{{.Settings.Desc}}</p>{{end}}
+<table>
+<tr><th>设置</th><th>值</th></tr>
+{{range settings .}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{range .Messages}}<div class="message role-{{.Role}}">
+<div class="meta"><strong>{{role .Role}}</strong> · {{time .CreatedAt}}</div>
+<div class="content">{{.Content}}</div>
+{{if .References}}<div class="references"><strong>引用</strong>
+<ol>
+{{range .References}}<li>{{reference .}}{{if .Content}}<blockquote>{{.Content}}</blockquote>{{end}}</li>
+{{end}}</ol>
+</div>
+{{end}}{{with .Usage}}<div class="usage">Token：{{usage .}}</div>
+{{end}}</div>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"chat-backend/models"
+	"chat-backend/services/interfaces"
+	"chat-backend/utils"
+)
+
+// importRollbackTimeout 导入失败后删除已创建对话的超时时间
+const importRollbackTimeout = time.Minute
+
+// importTranscript 从导出数据中解析出的一个对话
+type importTranscript struct {
+	Title    string
+	Messages []models.MessageRecord
+}
+
+// ImportConversations 解析 ChatGPT/OpenAI 格式的导出数据，并为其中每个对话创建带历史记录的新对话
+// 任一对话导入失败时删除本次已创建的对话，导入要么全部成功要么不留下任何对话
+func ImportConversations(ctx context.Context, chatService interfaces.ChatServiceInterface, defaultSettingsService interfaces.DefaultSettingsServiceInterface, req *models.ConversationImportRequest) (*models.ConversationImportResponse, error) {
+	transcripts, err := parseImport(req.Format, req.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	base := req.Settings
+	if base == nil {
+		base = defaultConversationSettings(defaultSettingsService)
+	}
+
+	response := &models.ConversationImportResponse{
+		Conversations: make([]models.ImportedConversation, 0, len(transcripts)),
+	}
+	for i, transcript := range transcripts {
+		settings := *base
+		if transcript.Title != "" {
+			settings.Name = transcript.Title
+		}
+		if settings.Name == "" {
+			settings.Name = "导入的对话"
+		}
+
+		conversation, err := chatService.ImportConversation(ctx, &settings, transcript.Messages)
+		if err != nil {
+			utils.ErrorWith("导入对话失败", "index", i, "imported", len(response.Conversations), "error", err)
+			rollbackImport(ctx, chatService, response.Conversations)
+			return nil, fmt.Errorf("导入第 %d 个对话失败: %w", i+1, err)
+		}
+
+		response.Conversations = append(response.Conversations, models.ImportedConversation{
+			Conversation: *conversation,
+			MessageCount: len(transcript.Messages),
+		})
+	}
+
+	utils.InfoWith("对话导入完成", "conversation_count", len(response.Conversations))
+	return response, nil
+}
+
+// rollbackImport 删除导入失败前已创建的对话
+// 导入可能因超时失败，删除时不受 ctx 取消的影响
+func rollbackImport(ctx context.Context, chatService interfaces.ChatServiceInterface, imported []models.ImportedConversation) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), importRollbackTimeout)
+	defer cancel()
+
+	for _, item := range imported {
+		if err := chatService.DeleteConversation(ctx, item.Conversation.ID); err != nil {
+			utils.ErrorWith("清理已导入的对话失败", "conversation_id", item.Conversation.ID, "error", err)
+		}
+	}
+	if len(imported) > 0 {
+		utils.InfoWith("已撤销本次导入的对话", "conversation_count", len(imported))
+	}
+}
+
+// defaultConversationSettings 使用持久化的默认配置生成对话设置
+func defaultConversationSettings(defaultSettingsService interfaces.DefaultSettingsServiceInterface) *models.ConversationSettings {
+	defaultSettings := defaultSettingsService.GetDefaultSettings()
+	return &models.ConversationSettings{
+		ModelID:          defaultSettings.Models.ChatModelID,
+		Temperature:      defaultSettings.Conversation.Temperature,
+		KnowledgeBaseIDs: []int{},
+		TopP:             defaultSettings.Conversation.TopP,
+		FrequencyPenalty: defaultSettings.Conversation.FrequencyPenalty,
+		PresencePenalty:  defaultSettings.Conversation.PresencePenalty,
+		ResponseType:     defaultSettings.Conversation.ResponseType,
+		Stream:           defaultSettings.Conversation.Stream,
+		ContextLimit:     defaultSettings.Conversation.ContextLimit,
+	}
+}
+
+// parseImport 按格式解析导出数据，格式为空时自动识别
+// 数据为空、无法解析或没有可导入的消息时返回 ErrImportData，以便调用方作为请求错误处理
+func parseImport(format string, data json.RawMessage) ([]importTranscript, error) {
+	transcripts, err := parseImportData(format, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrImportData, err)
+	}
+	if len(transcripts) == 0 {
+		return nil, fmt.Errorf("%w: 导入数据中没有可导入的消息", models.ErrImportData)
+	}
+	return transcripts, nil
+}
+
+// parseImportData 解析导出数据，返回的错误由 parseImport 统一包装
+func parseImportData(format string, data json.RawMessage) ([]importTranscript, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("导入数据不能为空")
+	}
+
+	if format == "" {
+		if format = detectImportFormat(data); format == "" {
+			return nil, fmt.Errorf("无法识别导入数据的格式，请指定 format 为 %s 或 %s", models.ImportFormatChatGPT, models.ImportFormatOpenAI)
+		}
+	}
+
+	switch format {
+	case models.ImportFormatChatGPT:
+		return parseChatGPTExport(data)
+	case models.ImportFormatOpenAI:
+		return parseOpenAIMessages(data)
+	default:
+		return nil, fmt.Errorf("不支持的导入格式: %s", format)
+	}
+}
+
+// detectImportFormat 根据数据结构识别导入格式
+func detectImportFormat(data []byte) string {
+	var fields map[string]json.RawMessage
+	if data[0] == '[' {
+		var items []map[string]json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil || len(items) == 0 {
+			return ""
+		}
+		fields = items[0]
+	} else if err := json.Unmarshal(data, &fields); err != nil {
+		return ""
+	}
+
+	switch {
+	case fields["mapping"] != nil:
+		return models.ImportFormatChatGPT
+	case fields["role"] != nil, fields["messages"] != nil:
+		return models.ImportFormatOpenAI
+	default:
+		return ""
+	}
+}
+
+// chatGPTConversation ChatGPT 导出的单个对话
+type chatGPTConversation struct {
+	Title       string                 `json:"title"`
+	CreateTime  float64                `json:"create_time"`
+	CurrentNode string                 `json:"current_node"`
+	Mapping     map[string]chatGPTNode `json:"mapping"`
+}
+
+// chatGPTNode ChatGPT 对话树中的节点
+type chatGPTNode struct {
+	Parent   string          `json:"parent"`
+	Children []string        `json:"children"`
+	Message  *chatGPTMessage `json:"message"`
+}
+
+// chatGPTMessage ChatGPT 对话树节点中的消息
+type chatGPTMessage struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	CreateTime float64 `json:"create_time"`
+	Content    struct {
+		ContentType string        `json:"content_type"`
+		Parts       []interface{} `json:"parts"`
+		Text        string        `json:"text"`
+	} `json:"content"`
+}
+
+// parseChatGPTExport 解析 ChatGPT 导出的 conversations.json（对话数组或单个对话）
+// 对话以树形保存所有分支，从 current_node 回溯到根节点得到当前显示的分支
+func parseChatGPTExport(data []byte) ([]importTranscript, error) {
+	var conversations []chatGPTConversation
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &conversations); err != nil {
+			return nil, fmt.Errorf("解析 ChatGPT 导出数据失败: %w", err)
+		}
+	} else {
+		var conversation chatGPTConversation
+		if err := json.Unmarshal(data, &conversation); err != nil {
+			return nil, fmt.Errorf("解析 ChatGPT 导出数据失败: %w", err)
+		}
+		conversations = append(conversations, conversation)
+	}
+
+	var transcripts []importTranscript
+	for _, conversation := range conversations {
+		createdAt := unixTime(conversation.CreateTime, time.Now())
+
+		// 回溯路径上的节点（从叶到根）
+		var path []*chatGPTMessage
+		nodeID := conversation.CurrentNode
+		if nodeID == "" {
+			nodeID = lastChatGPTLeaf(conversation.Mapping)
+		}
+		for steps := 0; nodeID != "" && steps <= len(conversation.Mapping); steps++ {
+			node, ok := conversation.Mapping[nodeID]
+			if !ok {
+				break
+			}
+			if node.Message != nil {
+				path = append(path, node.Message)
+			}
+			nodeID = node.Parent
+		}
+
+		var messages []models.MessageRecord
+		for i := len(path) - 1; i >= 0; i-- {
+			message := path[i]
+			role := message.Author.Role
+			if role != "user" && role != "assistant" && role != "system" {
+				continue // 跳过工具调用等中间消息
+			}
+
+			content := message.Content.Text
+			if len(message.Content.Parts) > 0 {
+				var parts []string
+				for _, part := range message.Content.Parts {
+					if text, ok := part.(string); ok && text != "" {
+						parts = append(parts, text)
+					}
+				}
+				content = strings.Join(parts, "\n")
+			}
+			if strings.TrimSpace(content) == "" {
+				continue
+			}
+
+			messages = append(messages, models.MessageRecord{
+				Role:      role,
+				Content:   content,
+				CreatedAt: unixTime(message.CreateTime, createdAt),
+			})
+		}
+
+		if len(messages) > 0 {
+			transcripts = append(transcripts, importTranscript{Title: conversation.Title, Messages: messages})
+		}
+	}
+	return transcripts, nil
+}
+
+// lastChatGPTLeaf 缺少 current_node 时，从根节点沿最后一个子节点找到叶节点
+func lastChatGPTLeaf(mapping map[string]chatGPTNode) string {
+	nodeID := ""
+	for id, node := range mapping {
+		if node.Parent == "" {
+			nodeID = id
+			break
+		}
+	}
+	for steps := 0; nodeID != "" && steps <= len(mapping); steps++ {
+		node := mapping[nodeID]
+		if len(node.Children) == 0 {
+			break
+		}
+		nodeID = node.Children[len(node.Children)-1]
+	}
+	return nodeID
+}
+
+// parseOpenAIMessages 解析 OpenAI 的 messages 数组（也可为 {"messages": [...]}）
+func parseOpenAIMessages(data []byte) ([]importTranscript, error) {
+	var raw []models.OpenAIChatMessage
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("解析 OpenAI 消息失败: %w", err)
+		}
+	} else {
+		var wrapper struct {
+			Messages []models.OpenAIChatMessage `json:"messages"`
+		}
+		if err := json.Unmarshal(data, &wrapper); err != nil {
+			return nil, fmt.Errorf("解析 OpenAI 消息失败: %w", err)
+		}
+		raw = wrapper.Messages
+	}
+
+	messages := openAIMessageRecords(raw, time.Now())
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	return []importTranscript{{Messages: messages}}, nil
+}
+
+// openAIMessageRecords 将 OpenAI 消息转换为消息记录，跳过 tool/function 消息和没有文本内容的消息
+func openAIMessageRecords(raw []models.OpenAIChatMessage, createdAt time.Time) []models.MessageRecord {
+	var messages []models.MessageRecord
+	for _, message := range raw {
+		if message.Role != "user" && message.Role != "assistant" && message.Role != "system" {
+			continue // 跳过 tool/function 消息
+		}
+
+		content := message.Text()
+		if strings.TrimSpace(content) == "" {
+			continue // 仅包含工具调用的助手消息
+		}
+
+		messages = append(messages, models.MessageRecord{
+			Role:      message.Role,
+			Content:   content,
+			CreatedAt: createdAt,
+		})
+	}
+	return messages
+}
+
+// unixTime 将秒级（可带小数）Unix 时间戳转换为时间，为 0 时返回 fallback
+func unixTime(seconds float64, fallback time.Time) time.Time {
+	if seconds <= 0 {
+		return fallback
+	}
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
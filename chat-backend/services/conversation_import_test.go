@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"chat-backend/models"
+	"chat-backend/pkg/database"
+	"chat-backend/services/interfaces"
+)
+
+// fakeChatService 以内存保存对话设置和导入的历史，模拟聊天服务
+type fakeChatService struct {
+	interfaces.ChatServiceInterface
+
+	nextID        int
+	settings      map[int]models.ConversationSettings
+	histories     map[int][]models.MessageRecord
+	importFailsAt int // 第几次导入失败（从 1 开始），0 表示不失败
+	imports       int
+	deleted       []int
+	updates       int
+}
+
+func newFakeChatService() *fakeChatService {
+	return &fakeChatService{
+		nextID:    100,
+		settings:  make(map[int]models.ConversationSettings),
+		histories: make(map[int][]models.MessageRecord),
+	}
+}
+
+func (s *fakeChatService) CreateConversation(ctx context.Context, settings *models.ConversationSettings) (*models.Conversation, error) {
+	s.nextID++
+	s.settings[s.nextID] = *settings
+	return &models.Conversation{ID: s.nextID, ConversationSettings: *settings}, nil
+}
+
+func (s *fakeChatService) ImportConversation(ctx context.Context, settings *models.ConversationSettings, messages []models.MessageRecord) (*models.Conversation, error) {
+	s.imports++
+	if s.imports == s.importFailsAt {
+		return nil, errors.New("导入失败")
+	}
+	conversation, _ := s.CreateConversation(ctx, settings)
+	s.histories[conversation.ID] = messages
+	return conversation, nil
+}
+
+func (s *fakeChatService) DeleteConversation(ctx context.Context, conversationID int) error {
+	s.deleted = append(s.deleted, conversationID)
+	delete(s.settings, conversationID)
+	delete(s.histories, conversationID)
+	return nil
+}
+
+func (s *fakeChatService) GetConversationSettings(ctx context.Context, conversationID int) (*models.ConversationSettings, error) {
+	settings, ok := s.settings[conversationID]
+	if !ok {
+		return nil, fmt.Errorf("对话 %d 不存在: %w", conversationID, database.ErrNotFound)
+	}
+	return &settings, nil
+}
+
+func (s *fakeChatService) UpdateConversationSettings(ctx context.Context, conversationID int, settings *models.ConversationSettings) error {
+	s.updates++
+	s.settings[conversationID] = *settings
+	return nil
+}
+
+// messageRoles 返回消息的角色和内容，便于比较
+func messageRoles(messages []models.MessageRecord) []string {
+	var result []string
+	for _, message := range messages {
+		result = append(result, message.Role+": "+message.Content)
+	}
+	return result
+}
+
+// chatGPTBranchExport 两个分支的 ChatGPT 对话，current_node 指向第二个回答
+const chatGPTBranchExport = `{
+	"title": "分支对话",
+	"create_time": 1700000000.5,
+	"current_node": "a2",
+	"mapping": {
+		"root": {"parent": "", "children": ["sys"], "message": null},
+		"sys": {"parent": "root", "children": ["u1"], "message": {"author": {"role": "system"}, "content": {"content_type": "text", "parts": [""]}}},
+		"u1": {"parent": "sys", "children": ["a1", "a2"], "message": {"author": {"role": "user"}, "create_time": 1700000001, "content": {"content_type": "text", "parts": ["你好", "世界"]}}},
+		"a1": {"parent": "u1", "children": [], "message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["旧回答"]}}},
+		"tool": {"parent": "u1", "children": ["a2"], "message": {"author": {"role": "tool"}, "content": {"content_type": "text", "parts": ["工具输出"]}}},
+		"a2": {"parent": "tool", "children": [], "message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["新回答"]}}}
+	}
+}`
+
+func TestParseChatGPTExport(t *testing.T) {
+	transcripts, err := parseImport("", json.RawMessage(chatGPTBranchExport))
+	if err != nil {
+		t.Fatalf("parseImport() error = %v", err)
+	}
+	if len(transcripts) != 1 {
+		t.Fatalf("解析出 %d 个对话, want 1", len(transcripts))
+	}
+
+	transcript := transcripts[0]
+	if transcript.Title != "分支对话" {
+		t.Errorf("Title = %q, want %q", transcript.Title, "分支对话")
+	}
+	// 沿 current_node 回溯，跳过空消息和工具消息，多段内容以换行拼接
+	want := []string{"user: 你好\n世界", "assistant: 新回答"}
+	if got := messageRoles(transcript.Messages); !reflect.DeepEqual(got, want) {
+		t.Errorf("Messages = %q, want %q", got, want)
+	}
+	if got := transcript.Messages[0].CreatedAt; !got.Equal(time.Unix(1700000001, 0)) {
+		t.Errorf("用户消息时间 = %v, want 消息自身的时间", got)
+	}
+	if got := transcript.Messages[1].CreatedAt; !got.Equal(time.Unix(1700000000, 5e8)) {
+		t.Errorf("回答时间 = %v, want 对话的创建时间", got)
+	}
+}
+
+func TestParseChatGPTExportWithoutCurrentNode(t *testing.T) {
+	data := `[{
+		"title": "无当前节点",
+		"mapping": {
+			"root": {"parent": "", "children": ["u1"]},
+			"u1": {"parent": "root", "children": ["a1", "a2"], "message": {"author": {"role": "user"}, "content": {"parts": ["问题"]}}},
+			"a1": {"parent": "u1", "message": {"author": {"role": "assistant"}, "content": {"parts": ["第一个分支"]}}},
+			"a2": {"parent": "u1", "message": {"author": {"role": "assistant"}, "content": {"parts": ["最后一个分支"]}}}
+		}
+	}, {
+		"title": "空对话",
+		"mapping": {"root": {"parent": ""}}
+	}]`
+
+	transcripts, err := parseImport(models.ImportFormatChatGPT, json.RawMessage(data))
+	if err != nil {
+		t.Fatalf("parseImport() error = %v", err)
+	}
+	if len(transcripts) != 1 {
+		t.Fatalf("解析出 %d 个对话, want 1（没有消息的对话被跳过）", len(transcripts))
+	}
+	want := []string{"user: 问题", "assistant: 最后一个分支"}
+	if got := messageRoles(transcripts[0].Messages); !reflect.DeepEqual(got, want) {
+		t.Errorf("Messages = %q, want %q", got, want)
+	}
+}
+
+func TestParseOpenAIMessages(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "消息数组",
+			data: `[
+				{"role": "system", "content": "你是助手"},
+				{"role": "user", "content": [{"type": "text", "text": "看图"}, {"type": "image_url", "image_url": {"url": "x"}}]},
+				{"role": "assistant", "content": null},
+				{"role": "tool", "content": "工具结果"},
+				{"role": "assistant", "content": "好的"}
+			]`,
+		},
+		{
+			name: "messages 对象",
+			data: `{"messages": [
+				{"role": "system", "content": "你是助手"},
+				{"role": "user", "content": "看图"},
+				{"role": "assistant", "content": "好的"}
+			]}`,
+		},
+	}
+	want := []string{"system: 你是助手", "user: 看图", "assistant: 好的"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transcripts, err := parseImport("", json.RawMessage(tt.data))
+			if err != nil {
+				t.Fatalf("parseImport() error = %v", err)
+			}
+			if len(transcripts) != 1 {
+				t.Fatalf("解析出 %d 个对话, want 1", len(transcripts))
+			}
+			if got := messageRoles(transcripts[0].Messages); !reflect.DeepEqual(got, want) {
+				t.Errorf("Messages = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestParseImportErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		data   string
+	}{
+		{name: "空数据", data: " "},
+		{name: "无法识别", data: `{"foo": 1}`},
+		{name: "不支持的格式", format: "claude", data: `[]`},
+		{name: "格式错误", format: models.ImportFormatChatGPT, data: `{"mapping": 1}`},
+		{name: "没有消息", format: models.ImportFormatOpenAI, data: `[{"role": "tool", "content": "结果"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseImport(tt.format, json.RawMessage(tt.data)); !errors.Is(err, models.ErrImportData) {
+				t.Errorf("parseImport() error = %v, want ErrImportData", err)
+			}
+		})
+	}
+}
+
+func TestImportConversations(t *testing.T) {
+	chat := newFakeChatService()
+	req := &models.ConversationImportRequest{
+		Settings: &models.ConversationSettings{ModelID: 3},
+		Data:     json.RawMessage(`[` + chatGPTBranchExport + `,` + chatGPTBranchExport + `]`),
+	}
+
+	response, err := ImportConversations(context.Background(), chat, nil, req)
+	if err != nil {
+		t.Fatalf("ImportConversations() error = %v", err)
+	}
+	if len(response.Conversations) != 2 {
+		t.Fatalf("导入 %d 个对话, want 2", len(response.Conversations))
+	}
+	for _, conversation := range response.Conversations {
+		if conversation.Name != "分支对话" || conversation.ModelID != 3 || conversation.MessageCount != 2 {
+			t.Errorf("导入的对话 = %+v, want 名称取自标题、使用请求的设置", conversation)
+		}
+	}
+}
+
+// TestImportConversationsRollback 任一对话导入失败时删除已创建的对话
+func TestImportConversationsRollback(t *testing.T) {
+	chat := newFakeChatService()
+	chat.importFailsAt = 3
+	req := &models.ConversationImportRequest{
+		Settings: &models.ConversationSettings{},
+		Data:     json.RawMessage(`[` + chatGPTBranchExport + `,` + chatGPTBranchExport + `,` + chatGPTBranchExport + `]`),
+	}
+
+	if _, err := ImportConversations(context.Background(), chat, nil, req); err == nil {
+		t.Fatal("ImportConversations() error = nil, want 导入失败")
+	}
+	if want := []int{101, 102}; !reflect.DeepEqual(chat.deleted, want) {
+		t.Errorf("删除的对话 = %v, want %v", chat.deleted, want)
+	}
+	if len(chat.settings) != 0 {
+		t.Errorf("仍有 %d 个对话未删除", len(chat.settings))
+	}
+}
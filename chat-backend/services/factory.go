@@ -31,6 +31,18 @@ type ServiceContainer struct {
 	knowledgeService         interfaces.KnowledgeServiceInterface
 	modelService            interfaces.ModelServiceInterface
 	defaultSettingsService  interfaces.DefaultSettingsServiceInterface
+	promptTemplateService   interfaces.PromptTemplateServiceInterface
+	assistantService        interfaces.AssistantServiceInterface
+
+	// 知识库文件状态跟踪器
+	knowledgeStatusTracker *KnowledgeStatusTracker
+	stopStatusTracker      context.CancelFunc
+
+	// 进行中的消息生成
+	generationRegistry *GenerationRegistry
+
+	// OpenAI 兼容接口的消息前缀与对话的对应关系
+	openAIConversations *OpenAIConversationCache
 	
 	// 配置
 	flowyConfig      *config.Config
@@ -44,14 +56,28 @@ func NewServiceContainer(serviceType ServiceType) (*ServiceContainer, error) {
 	}
 
 	// 根据服务类型初始化
+	var err error
 	switch serviceType {
 	case ServiceTypeFlowy:
-		return container.initFlowyServices()
+		_, err = container.initFlowyServices()
 	case ServiceTypeLangchaingo:
-		return container.initLangchaingoServices()
+		_, err = container.initLangchaingoServices()
 	default:
 		return nil, fmt.Errorf("unsupported service type: %s", serviceType)
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 启动知识库文件状态跟踪
+	trackerCtx, cancel := context.WithCancel(context.Background())
+	container.stopStatusTracker = cancel
+	container.knowledgeStatusTracker = NewKnowledgeStatusTracker(container.knowledgeService)
+	container.knowledgeStatusTracker.Start(trackerCtx)
+
+	container.generationRegistry = NewGenerationRegistry()
+
+	return container, nil
 }
 
 // initFlowyServices 初始化 Flowy 服务
@@ -64,13 +90,22 @@ func (sc *ServiceContainer) initFlowyServices() (*ServiceContainer, error) {
 	// 创建 Flowy SDK 实例
 	sdk := flowySDK.New(flowyCfg)
 
+	// 创建本地会话索引数据库
+	db, err := database.NewDatabase(utils.GetEnvOrDefault("FLOWY_SQLITE_DB_PATH", "./flowy_sessions.db"))
+	if err != nil {
+		return nil, fmt.Errorf("创建数据库连接失败: %w", err)
+	}
+
 	// 创建默认设置服务
 	sc.defaultSettingsService = flowy.NewFlowyDefaultSettingsService()
 
 	// 创建其他服务
-	sc.chatService = flowy.NewFlowyChatService(sdk, sc.defaultSettingsService)
-	sc.knowledgeService = flowy.NewFlowyKnowledgeService(sdk)
+	sc.chatService = flowy.NewFlowyChatService(sdk, db, sc.defaultSettingsService)
+	sc.knowledgeService = flowy.NewFlowyKnowledgeService(sdk, db)
 	sc.modelService = flowy.NewFlowyModelService(sdk)
+	sc.promptTemplateService = NewPromptTemplateService(db)
+	sc.openAIConversations = NewOpenAIConversationCache(db)
+	sc.assistantService = flowy.NewFlowyAssistantService(sdk, db)
 
 	utils.InfoWith("Flowy 服务初始化完成", "chat_service", "flowy", "knowledge_service", "flowy", "model_service", "flowy")
 	return sc, nil
@@ -99,9 +134,12 @@ func (sc *ServiceContainer) initLangchaingoServices() (*ServiceContainer, error)
 	sc.defaultSettingsService = langchaingo.NewLangchaingoDefaultSettingsService()
 
 	// 创建其他服务
-	sc.chatService = langchaingo.NewLangchaingoChatService(langchaingoCfg, sc.defaultSettingsService)
+	sc.chatService = langchaingo.NewLangchaingoChatService(langchaingoCfg, db, sc.defaultSettingsService)
 	sc.knowledgeService = langchaingo.NewLangchaingoKnowledgeService(langchaingoCfg)
 	sc.modelService = langchaingo.NewLangchaingoModelService(db, langchaingoCfg)
+	sc.promptTemplateService = NewPromptTemplateService(db)
+	sc.openAIConversations = NewOpenAIConversationCache(db)
+	sc.assistantService = langchaingo.NewLangchaingoAssistantService(db)
 
 	utils.InfoWith("Langchaingo 服务初始化完成", "chat_service", "langchaingo", "knowledge_service", "langchaingo", "model_service", "langchaingo")
 	return sc, nil
@@ -117,6 +155,21 @@ func (sc *ServiceContainer) GetKnowledgeService() interfaces.KnowledgeServiceInt
 	return sc.knowledgeService
 }
 
+// GetKnowledgeStatusTracker 获取知识库文件状态跟踪器
+func (sc *ServiceContainer) GetKnowledgeStatusTracker() *KnowledgeStatusTracker {
+	return sc.knowledgeStatusTracker
+}
+
+// GetGenerationRegistry 获取进行中的消息生成登记表
+func (sc *ServiceContainer) GetGenerationRegistry() *GenerationRegistry {
+	return sc.generationRegistry
+}
+
+// GetOpenAIConversationCache 获取 OpenAI 兼容接口的对话复用表
+func (sc *ServiceContainer) GetOpenAIConversationCache() *OpenAIConversationCache {
+	return sc.openAIConversations
+}
+
 // GetModelService 获取模型服务
 func (sc *ServiceContainer) GetModelService() interfaces.ModelServiceInterface {
 	return sc.modelService
@@ -127,6 +180,16 @@ func (sc *ServiceContainer) GetDefaultSettingsService() interfaces.DefaultSettin
 	return sc.defaultSettingsService
 }
 
+// GetPromptTemplateService 获取提示词模板服务
+func (sc *ServiceContainer) GetPromptTemplateService() interfaces.PromptTemplateServiceInterface {
+	return sc.promptTemplateService
+}
+
+// GetAssistantService 获取助手服务
+func (sc *ServiceContainer) GetAssistantService() interfaces.AssistantServiceInterface {
+	return sc.assistantService
+}
+
 // GetServiceType 获取服务类型
 func (sc *ServiceContainer) GetServiceType() ServiceType {
 	return sc.serviceType
@@ -161,6 +224,7 @@ func (sc *ServiceContainer) GetServiceInfo() map[string]interface{} {
 			"knowledge_service":         getServiceTypeName(sc.knowledgeService),
 			"model_service":            getServiceTypeName(sc.modelService),
 			"default_settings_service": getServiceTypeName(sc.defaultSettingsService),
+			"assistant_service":        getServiceTypeName(sc.assistantService),
 		},
 	}
 
@@ -202,6 +266,8 @@ func getServiceTypeName(service interface{}) string {
 		return "flowy"
 	case *flowy.FlowyDefaultSettingsService:
 		return "flowy"
+	case *flowy.FlowyAssistantService:
+		return "flowy"
 	case *langchaingo.LangchaingoChatService:
 		return "langchaingo"
 	case *langchaingo.LangchaingoKnowledgeService:
@@ -210,6 +276,8 @@ func getServiceTypeName(service interface{}) string {
 		return "langchaingo"
 	case *langchaingo.LangchaingoDefaultSettingsService:
 		return "langchaingo"
+	case *langchaingo.LangchaingoAssistantService:
+		return "langchaingo"
 	default:
 		return "unknown"
 	}
@@ -290,6 +358,33 @@ func GetGlobalKnowledgeService() interfaces.KnowledgeServiceInterface {
 	return container.GetKnowledgeService()
 }
 
+// GetGlobalKnowledgeStatusTracker 获取全局知识库文件状态跟踪器
+func GetGlobalKnowledgeStatusTracker() *KnowledgeStatusTracker {
+	container := GetGlobalServiceContainer()
+	if container == nil {
+		return nil
+	}
+	return container.GetKnowledgeStatusTracker()
+}
+
+// GetGlobalGenerationRegistry 获取全局进行中的消息生成登记表
+func GetGlobalGenerationRegistry() *GenerationRegistry {
+	container := GetGlobalServiceContainer()
+	if container == nil {
+		return nil
+	}
+	return container.GetGenerationRegistry()
+}
+
+// GetGlobalOpenAIConversationCache 获取全局 OpenAI 兼容接口的对话复用表
+func GetGlobalOpenAIConversationCache() *OpenAIConversationCache {
+	container := GetGlobalServiceContainer()
+	if container == nil {
+		return nil
+	}
+	return container.GetOpenAIConversationCache()
+}
+
 // GetGlobalModelService 获取全局模型服务
 func GetGlobalModelService() interfaces.ModelServiceInterface {
 	container := GetGlobalServiceContainer()
@@ -308,6 +403,24 @@ func GetGlobalDefaultSettingsService() interfaces.DefaultSettingsServiceInterfac
 	return container.GetDefaultSettingsService()
 }
 
+// GetGlobalPromptTemplateService 获取全局提示词模板服务
+func GetGlobalPromptTemplateService() interfaces.PromptTemplateServiceInterface {
+	container := GetGlobalServiceContainer()
+	if container == nil {
+		return nil
+	}
+	return container.GetPromptTemplateService()
+}
+
+// GetGlobalAssistantService 获取全局助手服务
+func GetGlobalAssistantService() interfaces.AssistantServiceInterface {
+	container := GetGlobalServiceContainer()
+	if container == nil {
+		return nil
+	}
+	return container.GetAssistantService()
+}
+
 // Shutdown 关闭服务
 func Shutdown() error {
 	if globalServiceContainer != nil {
@@ -315,6 +428,9 @@ func Shutdown() error {
 		
 		// 这里可以添加具体的清理逻辑
 		// 比如关闭数据库连接、释放资源等
+		if globalServiceContainer.stopStatusTracker != nil {
+			globalServiceContainer.stopStatusTracker()
+		}
 		
 		globalServiceContainer = nil
 		utils.LogInfo("服务已关闭")
@@ -0,0 +1,159 @@
+package flowy
+
+import (
+	"context"
+	"fmt"
+
+	"chat-backend/models"
+	"chat-backend/pkg/database"
+	"chat-backend/services/interfaces"
+	"chat-backend/utils"
+	"flowy-sdk"
+	agentSvc "flowy-sdk/services/agent"
+)
+
+// FlowyAssistantService 基于 flowy-sdk 的助手服务实现
+// 每个助手对应一个 Agent 和配置，从助手创建的对话均为该配置下的会话，修改助手即修改这些会话共用的配置
+type FlowyAssistantService struct {
+	sdk *flowy.SDK
+	db  *database.Database
+}
+
+// NewFlowyAssistantService 创建 Flowy 助手服务
+func NewFlowyAssistantService(sdk *flowy.SDK, db *database.Database) interfaces.AssistantServiceInterface {
+	return &FlowyAssistantService{
+		sdk: sdk,
+		db:  db,
+	}
+}
+
+// ListAssistants 获取助手列表
+func (s *FlowyAssistantService) ListAssistants(ctx context.Context) (*models.AssistantListResponse, error) {
+	records, err := s.db.ListAssistants()
+	if err != nil {
+		return nil, err
+	}
+
+	assistants := make([]models.Assistant, 0, len(records))
+	for i := range records {
+		assistant, err := s.toAssistant(&records[i])
+		if err != nil {
+			return nil, err
+		}
+		assistants = append(assistants, *assistant)
+	}
+	return &models.AssistantListResponse{Assistants: assistants}, nil
+}
+
+// GetAssistant 获取助手
+func (s *FlowyAssistantService) GetAssistant(ctx context.Context, id int) (*models.Assistant, error) {
+	assistant, err := s.db.GetAssistant(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toAssistant(assistant)
+}
+
+// CreateAssistant 创建助手及其 Agent 和配置
+// 助手的配置由其全部对话共用，发送附件时不再修改，因此创建时即开启文件分析插件
+func (s *FlowyAssistantService) CreateAssistant(ctx context.Context, settings *models.ConversationSettings) (*models.Assistant, error) {
+	utils.LogInfo("创建助手: %s", settings.Name)
+
+	agentID, settingID, err := createAgentSetting(ctx, s.sdk, settings, nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	assistant, err := s.db.CreateAssistant(settings, agentID, settingID)
+	if err != nil {
+		// 清理已创建的配置和Agent
+		if delErr := deleteAgentSetting(ctx, s.sdk, agentID, settingID); delErr != nil {
+			utils.ErrorWith("清理助手的配置和Agent失败", "agent_id", agentID, "setting_id", settingID, "error", delErr)
+		}
+		return nil, err
+	}
+
+	utils.InfoWith("助手创建成功", "assistant_id", assistant.ID, "agent_id", agentID, "setting_id", settingID)
+	return assistant.ToAssistant(0), nil
+}
+
+// UpdateAssistant 修改助手的 Agent 和配置，对从助手创建的全部会话之后的提问生效
+func (s *FlowyAssistantService) UpdateAssistant(ctx context.Context, id int, settings *models.ConversationSettings) (*models.Assistant, error) {
+	utils.InfoWith("修改助手", "assistant_id", id)
+
+	assistant, err := s.db.GetAssistant(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 如果 Name 或 Desc 有变化，则更新 Agent
+	if settings.Name != assistant.Name || settings.Desc != assistant.Desc {
+		_, err := s.sdk.Agent.UpdateAgent(ctx, &agentSvc.UpdateAgentRequest{
+			ID:   assistant.FlowyAgentID,
+			Name: settings.Name,
+			Desc: settings.Desc,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("更新Agent失败: %w", err)
+		}
+	}
+
+	config, err := findSettingConfig(ctx, s.sdk, assistant.FlowyAgentID, assistant.FlowySettingID)
+	if err != nil {
+		return nil, err
+	}
+	config.AgentID = assistant.FlowyAgentID
+	config.Name = settings.Name
+	if config.Chat == nil {
+		config.Chat = agentSvc.NewDefaultSettingConfig(assistant.FlowyAgentID, settings.Name).Chat
+	}
+	applyChatSettings(config.Chat, settings, nil)
+	config.Chat.Plugin.FileAnalyzer.Enable = true
+
+	if _, err := s.sdk.Agent.SaveConfig(ctx, config); err != nil {
+		return nil, fmt.Errorf("保存配置失败: %w", err)
+	}
+
+	if err := s.db.UpdateAssistant(assistant, settings); err != nil {
+		return nil, err
+	}
+
+	utils.InfoWith("助手已修改", "assistant_id", id, "setting_id", assistant.FlowySettingID)
+	return s.toAssistant(assistant)
+}
+
+// DeleteAssistant 删除助手及其 Agent 和配置，助手下仍有对话时不能删除
+func (s *FlowyAssistantService) DeleteAssistant(ctx context.Context, id int) error {
+	utils.InfoWith("删除助手", "assistant_id", id)
+
+	assistant, err := s.db.GetAssistant(id)
+	if err != nil {
+		return err
+	}
+	count, err := s.db.CountAssistantConversations(id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %d 个对话", models.ErrAssistantInUse, count)
+	}
+
+	if err := deleteAgentSetting(ctx, s.sdk, assistant.FlowyAgentID, assistant.FlowySettingID); err != nil {
+		return err
+	}
+	if err := s.db.DeleteAssistant(id); err != nil {
+		return err
+	}
+
+	utils.InfoWith("助手已删除", "assistant_id", id)
+	return nil
+}
+
+// toAssistant 转换为 Assistant 并统计从助手创建的对话数量
+func (s *FlowyAssistantService) toAssistant(assistant *models.AssistantGORM) (*models.Assistant, error) {
+	count, err := s.db.CountAssistantConversations(int(assistant.ID))
+	if err != nil {
+		return nil, err
+	}
+	return assistant.ToAssistant(int(count)), nil
+}
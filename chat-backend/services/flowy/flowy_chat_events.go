@@ -0,0 +1,198 @@
+package flowy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"chat-backend/models"
+	agentSvc "flowy-sdk/services/agent"
+)
+
+// streamMapper 将 Flowy 的流事件映射为类型化的聊天事件
+// Flowy 在多个事件中重复携带引用、工具调用、推荐问题等字段，仅在首次出现或内容发生变化时输出
+type streamMapper struct {
+	conversationID string
+
+	answer      strings.Builder // 已生成的回答内容
+	references  listDigest      // 已输出的各列表的内容摘要
+	tools       listDigest
+	suggestions listDigest
+	chart       bool
+	usage       models.TokenUsage
+	errMessage  string // Flowy 返回的错误信息，非空时以错误结束
+	finished    bool
+}
+
+// newStreamMapper 创建会话的流事件映射器
+func newStreamMapper(sessionID int) *streamMapper {
+	return &streamMapper{conversationID: fmt.Sprintf("%d", sessionID)}
+}
+
+// event 创建聊天事件
+func (m *streamMapper) event(eventType string, data interface{}, index int) models.SSEChatEvent {
+	return models.SSEChatEvent{
+		Type:  eventType,
+		Data:  data,
+		ID:    m.conversationID,
+		Index: index,
+	}
+}
+
+// mapEvent 将一个 Flowy 流事件拆分为零到多个聊天事件，结束事件总是最后输出
+func (m *streamMapper) mapEvent(event *agentSvc.StreamEvent) []models.SSEChatEvent {
+	if m.finished {
+		return nil // 结束后的事件（如 [DONE]）
+	}
+
+	if event.Error {
+		message := event.Message
+		if message == "" {
+			message = "Flowy 返回错误"
+		}
+		m.errMessage = message
+		errEvent := m.event(models.ChatEventError, message, event.Index)
+		errEvent.Error = message
+		return []models.SSEChatEvent{errEvent}
+	}
+
+	var events []models.SSEChatEvent
+	finish := event.EventType == models.ChatEventFinish || (event.EventType == "" && event.FinishReason != "")
+
+	switch {
+	case event.EventType == models.ChatEventSplash:
+		events = append(events, m.event(models.ChatEventSplash, event.Message, event.Index))
+	case !finish && event.Message != "":
+		m.answer.WriteString(event.Message)
+		events = append(events, m.event(models.ChatEventDelta, event.Message, event.Index))
+	}
+
+	if len(event.Plugins.Knowledge) > 0 {
+		if references := referencesFromKnowledge(event.Plugins.Knowledge); m.references.update(references) {
+			events = append(events, m.event(models.ChatEventReferences, references, event.Index))
+		}
+	}
+
+	if len(event.Tools) > 0 {
+		if calls := toolCallsFromTools(event.Tools); m.tools.update(calls) {
+			events = append(events, m.event(models.ChatEventToolCall, calls, event.Index))
+		}
+	}
+
+	if !m.chart {
+		if chart, ok := chartFromEvent(event); ok {
+			m.chart = true
+			events = append(events, m.event(models.ChatEventChart, chart, event.Index))
+		}
+	}
+
+	if len(event.SuggestedQuestions) > 0 && m.suggestions.update(event.SuggestedQuestions) {
+		events = append(events, m.event(models.ChatEventSuggestions, event.SuggestedQuestions, event.Index))
+	}
+
+	if event.Usage.TotalTokens > 0 && event.Usage.TotalTokens != m.usage.TotalTokens {
+		m.usage = models.TokenUsage{
+			PromptTokens:     event.Usage.PromptTokens,
+			CompletionTokens: event.Usage.CompletionTokens,
+			TotalTokens:      event.Usage.TotalTokens,
+			Duration:         event.Usage.Duration,
+		}
+		events = append(events, m.event(models.ChatEventUsage, m.usage, event.Index))
+	}
+
+	if finish {
+		events = append(events, m.finish(event.Message, event.FinishReason, event.Index))
+	}
+	return events
+}
+
+// finish 生成结束事件并标记结束，Flowy 返回过错误时总是以错误结束
+func (m *streamMapper) finish(message, reason string, index int) models.SSEChatEvent {
+	if m.errMessage != "" {
+		reason = models.FinishReasonError
+	}
+	if reason == "" {
+		reason = models.FinishReasonStop
+	}
+	m.finished = true
+	finishEvent := m.event(models.ChatEventFinish, message, index)
+	finishEvent.FinishReason = reason
+	return finishEvent
+}
+
+// fail 生成请求失败时的错误事件和结束事件
+func (m *streamMapper) fail(err error) []models.SSEChatEvent {
+	errEvent := m.event(models.ChatEventError, err.Error(), 0)
+	errEvent.Error = err.Error()
+	return []models.SSEChatEvent{errEvent, m.finish("生成失败", models.FinishReasonError, 0)}
+}
+
+// listDigest 列表序列化后的摘要，用于判断重复携带的列表内容是否发生变化
+type listDigest [sha256.Size]byte
+
+// update 计算列表的摘要，与上次不同时记录并返回 true
+func (d *listDigest) update(list interface{}) bool {
+	data, err := json.Marshal(list)
+	if err != nil {
+		return true
+	}
+	digest := listDigest(sha256.Sum256(data))
+	if digest == *d {
+		return false
+	}
+	*d = digest
+	return true
+}
+
+// toolCallsFromTools 将流事件中的工具调用转换为聊天事件的工具调用
+func toolCallsFromTools(items []agentSvc.ToolCall) []models.ChatToolCall {
+	calls := make([]models.ChatToolCall, 0, len(items))
+	for _, item := range items {
+		calls = append(calls, models.ChatToolCall{
+			Name:      item.Name,
+			Arguments: nonEmpty(item.Arguments),
+			Result:    nonEmpty(item.Result),
+		})
+	}
+	return calls
+}
+
+// chartFromEvent 提取流事件中的图表及结构化数据，均为空时返回 false
+func chartFromEvent(event *agentSvc.StreamEvent) (models.ChatChart, bool) {
+	chart := models.ChatChart{
+		Chart:   nonEmpty(event.ChartData),
+		JSON:    nonEmpty(event.StructData.JSON),
+		Code:    nonEmpty(event.StructData.Code),
+		MarkMap: nonEmpty(event.StructData.MarkMap),
+	}
+	ok := chart.Chart != nil || chart.JSON != nil || chart.Code != nil || chart.MarkMap != nil
+	return chart, ok
+}
+
+// nonEmpty 空字符串、空数组和空对象视为 nil
+func nonEmpty(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		if v.Len() == 0 {
+			return nil
+		}
+	}
+	return value
+}
+
+// sendEvents 依次发送聊天事件，ctx 被取消时放弃剩余事件
+func sendEvents(ctx context.Context, eventChan chan<- models.SSEChatEvent, events []models.SSEChatEvent) {
+	for _, event := range events {
+		select {
+		case eventChan <- event:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
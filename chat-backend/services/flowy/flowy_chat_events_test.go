@@ -0,0 +1,185 @@
+package flowy
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"chat-backend/models"
+	agentSvc "flowy-sdk/services/agent"
+)
+
+// eventTypes 返回聊天事件的类型列表
+func eventTypes(events []models.SSEChatEvent) []string {
+	types := make([]string, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestStreamMapperStream(t *testing.T) {
+	mapper := newStreamMapper(7)
+	knowledge := agentSvc.PluginsInfo{Knowledge: []agentSvc.KnowledgeReference{
+		{FileID: 3, FileName: "手册.pdf", Content: "片段", Score: 0.9, ChunkIndex: 2},
+	}}
+	tools := []agentSvc.ToolCall{
+		{Name: "search", Arguments: map[string]interface{}{"q": "x"}, Result: "结果"},
+	}
+
+	steps := []struct {
+		event agentSvc.StreamEvent
+		want  []string
+	}{
+		{agentSvc.StreamEvent{EventType: models.ChatEventSplash, Message: "开始"}, []string{models.ChatEventSplash}},
+		{agentSvc.StreamEvent{EventType: models.ChatEventDelta, Message: "你", Plugins: knowledge}, []string{models.ChatEventDelta, models.ChatEventReferences}},
+		// 重复携带的引用和工具调用只在变化时输出
+		{agentSvc.StreamEvent{EventType: models.ChatEventDelta, Message: "好", Plugins: knowledge, Tools: tools}, []string{models.ChatEventDelta, models.ChatEventToolCall}},
+		{agentSvc.StreamEvent{EventType: models.ChatEventDelta, Tools: tools, SuggestedQuestions: []string{"下一个问题"}}, []string{models.ChatEventSuggestions}},
+		{agentSvc.StreamEvent{EventType: models.ChatEventFinish, Message: "完成", Usage: agentSvc.UsageInfo{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}}, []string{models.ChatEventUsage, models.ChatEventFinish}},
+		// 结束后的事件被忽略
+		{agentSvc.StreamEvent{Message: "[DONE]"}, []string{}},
+	}
+
+	var all []models.SSEChatEvent
+	for i, step := range steps {
+		events := mapper.mapEvent(&step.event)
+		if got := eventTypes(events); !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("第 %d 个事件映射为 %v, want %v", i+1, got, step.want)
+		}
+		all = append(all, events...)
+	}
+
+	if got := mapper.answer.String(); got != "你好" {
+		t.Errorf("answer = %q, want %q", got, "你好")
+	}
+	for _, event := range all {
+		if event.ID != "7" {
+			t.Errorf("%s 事件的 ID = %q, want %q", event.Type, event.ID, "7")
+		}
+		switch event.Type {
+		case models.ChatEventReferences:
+			references := event.Data.([]models.Reference)
+			want := []models.Reference{{DocumentID: "3", DocumentTitle: "手册.pdf", Content: "片段", Similarity: 0.9, ChunkIndex: 2}}
+			if !reflect.DeepEqual(references, want) {
+				t.Errorf("references = %+v, want %+v", references, want)
+			}
+		case models.ChatEventToolCall:
+			calls := event.Data.([]models.ChatToolCall)
+			if len(calls) != 1 || calls[0].Name != "search" || calls[0].Result != "结果" {
+				t.Errorf("tool calls = %+v", calls)
+			}
+		case models.ChatEventUsage:
+			if usage := event.Data.(models.TokenUsage); usage.TotalTokens != 5 {
+				t.Errorf("usage = %+v, want TotalTokens 5", usage)
+			}
+		case models.ChatEventFinish:
+			if event.FinishReason != models.FinishReasonStop {
+				t.Errorf("FinishReason = %q, want %q", event.FinishReason, models.FinishReasonStop)
+			}
+		}
+	}
+}
+
+func TestStreamMapperListContentChanges(t *testing.T) {
+	mapper := newStreamMapper(7)
+
+	steps := []struct {
+		name  string
+		event agentSvc.StreamEvent
+		want  []string
+	}{
+		{name: "首次出现", event: agentSvc.StreamEvent{Tools: []agentSvc.ToolCall{{Name: "search"}}, SuggestedQuestions: []string{"问题一"}}, want: []string{models.ChatEventToolCall, models.ChatEventSuggestions}},
+		{name: "内容相同", event: agentSvc.StreamEvent{Tools: []agentSvc.ToolCall{{Name: "search"}}, SuggestedQuestions: []string{"问题一"}}, want: []string{}},
+		{name: "数量相同内容不同", event: agentSvc.StreamEvent{Tools: []agentSvc.ToolCall{{Name: "search", Result: "结果"}}, SuggestedQuestions: []string{"问题二"}}, want: []string{models.ChatEventToolCall, models.ChatEventSuggestions}},
+	}
+	for _, step := range steps {
+		if got := eventTypes(mapper.mapEvent(&step.event)); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: 映射为 %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestStreamMapperFinishReason(t *testing.T) {
+	tests := []struct {
+		name  string
+		event agentSvc.StreamEvent
+		want  string
+	}{
+		{name: "结束事件", event: agentSvc.StreamEvent{EventType: models.ChatEventFinish}, want: models.FinishReasonStop},
+		{name: "Flowy 给出结束原因", event: agentSvc.StreamEvent{EventType: models.ChatEventFinish, FinishReason: "length"}, want: "length"},
+		{name: "没有事件类型", event: agentSvc.StreamEvent{FinishReason: models.FinishReasonStop}, want: models.FinishReasonStop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper := newStreamMapper(1)
+			events := mapper.mapEvent(&tt.event)
+			if len(events) != 1 || events[0].Type != models.ChatEventFinish {
+				t.Fatalf("事件 = %v, want 仅结束事件", eventTypes(events))
+			}
+			if events[0].FinishReason != tt.want {
+				t.Errorf("FinishReason = %q, want %q", events[0].FinishReason, tt.want)
+			}
+			if !mapper.finished {
+				t.Error("finished = false, want true")
+			}
+		})
+	}
+}
+
+// TestStreamMapperError Flowy 返回错误后，无论之后的结束事件或补发的结束事件都以错误结束
+func TestStreamMapperError(t *testing.T) {
+	t.Run("Flowy 随后发送结束事件", func(t *testing.T) {
+		mapper := newStreamMapper(1)
+		events := mapper.mapEvent(&agentSvc.StreamEvent{Error: true, Message: "模型不可用"})
+		if len(events) != 1 || events[0].Type != models.ChatEventError || events[0].Error != "模型不可用" {
+			t.Fatalf("错误事件 = %+v", events)
+		}
+		if mapper.finished {
+			t.Fatal("错误事件不应结束生成")
+		}
+
+		events = mapper.mapEvent(&agentSvc.StreamEvent{EventType: models.ChatEventFinish, FinishReason: models.FinishReasonStop})
+		if last := events[len(events)-1]; last.Type != models.ChatEventFinish || last.FinishReason != models.FinishReasonError {
+			t.Errorf("结束事件 = %+v, want FinishReason %q", last, models.FinishReasonError)
+		}
+	})
+
+	t.Run("流结束时补发结束事件", func(t *testing.T) {
+		mapper := newStreamMapper(1)
+		events := mapper.mapEvent(&agentSvc.StreamEvent{Error: true})
+		if events[0].Error != "Flowy 返回错误" {
+			t.Errorf("没有错误信息时 Error = %q, want 默认信息", events[0].Error)
+		}
+		if finish := mapper.finish("生成失败", models.FinishReasonStop, 0); finish.FinishReason != models.FinishReasonError {
+			t.Errorf("FinishReason = %q, want %q", finish.FinishReason, models.FinishReasonError)
+		}
+	})
+
+	t.Run("请求失败", func(t *testing.T) {
+		mapper := newStreamMapper(1)
+		events := mapper.fail(errors.New("连接断开"))
+		if got := eventTypes(events); !reflect.DeepEqual(got, []string{models.ChatEventError, models.ChatEventFinish}) {
+			t.Fatalf("事件 = %v", got)
+		}
+		if events[0].Error != "连接断开" || events[1].FinishReason != models.FinishReasonError {
+			t.Errorf("事件 = %+v", events)
+		}
+	})
+}
+
+func TestChartFromEvent(t *testing.T) {
+	if _, ok := chartFromEvent(&agentSvc.StreamEvent{ChartData: "", StructData: agentSvc.StructData{JSON: map[string]interface{}{}}}); ok {
+		t.Error("空的图表数据不应输出图表")
+	}
+
+	mapper := newStreamMapper(1)
+	chartEvent := agentSvc.StreamEvent{EventType: models.ChatEventDelta, ChartData: map[string]interface{}{"type": "bar"}}
+	if got := eventTypes(mapper.mapEvent(&chartEvent)); !reflect.DeepEqual(got, []string{models.ChatEventChart}) {
+		t.Fatalf("事件 = %v, want 图表事件", got)
+	}
+	// 图表只输出一次
+	if got := eventTypes(mapper.mapEvent(&chartEvent)); len(got) != 0 {
+		t.Errorf("重复的图表输出了 %v", got)
+	}
+}
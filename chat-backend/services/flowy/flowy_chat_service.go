@@ -2,32 +2,68 @@ package flowy
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"chat-backend/models"
+	"chat-backend/pkg/database"
 	"chat-backend/services/interfaces"
 	"chat-backend/utils"
 	"flowy-sdk"
 	agentSvc "flowy-sdk/services/agent"
 )
 
+// 会话索引重建参数
+const (
+	sessionIndexRebuildInterval = time.Minute      // 两次从 Flowy 重建会话索引的最小间隔
+	sessionIndexRebuildTimeout  = 30 * time.Minute // 后台重建会话索引的超时时间
+)
+
+// sessionIndexBuiltKey 记录会话索引已从 Flowy 完整重建过的元数据键
+const sessionIndexBuiltKey = "flowy_session_index_built"
+
+// 会话记录镜像参数
+const (
+	messageSyncTimeout   = 30 * time.Second // 发送消息后后台镜像的超时时间
+	searchSyncSessionMax = 20               // 每次搜索前最多镜像的未同步会话数
+)
+
 // FlowyChatService 基于 flowy-sdk 的聊天服务实现
 type FlowyChatService struct {
 	sdk                    *flowy.SDK
+	db                     *database.Database // 本地会话索引：会话 -> Agent/配置/模型
 	defaultSettingsService interfaces.DefaultSettingsServiceInterface
+
+	rebuildMu   sync.Mutex
+	lastRebuild time.Time
+	rebuilding  chan struct{} // 进行中的重建结束时关闭，没有重建时为 nil
 }
 
 // NewFlowyChatService 创建 Flowy 聊天服务
-func NewFlowyChatService(sdk *flowy.SDK, defaultSettingsService interfaces.DefaultSettingsServiceInterface) interfaces.ChatServiceInterface {
+func NewFlowyChatService(sdk *flowy.SDK, db *database.Database, defaultSettingsService interfaces.DefaultSettingsServiceInterface) interfaces.ChatServiceInterface {
 	return &FlowyChatService{
 		sdk:                    sdk,
+		db:                     db,
 		defaultSettingsService: defaultSettingsService,
 	}
 }
 
 // CreateConversation 创建对话
 func (s *FlowyChatService) CreateConversation(ctx context.Context, settings *models.ConversationSettings) (*models.Conversation, error) {
+	return s.createConversation(ctx, settings, nil)
+}
+
+// createConversation 依次创建 Agent、配置和会话，history 为导入的历史消息，附加在系统提示词之后
+// 指定了助手时只在助手的配置下创建会话
+func (s *FlowyChatService) createConversation(ctx context.Context, settings *models.ConversationSettings, history []models.MessageRecord) (*models.Conversation, error) {
 	// 如果没有提供设置，使用持久化的默认配置
 	if settings == nil {
 		defaultSettings := s.defaultSettingsService.GetDefaultSettings()
@@ -48,238 +84,509 @@ func (s *FlowyChatService) CreateConversation(ctx context.Context, settings *mod
 		utils.LogInfo("创建对话: %s", settings.Name)
 	}
 
-	// 步骤1: 创建一个新的Agent
-	createAgentReq := &agentSvc.CreateAgentRequest{
-		Name:   settings.Name,
-		Desc:   settings.Desc,
-		Type:   0,  // 默认类型为0 (多轮对话)
-		Avatar: "", // 默认无头像
+	if settings.AssistantID != 0 {
+		return s.createAssistantConversation(ctx, settings)
 	}
 
-	agentID, err := s.sdk.Agent.CreateAgent(ctx, createAgentReq)
+	// 步骤1-2: 创建Agent及其配置
+	agentID, settingID, err := createAgentSetting(ctx, s.sdk, settings, history, false)
 	if err != nil {
-		return nil, fmt.Errorf("创建Agent失败: %w", err)
+		return nil, err
 	}
 
-	utils.InfoWith("Agent创建成功", "agent_id", agentID, "title", settings.Name)
+	// 步骤3: 创建会话
+	createSessionReq := &agentSvc.CreateSessionRequest{
+		SettingID:  settingID,
+		PromptVars: sessionPromptVars(settings.PromptVars),
+	}
 
-	// 步骤2: 为这个Agent创建一个配置，使用传入的设置参数
-	// 根据模型ID获取模型名称
-	modelName, err := s.getModelNameByID(ctx, settings.ModelID)
+	session, err := s.sdk.Agent.CreateSession(ctx, createSessionReq)
 	if err != nil {
-		// 如果获取模型名称失败,清理已创建的Agent
+		// 如果会话创建失败,需要清理已创建的配置和Agent
+		_ = s.sdk.Agent.DeleteConfig(ctx, settingID)
 		_ = s.sdk.Agent.DeleteAgent(ctx, agentID)
-		return nil, fmt.Errorf("获取模型名称失败: %w", err)
+		return nil, fmt.Errorf("创建会话失败: %w", err)
 	}
 
-	utils.InfoWith("使用模型", "model_id", settings.ModelID, "model_name", modelName)
+	utils.InfoWith("会话创建成功", "session_id", session.ID, "setting_id", settingID, "agent_id", agentID)
 
-	// 处理知识库配置
-	knowledgeIDs := []int{}
-	enableKnowledge := false
-	if len(settings.KnowledgeBaseIDs) > 0 {
-		enableKnowledge = true
-		for _, kbID := range settings.KnowledgeBaseIDs {
-			knowledgeIDs = append(knowledgeIDs, kbID)
-		}
+	// 写入本地会话索引，索引缺失时可从 Flowy 重建，因此失败不影响创建结果
+	if err := s.db.SaveFlowySession(models.NewFlowySessionGORM(session.ID, agentID, settingID, settings)); err != nil {
+		utils.ErrorWith("写入会话索引失败", "session_id", session.ID, "error", err)
 	}
 
-	// 使用工厂函数创建默认配置
-	saveConfigReq := agentSvc.NewDefaultSettingConfig(agentID, settings.Name)
+	// 转换为Conversation模型
+	return &models.Conversation{
+		ID:                   session.ID,
+		ConversationSettings: *settings,
+	}, nil
+}
 
-	// 覆盖需要自定义的配置
-	saveConfigReq.Chat.Stream = settings.Stream
-	saveConfigReq.Chat.Model.ID = settings.ModelID
-	saveConfigReq.Chat.Model.Temperature = settings.Temperature
-	saveConfigReq.Chat.Model.TopP = settings.TopP
-	saveConfigReq.Chat.Model.PresencePenalty = settings.PresencePenalty
-	saveConfigReq.Chat.Model.FrequencyPenalty = settings.FrequencyPenalty
-	saveConfigReq.Chat.Model.ResponseType = settings.ResponseType
-	saveConfigReq.Chat.ContextLimit = settings.ContextLimit
-
-	// 设置系统提示词
-	saveConfigReq.Chat.Prompt.Prompts = []agentSvc.Prompt{
-		{
-			Role: 0,
-			Text: "你是一个有帮助的AI助手。",
-		},
+// createAssistantConversation 在助手的配置下创建会话，除名称和描述外的设置取自助手
+func (s *FlowyChatService) createAssistantConversation(ctx context.Context, settings *models.ConversationSettings) (*models.Conversation, error) {
+	assistant, err := s.db.GetAssistant(settings.AssistantID)
+	if err != nil {
+		return nil, err
 	}
+	conversationSettings := assistant.ConversationSettings(settings.Name, settings.Desc)
 
-	// 设置知识库配置
-	saveConfigReq.Chat.Plugin.Knowledge.Enable = enableKnowledge
-	saveConfigReq.Chat.Plugin.Knowledge.Knowledges = knowledgeIDs
+	session, err := s.sdk.Agent.CreateSession(ctx, &agentSvc.CreateSessionRequest{
+		SettingID:  assistant.FlowySettingID,
+		PromptVars: sessionPromptVars(conversationSettings.PromptVars),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建会话失败: %w", err)
+	}
+
+	utils.InfoWith("会话创建成功", "session_id", session.ID, "assistant_id", assistant.ID, "setting_id", assistant.FlowySettingID)
+
+	// 写入本地会话索引，索引缺失时可从 Flowy 重建，因此失败不影响创建结果
+	if err := s.db.SaveFlowySession(models.NewFlowySessionGORM(session.ID, assistant.FlowyAgentID, assistant.FlowySettingID, conversationSettings)); err != nil {
+		utils.ErrorWith("写入会话索引失败", "session_id", session.ID, "error", err)
+	}
+
+	return &models.Conversation{
+		ID:                   session.ID,
+		ConversationSettings: *conversationSettings,
+	}, nil
+}
 
-	settingID, err := s.sdk.Agent.SaveConfig(ctx, saveConfigReq)
+// ImportConversation 创建对话并将导入的历史消息保存到本地历史覆盖层
+// Flowy 无法写入既有的会话记录，因此将最近的历史写入系统提示词作为上下文，使对话可以继续
+// 历史须写入独立配置的系统提示词，因此导入的对话不属于任何助手
+func (s *FlowyChatService) ImportConversation(ctx context.Context, settings *models.ConversationSettings, messages []models.MessageRecord) (*models.Conversation, error) {
+	detached := *settings
+	detached.AssistantID = 0
+	conversation, err := s.createConversation(ctx, &detached, messages)
 	if err != nil {
-		// 如果配置创建失败,需要清理已创建的Agent
-		_ = s.sdk.Agent.DeleteAgent(ctx, agentID)
-		return nil, fmt.Errorf("创建配置失败: %w", err)
+		return nil, err
 	}
 
-	utils.InfoWith("配置创建成功", "setting_id", settingID, "agent_id", agentID)
+	if err := s.db.SaveFlowyHistoryOverlay(conversation.ID, messages); err != nil {
+		// 清理已创建的会话、配置和Agent
+		if delErr := s.DeleteConversation(ctx, conversation.ID); delErr != nil {
+			utils.ErrorWith("清理导入失败的对话失败", "session_id", conversation.ID, "error", delErr)
+		}
+		return nil, err
+	}
 
-	// 步骤3: 创建会话
-	createSessionReq := &agentSvc.CreateSessionRequest{
-		SettingID:  settingID,
-		PromptVars: []agentSvc.PromptVar{},
+	utils.InfoWith("对话导入成功", "session_id", conversation.ID, "message_count", len(messages))
+	return conversation, nil
+}
+
+// ForkConversation 以相同设置创建新会话，截至指定消息（含）的历史保存到新会话的本地历史覆盖层并作为上下文
+func (s *FlowyChatService) ForkConversation(ctx context.Context, conversationID int, messageID int) (*models.Conversation, error) {
+	utils.InfoWith("创建对话分支", "conversation_id", conversationID, "message_id", messageID)
+
+	settings, err := s.GetConversationSettings(ctx, conversationID)
+	if err != nil {
+		return nil, err
 	}
 
-	session, err := s.sdk.Agent.CreateSession(ctx, createSessionReq)
+	history, err := s.GetConversationHistory(ctx, conversationID)
 	if err != nil {
-		// 如果会话创建失败,需要清理已创建的配置和Agent
-		_ = s.sdk.Agent.DeleteConfig(ctx, settingID)
-		_ = s.sdk.Agent.DeleteAgent(ctx, agentID)
-		return nil, fmt.Errorf("创建会话失败: %w", err)
+		return nil, err
 	}
 
-	utils.InfoWith("会话创建成功", "session_id", session.ID, "setting_id", settingID, "agent_id", agentID)
+	// 分支点须为 Flowy 的会话记录（导入的历史消息没有记录ID）
+	cut := -1
+	for i, message := range history.Messages {
+		if !message.Imported && message.ID == messageID {
+			cut = i
+			break
+		}
+	}
+	if cut < 0 {
+		return nil, fmt.Errorf("对话 %d 中不存在消息 %d: %w", conversationID, messageID, database.ErrNotFound)
+	}
 
-	// 转换为Conversation模型
-	return &models.Conversation{
-		ID:                   session.ID,
-		ConversationSettings: *settings,
-	}, nil
+	conversation, err := s.ImportConversation(ctx, settings, history.Messages[:cut+1])
+	if err != nil {
+		return nil, err
+	}
+
+	utils.InfoWith("对话分支创建成功", "session_id", conversation.ID, "source_id", conversationID, "message_count", cut+1)
+	return conversation, nil
 }
 
 // SendMessage 发送消息并返回SSE流
 func (s *FlowyChatService) SendMessage(ctx context.Context, req *models.ChatRequest, eventChan chan<- models.SSEChatEvent) error {
 	utils.InfoWith("开始流式发送消息", "conversation_id", req.ConversationID, "content", req.Content)
 
-	defer close(eventChan)
+	// 对话首次收到附件时开启文件分析插件
+	if len(req.Files) > 0 {
+		if err := s.enableFileAnalyzer(ctx, req.ConversationID); err != nil {
+			close(eventChan)
+			return err
+		}
+	}
+
+	// 生成回答时的模型和知识库随回答保存，评价时据此统计
+	settings, err := s.GetConversationSettings(ctx, req.ConversationID)
+	if err != nil {
+		close(eventChan)
+		return err
+	}
+
+	// 重新生成或编辑过的对话在最新的后续会话中继续，其第一条提问带上保留的历史
+	sessionID, segment, err := s.currentSession(req.ConversationID)
+	if err != nil {
+		close(eventChan)
+		return err
+	}
+	content := req.Content
+	if segment != nil && !segment.Seeded {
+		content = segment.HistoryPrompt + content
+	}
 
 	// 创建 SDK 的 AsyncChatRequest
 	asyncReq := &agentSvc.AsyncChatRequest{
-		SessionID: req.ConversationID,
-		Content:   req.Content,
-		Files:     []string{}, // Files字段已移除，使用空数组
+		SessionID: sessionID,
+		Content:   content,
+		Files:     req.Files,     // 附件的 OSS 名称，由 UploadChatFile 返回
 		RequestID: req.RequestID, // 使用请求中的RequestID
 	}
 
 	// 创建转换通道
 	flowyEventChan := make(chan agentSvc.StreamEvent, 10)
-	
-	// 启动转换 goroutine
+
+	// 启动转换 goroutine，将 Flowy 事件映射为类型化的聊天事件并累积回答内容，ctx 被取消后不再转发
+	mapper := newStreamMapper(req.ConversationID)
+	converted := make(chan struct{})
 	go func() {
-		defer close(eventChan)
+		defer close(converted)
 		for event := range flowyEventChan {
-			// 转换为我们的 SSEChatEvent
-			sseEvent := models.SSEChatEvent{
-				Type:  event.EventType,
-				Data:  event.Message,
-				ID:    fmt.Sprintf("%d", event.SessionID),
-				Error: "",
-			}
-			if event.Error {
-				sseEvent.Error = "Error occurred"
-			}
-			eventChan <- sseEvent
+			sendEvents(ctx, eventChan, mapper.mapEvent(&event))
 		}
 	}()
 
-	// 调用 SDK 的流式对话接口
-	err := s.sdk.Agent.ChatAsync(ctx, asyncReq, flowyEventChan)
-	if err != nil {
+	// 调用 SDK 的流式对话接口，返回后不会再写入 flowyEventChan
+	err = s.sdk.Agent.ChatAsync(ctx, asyncReq, flowyEventChan)
+	close(flowyEventChan)
+	<-converted
+	defer close(eventChan)
+
+	if segment != nil && !segment.Seeded && (err == nil || mapper.finished) {
+		if err := s.db.MarkFlowySessionSegmentSeeded(sessionID); err != nil {
+			utils.ErrorWith("更新后续会话失败", "session_id", sessionID, "error", err)
+		}
+	}
+
+	// 收到结束事件后的错误（如结束后连接被取消）不影响本次生成
+	if err != nil && !mapper.finished {
+		if ctx.Err() != nil {
+			// 停止生成或客户端断开，保存已生成的部分
+			utils.InfoWith("生成已中断", "conversation_id", req.ConversationID, "request_id", req.RequestID, "answer_length", mapper.answer.Len())
+			go s.saveStoppedAnswer(req, settings, mapper.answer.String())
+			return nil
+		}
 		utils.ErrorWith("流式发送消息失败", "conversation_id", req.ConversationID, "error", err)
+		sendEvents(ctx, eventChan, mapper.fail(err))
 		return err
 	}
+	if mapper.errMessage != "" {
+		utils.ErrorWith("Flowy 返回错误", "conversation_id", req.ConversationID, "request_id", req.RequestID, "error", mapper.errMessage)
+	}
+	if !mapper.finished {
+		message := "处理完成"
+		if mapper.errMessage != "" {
+			message = "生成失败"
+		}
+		sendEvents(ctx, eventChan, []models.SSEChatEvent{mapper.finish(message, models.FinishReasonStop, 0)})
+	}
+
+	// 后台将新的会话记录镜像到本地，供消息搜索使用
+	go func() {
+		syncCtx, cancel := context.WithTimeout(context.Background(), messageSyncTimeout)
+		defer cancel()
+		records, err := s.syncSessionMessages(syncCtx, req.ConversationID)
+		if err != nil {
+			utils.ErrorWith("镜像会话记录失败", "session_id", req.ConversationID, "error", err)
+			return
+		}
+		s.saveRequestFiles(req, records)
+		s.saveAnswerSettings(req, settings, records)
+	}()
 
 	utils.InfoWith("流式消息发送完成", "conversation_id", req.ConversationID)
 	return nil
 }
 
-// ListConversations 获取对话列表
-func (s *FlowyChatService) ListConversations(ctx context.Context, page, pageSize int) (*models.ConversationListResponse, error) {
-	utils.LogInfo("获取对话列表")
+// UploadChatFile 上传聊天附件到 Flowy，附件ID为 Flowy 返回的 OSS 名称，由文件分析插件解析
+func (s *FlowyChatService) UploadChatFile(ctx context.Context, filename string, file io.Reader) (*models.ChatFile, error) {
+	resp, err := s.sdk.Agent.UploadChatFile(ctx, file, filename)
+	if err != nil {
+		return nil, fmt.Errorf("上传聊天附件失败: %w", err)
+	}
+
+	id := resp.OSS
+	if id == "" {
+		id = resp.FileID
+	}
+	name := resp.Name
+	if name == "" {
+		name = filename
+	}
+
+	utils.InfoWith("聊天附件上传成功", "file_id", id, "name", name, "size", resp.Size)
+	return &models.ChatFile{
+		ID:          id,
+		Name:        name,
+		Size:        resp.Size,
+		ContentType: mime.TypeByExtension(filepath.Ext(filename)),
+	}, nil
+}
+
+// enableFileAnalyzer 在会话配置中开启文件分析插件，已开启时不做修改
+// 助手的配置由同一助手的全部对话共用，由助手服务在创建和修改助手时开启，这里不做修改
+func (s *FlowyChatService) enableFileAnalyzer(ctx context.Context, sessionID int) error {
+	info, err := s.findSessionInfo(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("查找会话配置失败: %w", err)
+	}
+	if info.Settings != nil && info.Settings.AssistantID != 0 {
+		return nil
+	}
+	if err := s.loadSessionConfig(ctx, info); err != nil {
+		return fmt.Errorf("查找会话配置失败: %w", err)
+	}
+	if info.Config.Chat == nil || info.Config.Chat.Plugin.FileAnalyzer.Enable {
+		return nil
+	}
 
-	// 获取所有Agent的会话
-	agentList, err := s.sdk.Agent.ListAgentsByPage(ctx, 1, 100)
+	config := *info.Config
+	config.AgentID = info.AgentID
+	config.Chat.Plugin.FileAnalyzer.Enable = true
+	if _, err := s.sdk.Agent.SaveConfig(ctx, &config); err != nil {
+		return fmt.Errorf("开启文件分析插件失败: %w", err)
+	}
+
+	utils.InfoWith("已开启文件分析插件", "session_id", sessionID, "setting_id", info.SettingID)
+	return nil
+}
+
+// RegenerateMessage 归档消息所在的最后一轮对话，返回以原提问重新生成回答的请求
+// Flowy 无法删除会话记录，对话在新的后续会话中继续，对话ID不变
+func (s *FlowyChatService) RegenerateMessage(ctx context.Context, messageID int) (*models.ChatRequest, error) {
+	return s.rewindTurn(ctx, messageID, "")
+}
+
+// EditMessage 归档最后一轮对话，返回以新内容重新提问的请求
+func (s *FlowyChatService) EditMessage(ctx context.Context, messageID int, content string) (*models.ChatRequest, error) {
+	return s.rewindTurn(ctx, messageID, content)
+}
+
+// rewindTurn 将消息所在的最后一轮对话保存为历史版本，content 为空时沿用原提问，附件总是沿用原提问的附件
+// 在对话的配置下创建后续会话，被归档轮次之前的历史作为其第一条提问的前缀，使被归档的轮次不再作为上下文发送给模型；
+// 对话ID、所属助手以及此前的会话记录和评价保持不变
+func (s *FlowyChatService) rewindTurn(ctx context.Context, messageID int, content string) (*models.ChatRequest, error) {
+	conversationID, history, turn, err := s.findMessageTurn(ctx, messageID)
 	if err != nil {
-		return nil, fmt.Errorf("获取Agent列表失败: %w", err)
+		return nil, err
+	}
+	if turn.End != len(history.Messages) {
+		return nil, models.ErrMessageNotLatest
+	}
+	if content != "" && history.Messages[turn.Start].ID != messageID {
+		return nil, fmt.Errorf("只能编辑用户消息: %w", models.ErrMessageNotEditable)
+	}
+	if history.Messages[turn.Start].Imported {
+		return nil, fmt.Errorf("导入的历史消息不支持重新生成: %w", models.ErrMessageNotEditable)
 	}
 
-	var allConversations []models.Conversation
+	info, err := s.findSessionInfo(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	previous, _, err := s.currentSession(conversationID)
+	if err != nil {
+		return nil, err
+	}
 
-	// 遍历agents获取会话
-	for _, agent := range agentList.Records {
+	session, err := s.sdk.Agent.CreateSession(ctx, &agentSvc.CreateSessionRequest{
+		SettingID:  info.SettingID,
+		PromptVars: sessionPromptVars(info.Settings.PromptVars),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建后续会话失败: %w", err)
+	}
 
-		// 获取Agent的配置
-		configs, err := s.sdk.Agent.ListConfigs(ctx, agent.ID)
-		if err != nil {
-			continue // 跳过错误的agent
+	segment := &models.FlowySessionSegmentGORM{
+		SessionID:      session.ID,
+		ConversationID: conversationID,
+		HistoryPrompt:  seedHistoryQuestion(history.Messages[:turn.Start], info.Settings.ContextLimit),
+	}
+	variant := models.NewMessageVariantGORM(conversationID, history.Messages, turn)
+	if err := s.db.SaveFlowySessionSegment(segment); err != nil {
+		s.deleteSegmentSession(ctx, session.ID)
+		return nil, err
+	}
+	if err := s.db.SaveMessageVariant(variant); err != nil {
+		if delErr := s.db.DeleteFlowySessionSegment(session.ID); delErr != nil {
+			utils.ErrorWith("清理后续会话失败", "session_id", session.ID, "error", delErr)
 		}
+		s.deleteSegmentSession(ctx, session.ID)
+		return nil, err
+	}
 
-		// 获取每个配置的会话列表
-		for _, config := range configs {
-			sessions, err := s.sdk.Agent.ListSessions(ctx, config.ID, nil)
-			if err != nil {
-				continue
-			}
+	// 此前的后续会话只包含被归档的轮次时不再需要
+	if previous != conversationID {
+		s.pruneSegment(ctx, previous, history.Messages[turn.Start].ID)
+	}
 
-			for _, session := range sessions {
-				// 使用工厂函数创建默认设置，然后从session和config中提取真实的值
-				settings := models.NewDefaultConversationSettings()
-				settings.Name = agent.Name // 使用会话名称
-				settings.Desc = agent.Desc // 使用Agent描述
-
-				// 从配置中提取真实的值
-				if config.Chat != nil {
-					settings.Temperature = config.Chat.Model.Temperature
-					settings.TopP = config.Chat.Model.TopP
-					settings.PresencePenalty = config.Chat.Model.PresencePenalty
-					settings.FrequencyPenalty = config.Chat.Model.FrequencyPenalty
-					settings.ResponseType = config.Chat.Model.ResponseType
-					settings.Stream = config.Chat.Stream
-					settings.ContextLimit = config.Chat.ContextLimit
-					settings.ModelID = config.Chat.Model.ID
-
-					// 提取知识库配置
-					if config.Chat.Plugin.Knowledge.Enable && len(config.Chat.Plugin.Knowledge.Knowledges) > 0 {
-						settings.KnowledgeBaseIDs = []int{}
-						for _, kbID := range config.Chat.Plugin.Knowledge.Knowledges {
-							settings.KnowledgeBaseIDs = append(settings.KnowledgeBaseIDs, kbID)
-						}
-					}
-				}
+	if content == "" {
+		content = variant.Question
+	}
+	utils.InfoWith("已归档对话轮次", "conversation_id", conversationID, "session_id", session.ID, "turn", turn.Index, "edited", content != variant.Question)
+	return &models.ChatRequest{ConversationID: conversationID, Content: content, Files: history.Messages[turn.Start].Files}, nil
+}
 
-				conv := models.Conversation{
-					ID:                   session.ID,
-					ConversationSettings: *settings,
-				}
-				allConversations = append(allConversations, conv)
-			}
+// currentSession 获取对话当前继续的 Flowy 会话，重新生成或编辑过时为最新的后续会话，否则为对话最初的会话
+func (s *FlowyChatService) currentSession(conversationID int) (int, *models.FlowySessionSegmentGORM, error) {
+	segments, err := s.db.ListFlowySessionSegments(conversationID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(segments) == 0 {
+		return conversationID, nil, nil
+	}
+	segment := &segments[len(segments)-1]
+	return segment.SessionID, segment, nil
+}
+
+// pruneSegment 后续会话的记录均属于被归档的轮次（ID 不小于 firstID）时删除该会话，失败时仅记录日志
+func (s *FlowyChatService) pruneSegment(ctx context.Context, sessionID, firstID int) {
+	recordsResp, err := s.sdk.Agent.GetSessionRecords(ctx, sessionID)
+	if err != nil {
+		utils.WarnWith("获取后续会话记录失败", "session_id", sessionID, "error", err)
+		return
+	}
+	for _, record := range recordsResp.Records {
+		if record.ID < firstID {
+			return
 		}
 	}
 
-	// 增加对 page 和 pageSize 的校验
-	if page <= 0 {
-		page = 1
+	if err := s.sdk.Agent.DeleteSession(ctx, sessionID); err != nil {
+		utils.WarnWith("删除已归档的后续会话失败", "session_id", sessionID, "error", err)
+		return
+	}
+	if err := s.db.DeleteFlowySessionSegment(sessionID); err != nil {
+		utils.ErrorWith("删除后续会话失败", "session_id", sessionID, "error", err)
+	}
+}
+
+// deleteSegmentSession 清理创建失败的后续会话，失败时仅记录日志
+func (s *FlowyChatService) deleteSegmentSession(ctx context.Context, sessionID int) {
+	if err := s.sdk.Agent.DeleteSession(ctx, sessionID); err != nil {
+		utils.ErrorWith("清理后续会话失败", "session_id", sessionID, "error", err)
+	}
+}
+
+// GetMessageAlternates 获取消息所在轮次的全部版本
+func (s *FlowyChatService) GetMessageAlternates(ctx context.Context, messageID int) (*models.MessageAlternatesResponse, error) {
+	sessionID, history, turn, err := s.findMessageTurn(ctx, messageID)
+	if err != nil {
+		return nil, err
 	}
-	if pageSize <= 0 {
-		pageSize = 10 // 或者一个合理的默认值
+	variants, err := s.db.ListMessageVariants(sessionID)
+	if err != nil {
+		return nil, err
 	}
+	return models.NewMessageAlternatesResponse(sessionID, history.Messages, turn, variants), nil
+}
 
-	start := (page - 1) * pageSize
-	end := start + pageSize
+// SubmitFeedback 评价回答，保存到本地后同步到 Flowy 的赞/踩
+// 同步失败不影响本地保存的评价
+func (s *FlowyChatService) SubmitFeedback(ctx context.Context, messageID int, req *models.MessageFeedbackRequest) (*models.MessageFeedback, error) {
+	sessionID, history, turn, err := s.findMessageTurn(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := s.GetConversationSettings(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
 
-	var pagedConversations []models.Conversation
+	feedback, err := models.NewMessageFeedbackGORM(sessionID, settings, history.Messages, turn, messageID, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SaveMessageFeedback(feedback); err != nil {
+		return nil, err
+	}
 
-	// 确保 start 不会越界
-	if start < len(allConversations) {
-		// 如果 end 越界，Go 的切片操作会自动处理
-		if end > len(allConversations) {
-			end = len(allConversations)
-		}
-		pagedConversations = allConversations[start:end]
+	if req.Rating == models.FeedbackLike {
+		err = s.sdk.Agent.LikeMessage(ctx, strconv.Itoa(messageID))
 	} else {
-		// 如果 start 已经超出范围，直接返回空切片
-		pagedConversations = []models.Conversation{}
+		err = s.sdk.Agent.DislikeMessage(ctx, strconv.Itoa(messageID))
+	}
+	if err != nil {
+		utils.WarnWith("同步评价到 Flowy 失败", "session_id", sessionID, "message_id", messageID, "error", err)
+	}
+
+	utils.InfoWith("回答评价已保存", "session_id", sessionID, "message_id", messageID, "rating", req.Rating)
+	return feedback.ToMessageFeedback(), nil
+}
+
+// GetFeedbackReport 汇总本地保存的回答评价
+func (s *FlowyChatService) GetFeedbackReport(ctx context.Context, req *models.FeedbackReportRequest) (*models.FeedbackReport, error) {
+	feedback, err := s.db.ListMessageFeedback(req.Since, req.Until, req.ModelID)
+	if err != nil {
+		return nil, err
+	}
+	return models.NewFeedbackReport(req, feedback), nil
+}
+
+// findMessageTurn 通过本地镜像确定消息所属的会话，返回会话历史及消息所在的轮次
+func (s *FlowyChatService) findMessageTurn(ctx context.Context, messageID int) (int, *models.ConversationHistoryResponse, *models.MessageTurn, error) {
+	sessionID, err := s.db.GetMessageConversationID(messageID)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	history, err := s.GetConversationHistory(ctx, sessionID)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	turn, ok := models.FindMessageTurn(history.Messages, messageID)
+	if !ok {
+		return 0, nil, nil, fmt.Errorf("消息 %d 不属于任何一轮对话: %w", messageID, database.ErrNotFound)
+	}
+	return sessionID, history, turn, nil
+}
+
+// ListConversations 获取对话列表
+func (s *FlowyChatService) ListConversations(ctx context.Context, req *models.ConversationListRequest) (*models.ConversationListResponse, error) {
+	utils.LogInfo("获取对话列表")
+
+	if err := req.Normalize(); err != nil {
+		return nil, err
+	}
+
+	// 本地索引尚未完整重建过时（首次启动或升级后）在后台从 Flowy 重建，本次返回索引中已有的对话
+	if _, err := s.db.GetMetadata(sessionIndexBuiltKey); err != nil {
+		if !errors.Is(err, database.ErrNotFound) {
+			return nil, err
+		}
+		s.startSessionIndexRebuild()
+	}
+
+	sessions, total, err := s.db.ListFlowySessions(req)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := make([]models.Conversation, 0, len(sessions))
+	for i := range sessions {
+		conversations = append(conversations, *sessions[i].ToConversation())
 	}
 
 	return &models.ConversationListResponse{
-		Conversations: pagedConversations,
-		Total:         len(allConversations),
-		Page:          page,
-		PageSize:      pageSize,
+		Conversations: conversations,
+		Total:         int(total),
+		Page:          req.Page,
+		PageSize:      req.PageSize,
 	}, nil
 }
 
@@ -297,7 +604,19 @@ func (s *FlowyChatService) DeleteConversation(ctx context.Context, conversationI
 
 	utils.InfoWith("找到会话关联", "session_id", sessionID, "setting_id", sessionInfo.SettingID, "agent_id", sessionInfo.AgentID)
 
-	// 步骤2: 删除会话
+	// 步骤2: 删除重新生成或编辑时创建的后续会话和对话最初的会话
+	segments, err := s.db.ListFlowySessionSegments(sessionID)
+	if err != nil {
+		return err
+	}
+	for i := range segments {
+		if err := s.sdk.Agent.DeleteSession(ctx, segments[i].SessionID); err != nil {
+			return fmt.Errorf("删除后续会话失败: %w", err)
+		}
+		if err := s.db.DeleteFlowySessionSegment(segments[i].SessionID); err != nil {
+			return err
+		}
+	}
 	err = s.sdk.Agent.DeleteSession(ctx, sessionID)
 	if err != nil {
 		return fmt.Errorf("删除会话失败: %w", err)
@@ -305,31 +624,33 @@ func (s *FlowyChatService) DeleteConversation(ctx context.Context, conversationI
 
 	utils.InfoWith("会话已删除", "session_id", sessionID)
 
-	// 步骤3: 删除配置
-	err = s.sdk.Agent.DeleteConfig(ctx, sessionInfo.SettingID)
-	if err != nil {
-		utils.ErrorWith("删除配置失败", "setting_id", sessionInfo.SettingID, "error", err)
-		// 继续删除Agent，即使配置删除失败
-	} else {
-		utils.InfoWith("配置已删除", "setting_id", sessionInfo.SettingID)
+	// 步骤3: 删除配置和Agent，从助手创建的对话共用助手的配置和Agent，不删除
+	if sessionInfo.Settings.AssistantID == 0 {
+		if err := deleteAgentSetting(ctx, s.sdk, sessionInfo.AgentID, sessionInfo.SettingID); err != nil {
+			return err
+		}
 	}
 
-	// 步骤4: 删除Agent
-	err = s.sdk.Agent.DeleteAgent(ctx, sessionInfo.AgentID)
-	if err != nil {
-		utils.ErrorWith("删除Agent失败", "agent_id", sessionInfo.AgentID, "error", err)
-		return fmt.Errorf("删除Agent失败: %w", err)
+	if err := s.db.DeleteFlowySession(sessionID); err != nil {
+		utils.ErrorWith("删除会话索引失败", "session_id", sessionID, "error", err)
 	}
-
-	utils.InfoWith("Agent已删除", "agent_id", sessionInfo.AgentID)
-	utils.LogInfo("对话及其关联的配置和Agent已全部删除: %s", conversationID)
+	if err := s.db.DeleteMessages(sessionID); err != nil {
+		utils.ErrorWith("删除会话记录镜像失败", "session_id", sessionID, "error", err)
+	}
+	if err := s.db.DeleteFlowyHistoryOverlay(sessionID); err != nil {
+		utils.ErrorWith("删除历史覆盖层失败", "session_id", sessionID, "error", err)
+	}
+	if err := s.db.DeleteMessageVariants(sessionID); err != nil {
+		utils.ErrorWith("删除消息历史版本失败", "session_id", sessionID, "error", err)
+	}
+	utils.LogInfo("对话已删除: %d", conversationID)
 
 	return nil
 }
 
 // GetConversations 获取对话列表 (别名方法)
-func (s *FlowyChatService) GetConversations(ctx context.Context, page, pageSize int) (*models.ConversationListResponse, error) {
-	return s.ListConversations(ctx, page, pageSize)
+func (s *FlowyChatService) GetConversations(ctx context.Context, req *models.ConversationListRequest) (*models.ConversationListResponse, error) {
+	return s.ListConversations(ctx, req)
 }
 
 // UpdateConversationSettings 更新对话设置
@@ -344,6 +665,15 @@ func (s *FlowyChatService) UpdateConversationSettings(ctx context.Context, conve
 		return fmt.Errorf("查找会话配置失败: %w", err)
 	}
 
+	// 从助手创建的对话共用助手的配置，只在本地索引中更新名称和描述
+	if sessionInfo.Settings.AssistantID != 0 {
+		return s.updateAssistantConversation(sessionID, sessionInfo, settings)
+	}
+
+	if err := s.loadSessionConfig(ctx, sessionInfo); err != nil {
+		return fmt.Errorf("查找会话配置失败: %w", err)
+	}
+
 	// 如果 Name 或 Desc 有变化，则更新 Agent
 	if settings.Name != "" && settings.Name != sessionInfo.AgentName || settings.Desc != sessionInfo.AgentDesc {
 		updateAgentReq := &agentSvc.UpdateAgentRequest{
@@ -367,6 +697,12 @@ func (s *FlowyChatService) UpdateConversationSettings(ctx context.Context, conve
 		}
 	}
 
+	// 导入的历史消息保存在系统提示词中，更新提示词时需要保留
+	overlay, err := s.db.ListFlowyHistoryOverlay(sessionID)
+	if err != nil {
+		return err
+	}
+
 	// 构建更新的配置请求，基于现有配置
 	updateReq := &agentSvc.SaveConfigRequest{
 		AgentID: sessionInfo.AgentID,
@@ -378,33 +714,8 @@ func (s *FlowyChatService) UpdateConversationSettings(ctx context.Context, conve
 	if sessionInfo.Config.Chat != nil {
 		chatConfig := sessionInfo.Config.Chat
 
-		// 更新模型配置
-		chatConfig.Model.Temperature = settings.Temperature
-		chatConfig.Model.TopP = settings.TopP
-		chatConfig.Model.FrequencyPenalty = settings.FrequencyPenalty
-		chatConfig.Model.PresencePenalty = settings.PresencePenalty
-		chatConfig.Model.ResponseType = settings.ResponseType
-		chatConfig.Model.ID = settings.ModelID
-
-		// 更新流式输出设置
-		chatConfig.Stream = settings.Stream
-
-		// 更新上下文限制
-		if settings.ContextLimit > 0 {
-			chatConfig.ContextLimit = settings.ContextLimit
-		}
-
-		// 更新知识库配置
-		if len(settings.KnowledgeBaseIDs) > 0 {
-			chatConfig.Plugin.Knowledge.Enable = true
-			chatConfig.Plugin.Knowledge.Knowledges = []int{}
-			for _, kbID := range settings.KnowledgeBaseIDs {
-				chatConfig.Plugin.Knowledge.Knowledges = append(chatConfig.Plugin.Knowledge.Knowledges, kbID)
-			}
-		} else {
-			chatConfig.Plugin.Knowledge.Enable = false
-			chatConfig.Plugin.Knowledge.Knowledges = []int{}
-		}
+		// 更新模型参数、知识库和工具，导入的历史仍附加在系统提示词之后
+		applyChatSettings(chatConfig, settings, overlay)
 
 		updateReq.Chat = chatConfig
 	} else {
@@ -425,22 +736,8 @@ func (s *FlowyChatService) UpdateConversationSettings(ctx context.Context, conve
 		updateReq.Chat = tempConfig.Chat
 
 		// 覆盖需要自定义的配置
-		updateReq.Chat.Stream = settings.Stream
-		updateReq.Chat.Model.ID = settings.ModelID
 		// updateReq.Chat.Model.Model = modelName
-		updateReq.Chat.Model.Temperature = settings.Temperature
-		updateReq.Chat.Model.TopP = settings.TopP
-		updateReq.Chat.Model.PresencePenalty = settings.PresencePenalty
-		updateReq.Chat.Model.FrequencyPenalty = settings.FrequencyPenalty
-		updateReq.Chat.Model.ResponseType = settings.ResponseType
-		updateReq.Chat.ContextLimit = settings.ContextLimit
-
-		// 设置知识库配置
-		if len(settings.KnowledgeBaseIDs) > 0 {
-			for _, kbID := range settings.KnowledgeBaseIDs {
-				updateReq.Chat.Plugin.Knowledge.Knowledges = append(updateReq.Chat.Plugin.Knowledge.Knowledges, kbID)
-			}
-		}
+		applyChatSettings(updateReq.Chat, settings, overlay)
 	}
 
 	// 保留其他类型的配置
@@ -466,12 +763,40 @@ func (s *FlowyChatService) UpdateConversationSettings(ctx context.Context, conve
 		return fmt.Errorf("保存配置失败: %w", err)
 	}
 
+	// 同步更新本地会话索引
+	indexed := *settings
+	if indexed.Name == "" {
+		indexed.Name = sessionInfo.AgentName
+	}
+	if err := s.db.SaveFlowySession(models.NewFlowySessionGORM(sessionID, sessionInfo.AgentID, sessionInfo.SettingID, &indexed)); err != nil {
+		utils.ErrorWith("更新会话索引失败", "session_id", sessionID, "error", err)
+	}
+
 	utils.InfoWith("对话设置已更新", "conversation_id", conversationID, "setting_id", sessionInfo.SettingID)
 	return nil
 }
 
-// GetConversationSettings 获取对话设置
-func (s *FlowyChatService) GetConversationSettings(ctx context.Context, conversationID int) (*models.ConversationSettings, error) {
+// updateAssistantConversation 更新从助手创建的对话的名称和描述，其他设置取自助手，修改其他设置时返回 ErrAssistantSettings
+func (s *FlowyChatService) updateAssistantConversation(sessionID int, sessionInfo *SessionInfo, settings *models.ConversationSettings) error {
+	assistant, err := s.db.GetAssistant(sessionInfo.Settings.AssistantID)
+	if err != nil {
+		return err
+	}
+
+	indexed, err := assistant.UpdateConversationSettings(sessionInfo.AgentName, settings)
+	if err != nil {
+		return err
+	}
+	if err := s.db.SaveFlowySession(models.NewFlowySessionGORM(sessionID, sessionInfo.AgentID, sessionInfo.SettingID, indexed)); err != nil {
+		return err
+	}
+
+	utils.InfoWith("对话设置已更新", "conversation_id", sessionID, "assistant_id", assistant.ID)
+	return nil
+}
+
+// GetConversationSettings 获取对话设置
+func (s *FlowyChatService) GetConversationSettings(ctx context.Context, conversationID int) (*models.ConversationSettings, error) {
 	utils.InfoWith("获取对话设置", "conversation_id", conversationID)
 
 	sessionID := conversationID
@@ -482,46 +807,8 @@ func (s *FlowyChatService) GetConversationSettings(ctx context.Context, conversa
 		return nil, fmt.Errorf("查找会话配置失败: %w", err)
 	}
 
-	// 将SDK的配置转换为ConversationSettings
-	settings := models.NewDefaultConversationSettings()
-
-	// 从配置中提取设置
-	if sessionInfo.Config.Chat != nil {
-		// 提取模型配置 - 根据模型名称获取模型ID
-		// if sessionInfo.Config.Chat.Model.Model != "" {
-		// 	modelID, err := s.getModelIDByName(ctx, sessionInfo.Config.Chat.Model.Model)
-		// 	if err != nil {
-		// 		utils.ErrorWith("根据模型名称获取模型ID失败", "model_name", sessionInfo.Config.Chat.Model.Model, "error", err)
-		// 		settings.ModelID = 1 // 使用默认模型ID
-		// 	} else {
-		// 		settings.ModelID = modelID
-		// 	}
-		// } else {
-		// 	settings.ModelID = 1 // 默认模型ID
-		// }
-		settings.ModelID = sessionInfo.ModelID
-		settings.Name = sessionInfo.AgentName
-		settings.Desc = sessionInfo.AgentDesc
-		settings.Temperature = sessionInfo.Config.Chat.Model.Temperature
-		settings.TopP = sessionInfo.Config.Chat.Model.TopP
-		settings.FrequencyPenalty = sessionInfo.Config.Chat.Model.FrequencyPenalty
-		settings.PresencePenalty = sessionInfo.Config.Chat.Model.PresencePenalty
-		settings.ResponseType = sessionInfo.Config.Chat.Model.ResponseType
-		settings.Stream = sessionInfo.Config.Chat.Stream
-
-		// 提取上下文限制
-		if sessionInfo.Config.Chat.ContextLimit > 0 {
-			settings.ContextLimit = sessionInfo.Config.Chat.ContextLimit
-		}
-
-		// 提取知识库配置
-		if sessionInfo.Config.Chat.Plugin.Knowledge.Enable && len(sessionInfo.Config.Chat.Plugin.Knowledge.Knowledges) > 0 {
-			settings.KnowledgeBaseIDs = []int{}
-			for _, kbID := range sessionInfo.Config.Chat.Plugin.Knowledge.Knowledges {
-				settings.KnowledgeBaseIDs = append(settings.KnowledgeBaseIDs, kbID)
-			}
-		}
-	}
+	// 直接使用本地索引中的设置快照
+	settings := sessionInfo.Settings
 
 	utils.InfoWith("成功获取对话设置", "conversation_id", conversationID)
 	return settings, nil
@@ -533,23 +820,75 @@ func (s *FlowyChatService) GetConversationHistory(ctx context.Context, conversat
 
 	sessionID := conversationID
 
-	// 调用SDK获取会话记录
-	recordsResp, err := s.sdk.Agent.GetSessionRecords(ctx, sessionID)
+	// 获取会话记录并同步本地镜像
+	records, err := s.syncSessionMessages(ctx, sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("获取会话记录失败: %w", err)
+		return nil, err
+	}
+
+	// Flowy 的记录没有时间字段，使用本地镜像中首次同步的时间
+	mirrored, err := s.db.ListMessages(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	mirroredByID := make(map[int]models.MessageRecord, len(mirrored))
+	for _, message := range mirrored {
+		mirroredByID[message.ID] = message
+	}
+
+	// 导入的历史消息排在 Flowy 记录之前
+	messages, err := s.db.ListFlowyHistoryOverlay(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	variants, err := s.db.ListMessageVariants(sessionID)
+	if err != nil {
+		return nil, err
 	}
 
 	// 转换 SessionRecord 到 MessageRecord
-	var messages []models.MessageRecord
-	for _, record := range recordsResp.Records {
+	for _, record := range records {
+		if hiddenRecord(variants, record.ID) {
+			continue // 已被重新生成或编辑的轮次
+		}
 		message := models.MessageRecord{
-			ID:        record.ID,
-			Role:      record.Role,
-			Content:   record.Content,
-			CreatedAt: time.Now(), // SDK 的记录可能没有时间字段，使用当前时间
+			ID:         record.ID,
+			Role:       recordRole(&record),
+			Content:      record.Content,
+			CreatedAt:    time.Now(), // 尚未镜像的记录（生成中）使用当前时间
+			References:   referencesFromKnowledge(record.Plugins.Knowledge),
+			FinishReason: record.FinishReason,
+			RequestID:    record.RequestID,
+		}
+		if record.Usage.TotalTokens > 0 {
+			message.Usage = &models.TokenUsage{
+				PromptTokens:     record.Usage.PromptTokens,
+				CompletionTokens: record.Usage.CompletionTokens,
+				TotalTokens:      record.Usage.TotalTokens,
+				Duration:         record.Usage.Duration,
+			}
+		}
+		if mirror, ok := mirroredByID[record.ID]; ok {
+			message.CreatedAt = mirror.CreatedAt
+			message.Files = mirror.Files
+			message.ModelID = mirror.ModelID
+			message.KnowledgeBaseIDs = mirror.KnowledgeBaseIDs
+			if mirror.FinishReason == models.FinishReasonStopped {
+				// 被中断的回答以本地保存的部分为准，Flowy 中的记录可能仍在生成或已生成完毕
+				message.Content = mirror.Content
+				message.FinishReason = mirror.FinishReason
+			}
 		}
 		messages = append(messages, message)
 	}
+	models.ApplyMessageVersions(messages, variants)
+
+	feedback, err := s.db.ListConversationFeedback(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	models.ApplyMessageFeedback(messages, feedback)
 
 	response := &models.ConversationHistoryResponse{
 		ConversationID: fmt.Sprintf("%d", conversationID),
@@ -557,72 +896,707 @@ func (s *FlowyChatService) GetConversationHistory(ctx context.Context, conversat
 		Total:          len(messages),
 	}
 
-	utils.InfoWith("成功获取对话历史", "conversation_id", conversationID, "message_count", len(recordsResp.Records))
+	utils.InfoWith("成功获取对话历史", "conversation_id", conversationID, "message_count", len(records))
 	return response, nil
 }
 
+// SearchMessages 在所有对话的消息中搜索关键字
+// 搜索基于本地镜像的会话记录，搜索前会先镜像尚未同步过的会话
+func (s *FlowyChatService) SearchMessages(ctx context.Context, req *models.MessageSearchRequest) (*models.MessageSearchResponse, error) {
+	if err := req.Normalize(); err != nil {
+		return nil, err
+	}
+	utils.InfoWith("搜索消息", "query", req.Query, "limit", req.Limit)
+
+	sessionIDs, err := s.db.ListUnsyncedFlowySessionIDs(searchSyncSessionMax)
+	if err != nil {
+		return nil, err
+	}
+	for _, sessionID := range sessionIDs {
+		if _, err := s.syncSessionMessages(ctx, sessionID); err != nil {
+			utils.WarnWith("镜像会话记录失败", "session_id", sessionID, "error", err)
+		}
+	}
+
+	results, total, err := s.db.SearchMessages(req.Query, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MessageSearchResponse{
+		Query:   req.Query,
+		Results: results,
+		Total:   int(total),
+	}, nil
+}
+
+// syncSessionMessages 获取对话的会话记录，并将本地镜像中尚未保存的已完成记录增量写入本地消息表
+// 返回 Flowy 的全部会话记录
+func (s *FlowyChatService) syncSessionMessages(ctx context.Context, sessionID int) ([]agentSvc.SessionRecord, error) {
+	records, err := s.conversationRecords(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	lastID, err := s.db.GetLastMessageID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	variants, err := s.db.ListMessageVariants(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	stopped, err := s.db.ListStoppedMessageIDs(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []models.MessageGORM
+	pending := false
+	for i := range records {
+		record := &records[i]
+		// 生成中的记录内容尚不完整，留待下次同步；被中断的记录已保存了部分内容
+		if record.Pending && !stopped[record.ID] {
+			pending = true
+			break
+		}
+		if record.ID <= lastID || hiddenRecord(variants, record.ID) {
+			continue
+		}
+		messages = append(messages, models.MessageGORM{
+			ID:             uint(record.ID),
+			ConversationID: sessionID,
+			Role:           recordRole(record),
+			Content:        record.Content,
+			FinishReason:   record.FinishReason,
+		})
+	}
+
+	if err := s.db.SaveMessages(messages); err != nil {
+		return nil, err
+	}
+	// 有记录仍在生成中时本次镜像不完整，不记录镜像时间，会话留待之后再次镜像
+	if !pending {
+		if err := s.db.MarkFlowySessionSynced(sessionID, len(messages) > 0); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(messages) > 0 {
+		utils.InfoWith("会话记录已镜像", "session_id", sessionID, "new_messages", len(messages))
+	}
+	return records, nil
+}
+
+// conversationRecords 按顺序获取对话最初的会话及全部后续会话的记录
+// 后续会话第一条提问中保留的历史前缀已去除，记录ID在各会话间递增
+func (s *FlowyChatService) conversationRecords(ctx context.Context, conversationID int) ([]agentSvc.SessionRecord, error) {
+	recordsResp, err := s.sdk.Agent.GetSessionRecords(ctx, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("获取会话记录失败: %w", err)
+	}
+	records := recordsResp.Records
+
+	segments, err := s.db.ListFlowySessionSegments(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range segments {
+		segment := &segments[i]
+		segmentResp, err := s.sdk.Agent.GetSessionRecords(ctx, segment.SessionID)
+		if err != nil {
+			return nil, fmt.Errorf("获取后续会话 %d 的记录失败: %w", segment.SessionID, err)
+		}
+		for j := range segmentResp.Records {
+			if recordRole(&segmentResp.Records[j]) == "user" {
+				segmentResp.Records[j].Content = strings.TrimPrefix(segmentResp.Records[j].Content, segment.HistoryPrompt)
+				break
+			}
+		}
+		// 生成被中断或失败时第一条提问可能已写入，之后的提问不再带上保留的历史
+		if len(segmentResp.Records) > 0 && !segment.Seeded {
+			if err := s.db.MarkFlowySessionSegmentSeeded(segment.SessionID); err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, segmentResp.Records...)
+	}
+	return records, nil
+}
+
+// saveRequestFiles 将本次提问携带的附件ID保存到镜像中对应的用户消息，重新生成或编辑时沿用
+// Flowy 的会话记录不包含附件，按 RequestID 找到本次的记录后取其所在轮次的用户消息
+func (s *FlowyChatService) saveRequestFiles(req *models.ChatRequest, records []agentSvc.SessionRecord) {
+	if len(req.Files) == 0 || req.RequestID == "" {
+		return
+	}
+
+	last := -1
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].RequestID == req.RequestID {
+			last = i
+			break
+		}
+	}
+	for i := last; i >= 0; i-- {
+		if recordRole(&records[i]) != "user" {
+			continue
+		}
+		if err := s.db.SetMessageFiles(records[i].ID, req.Files); err != nil {
+			utils.ErrorWith("保存消息附件失败", "session_id", req.ConversationID, "record_id", records[i].ID, "error", err)
+		}
+		return
+	}
+	utils.WarnWith("未找到携带附件的提问对应的会话记录", "session_id", req.ConversationID, "request_id", req.RequestID)
+}
+
+// saveAnswerSettings 将生成回答时对话使用的模型和知识库保存到镜像中对应的回答
+// 按 RequestID 找到本次的回答记录，RequestID 为空时无法确定对应的记录
+func (s *FlowyChatService) saveAnswerSettings(req *models.ChatRequest, settings *models.ConversationSettings, records []agentSvc.SessionRecord) {
+	if req.RequestID == "" {
+		return
+	}
+
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].RequestID != req.RequestID || recordRole(&records[i]) != "assistant" {
+			continue
+		}
+		if err := s.db.SetMessageSettings(records[i].ID, settings.ModelID, settings.KnowledgeBaseIDs); err != nil {
+			utils.ErrorWith("保存回答的模型和知识库失败", "session_id", req.ConversationID, "record_id", records[i].ID, "error", err)
+		}
+		return
+	}
+	utils.WarnWith("未找到本次回答对应的会话记录", "session_id", req.ConversationID, "request_id", req.RequestID)
+}
+
+// saveStoppedAnswer 将被中断的回答写入本地镜像，覆盖 Flowy 中对应的会话记录
+// Flowy 无法修改会话记录，按 RequestID（为空时取仍在生成中的最后一条回复）找到对应记录后在本地保存已生成的部分
+func (s *FlowyChatService) saveStoppedAnswer(req *models.ChatRequest, settings *models.ConversationSettings, partial string) {
+	ctx, cancel := context.WithTimeout(context.Background(), messageSyncTimeout)
+	defer cancel()
+
+	sessionID, requestID := req.ConversationID, req.RequestID
+	// 先镜像之前的记录，避免其被中断记录的ID跳过
+	records, err := s.syncSessionMessages(ctx, sessionID)
+	if err != nil {
+		utils.ErrorWith("镜像会话记录失败", "session_id", sessionID, "error", err)
+		return
+	}
+	s.saveRequestFiles(req, records)
+
+	var target *agentSvc.SessionRecord
+	for i := len(records) - 1; i >= 0; i-- {
+		record := &records[i]
+		if recordRole(record) != "assistant" {
+			continue
+		}
+		if requestID != "" && record.RequestID != requestID {
+			continue
+		}
+		if requestID != "" || record.Pending {
+			target = record
+		}
+		break
+	}
+	if target == nil {
+		utils.WarnWith("未找到被中断回答对应的会话记录", "session_id", sessionID, "request_id", requestID)
+		return
+	}
+
+	err = s.db.SaveMessages([]models.MessageGORM{{
+		ID:             uint(target.ID),
+		ConversationID: sessionID,
+		Role:           "assistant",
+		Content:        partial,
+		FinishReason:   models.FinishReasonStopped,
+	}})
+	if err != nil {
+		utils.ErrorWith("保存被中断的回答失败", "session_id", sessionID, "record_id", target.ID, "error", err)
+		return
+	}
+	if err := s.db.SetMessageSettings(target.ID, settings.ModelID, settings.KnowledgeBaseIDs); err != nil {
+		utils.ErrorWith("保存回答的模型和知识库失败", "session_id", sessionID, "record_id", target.ID, "error", err)
+	}
+}
+
+// hiddenRecord 判断会话记录是否已归档为历史版本
+func hiddenRecord(variants []models.MessageVariantGORM, recordID int) bool {
+	for i := range variants {
+		if variants[i].Hides(recordID) {
+			return true
+		}
+	}
+	return false
+}
+
+// referencesFromKnowledge 将知识库插件的检索结果转换为引用信息
+func referencesFromKnowledge(items []agentSvc.KnowledgeReference) []models.Reference {
+	var references []models.Reference
+	for _, item := range items {
+		references = append(references, models.Reference{
+			DocumentID:    strconv.Itoa(item.FileID),
+			DocumentTitle: item.FileName,
+			Content:       item.Content,
+			Similarity:    item.Score,
+			ChunkIndex:    item.ChunkIndex,
+		})
+	}
+	return references
+}
+
+// Flowy 内置工具在对话设置中的名称
+const (
+	toolData2Chart = "data2chart"
+	toolPython     = "python"
+	toolDatetime   = "datetime"
+)
+
+// createAgentSetting 按对话设置依次创建 Agent 和配置，失败时清理已创建的 Agent
+// history 为导入的历史消息，附加在系统提示词之后；fileAnalyzer 为 true 时开启文件分析插件
+func createAgentSetting(ctx context.Context, sdk *flowy.SDK, settings *models.ConversationSettings, history []models.MessageRecord, fileAnalyzer bool) (int, int, error) {
+	// 步骤1: 创建一个新的Agent
+	createAgentReq := &agentSvc.CreateAgentRequest{
+		Name:   settings.Name,
+		Desc:   settings.Desc,
+		Type:   0,  // 默认类型为0 (多轮对话)
+		Avatar: "", // 默认无头像
+	}
+
+	agentID, err := sdk.Agent.CreateAgent(ctx, createAgentReq)
+	if err != nil {
+		return 0, 0, fmt.Errorf("创建Agent失败: %w", err)
+	}
+
+	utils.InfoWith("Agent创建成功", "agent_id", agentID, "title", settings.Name)
+
+	// 步骤2: 为这个Agent创建一个配置，使用传入的设置参数
+	// 根据模型ID获取模型名称
+	modelName, err := getModelNameByID(ctx, sdk, settings.ModelID)
+	if err != nil {
+		// 如果获取模型名称失败,清理已创建的Agent
+		_ = sdk.Agent.DeleteAgent(ctx, agentID)
+		return 0, 0, fmt.Errorf("获取模型名称失败: %w", err)
+	}
+
+	utils.InfoWith("使用模型", "model_id", settings.ModelID, "model_name", modelName)
+
+	// 使用工厂函数创建默认配置，覆盖需要自定义的配置
+	saveConfigReq := agentSvc.NewDefaultSettingConfig(agentID, settings.Name)
+	applyChatSettings(saveConfigReq.Chat, settings, history)
+	saveConfigReq.Chat.Plugin.FileAnalyzer.Enable = fileAnalyzer
+
+	settingID, err := sdk.Agent.SaveConfig(ctx, saveConfigReq)
+	if err != nil {
+		// 如果配置创建失败,需要清理已创建的Agent
+		_ = sdk.Agent.DeleteAgent(ctx, agentID)
+		return 0, 0, fmt.Errorf("创建配置失败: %w", err)
+	}
+
+	utils.InfoWith("配置创建成功", "setting_id", settingID, "agent_id", agentID)
+	return agentID, settingID, nil
+}
+
+// deleteAgentSetting 删除配置及其 Agent，配置删除失败时仍继续删除 Agent
+func deleteAgentSetting(ctx context.Context, sdk *flowy.SDK, agentID, settingID int) error {
+	err := sdk.Agent.DeleteConfig(ctx, settingID)
+	if err != nil {
+		utils.ErrorWith("删除配置失败", "setting_id", settingID, "error", err)
+		// 继续删除Agent，即使配置删除失败
+	} else {
+		utils.InfoWith("配置已删除", "setting_id", settingID)
+	}
+
+	err = sdk.Agent.DeleteAgent(ctx, agentID)
+	if err != nil {
+		utils.ErrorWith("删除Agent失败", "agent_id", agentID, "error", err)
+		return fmt.Errorf("删除Agent失败: %w", err)
+	}
+
+	utils.InfoWith("Agent已删除", "agent_id", agentID)
+	return nil
+}
+
+// findSettingConfig 从 Flowy 加载 Agent 下的指定配置
+func findSettingConfig(ctx context.Context, sdk *flowy.SDK, agentID, settingID int) (*agentSvc.SettingConfig, error) {
+	configs, err := sdk.Agent.ListConfigs(ctx, agentID)
+	if err != nil {
+		return nil, fmt.Errorf("获取Agent配置失败: %w", err)
+	}
+
+	for i := range configs {
+		if configs[i].ID == settingID {
+			return &configs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("未找到配置 %d", settingID)
+}
+
+// applyChatSettings 将对话设置写入多轮对话配置，history 为附加在系统提示词之后的历史消息
+func applyChatSettings(chat *agentSvc.ChatConfig, settings *models.ConversationSettings, history []models.MessageRecord) {
+	chat.Stream = settings.Stream
+	chat.Model.ID = settings.ModelID
+	chat.Model.Temperature = settings.Temperature
+	chat.Model.TopP = settings.TopP
+	chat.Model.PresencePenalty = settings.PresencePenalty
+	chat.Model.FrequencyPenalty = settings.FrequencyPenalty
+	chat.Model.ResponseType = settings.ResponseType
+	if settings.ContextLimit > 0 {
+		chat.ContextLimit = settings.ContextLimit
+	}
+
+	// 设置系统提示词、提示词变量和开场白，历史条数受上下文限制约束
+	applyPromptSettings(chat, settings, history)
+
+	chat.Plugin.Knowledge.Enable = len(settings.KnowledgeBaseIDs) > 0
+	chat.Plugin.Knowledge.Knowledges = append([]int{}, settings.KnowledgeBaseIDs...)
+
+	chat.Tool.Tools = []string{}
+	chat.Tool.BuiltinTools = agentSvc.BuiltinTools{}
+	for _, name := range settings.Tools {
+		switch name {
+		case toolData2Chart:
+			chat.Tool.BuiltinTools.Data2Chart = true
+		case toolPython:
+			chat.Tool.BuiltinTools.Python = true
+		case toolDatetime:
+			chat.Tool.BuiltinTools.Datetime = true
+		default:
+			chat.Tool.Tools = append(chat.Tool.Tools, name)
+		}
+	}
+}
+
+// configTools 获取配置中启用的工具，内置工具在前
+func configTools(tool *agentSvc.ToolConfig) []string {
+	var tools []string
+	if tool.BuiltinTools.Data2Chart {
+		tools = append(tools, toolData2Chart)
+	}
+	if tool.BuiltinTools.Python {
+		tools = append(tools, toolPython)
+	}
+	if tool.BuiltinTools.Datetime {
+		tools = append(tools, toolDatetime)
+	}
+	return append(tools, tool.Tools...)
+}
+
+// seedHistoryHeader 系统提示词与附加的历史消息之间的分隔
+const seedHistoryHeader = "\n\n以下是此前的对话记录，请在此基础上继续对话：\n"
+
+// applyPromptSettings 将系统提示词、提示词变量和开场白写入对话配置
+// 提示词变量由本服务代入系统提示词，修改设置后立即生效（Flowy 会话的变量值在创建后无法修改）
+func applyPromptSettings(chat *agentSvc.ChatConfig, settings *models.ConversationSettings, history []models.MessageRecord) {
+	chat.Prompt.Prompts = []agentSvc.Prompt{
+		{
+			Role: 0,
+			Text: seedHistoryPrompt(settings.SystemPromptText(), history, chat.ContextLimit),
+		},
+	}
+	chat.Prompt.PromptVars = []string{}
+	for _, v := range sessionPromptVars(settings.PromptVars) {
+		chat.Prompt.PromptVars = append(chat.Prompt.PromptVars, v.Name)
+	}
+
+	chat.Prologue.Text = ""
+	chat.Prologue.SampleQuestions = []string{}
+	if settings.Prologue != nil {
+		chat.Prologue.Text = settings.Prologue.Text
+		chat.Prologue.SampleQuestions = append(chat.Prologue.SampleQuestions, settings.Prologue.SampleQuestions...)
+	}
+}
+
+// sessionPromptVars 将提示词变量转换为 Flowy 会话的变量列表，按变量名排序
+func sessionPromptVars(vars map[string]string) []agentSvc.PromptVar {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]agentSvc.PromptVar, 0, len(names))
+	for _, name := range names {
+		result = append(result, agentSvc.PromptVar{ID: name, Type: "text", Name: name, Value: vars[name]})
+	}
+	return result
+}
+
+// seedHistoryPrompt 在系统提示词后附加最近 limit 条历史消息，作为 Flowy 会话的初始上下文
+func seedHistoryPrompt(systemPrompt string, messages []models.MessageRecord, limit int) string {
+	if limit > 0 && len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	if len(messages) == 0 {
+		return systemPrompt
+	}
+
+	var b strings.Builder
+	b.WriteString(systemPrompt)
+	b.WriteString(seedHistoryHeader)
+	for _, message := range messages {
+		switch message.Role {
+		case "user":
+			b.WriteString("\n用户：")
+		case "assistant":
+			b.WriteString("\n助手：")
+		default:
+			b.WriteString("\n系统：")
+		}
+		b.WriteString(message.Content)
+	}
+	return b.String()
+}
+
+// seedHistoryQuestion 生成后续会话第一条提问的前缀，包含最近 limit 条保留的历史
+// 导入的历史已写入配置的系统提示词，不再重复
+func seedHistoryQuestion(messages []models.MessageRecord, limit int) string {
+	kept := make([]models.MessageRecord, 0, len(messages))
+	for _, message := range messages {
+		if !message.Imported {
+			kept = append(kept, message)
+		}
+	}
+	prompt := strings.TrimPrefix(seedHistoryPrompt("", kept, limit), "\n\n")
+	if prompt == "" {
+		return ""
+	}
+	return prompt + "\n\n以下是新的提问：\n"
+}
+
+// recordRole 获取会话记录的角色，缺失时根据发送者推断
+func recordRole(record *agentSvc.SessionRecord) string {
+	if record.Role != "" {
+		return record.Role
+	}
+	if record.Sender == 1 {
+		return "user"
+	}
+	return "assistant"
+}
+
 // SessionInfo 会话信息
 type SessionInfo struct {
 	AgentID   int
 	SettingID int
-	Config    *agentSvc.SettingConfig
+	Config    *agentSvc.SettingConfig // 需要时由 loadSessionConfig 从 Flowy 加载
 	AgentName string
 	AgentDesc string
 	ModelID   int
+	Settings  *models.ConversationSettings
 }
 
-// findSessionInfo 查找会话对应的AgentID、SettingID、配置信息以及Agent的名称和描述
+// findSessionInfo 从本地会话索引查找会话对应的AgentID、SettingID以及Agent的名称和描述
+// 索引中不存在时等待后台从 Flowy 重建索引后再次查找，ctx 结束时重建仍在后台继续
 func (s *FlowyChatService) findSessionInfo(ctx context.Context, sessionID int) (*SessionInfo, error) {
-	agentList, err := s.sdk.Agent.ListAgentsByPage(ctx, 1, 100)
+	session, err := s.db.GetFlowySession(sessionID)
+	if errors.Is(err, database.ErrNotFound) {
+		select {
+		case <-s.startSessionIndexRebuild():
+		case <-ctx.Done():
+			return nil, fmt.Errorf("等待会话索引重建失败: %w", ctx.Err())
+		}
+		session, err = s.db.GetFlowySession(sessionID)
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, fmt.Errorf("未找到会话 %d 对应的配置和Agent: %w", sessionID, err)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("获取Agent列表失败: %w", err)
+		return nil, err
 	}
 
-	// 遍历所有Agent的配置和会话来找到对应的session
-	for _, agent := range agentList.Records {
+	conversation := session.ToConversation()
+	return &SessionInfo{
+		AgentID:   session.AgentID,
+		SettingID: session.SettingID,
+		AgentName: session.Name,
+		AgentDesc: session.Desc,
+		ModelID:   session.ModelID,
+		Settings:  &conversation.ConversationSettings,
+	}, nil
+}
 
+// loadSessionConfig 从 Flowy 加载会话所用的配置
+func (s *FlowyChatService) loadSessionConfig(ctx context.Context, info *SessionInfo) error {
+	config, err := findSettingConfig(ctx, s.sdk, info.AgentID, info.SettingID)
+	if err != nil {
+		return err
+	}
+	info.Config = config
+	return nil
+}
+
+// startSessionIndexRebuild 在后台从 Flowy 重建会话索引，返回重建结束时关闭的通道
+// 重建使用独立的上下文，不受触发它的请求超时影响；已有重建进行中时返回其通道。
+// 为避免频繁的全量遍历，两次重建之间至少间隔 sessionIndexRebuildInterval，间隔内返回已关闭的通道
+func (s *FlowyChatService) startSessionIndexRebuild() <-chan struct{} {
+	s.rebuildMu.Lock()
+	defer s.rebuildMu.Unlock()
+
+	if s.rebuilding != nil {
+		return s.rebuilding
+	}
+	done := make(chan struct{})
+	if time.Since(s.lastRebuild) < sessionIndexRebuildInterval {
+		close(done)
+		return done
+	}
+
+	s.rebuilding = done
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				utils.ErrorWith("重建会话索引 panic", "error", r)
+			}
+			s.rebuildMu.Lock()
+			s.lastRebuild = time.Now()
+			s.rebuilding = nil
+			s.rebuildMu.Unlock()
+			close(done)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), sessionIndexRebuildTimeout)
+		defer cancel()
+		if err := s.rebuildSessionIndex(ctx); err != nil {
+			utils.ErrorWith("重建会话索引失败", "error", err)
+		}
+	}()
+	return done
+}
+
+// rebuildSessionIndex 遍历 Flowy 的全部 Agent、配置和会话，补全本地会话索引
+// 已有的索引记录保持不变；遍历完整时删除 Flowy 中已不存在的会话，并记录索引已完整重建
+func (s *FlowyChatService) rebuildSessionIndex(ctx context.Context) error {
+	utils.LogInfo("从 Flowy 重建会话索引")
+	started := time.Now()
+
+	agents, err := s.sdk.Agent.ListAllAgents(ctx)
+	if err != nil {
+		return fmt.Errorf("获取Agent列表失败: %w", err)
+	}
+
+	// 后续会话属于其对话，不单独建立索引
+	segmentIDs, err := s.db.ListFlowySessionSegmentIDs()
+	if err != nil {
+		return err
+	}
+	segments := make(map[int]bool, len(segmentIDs))
+	for _, sessionID := range segmentIDs {
+		segments[sessionID] = true
+	}
+
+	existing := make(map[int]bool)
+	complete := true
+	for _, agent := range agents {
 		configs, err := s.sdk.Agent.ListConfigs(ctx, agent.ID)
 		if err != nil {
+			// 跳过错误的agent，本次遍历不完整
+			utils.WarnWith("获取配置列表失败", "agent_id", agent.ID, "error", err.Error())
+			complete = false
 			continue
 		}
 
-		for _, cfg := range configs {
-
-			sessions, err := s.sdk.Agent.ListSessions(ctx, cfg.ID, nil)
+		for i := range configs {
+			sessions, err := s.sdk.Agent.ListSessions(ctx, configs[i].ID, nil)
 			if err != nil {
+				utils.WarnWith("获取会话列表失败", "setting_id", configs[i].ID, "error", err.Error())
+				complete = false
 				continue
 			}
 
+			// 助手配置下的会话使用助手的设置，对话名称取会话标题
+			assistant, err := s.db.GetAssistantBySettingID(configs[i].ID)
+			if err != nil && !errors.Is(err, database.ErrNotFound) {
+				return err
+			}
+
+			settings := settingsFromConfig(agent.Name, agent.Desc, &configs[i])
 			for _, session := range sessions {
-				if session.ID == sessionID {
-					modelID := 0
-					if cfg.Chat != nil && cfg.Chat.Model.ID > 0 {
-						modelID = cfg.Chat.Model.ID
-					}
-					return &SessionInfo{
-						AgentID:   agent.ID,
-						SettingID: cfg.ID,
-						Config:    &cfg,
-						AgentName: agent.Name,
-						AgentDesc: agent.Desc,
-						ModelID:   modelID,
-					}, nil
+				if segments[session.ID] {
+					continue
 				}
+				if assistant != nil {
+					settings = assistant.ConversationSettings(session.Title, "")
+				}
+				if err := s.db.SaveRebuiltFlowySession(models.NewFlowySessionGORM(session.ID, agent.ID, configs[i].ID, settings)); err != nil {
+					return err
+				}
+				existing[session.ID] = true
 			}
 		}
 	}
 
-	return nil, fmt.Errorf("未找到会话 %d 对应的配置和Agent", sessionID)
+	if !complete {
+		utils.InfoWith("会话索引部分重建完成", "session_count", len(existing))
+		return nil
+	}
+
+	pruned, err := s.db.PruneFlowySessions(existing, started)
+	if err != nil {
+		return err
+	}
+	if err := s.db.SetMetadata(sessionIndexBuiltKey, started.Format(time.RFC3339)); err != nil {
+		return err
+	}
+	utils.InfoWith("会话索引重建完成", "session_count", len(existing), "pruned_count", pruned)
+	return nil
+}
+
+// settingsFromConfig 从 Agent 信息和配置中提取对话设置
+func settingsFromConfig(name, desc string, config *agentSvc.SettingConfig) *models.ConversationSettings {
+	// 使用工厂函数创建默认设置，然后从config中提取真实的值
+	settings := models.NewDefaultConversationSettings()
+	settings.Name = name
+	settings.Desc = desc
+
+	if config.Chat != nil {
+		settings.Temperature = config.Chat.Model.Temperature
+		settings.TopP = config.Chat.Model.TopP
+		settings.PresencePenalty = config.Chat.Model.PresencePenalty
+		settings.FrequencyPenalty = config.Chat.Model.FrequencyPenalty
+		settings.ResponseType = config.Chat.Model.ResponseType
+		settings.Stream = config.Chat.Stream
+		settings.ModelID = config.Chat.Model.ID
+
+		// 提取上下文限制
+		if config.Chat.ContextLimit > 0 {
+			settings.ContextLimit = config.Chat.ContextLimit
+		}
+
+		// 提取知识库和工具配置
+		if config.Chat.Plugin.Knowledge.Enable && len(config.Chat.Plugin.Knowledge.Knowledges) > 0 {
+			settings.KnowledgeBaseIDs = append([]int{}, config.Chat.Plugin.Knowledge.Knowledges...)
+		}
+		settings.Tools = configTools(&config.Chat.Tool)
+
+		// 提取系统提示词（已代入变量，不含导入的历史）和开场白
+		for _, prompt := range config.Chat.Prompt.Prompts {
+			if prompt.Role != 0 {
+				continue
+			}
+			systemPrompt, _, _ := strings.Cut(prompt.Text, seedHistoryHeader)
+			if systemPrompt != models.DefaultSystemPrompt {
+				settings.SystemPrompt = systemPrompt
+			}
+			break
+		}
+		if prologue := config.Chat.Prologue; prologue.Text != "" || len(prologue.SampleQuestions) > 0 {
+			settings.Prologue = &models.ConversationPrologue{
+				Text:            prologue.Text,
+				SampleQuestions: append([]string{}, prologue.SampleQuestions...),
+			}
+		}
+	}
+	return settings
 }
 
 // getModelNameByID 根据模型ID获取模型名称
-func (s *FlowyChatService) getModelNameByID(ctx context.Context, modelID int) (string, error) {
+func getModelNameByID(ctx context.Context, sdk *flowy.SDK, modelID int) (string, error) {
 	if modelID <= 0 {
 		return "", fmt.Errorf("无效的模型ID: %d", modelID)
 	}
 
 	// 获取所有可用模型
-	models, err := s.sdk.Model.ListAvailableAllModels(ctx)
+	models, err := sdk.Model.ListAvailableAllModels(ctx)
 	if err != nil {
 		return "", fmt.Errorf("获取模型列表失败: %w", err)
 	}
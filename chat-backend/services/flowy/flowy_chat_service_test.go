@@ -0,0 +1,36 @@
+package flowy
+
+import (
+	"strings"
+	"testing"
+
+	"chat-backend/models"
+)
+
+func TestSeedHistoryQuestion(t *testing.T) {
+	if prefix := seedHistoryQuestion(nil, 10); prefix != "" {
+		t.Fatalf("empty history prefix = %q, want empty", prefix)
+	}
+
+	messages := []models.MessageRecord{
+		{Role: "user", Content: "导入的提问", Imported: true},
+		{Role: "assistant", Content: "导入的回答", Imported: true},
+		{ID: 11, Role: "user", Content: "第一问"},
+		{ID: 12, Role: "assistant", Content: "第一答"},
+		{ID: 13, Role: "user", Content: "第二问"},
+		{ID: 14, Role: "assistant", Content: "第二答"},
+	}
+	prefix := seedHistoryQuestion(messages, 2)
+
+	if strings.Contains(prefix, "导入的") {
+		t.Errorf("prefix repeats imported history already in the system prompt: %q", prefix)
+	}
+	if strings.Contains(prefix, "第一问") || !strings.Contains(prefix, "用户：第二问") || !strings.Contains(prefix, "助手：第二答") {
+		t.Errorf("prefix should keep only the last 2 messages: %q", prefix)
+	}
+
+	// 查询历史时从后续会话的第一条提问中去除前缀
+	if got := strings.TrimPrefix(prefix+"重新提问", prefix); got != "重新提问" {
+		t.Errorf("trimmed question = %q", got)
+	}
+}
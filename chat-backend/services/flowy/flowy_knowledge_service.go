@@ -2,28 +2,40 @@ package flowy
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"chat-backend/models"
+	"chat-backend/pkg/database"
 	"chat-backend/services/interfaces"
 	"chat-backend/utils"
 	"flowy-sdk"
 	knowledgeSvc "flowy-sdk/services/knowledge"
 )
 
+// fileIndexRebuildInterval 两次从 Flowy 重建文件索引的最小间隔
+const fileIndexRebuildInterval = time.Minute
+
 // FlowyKnowledgeService 基于 flowy-sdk 的知识库服务实现
+// 本地数据库记录文件所属的知识库，按文件ID查找时无需遍历全部知识库
 type FlowyKnowledgeService struct {
 	sdk *flowy.SDK
+	db  *database.Database
+
+	rebuildMu   sync.Mutex
+	lastRebuild time.Time
 }
 
 // NewFlowyKnowledgeService 创建 Flowy 知识库服务
-func NewFlowyKnowledgeService(sdk *flowy.SDK) interfaces.KnowledgeServiceInterface {
+func NewFlowyKnowledgeService(sdk *flowy.SDK, db *database.Database) interfaces.KnowledgeServiceInterface {
 	return &FlowyKnowledgeService{
 		sdk: sdk,
+		db:  db,
 	}
 }
 
@@ -165,6 +177,9 @@ func (s *FlowyKnowledgeService) DeleteKnowledgeBase(ctx context.Context, id int)
 		utils.ErrorWith("删除知识库失败", "id", id, "error", err)
 		return fmt.Errorf("删除知识库失败: %w", err)
 	}
+	if err := s.db.ReplaceFlowyKnowledgeFiles(id, nil); err != nil {
+		utils.WarnWith("删除知识库文件索引失败", "id", id, "error", err.Error())
+	}
 
 	utils.InfoWith("删除知识库成功", "id", id)
 	return nil
@@ -175,26 +190,16 @@ func (s *FlowyKnowledgeService) GetKnowledgeBaseFiles(ctx context.Context, id in
 	utils.InfoWith("获取知识库文件列表", "id", id)
 
 	// 调用Flowy SDK获取文件列表
-	files, err := s.sdk.Knowledge.ListFiles(ctx, id, "zh")
+	files, err := s.listFiles(ctx, id)
 	if err != nil {
 		utils.ErrorWith("获取知识库文件列表失败", "id", id, "error", err)
-		return nil, fmt.Errorf("获取知识库文件列表失败: %w", err)
+		return nil, err
 	}
 
 	// 转换数据
 	var knowledgeFiles []models.KnowledgeFile
-	for _, file := range files {
-		kf := models.KnowledgeFile{
-			ID:           file.ID,
-			Name:         file.Name,
-			Size:         file.FileSize,
-			Enable:       file.Enable,
-			Status:       file.Status,
-			UploadedAt:   parseTime(file.CreateTime),
-			IndexPercent: file.IndexPercent,
-			ErrorMessage: file.ErrorMessage,
-		}
-		knowledgeFiles = append(knowledgeFiles, kf)
+	for i := range files {
+		knowledgeFiles = append(knowledgeFiles, toKnowledgeFile(&files[i]))
 	}
 
 	utils.InfoWith("获取知识库文件列表成功", "id", id, "count", len(knowledgeFiles))
@@ -211,6 +216,7 @@ func (s *FlowyKnowledgeService) UploadFile(ctx context.Context, id int, filename
 		utils.ErrorWith("上传文件失败", "id", id, "filename", filename, "error", err)
 		return nil, fmt.Errorf("上传文件失败: %w", err)
 	}
+	s.saveFileIndex(id, uploadData.ID)
 
 	result := &models.KnowledgeFile{
 		ID:           uploadData.ID,
@@ -266,6 +272,7 @@ func (s *FlowyKnowledgeService) UploadFileFromPath(ctx context.Context, id int,
 		utils.ErrorWith("从路径上传文件失败", "id", id, "path", filePath, "filename", filename, "error", err)
 		return nil, fmt.Errorf("上传文件失败: %w", err)
 	}
+	s.saveFileIndex(id, uploadData.ID)
 
 	result := &models.KnowledgeFile{
 		ID:           uploadData.ID,
@@ -290,46 +297,54 @@ func (s *FlowyKnowledgeService) BatchUploadFilesFromPath(ctx context.Context, id
 
 	utils.LogInfo("开始批量上传文件到知识库: %d, 文件数: %d", id, len(filePaths))
 
-	response := &models.BatchUploadResponse{
-		Total:   len(filePaths),
-		Results: make([]models.BatchUploadResult, 0, len(filePaths)),
-	}
+	// 有限并发上传，结果顺序与 filePaths 一致
+	response := utils.RunBatchUpload(ctx, filePaths, utils.FileSizes(filePaths), func(fileCtx context.Context, i int) (*models.KnowledgeFile, error) {
+		return s.UploadFileFromPath(fileCtx, id, filePaths[i])
+	})
 
-	// 创建超时上下文用于整个批量操作
-	batchCtx, cancel := context.WithTimeout(context.Background(), time.Duration(len(filePaths)*60)*time.Second)
-	defer cancel()
+	utils.InfoWith("批量上传完成", "知识库ID", id, "总数", response.Total, "成功", response.SuccessCount, "失败", response.FailureCount)
+	return response, nil
+}
 
-	// 上传每个文件
-	for _, filePath := range filePaths {
-		result := models.BatchUploadResult{
-			FilePath: filePath,
+// GetFileKnowledgeBaseID 从本地文件索引获取文件所属的知识库ID
+// 索引在列出知识库文件和上传文件时写入；索引中没有该文件时（如升级后尚未列出过其知识库）从 Flowy 重建索引后再次查找，
+// 仍不存在时返回 ErrNotFound
+func (s *FlowyKnowledgeService) GetFileKnowledgeBaseID(ctx context.Context, fileID int) (int, error) {
+	kbID, err := s.db.GetFlowyFileKnowledgeBaseID(fileID)
+	if errors.Is(err, database.ErrNotFound) {
+		if err := s.rebuildFileIndex(ctx); err != nil {
+			return 0, err
 		}
+		kbID, err = s.db.GetFlowyFileKnowledgeBaseID(fileID)
+	}
+	return kbID, err
+}
 
-		// 为每个文件单独设置超时
-		fileCtx, fileCancel := context.WithTimeout(batchCtx, 60*time.Second)
+// rebuildFileIndex 列出全部知识库的文件，刷新本地文件索引
+// 为避免不存在的文件ID频繁触发全量遍历，两次重建之间至少间隔 fileIndexRebuildInterval
+func (s *FlowyKnowledgeService) rebuildFileIndex(ctx context.Context) error {
+	s.rebuildMu.Lock()
+	defer s.rebuildMu.Unlock()
 
-		uploadedFile, err := s.UploadFileFromPath(fileCtx, id, filePath)
-		fileCancel()
+	if time.Since(s.lastRebuild) < fileIndexRebuildInterval {
+		return nil
+	}
 
-		if err != nil {
-			result.Success = false
-			result.Message = "上传失败"
-			result.Error = err.Error()
-			response.FailureCount++
-			utils.ErrorWith("批量上传文件失败", "path", filePath, "error", err)
-		} else {
-			result.Success = true
-			result.Message = "上传成功"
-			result.File = uploadedFile
-			response.SuccessCount++
-			utils.InfoWith("批量上传文件成功", "path", filePath, "file_id", uploadedFile.ID)
+	utils.LogInfo("从 Flowy 重建知识库文件索引")
+	knowledgeBases, err := s.sdk.Knowledge.ListKnowledgeBases(ctx)
+	if err != nil {
+		return fmt.Errorf("获取知识库列表失败: %w", err)
+	}
+	for _, kb := range knowledgeBases {
+		if _, err := s.listFiles(ctx, kb.ID); err != nil {
+			// 跳过出错的知识库，其文件下次重建时再补全
+			utils.WarnWith("获取知识库文件列表失败", "id", kb.ID, "error", err.Error())
 		}
-
-		response.Results = append(response.Results, result)
 	}
 
-	utils.InfoWith("批量上传完成", "知识库ID", id, "总数", response.Total, "成功", response.SuccessCount, "失败", response.FailureCount)
-	return response, nil
+	s.lastRebuild = time.Now()
+	utils.InfoWith("知识库文件索引重建完成", "knowledge_base_count", len(knowledgeBases))
+	return nil
 }
 
 // DeleteFile 删除知识库文件
@@ -347,6 +362,9 @@ func (s *FlowyKnowledgeService) DeleteFile(ctx context.Context, fileID int) erro
 		utils.ErrorWith("删除文件失败", "file_id", fileID, "error", err)
 		return fmt.Errorf("删除文件失败: %w", err)
 	}
+	if err := s.db.DeleteFlowyKnowledgeFile(fileID); err != nil {
+		utils.WarnWith("删除知识库文件索引失败", "file_id", fileID, "error", err.Error())
+	}
 
 	utils.InfoWith("删除文件成功", "file_id", fileID)
 	return nil
@@ -376,6 +394,203 @@ func (s *FlowyKnowledgeService) ToggleFileEnable(ctx context.Context, fileID int
 	return nil
 }
 
+// ReindexFile 重建文件索引
+// Flowy 修改文件配置后会重新切片并建立索引，这里以文件当前配置调用 ModifyFile 触发重建，Flowy 未开始重建时返回错误
+func (s *FlowyKnowledgeService) ReindexFile(ctx context.Context, fileID int) (*models.KnowledgeFile, error) {
+	utils.InfoWith("重建文件索引", "file_id", fileID)
+
+	if fileID == 0 {
+		utils.ErrorWith("无效的文件ID", "file_id", fileID)
+		return nil, fmt.Errorf("无效的文件ID: %d", fileID)
+	}
+
+	file, err := s.findFile(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	logCount, err := s.startReindex(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.getFile(ctx, file.KnowledgeID, file.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.confirmReindex(ctx, current, logCount); err != nil {
+		return nil, err
+	}
+
+	// 具体进度由后续查询获得
+	result := toKnowledgeFile(current)
+	utils.InfoWith("文件索引重建已开始", "file_id", fileID)
+	return &result, nil
+}
+
+// reindexConcurrency 重建知识库索引时同时提交的文件数
+const reindexConcurrency = 4
+
+// ReindexKnowledgeBase 重建知识库中所有文件的索引
+// 文件列表只获取一次：并发提交各文件的重建后再列出一次文件确认重建是否开始，未能开始的文件在 Failures 中返回
+func (s *FlowyKnowledgeService) ReindexKnowledgeBase(ctx context.Context, id int) (*models.ReindexKnowledgeBaseResponse, error) {
+	utils.InfoWith("重建知识库索引", "id", id)
+
+	files, err := s.listFiles(ctx, id)
+	if err != nil {
+		utils.ErrorWith("获取知识库文件列表失败", "id", id, "error", err)
+		return nil, err
+	}
+
+	logCounts := make([]int, len(files))
+	errs := make([]error, len(files))
+	sem := make(chan struct{}, reindexConcurrency)
+	var wg sync.WaitGroup
+	for i := range files {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			logCounts[index], errs[index] = s.startReindex(ctx, &files[index])
+		}(i)
+	}
+	wg.Wait()
+
+	// 重新列出一次文件，确认已提交的文件开始了重建
+	current := make(map[int]*knowledgeSvc.FileInfo, len(files))
+	after, listErr := s.listFiles(ctx, id)
+	for i := range after {
+		current[after[i].ID] = &after[i]
+	}
+
+	response := &models.ReindexKnowledgeBaseResponse{
+		KnowledgeFiles: make([]models.KnowledgeFile, 0, len(files)),
+		Failures:       []models.ReindexFailure{},
+	}
+	for i := range files {
+		file := &files[i]
+		if errs[i] == nil {
+			if latest := current[file.ID]; latest != nil {
+				file = latest
+				errs[i] = s.confirmReindex(ctx, latest, logCounts[i])
+			} else if listErr != nil {
+				errs[i] = listErr
+			} else {
+				errs[i] = fmt.Errorf("文件ID %d 不存在: %w", file.ID, database.ErrNotFound)
+			}
+		}
+		// 单个文件失败不影响其他文件，返回其当前状态和失败原因
+		response.KnowledgeFiles = append(response.KnowledgeFiles, toKnowledgeFile(file))
+		if errs[i] != nil {
+			response.Failures = append(response.Failures, models.ReindexFailure{FileID: file.ID, Name: file.Name, Error: errs[i].Error()})
+		}
+	}
+
+	utils.InfoWith("知识库索引重建已开始", "id", id, "file_count", len(files), "failure_count", len(response.Failures))
+	return response, nil
+}
+
+// startReindex 以文件当前配置调用 ModifyFile 触发重建索引
+// 返回调用前的处理日志数供 confirmReindex 比较，无法获取日志时为 -1
+func (s *FlowyKnowledgeService) startReindex(ctx context.Context, file *knowledgeSvc.FileInfo) (int, error) {
+	logCount := -1
+	if logs, err := s.sdk.Knowledge.GetFileLogs(ctx, file.ID); err == nil {
+		logCount = len(logs)
+	}
+
+	err := s.sdk.Knowledge.ModifyFile(ctx, &knowledgeSvc.FileModifyRequest{
+		ID:             file.ID,
+		Name:           file.Name,
+		ChunkStrategy:  file.ChunkStrategy,
+		ChunkSize:      file.ChunkSize,
+		RecallStrategy: file.RecallStrategy,
+		RecallLimit:    file.RecallLimit,
+		RecallPrompt:   file.RecallPrompt,
+		Labels:         file.Labels,
+	})
+	if err != nil {
+		utils.ErrorWith("重建文件索引失败", "file_id", file.ID, "error", err)
+		return logCount, fmt.Errorf("重建文件索引失败: %w", err)
+	}
+	return logCount, nil
+}
+
+// confirmReindex 根据重新读取的文件确认 Flowy 确实开始了重建
+// 文件回到构建中或处理日志比调用前多时视为已开始重建，否则返回 ErrReindexNotStarted
+func (s *FlowyKnowledgeService) confirmReindex(ctx context.Context, current *knowledgeSvc.FileInfo, logCount int) error {
+	started := current.Status == 0
+	if !started && logCount >= 0 {
+		after, err := s.sdk.Knowledge.GetFileLogs(ctx, current.ID)
+		started = err == nil && len(after) > logCount
+	}
+	if !started {
+		utils.WarnWith("Flowy 未重建文件索引", "file_id", current.ID, "status", current.Status)
+		return fmt.Errorf("%w: Flowy 未重建文件 %d 的索引", models.ErrReindexNotStarted, current.ID)
+	}
+	return nil
+}
+
+// getFile 从知识库的文件列表中获取指定文件
+func (s *FlowyKnowledgeService) getFile(ctx context.Context, knowledgeID, fileID int) (*knowledgeSvc.FileInfo, error) {
+	files, err := s.listFiles(ctx, knowledgeID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		if files[i].ID == fileID {
+			return &files[i], nil
+		}
+	}
+	return nil, fmt.Errorf("文件ID %d 不存在: %w", fileID, database.ErrNotFound)
+}
+
+// findFile 根据本地文件索引确定文件所属的知识库并获取文件，不遍历全部知识库
+func (s *FlowyKnowledgeService) findFile(ctx context.Context, fileID int) (*knowledgeSvc.FileInfo, error) {
+	kbID, err := s.GetFileKnowledgeBaseID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	return s.getFile(ctx, kbID, fileID)
+}
+
+// listFiles 获取知识库的文件列表，同时刷新本地文件索引
+func (s *FlowyKnowledgeService) listFiles(ctx context.Context, knowledgeID int) ([]knowledgeSvc.FileInfo, error) {
+	files, err := s.sdk.Knowledge.ListFiles(ctx, knowledgeID, "zh")
+	if err != nil {
+		return nil, fmt.Errorf("获取知识库文件列表失败: %w", err)
+	}
+
+	fileIDs := make([]int, 0, len(files))
+	for i := range files {
+		fileIDs = append(fileIDs, files[i].ID)
+	}
+	if err := s.db.ReplaceFlowyKnowledgeFiles(knowledgeID, fileIDs); err != nil {
+		utils.WarnWith("更新知识库文件索引失败", "id", knowledgeID, "error", err.Error())
+	}
+	return files, nil
+}
+
+// saveFileIndex 记录上传文件所属的知识库，失败时只记录日志
+func (s *FlowyKnowledgeService) saveFileIndex(knowledgeID, fileID int) {
+	if err := s.db.SaveFlowyKnowledgeFile(knowledgeID, fileID); err != nil {
+		utils.WarnWith("保存知识库文件索引失败", "id", knowledgeID, "file_id", fileID, "error", err.Error())
+	}
+}
+
+// toKnowledgeFile 将 Flowy 文件信息转换为知识库文件
+func toKnowledgeFile(file *knowledgeSvc.FileInfo) models.KnowledgeFile {
+	return models.KnowledgeFile{
+		ID:           file.ID,
+		Name:         file.Name,
+		Size:         file.FileSize,
+		Enable:       file.Enable,
+		Status:       file.Status,
+		UploadedAt:   parseTime(file.CreateTime),
+		IndexPercent: file.IndexPercent,
+		ErrorMessage: file.ErrorMessage,
+	}
+}
+
 func getFileType(filename string) string {
 	// 简单的文件类型判断
 	if len(filename) > 4 {
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"chat-backend/models"
+	"chat-backend/utils"
+)
+
+// ErrGenerationStopped 生成被停止接口主动取消
+var ErrGenerationStopped = errors.New("生成已停止")
+
+// 生成登记参数
+const (
+	generationTimeout   = 10 * time.Minute // 与客户端连接解耦的生成的最长时间
+	generationRetention = 5 * time.Minute  // 生成结束后保留事件供断线重连的时间
+)
+
+// GenerationEvent 生成过程中缓冲的SSE事件
+type GenerationEvent struct {
+	ID    int64 // 同一生成内单调递增，从 1 开始，作为SSE的 id 字段
+	Type  string
+	Event models.SSEChatEvent
+}
+
+// Generation 一次消息生成及其已产生的事件
+type Generation struct {
+	RequestID      string
+	ConversationID int
+	StartedAt      time.Time
+
+	cancel context.CancelCauseFunc
+
+	mu      sync.Mutex
+	events  []GenerationEvent
+	done    bool
+	changed chan struct{} // 有新事件或生成结束时关闭并替换
+}
+
+// Publish 追加一个事件并通知等待中的客户端，生成结束后忽略
+func (g *Generation) Publish(eventType string, event models.SSEChatEvent) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.done {
+		return
+	}
+
+	g.events = append(g.events, GenerationEvent{
+		ID:    int64(len(g.events)) + 1,
+		Type:  eventType,
+		Event: event,
+	})
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+// EventsAfter 返回ID大于 lastEventID 的事件、下一次变化的通知通道，以及生成是否已结束
+func (g *Generation) EventsAfter(lastEventID int64) ([]GenerationEvent, <-chan struct{}, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var events []GenerationEvent
+	if lastEventID < 0 {
+		lastEventID = 0
+	}
+	if lastEventID < int64(len(g.events)) {
+		events = append(events, g.events[lastEventID:]...)
+	}
+	return events, g.changed, g.done
+}
+
+// Done 判断生成是否已结束
+func (g *Generation) Done() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.done
+}
+
+// Wait 等待生成结束，ctx 取消时返回其错误
+func (g *Generation) Wait(ctx context.Context) error {
+	for {
+		g.mu.Lock()
+		done, changed := g.done, g.changed
+		g.mu.Unlock()
+		if done {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// close 标记生成结束并通知等待中的客户端
+func (g *Generation) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.done {
+		return
+	}
+	g.done = true
+	close(g.changed)
+}
+
+// GenerationRegistry 消息生成登记表
+// 以 RequestID 为键保存进行中和刚结束的生成：生成与客户端连接解耦，事件缓冲后可在断线重连时回放，
+// 也可以通过停止接口主动取消
+type GenerationRegistry struct {
+	mu          sync.Mutex
+	generations map[string]*Generation // RequestID -> 生成
+}
+
+// NewGenerationRegistry 创建消息生成登记表
+func NewGenerationRegistry() *GenerationRegistry {
+	return &GenerationRegistry{
+		generations: make(map[string]*Generation),
+	}
+}
+
+// Start 登记一次生成，返回用于生成的上下文，生成结束后须调用 Finish
+// RequestID 为空时不登记，生成随 parent 取消；否则生成不随 parent 取消，直至完成、被停止或超时
+// RequestID 已在生成中时返回错误
+func (r *GenerationRegistry) Start(parent context.Context, requestID string, conversationID int) (context.Context, *Generation, error) {
+	generation := &Generation{
+		RequestID:      requestID,
+		ConversationID: conversationID,
+		StartedAt:      time.Now(),
+		changed:        make(chan struct{}),
+	}
+	if requestID == "" {
+		ctx, cancel := context.WithCancelCause(parent)
+		generation.cancel = cancel
+		return ctx, generation, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.generations[requestID]; ok && !existing.Done() {
+		return nil, nil, fmt.Errorf("请求 %s 正在生成中", requestID)
+	}
+
+	ctx, cancel := context.WithCancelCause(context.WithoutCancel(parent))
+	ctx, cancelTimeout := context.WithTimeoutCause(ctx, generationTimeout, fmt.Errorf("生成超过 %s", generationTimeout))
+	generation.cancel = func(cause error) {
+		cancel(cause)
+		cancelTimeout()
+	}
+	r.generations[requestID] = generation
+	return ctx, generation, nil
+}
+
+// Get 获取进行中或刚结束的生成
+func (r *GenerationRegistry) Get(requestID string) (*Generation, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	generation, ok := r.generations[requestID]
+	return generation, ok
+}
+
+// Bind 设置生成所属的对话，用于登记时尚未确定对话的生成（如重新生成前须先登记 RequestID），须在发送消息前调用
+func (r *GenerationRegistry) Bind(generation *Generation, conversationID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	generation.ConversationID = conversationID
+}
+
+// Stop 停止指定请求的生成，请求不存在或已结束时返回 false
+func (r *GenerationRegistry) Stop(requestID string) bool {
+	r.mu.Lock()
+	generation, ok := r.generations[requestID]
+	var conversationID int
+	if ok {
+		conversationID = generation.ConversationID
+	}
+	r.mu.Unlock()
+	if !ok || generation.Done() {
+		return false
+	}
+
+	utils.InfoWith("停止生成", "request_id", requestID, "conversation_id", conversationID)
+	generation.cancel(ErrGenerationStopped)
+	return true
+}
+
+// Abort 撤销尚未发送消息的生成，立即移除登记，RequestID 可马上重新使用
+func (r *GenerationRegistry) Abort(generation *Generation) {
+	generation.close()
+	generation.cancel(nil)
+	if generation.RequestID == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.generations[generation.RequestID] == generation {
+		delete(r.generations, generation.RequestID)
+	}
+}
+
+// Finish 标记生成结束并释放其上下文，事件在保留期后随登记一并移除
+func (r *GenerationRegistry) Finish(generation *Generation) {
+	generation.close()
+	generation.cancel(nil)
+	if generation.RequestID == "" {
+		return
+	}
+
+	time.AfterFunc(generationRetention, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.generations[generation.RequestID] == generation {
+			delete(r.generations, generation.RequestID)
+		}
+	})
+}
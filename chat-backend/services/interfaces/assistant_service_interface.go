@@ -0,0 +1,25 @@
+package interfaces
+
+import (
+	"context"
+
+	"chat-backend/models"
+)
+
+// AssistantServiceInterface 助手服务接口
+type AssistantServiceInterface interface {
+	// ListAssistants 获取助手列表
+	ListAssistants(ctx context.Context) (*models.AssistantListResponse, error)
+
+	// GetAssistant 获取助手
+	GetAssistant(ctx context.Context, id int) (*models.Assistant, error)
+
+	// CreateAssistant 创建助手
+	CreateAssistant(ctx context.Context, settings *models.ConversationSettings) (*models.Assistant, error)
+
+	// UpdateAssistant 修改助手，对从助手创建的对话之后的提问生效
+	UpdateAssistant(ctx context.Context, id int, settings *models.ConversationSettings) (*models.Assistant, error)
+
+	// DeleteAssistant 删除助手，助手下仍有对话时返回 models.ErrAssistantInUse
+	DeleteAssistant(ctx context.Context, id int) error
+}
@@ -2,6 +2,7 @@ package interfaces
 
 import (
 	"context"
+	"io"
 
 	"chat-backend/models"
 )
@@ -11,17 +12,41 @@ type ChatServiceInterface interface {
 	// CreateConversation 创建对话
 	CreateConversation(ctx context.Context, settings *models.ConversationSettings) (*models.Conversation, error)
 
+	// ImportConversation 创建对话并写入导入的历史消息，导入后可继续对话
+	ImportConversation(ctx context.Context, settings *models.ConversationSettings, messages []models.MessageRecord) (*models.Conversation, error)
+
+	// ForkConversation 以相同设置创建新对话，历史截至指定消息（含）
+	ForkConversation(ctx context.Context, conversationID int, messageID int) (*models.Conversation, error)
+
 	// SendMessage 发送消息并返回SSE流
 	SendMessage(ctx context.Context, req *models.ChatRequest, eventChan chan<- models.SSEChatEvent) error
 
+	// UploadChatFile 上传聊天附件，返回的附件ID用于 ChatRequest.Files
+	UploadChatFile(ctx context.Context, filename string, file io.Reader) (*models.ChatFile, error)
+
+	// RegenerateMessage 归档消息所在的最后一轮对话并将其移出历史，返回以原提问重新生成回答的请求
+	RegenerateMessage(ctx context.Context, messageID int) (*models.ChatRequest, error)
+
+	// EditMessage 归档最后一轮对话并将其移出历史，返回以新内容重新提问的请求
+	EditMessage(ctx context.Context, messageID int, content string) (*models.ChatRequest, error)
+
+	// GetMessageAlternates 获取消息所在轮次的全部版本
+	GetMessageAlternates(ctx context.Context, messageID int) (*models.MessageAlternatesResponse, error)
+
+	// SubmitFeedback 评价回答，评价保存在本地，后端支持时同步到上游
+	SubmitFeedback(ctx context.Context, messageID int, req *models.MessageFeedbackRequest) (*models.MessageFeedback, error)
+
+	// GetFeedbackReport 按模型、知识库和日期汇总回答的评价
+	GetFeedbackReport(ctx context.Context, req *models.FeedbackReportRequest) (*models.FeedbackReport, error)
+
 	// ListConversations 获取对话列表
-	ListConversations(ctx context.Context, page, pageSize int) (*models.ConversationListResponse, error)
+	ListConversations(ctx context.Context, req *models.ConversationListRequest) (*models.ConversationListResponse, error)
 
 	// DeleteConversation 删除对话
 	DeleteConversation(ctx context.Context, conversationID int) error
 
 	// GetConversations 获取对话列表 (别名方法)
-	GetConversations(ctx context.Context, page, pageSize int) (*models.ConversationListResponse, error)
+	GetConversations(ctx context.Context, req *models.ConversationListRequest) (*models.ConversationListResponse, error)
 
 	// UpdateConversationSettings 更新对话设置
 	UpdateConversationSettings(ctx context.Context, conversationID int, settings *models.ConversationSettings) error
@@ -31,4 +56,7 @@ type ChatServiceInterface interface {
 
 	// GetConversationHistory 获取对话历史记录
 	GetConversationHistory(ctx context.Context, conversationID int) (*models.ConversationHistoryResponse, error)
+
+	// SearchMessages 在所有对话的消息中搜索关键字
+	SearchMessages(ctx context.Context, req *models.MessageSearchRequest) (*models.MessageSearchResponse, error)
 }
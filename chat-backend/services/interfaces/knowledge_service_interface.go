@@ -33,9 +33,18 @@ type KnowledgeServiceInterface interface {
 	// BatchUploadFilesFromPath 批量从文件路径上传文件到知识库
 	BatchUploadFilesFromPath(ctx context.Context, id int, filePaths []string) (*models.BatchUploadResponse, error)
 
+	// GetFileKnowledgeBaseID 获取文件所属的知识库ID，只查询本地记录而不遍历知识库，未知时返回 database.ErrNotFound
+	GetFileKnowledgeBaseID(ctx context.Context, fileID int) (int, error)
+
 	// DeleteFile 删除知识库文件
 	DeleteFile(ctx context.Context, fileID int) error
 
 	// ToggleFileEnable 切换文件启用状态
 	ToggleFileEnable(ctx context.Context, fileID int, enable bool) error
+
+	// ReindexFile 重建文件索引，重建进度通过文件的 Status/IndexPercent 字段反映
+	ReindexFile(ctx context.Context, fileID int) (*models.KnowledgeFile, error)
+
+	// ReindexKnowledgeBase 重建知识库中所有文件的索引，未能开始重建的文件在响应的 Failures 中返回
+	ReindexKnowledgeBase(ctx context.Context, id int) (*models.ReindexKnowledgeBaseResponse, error)
 }
@@ -0,0 +1,34 @@
+package interfaces
+
+import (
+	"context"
+
+	"chat-backend/models"
+)
+
+// PromptTemplateServiceInterface 提示词模板服务接口
+type PromptTemplateServiceInterface interface {
+	// ListTemplates 获取提示词模板列表及全部分类
+	ListTemplates(ctx context.Context, req *models.PromptTemplateListRequest) (*models.PromptTemplateListResponse, error)
+
+	// GetTemplate 获取提示词模板
+	GetTemplate(ctx context.Context, id int) (*models.PromptTemplate, error)
+
+	// CreateTemplate 创建提示词模板
+	CreateTemplate(ctx context.Context, req *models.PromptTemplateRequest) (*models.PromptTemplate, error)
+
+	// UpdateTemplate 修改提示词模板，内容变化时生成新版本
+	UpdateTemplate(ctx context.Context, id int, req *models.PromptTemplateRequest) (*models.PromptTemplate, error)
+
+	// DeleteTemplate 删除提示词模板
+	DeleteTemplate(ctx context.Context, id int) error
+
+	// ListTemplateVersions 获取提示词模板的历史版本
+	ListTemplateVersions(ctx context.Context, id int) ([]models.PromptTemplateVersion, error)
+
+	// RenderTemplate 以给定变量渲染提示词模板，用于预览
+	RenderTemplate(ctx context.Context, id int, req *models.PromptRenderRequest) (*models.PromptRenderResponse, error)
+
+	// ApplyTemplate 对话设置引用模板时，以模板内容作为系统提示词
+	ApplyTemplate(ctx context.Context, settings *models.ConversationSettings) error
+}
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"chat-backend/models"
+	"chat-backend/pkg/database"
+	"chat-backend/services/interfaces"
+	"chat-backend/utils"
+)
+
+// 文件索引状态
+const (
+	FileStatusBuilding = 0 // 构建中
+	FileStatusFinished = 1 // 完成
+	FileStatusFailed   = 2 // 失败
+)
+
+// 状态跟踪器参数
+const (
+	statusPollInterval = 2 * time.Second
+	statusPollTimeout  = 10 * time.Second
+)
+
+// trackedFile 跟踪中的文件
+type trackedFile struct {
+	kbID int
+	file models.KnowledgeFile
+}
+
+// KnowledgeStatusTracker 知识库文件索引状态跟踪器
+// 后台轮询仍在构建中的文件并缓存其状态，状态变化时推送给订阅者，
+// 使客户端无需反复拉取整个知识库文件列表。
+// 构建中的文件和有订阅者的知识库的文件保留在缓存中，其余已完成或失败的文件不再缓存，缓存大小不随文件总数增长
+type KnowledgeStatusTracker struct {
+	knowledgeService interfaces.KnowledgeServiceInterface
+
+	mu          sync.RWMutex
+	files       map[int]*trackedFile                   // 文件ID -> 缓存状态
+	pending     map[int]map[int]struct{}               // 知识库ID -> 构建中的文件ID
+	subscribers map[int]map[*statusSubscriber]struct{} // 知识库ID -> 订阅者
+	wake        chan struct{}
+}
+
+// NewKnowledgeStatusTracker 创建知识库文件状态跟踪器
+func NewKnowledgeStatusTracker(knowledgeService interfaces.KnowledgeServiceInterface) *KnowledgeStatusTracker {
+	return &KnowledgeStatusTracker{
+		knowledgeService: knowledgeService,
+		files:            make(map[int]*trackedFile),
+		pending:          make(map[int]map[int]struct{}),
+		subscribers:      make(map[int]map[*statusSubscriber]struct{}),
+		wake:             make(chan struct{}, 1),
+	}
+}
+
+// Start 启动后台轮询，ctx 取消后停止
+func (t *KnowledgeStatusTracker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(statusPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-t.wake:
+			}
+			t.poll(ctx)
+		}
+	}()
+}
+
+// Track 缓存文件状态，构建中的文件会被加入后台轮询
+func (t *KnowledgeStatusTracker) Track(kbID int, file models.KnowledgeFile) {
+	t.update(kbID, file)
+
+	if file.Status == FileStatusBuilding {
+		select {
+		case t.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// TrackFile 更新所属知识库未知的文件状态（如重建索引后），先从缓存或知识库服务的本地记录中确定其知识库
+func (t *KnowledgeStatusTracker) TrackFile(ctx context.Context, file models.KnowledgeFile) error {
+	t.mu.RLock()
+	tracked, ok := t.files[file.ID]
+	t.mu.RUnlock()
+
+	kbID := 0
+	if ok {
+		kbID = tracked.kbID
+	} else {
+		id, err := t.knowledgeService.GetFileKnowledgeBaseID(ctx, file.ID)
+		if err != nil {
+			return fmt.Errorf("文件不存在: %d: %w", file.ID, err)
+		}
+		kbID = id
+	}
+
+	t.Track(kbID, file)
+	return nil
+}
+
+// Forget 移除文件的缓存状态（文件被删除时调用）
+func (t *KnowledgeStatusTracker) Forget(fileID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if tracked, ok := t.files[fileID]; ok {
+		delete(t.pending[tracked.kbID], fileID)
+		delete(t.files, fileID)
+	}
+}
+
+// GetFileStatus 获取文件索引状态，未缓存时加载文件所属知识库的文件列表
+// 所属知识库由知识库服务的本地记录确定，未知的文件直接返回错误，不遍历全部知识库
+func (t *KnowledgeStatusTracker) GetFileStatus(ctx context.Context, fileID int) (*models.KnowledgeFile, error) {
+	if file, ok := t.CachedFileStatus(fileID); ok {
+		return &file, nil
+	}
+
+	kbID, err := t.knowledgeService.GetFileKnowledgeBaseID(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("文件不存在: %d: %w", fileID, err)
+	}
+	files, err := t.LoadKnowledgeBase(ctx, kbID)
+	if err != nil {
+		return nil, fmt.Errorf("加载知识库文件状态失败: %w", err)
+	}
+
+	// 已完成的文件可能未被缓存，直接从拉取的列表中查找
+	for i := range files {
+		if files[i].ID == fileID {
+			return &files[i], nil
+		}
+	}
+	return nil, fmt.Errorf("文件不存在: %d: %w", fileID, database.ErrNotFound)
+}
+
+// LoadKnowledgeBase 拉取知识库文件列表并缓存所有文件状态
+func (t *KnowledgeStatusTracker) LoadKnowledgeBase(ctx context.Context, kbID int) ([]models.KnowledgeFile, error) {
+	files, err := t.knowledgeService.GetKnowledgeBaseFiles(ctx, kbID)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		t.Track(kbID, file)
+	}
+	return files, nil
+}
+
+// CachedFileStatus 只从缓存中获取文件状态，不访问知识库服务
+func (t *KnowledgeStatusTracker) CachedFileStatus(fileID int) (models.KnowledgeFile, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if tracked, ok := t.files[fileID]; ok {
+		return tracked.file, true
+	}
+	return models.KnowledgeFile{}, false
+}
+
+// Subscribe 订阅知识库文件状态变化，返回事件通道和取消订阅函数
+// 订阅者处理不及时时，同一文件只保留最新状态，待订阅者跟上后送达，不会丢失完成或失败状态
+func (t *KnowledgeStatusTracker) Subscribe(kbID int) (<-chan models.KnowledgeFile, func()) {
+	sub := newStatusSubscriber()
+
+	t.mu.Lock()
+	if t.subscribers[kbID] == nil {
+		t.subscribers[kbID] = make(map[*statusSubscriber]struct{})
+	}
+	t.subscribers[kbID][sub] = struct{}{}
+	t.mu.Unlock()
+
+	go sub.run()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			t.mu.Lock()
+			delete(t.subscribers[kbID], sub)
+			if len(t.subscribers[kbID]) == 0 {
+				delete(t.subscribers, kbID)
+				t.evictFinished(kbID)
+			}
+			t.mu.Unlock()
+			close(sub.done)
+		})
+	}
+	return sub.out, unsubscribe
+}
+
+// poll 拉取所有存在构建中文件的知识库，更新缓存并推送变化
+func (t *KnowledgeStatusTracker) poll(ctx context.Context) {
+	t.mu.RLock()
+	kbIDs := make([]int, 0, len(t.pending))
+	for kbID, fileIDs := range t.pending {
+		if len(fileIDs) > 0 {
+			kbIDs = append(kbIDs, kbID)
+		}
+	}
+	t.mu.RUnlock()
+
+	for _, kbID := range kbIDs {
+		pollCtx, cancel := context.WithTimeout(ctx, statusPollTimeout)
+		files, err := t.knowledgeService.GetKnowledgeBaseFiles(pollCtx, kbID)
+		cancel()
+		if err != nil {
+			utils.ErrorWith("轮询知识库文件状态失败", "kb_id", kbID, "error", err)
+			continue
+		}
+
+		found := make(map[int]bool, len(files))
+		for _, file := range files {
+			found[file.ID] = true
+			t.update(kbID, file)
+		}
+
+		// 构建完成前被删除的文件视为失败
+		t.mu.RLock()
+		var missing []models.KnowledgeFile
+		for fileID := range t.pending[kbID] {
+			if !found[fileID] {
+				file := t.files[fileID].file
+				file.Status = FileStatusFailed
+				file.ErrorMessage = "文件不存在"
+				missing = append(missing, file)
+			}
+		}
+		t.mu.RUnlock()
+
+		for _, file := range missing {
+			t.update(kbID, file)
+			t.Forget(file.ID)
+		}
+	}
+}
+
+// update 更新文件缓存，状态或进度发生变化时推送给订阅者
+func (t *KnowledgeStatusTracker) update(kbID int, file models.KnowledgeFile) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	old, exists := t.files[file.ID]
+	changed := !exists || old.file.Status != file.Status || old.file.IndexPercent != file.IndexPercent
+	t.files[file.ID] = &trackedFile{kbID: kbID, file: file}
+
+	if file.Status == FileStatusBuilding {
+		if t.pending[kbID] == nil {
+			t.pending[kbID] = make(map[int]struct{})
+		}
+		t.pending[kbID][file.ID] = struct{}{}
+	} else if fileIDs, ok := t.pending[kbID]; ok {
+		delete(fileIDs, file.ID)
+		if len(fileIDs) == 0 {
+			delete(t.pending, kbID)
+		}
+	}
+
+	if changed {
+		for sub := range t.subscribers[kbID] {
+			sub.push(file)
+		}
+	}
+	if file.Status != FileStatusBuilding && len(t.subscribers[kbID]) == 0 {
+		delete(t.files, file.ID)
+	}
+}
+
+// evictFinished 移除知识库中已完成或失败的文件缓存，在知识库没有订阅者后调用，调用方须持有写锁
+func (t *KnowledgeStatusTracker) evictFinished(kbID int) {
+	for fileID, tracked := range t.files {
+		if tracked.kbID == kbID && tracked.file.Status != FileStatusBuilding {
+			delete(t.files, fileID)
+		}
+	}
+}
+
+// statusSubscriber 文件状态订阅者
+// 待送达的状态按文件合并，只保留每个文件的最新状态，由独立的 goroutine 依次送达
+type statusSubscriber struct {
+	out    chan models.KnowledgeFile
+	notify chan struct{}
+	done   chan struct{}
+
+	mu     sync.Mutex
+	queue  []int                        // 待送达的文件ID，按首次变化的顺序排列
+	latest map[int]models.KnowledgeFile // 文件ID -> 最新状态
+}
+
+// newStatusSubscriber 创建订阅者
+func newStatusSubscriber() *statusSubscriber {
+	return &statusSubscriber{
+		out:    make(chan models.KnowledgeFile),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		latest: make(map[int]models.KnowledgeFile),
+	}
+}
+
+// push 记录文件的最新状态并唤醒送达 goroutine，不会阻塞
+func (s *statusSubscriber) push(file models.KnowledgeFile) {
+	s.mu.Lock()
+	if _, ok := s.latest[file.ID]; !ok {
+		s.queue = append(s.queue, file.ID)
+	}
+	s.latest[file.ID] = file
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// next 取出下一个待送达的状态
+func (s *statusSubscriber) next() (models.KnowledgeFile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return models.KnowledgeFile{}, false
+	}
+	fileID := s.queue[0]
+	s.queue = s.queue[1:]
+	file := s.latest[fileID]
+	delete(s.latest, fileID)
+	return file, true
+}
+
+// run 依次送达待送达的状态，直到取消订阅
+func (s *statusSubscriber) run() {
+	for {
+		select {
+		case <-s.notify:
+		case <-s.done:
+			return
+		}
+		for {
+			file, ok := s.next()
+			if !ok {
+				break
+			}
+			select {
+			case s.out <- file:
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
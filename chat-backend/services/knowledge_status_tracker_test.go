@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"chat-backend/models"
+	"chat-backend/pkg/database"
+	"chat-backend/services/interfaces"
+)
+
+// fakeKnowledgeService 以内存中的知识库文件列表模拟知识库服务
+type fakeKnowledgeService struct {
+	interfaces.KnowledgeServiceInterface
+
+	mu        sync.Mutex
+	files     map[int][]models.KnowledgeFile // 知识库ID -> 文件列表
+	listCalls int
+}
+
+func newFakeKnowledgeService() *fakeKnowledgeService {
+	return &fakeKnowledgeService{files: make(map[int][]models.KnowledgeFile)}
+}
+
+// setFiles 替换知识库的文件列表
+func (s *fakeKnowledgeService) setFiles(kbID int, files ...models.KnowledgeFile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[kbID] = files
+}
+
+func (s *fakeKnowledgeService) GetKnowledgeBaseFiles(ctx context.Context, id int) ([]models.KnowledgeFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listCalls++
+	return append([]models.KnowledgeFile(nil), s.files[id]...), nil
+}
+
+func (s *fakeKnowledgeService) GetFileKnowledgeBaseID(ctx context.Context, fileID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for kbID, files := range s.files {
+		for _, file := range files {
+			if file.ID == fileID {
+				return kbID, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("文件 %d 不存在: %w", fileID, database.ErrNotFound)
+}
+
+// receive 在超时前从订阅通道读取一个状态
+func receive(t *testing.T, events <-chan models.KnowledgeFile) models.KnowledgeFile {
+	t.Helper()
+	select {
+	case file := <-events:
+		return file
+	case <-time.After(time.Second):
+		t.Fatal("等待文件状态超时")
+		return models.KnowledgeFile{}
+	}
+}
+
+func TestKnowledgeStatusTrackerGetFileStatus(t *testing.T) {
+	knowledge := newFakeKnowledgeService()
+	knowledge.setFiles(1, models.KnowledgeFile{ID: 10, Status: FileStatusFinished}, models.KnowledgeFile{ID: 11, Status: FileStatusBuilding})
+	tracker := NewKnowledgeStatusTracker(knowledge)
+
+	file, err := tracker.GetFileStatus(context.Background(), 11)
+	if err != nil {
+		t.Fatalf("GetFileStatus() error = %v", err)
+	}
+	if file.Status != FileStatusBuilding {
+		t.Errorf("Status = %d, want %d", file.Status, FileStatusBuilding)
+	}
+
+	// 构建中的文件已被缓存，不再拉取文件列表
+	if _, err := tracker.GetFileStatus(context.Background(), 11); err != nil {
+		t.Fatalf("GetFileStatus() error = %v", err)
+	}
+	if knowledge.listCalls != 1 {
+		t.Errorf("拉取文件列表 %d 次, want 1", knowledge.listCalls)
+	}
+
+	// 没有订阅者时已完成的文件不缓存，每次从文件列表中获取
+	file, err = tracker.GetFileStatus(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("GetFileStatus() error = %v", err)
+	}
+	if file.Status != FileStatusFinished || knowledge.listCalls != 2 {
+		t.Errorf("Status = %d, 拉取文件列表 %d 次, want %d 和 2 次", file.Status, knowledge.listCalls, FileStatusFinished)
+	}
+
+	// 未知文件直接返回 ErrNotFound，不遍历知识库
+	if _, err := tracker.GetFileStatus(context.Background(), 99); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetFileStatus(99) error = %v, want ErrNotFound", err)
+	}
+	if knowledge.listCalls != 2 {
+		t.Errorf("拉取文件列表 %d 次, want 2", knowledge.listCalls)
+	}
+}
+
+// TestKnowledgeStatusTrackerEviction 已结束的文件只在知识库有订阅者时缓存，最后一个订阅者取消后移除
+func TestKnowledgeStatusTrackerEviction(t *testing.T) {
+	tracker := NewKnowledgeStatusTracker(newFakeKnowledgeService())
+
+	tracker.Track(1, models.KnowledgeFile{ID: 1, Status: FileStatusFinished})
+	if _, ok := tracker.CachedFileStatus(1); ok {
+		t.Error("没有订阅者时缓存了已完成的文件")
+	}
+
+	_, unsubscribe := tracker.Subscribe(1)
+	_, unsubscribeOther := tracker.Subscribe(1)
+	tracker.Track(1, models.KnowledgeFile{ID: 1, Status: FileStatusFinished})
+	tracker.Track(1, models.KnowledgeFile{ID: 2, Status: FileStatusFailed})
+	tracker.Track(1, models.KnowledgeFile{ID: 3, Status: FileStatusBuilding})
+	tracker.Track(2, models.KnowledgeFile{ID: 4, Status: FileStatusBuilding})
+
+	unsubscribe()
+	if _, ok := tracker.CachedFileStatus(1); !ok {
+		t.Error("仍有订阅者时移除了文件缓存")
+	}
+
+	unsubscribeOther()
+	for _, fileID := range []int{1, 2} {
+		if _, ok := tracker.CachedFileStatus(fileID); ok {
+			t.Errorf("文件 %d 在最后一个订阅者取消后仍被缓存", fileID)
+		}
+	}
+	for _, fileID := range []int{3, 4} {
+		if _, ok := tracker.CachedFileStatus(fileID); !ok {
+			t.Errorf("构建中的文件 %d 被移出缓存", fileID)
+		}
+	}
+}
+
+func TestKnowledgeStatusTrackerTrackFile(t *testing.T) {
+	knowledge := newFakeKnowledgeService()
+	knowledge.setFiles(2, models.KnowledgeFile{ID: 20, Status: FileStatusFinished})
+	tracker := NewKnowledgeStatusTracker(knowledge)
+
+	events, unsubscribe := tracker.Subscribe(2)
+	defer unsubscribe()
+
+	if err := tracker.TrackFile(context.Background(), models.KnowledgeFile{ID: 20, Status: FileStatusBuilding}); err != nil {
+		t.Fatalf("TrackFile() error = %v", err)
+	}
+	if file := receive(t, events); file.ID != 20 || file.Status != FileStatusBuilding {
+		t.Errorf("收到 %+v, want 文件 20 构建中", file)
+	}
+
+	if err := tracker.TrackFile(context.Background(), models.KnowledgeFile{ID: 99}); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("TrackFile(99) error = %v, want ErrNotFound", err)
+	}
+}
+
+// TestKnowledgeStatusTrackerSlowSubscriber 订阅者处理不及时时合并中间状态，但总能收到最终状态
+func TestKnowledgeStatusTrackerSlowSubscriber(t *testing.T) {
+	tracker := NewKnowledgeStatusTracker(newFakeKnowledgeService())
+	events, unsubscribe := tracker.Subscribe(1)
+	defer unsubscribe()
+
+	for percent := 0; percent < 100; percent += 10 {
+		tracker.Track(1, models.KnowledgeFile{ID: 1, Status: FileStatusBuilding, IndexPercent: percent})
+		tracker.Track(1, models.KnowledgeFile{ID: 2, Status: FileStatusBuilding, IndexPercent: percent})
+	}
+	tracker.Track(1, models.KnowledgeFile{ID: 1, Status: FileStatusFinished, IndexPercent: 100})
+	tracker.Track(1, models.KnowledgeFile{ID: 2, Status: FileStatusFailed})
+
+	final := make(map[int]models.KnowledgeFile)
+	for len(final) < 2 {
+		file := receive(t, events)
+		if file.Status != FileStatusBuilding {
+			final[file.ID] = file
+		}
+	}
+	if final[1].Status != FileStatusFinished || final[1].IndexPercent != 100 {
+		t.Errorf("文件 1 最终状态 = %+v, want 完成", final[1])
+	}
+	if final[2].Status != FileStatusFailed {
+		t.Errorf("文件 2 最终状态 = %+v, want 失败", final[2])
+	}
+}
+
+// TestKnowledgeStatusTrackerPoll 轮询更新构建中的文件，构建完成前被删除的文件视为失败
+func TestKnowledgeStatusTrackerPoll(t *testing.T) {
+	knowledge := newFakeKnowledgeService()
+	tracker := NewKnowledgeStatusTracker(knowledge)
+	tracker.Track(1, models.KnowledgeFile{ID: 1, Status: FileStatusBuilding})
+	tracker.Track(1, models.KnowledgeFile{ID: 2, Status: FileStatusBuilding})
+
+	events, unsubscribe := tracker.Subscribe(1)
+	defer unsubscribe()
+
+	knowledge.setFiles(1, models.KnowledgeFile{ID: 1, Status: FileStatusFinished, IndexPercent: 100})
+	tracker.poll(context.Background())
+
+	got := map[int]models.KnowledgeFile{}
+	for len(got) < 2 {
+		file := receive(t, events)
+		got[file.ID] = file
+	}
+	if got[1].Status != FileStatusFinished {
+		t.Errorf("文件 1 状态 = %d, want %d", got[1].Status, FileStatusFinished)
+	}
+	if got[2].Status != FileStatusFailed {
+		t.Errorf("文件 2 状态 = %d, want %d", got[2].Status, FileStatusFailed)
+	}
+	if _, ok := tracker.CachedFileStatus(2); ok {
+		t.Error("被删除的文件应移出缓存")
+	}
+	if len(tracker.pending) != 0 {
+		t.Errorf("仍有 %d 个知识库等待轮询", len(tracker.pending))
+	}
+}
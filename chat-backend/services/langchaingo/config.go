@@ -23,6 +23,9 @@ type LangchaingoConfig struct {
 	
 	// SQLite 配置
 	SQLite SQLiteConfig `json:"sqlite"`
+	
+	// 文件存储配置
+	Upload UploadConfig `json:"upload"`
 }
 
 // LLMConfig LLM 配置
@@ -57,6 +60,11 @@ type SQLiteConfig struct {
 	Password string `json:"password"`
 }
 
+// UploadConfig 文件存储配置
+type UploadConfig struct {
+	Dir string `json:"dir"`
+}
+
 // GetLangchaingoConfig 从统一环境配置获取 Langchaingo 配置
 func GetLangchaingoConfig() *LangchaingoConfig {
 	envConfig := utils.GetGlobalEnvConfig()
@@ -92,6 +100,9 @@ func GetLangchaingoConfig() *LangchaingoConfig {
 			DBPath:   envConfig.Get("LANGCHAINO_SQLITE_DB_PATH"),
 			Password: envConfig.Get("LANGCHAINO_SQLITE_PASSWORD"),
 		},
+		Upload: UploadConfig{
+			Dir: envConfig.Get("LANGCHAINO_UPLOAD_DIR"),
+		},
 	}
 }
 
@@ -131,5 +142,9 @@ func (c *LangchaingoConfig) ValidateConfig() error {
 		c.SQLite.DBPath = "./chat_history.db"
 	}
 	
+	if c.Upload.Dir == "" {
+		c.Upload.Dir = "./uploads"
+	}
+	
 	return nil
 }
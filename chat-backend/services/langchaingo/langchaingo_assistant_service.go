@@ -0,0 +1,95 @@
+package langchaingo
+
+import (
+	"context"
+	"fmt"
+
+	"chat-backend/models"
+	"chat-backend/pkg/database"
+	"chat-backend/services/interfaces"
+)
+
+// LangchaingoAssistantService 基于 langchaingo 的助手服务实现
+// 助手只保存在本地数据库，从助手创建的对话在每次提问时读取对话的设置快照
+type LangchaingoAssistantService struct {
+	db *database.Database
+}
+
+// NewLangchaingoAssistantService 创建 Langchaingo 助手服务
+func NewLangchaingoAssistantService(db *database.Database) interfaces.AssistantServiceInterface {
+	return &LangchaingoAssistantService{
+		db: db,
+	}
+}
+
+// ListAssistants 获取助手列表
+func (s *LangchaingoAssistantService) ListAssistants(ctx context.Context) (*models.AssistantListResponse, error) {
+	records, err := s.db.ListAssistants()
+	if err != nil {
+		return nil, err
+	}
+
+	assistants := make([]models.Assistant, 0, len(records))
+	for i := range records {
+		assistant, err := s.toAssistant(&records[i])
+		if err != nil {
+			return nil, err
+		}
+		assistants = append(assistants, *assistant)
+	}
+	return &models.AssistantListResponse{Assistants: assistants}, nil
+}
+
+// GetAssistant 获取助手
+func (s *LangchaingoAssistantService) GetAssistant(ctx context.Context, id int) (*models.Assistant, error) {
+	assistant, err := s.db.GetAssistant(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toAssistant(assistant)
+}
+
+// CreateAssistant 创建助手
+func (s *LangchaingoAssistantService) CreateAssistant(ctx context.Context, settings *models.ConversationSettings) (*models.Assistant, error) {
+	assistant, err := s.db.CreateAssistant(settings, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return assistant.ToAssistant(0), nil
+}
+
+// UpdateAssistant 修改助手，同时更新从助手创建的对话的设置快照
+func (s *LangchaingoAssistantService) UpdateAssistant(ctx context.Context, id int, settings *models.ConversationSettings) (*models.Assistant, error) {
+	assistant, err := s.db.GetAssistant(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.UpdateAssistant(assistant, settings); err != nil {
+		return nil, err
+	}
+	return s.toAssistant(assistant)
+}
+
+// DeleteAssistant 删除助手，助手下仍有对话时不能删除
+func (s *LangchaingoAssistantService) DeleteAssistant(ctx context.Context, id int) error {
+	if _, err := s.db.GetAssistant(id); err != nil {
+		return err
+	}
+	count, err := s.db.CountAssistantConversations(id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %d 个对话", models.ErrAssistantInUse, count)
+	}
+	return s.db.DeleteAssistant(id)
+}
+
+// toAssistant 转换为 Assistant 并统计从助手创建的对话数量
+func (s *LangchaingoAssistantService) toAssistant(assistant *models.AssistantGORM) (*models.Assistant, error) {
+	count, err := s.db.CountAssistantConversations(int(assistant.ID))
+	if err != nil {
+		return nil, err
+	}
+	return assistant.ToAssistant(int(count)), nil
+}
@@ -1,25 +1,48 @@
 package langchaingo
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"chat-backend/models"
+	"chat-backend/pkg/database"
 	"chat-backend/services/interfaces"
 	"chat-backend/utils"
 )
 
+// chatFileMaxPromptRunes 每个附件注入提示词的最大字符数，超出部分截断
+const chatFileMaxPromptRunes = 20000
+
+// doclingFileExtensions 通过 Docling 提取文本的附件类型，与知识库文档的解析流程相同
+var doclingFileExtensions = map[string]bool{
+	".pdf":  true,
+	".docx": true,
+	".pptx": true,
+	".xlsx": true,
+}
+
 // LangchaingoChatService 基于 langchaingo 的聊天服务实现
 type LangchaingoChatService struct {
 	config                    *LangchaingoConfig
+	db                        *database.Database
 	defaultSettingsService interfaces.DefaultSettingsServiceInterface
 }
 
 // NewLangchaingoChatService 创建 Langchaingo 聊天服务
-func NewLangchaingoChatService(config *LangchaingoConfig, defaultSettingsService interfaces.DefaultSettingsServiceInterface) interfaces.ChatServiceInterface {
+func NewLangchaingoChatService(config *LangchaingoConfig, db *database.Database, defaultSettingsService interfaces.DefaultSettingsServiceInterface) interfaces.ChatServiceInterface {
 	return &LangchaingoChatService{
 		config:                    config,
+		db:                        db,
 		defaultSettingsService: defaultSettingsService,
 	}
 }
@@ -46,31 +69,106 @@ func (s *LangchaingoChatService) CreateConversation(ctx context.Context, setting
 		utils.LogInfo("创建对话: %s", settings.Name)
 	}
 
-	// TODO: 实现 langchaingo 对话创建
-	// 这里需要：
-	// 1. 创建 SQLite 对话记录
-	// 2. 初始化对话记忆
-	// 3. 设置知识库关联（如果有）
-	
-	// 暂时返回模拟数据
-	conversationID := 1 // 模拟ID
+	// 指定了助手时，除名称和描述外的设置取自助手
+	if settings.AssistantID != 0 {
+		assistant, err := s.db.GetAssistant(settings.AssistantID)
+		if err != nil {
+			return nil, err
+		}
+		settings = assistant.ConversationSettings(settings.Name, settings.Desc)
+	}
 
-	utils.InfoWith("对话创建成功", "conversation_id", conversationID, "name", settings.Name)
+	// 创建 SQLite 对话记录
+	// TODO: 初始化对话记忆
+	conversation, err := s.db.CreateConversation(settings)
+	if err != nil {
+		return nil, err
+	}
 
-	// 转换为Conversation模型
-	return &models.Conversation{
-		ID:                   conversationID,
-		ConversationSettings: *settings,
-	}, nil
+	utils.InfoWith("对话创建成功", "conversation_id", conversation.ID, "name", settings.Name)
+	return conversation, nil
+}
+
+// ImportConversation 创建对话并写入导入的历史消息，与 Flowy 实现一致，导入的对话不属于任何助手
+func (s *LangchaingoChatService) ImportConversation(ctx context.Context, settings *models.ConversationSettings, messages []models.MessageRecord) (*models.Conversation, error) {
+	detached := *settings
+	detached.AssistantID = 0
+	conversation, err := s.CreateConversation(ctx, &detached)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.CreateMessages(conversation.ID, messages); err != nil {
+		// 清理已创建的对话
+		_ = s.db.DeleteConversation(conversation.ID)
+		return nil, err
+	}
+
+	utils.InfoWith("对话导入成功", "conversation_id", conversation.ID, "message_count", len(messages))
+	return conversation, nil
+}
+
+// ForkConversation 以相同设置创建新对话，并复制截至指定消息（含）的历史，分支不属于任何助手
+func (s *LangchaingoChatService) ForkConversation(ctx context.Context, conversationID int, messageID int) (*models.Conversation, error) {
+	utils.InfoWith("创建对话分支", "conversation_id", conversationID, "message_id", messageID)
+
+	source, err := s.db.GetConversation(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.db.GetMessage(conversationID, messageID); err != nil {
+		return nil, err
+	}
+
+	settings := source.ConversationSettings
+	settings.AssistantID = 0
+	conversation, err := s.db.CreateConversation(&settings)
+	if err != nil {
+		return nil, err
+	}
+
+	copied, err := s.db.CopyMessages(conversationID, conversation.ID, messageID)
+	if err != nil {
+		// 清理已创建的对话
+		_ = s.db.DeleteConversation(conversation.ID)
+		return nil, err
+	}
+
+	utils.InfoWith("对话分支创建成功", "conversation_id", conversation.ID, "source_id", conversationID, "message_count", copied)
+	return conversation, nil
 }
 
 // SendMessage 发送消息并返回SSE流
 func (s *LangchaingoChatService) SendMessage(ctx context.Context, req *models.ChatRequest, eventChan chan<- models.SSEChatEvent) error {
 	utils.InfoWith("开始流式发送消息", "conversation_id", req.ConversationID, "content", req.Content)
 
-	defer close(eventChan)
+	conversation, err := s.db.GetConversation(req.ConversationID)
+	if err != nil {
+		close(eventChan)
+		return err
+	}
+	systemPrompt := conversation.SystemPromptText()
+
+	// 附件内容仅作为本轮提问的上下文，不写入消息历史
+	prompt := req.Content
+	if len(req.Files) > 0 {
+		files, err := s.db.GetChatFiles(req.Files)
+		if err != nil {
+			close(eventChan)
+			return err
+		}
+		prompt = attachmentPrompt(req.Content, files)
+		utils.InfoWith("已注入附件内容", "conversation_id", req.ConversationID, "file_count", len(files))
+	}
+
+	// 保存用户消息，附件ID随消息保存，重新生成或编辑时沿用
+	if _, err := s.db.CreateMessage(req.ConversationID, "user", req.Content, req.Files); err != nil {
+		close(eventChan)
+		return err
+	}
 
-	// TODO: 实现 KEY_PROCESS_AND_CODE.md 中的 chat 流程
+	// TODO: 实现 KEY_PROCESS_AND_CODE.md 中的 chat 流程，以 systemPrompt 作为系统消息、prompt 作为本轮输入
+	utils.InfoWith("使用系统提示词", "conversation_id", req.ConversationID, "system_prompt_length", len(systemPrompt), "prompt_length", len(prompt))
 	// 这里需要：
 	// 1. 初始化 LLM (OpenAI)
 	// 2. 初始化嵌入模型 (Ollama bge-m3)
@@ -79,80 +177,240 @@ func (s *LangchaingoChatService) SendMessage(ctx context.Context, req *models.Ch
 	// 5. 使用 ConversationalRetrievalQA 进行问答
 	// 6. 支持流式输出
 
-	// 模拟流式响应
+	// 模拟流式响应，ctx 被取消（停止生成或客户端断开）时保存已生成的部分
 	go func() {
+		defer close(eventChan)
+
 		// 发送开始事件
 		startEvent := models.SSEChatEvent{
-			Type:  "resp_splash",
+			Type:  models.ChatEventSplash,
 			Data:  "开始处理消息",
 			ID:    fmt.Sprintf("%d", req.ConversationID),
 		}
-		eventChan <- startEvent
+		if !sendEvent(ctx, eventChan, startEvent) {
+			return
+		}
 
 		// 模拟处理延迟
-		time.Sleep(1 * time.Second)
+		if !sleep(ctx, 1*time.Second) {
+			return
+		}
 
 		// 发送内容块
 		content := "这是基于 Langchaingo 的模拟响应。实际实现将集成 OpenAI LLM、Ollama 向量化和 Qdrant 检索。"
+		var answer strings.Builder
+		finishReason := models.FinishReasonStop
 		for _, char := range content {
 			chunkEvent := models.SSEChatEvent{
-				Type:  "resp_increment",
+				Type:  models.ChatEventDelta,
 				Data:  string(char),
 				ID:    fmt.Sprintf("%d", req.ConversationID),
 			}
-			eventChan <- chunkEvent
-			time.Sleep(50 * time.Millisecond) // 模拟流式延迟
+			if !sendEvent(ctx, eventChan, chunkEvent) {
+				finishReason = models.FinishReasonStopped
+				break
+			}
+			answer.WriteRune(char)
+			if !sleep(ctx, 50*time.Millisecond) { // 模拟流式延迟
+				finishReason = models.FinishReasonStopped
+				break
+			}
+		}
+
+		// 保存助手回复
+		if answer.Len() > 0 {
+			// 记录生成回答时的模型和知识库，评价时据此统计
+			reply := models.MessageRecord{
+				Role:             "assistant",
+				Content:          answer.String(),
+				FinishReason:     finishReason,
+				RequestID:        req.RequestID,
+				ModelID:          conversation.ModelID,
+				KnowledgeBaseIDs: conversation.KnowledgeBaseIDs,
+			}
+			if err := s.db.CreateMessages(req.ConversationID, []models.MessageRecord{reply}); err != nil {
+				utils.ErrorWith("保存助手回复失败", "conversation_id", req.ConversationID, "error", err)
+			}
+		}
+		if finishReason == models.FinishReasonStopped {
+			utils.InfoWith("生成已中断", "conversation_id", req.ConversationID, "request_id", req.RequestID, "answer_length", answer.Len())
+			return
 		}
 
 		// 发送结束事件
 		endEvent := models.SSEChatEvent{
-			Type:  "resp_finish",
-			Data:  "处理完成",
-			ID:    fmt.Sprintf("%d", req.ConversationID),
+			Type:         models.ChatEventFinish,
+			Data:         "处理完成",
+			ID:           fmt.Sprintf("%d", req.ConversationID),
+			FinishReason: finishReason,
 		}
-		eventChan <- endEvent
+		sendEvent(ctx, eventChan, endEvent)
 	}()
 
 	utils.InfoWith("流式消息发送完成", "conversation_id", req.ConversationID)
 	return nil
 }
 
-// ListConversations 获取对话列表
-func (s *LangchaingoChatService) ListConversations(ctx context.Context, page, pageSize int) (*models.ConversationListResponse, error) {
-	utils.LogInfo("获取对话列表")
+// UploadChatFile 提取附件的文本内容并保存，发送消息时注入提示词
+// 支持 UTF-8 编码的文本文件和 PDF、Word、PowerPoint、Excel 文档（由 Docling 解析），其他文件返回 ErrChatFileType
+func (s *LangchaingoChatService) UploadChatFile(ctx context.Context, filename string, file io.Reader) (*models.ChatFile, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("读取附件失败: %w", err)
+	}
 
-	// TODO: 实现 SQLite 对话记录查询
-	// 暂时返回空列表
-	var allConversations []models.Conversation
+	text, contentType, err := s.extractFileText(ctx, filename, data)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := newChatFileID()
+	if err != nil {
+		return nil, fmt.Errorf("生成附件ID失败: %w", err)
+	}
 
-	// 增加对 page 和 pageSize 的校验
-	if page <= 0 {
-		page = 1
+	record := &models.ChatFileGORM{
+		ID:          id,
+		Name:        filename,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Content:     text,
 	}
-	if pageSize <= 0 {
-		pageSize = 10
+	if err := s.db.SaveChatFile(record); err != nil {
+		return nil, err
 	}
 
-	start := (page - 1) * pageSize
-	end := start + pageSize
+	utils.InfoWith("聊天附件上传成功", "file_id", id, "name", filename, "size", len(data))
+	return record.ToChatFile(), nil
+}
 
-	var pagedConversations []models.Conversation
+// RegenerateMessage 归档消息所在的最后一轮对话并删除，返回以原提问重新生成回答的请求
+func (s *LangchaingoChatService) RegenerateMessage(ctx context.Context, messageID int) (*models.ChatRequest, error) {
+	return s.rewindTurn(messageID, "")
+}
 
-	// 确保 start 不会越界
-	if start < len(allConversations) {
-		if end > len(allConversations) {
-			end = len(allConversations)
-		}
-		pagedConversations = allConversations[start:end]
-	} else {
-		pagedConversations = []models.Conversation{}
+// EditMessage 归档最后一轮对话并删除，返回以新内容重新提问的请求
+func (s *LangchaingoChatService) EditMessage(ctx context.Context, messageID int, content string) (*models.ChatRequest, error) {
+	return s.rewindTurn(messageID, content)
+}
+
+// rewindTurn 将消息所在的最后一轮对话保存为历史版本后删除，content 为空时沿用原提问，附件总是沿用原提问的附件
+func (s *LangchaingoChatService) rewindTurn(messageID int, content string) (*models.ChatRequest, error) {
+	conversationID, err := s.db.GetMessageConversationID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := s.db.ListMessages(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	turn, ok := models.FindMessageTurn(messages, messageID)
+	if !ok {
+		return nil, fmt.Errorf("消息 %d 不属于任何一轮对话: %w", messageID, database.ErrNotFound)
+	}
+	if turn.End != len(messages) {
+		return nil, models.ErrMessageNotLatest
+	}
+	if content != "" && messages[turn.Start].ID != messageID {
+		return nil, fmt.Errorf("只能编辑用户消息: %w", models.ErrMessageNotEditable)
+	}
+
+	variant := models.NewMessageVariantGORM(conversationID, messages, turn)
+	if err := s.db.SaveMessageVariant(variant); err != nil {
+		return nil, err
+	}
+	if err := s.db.DeleteMessageRange(conversationID, variant.FirstMessageID, variant.LastMessageID); err != nil {
+		return nil, err
+	}
+
+	if content == "" {
+		content = variant.Question
+	}
+	utils.InfoWith("已归档对话轮次", "conversation_id", conversationID, "turn", turn.Index, "edited", content != variant.Question)
+	return &models.ChatRequest{ConversationID: conversationID, Content: content, Files: messages[turn.Start].Files}, nil
+}
+
+// GetMessageAlternates 获取消息所在轮次的全部版本
+func (s *LangchaingoChatService) GetMessageAlternates(ctx context.Context, messageID int) (*models.MessageAlternatesResponse, error) {
+	conversationID, err := s.db.GetMessageConversationID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := s.db.ListMessages(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	turn, ok := models.FindMessageTurn(messages, messageID)
+	if !ok {
+		return nil, fmt.Errorf("消息 %d 不属于任何一轮对话: %w", messageID, database.ErrNotFound)
+	}
+	variants, err := s.db.ListMessageVariants(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	return models.NewMessageAlternatesResponse(conversationID, messages, turn, variants), nil
+}
+
+// SubmitFeedback 评价回答并保存到本地
+func (s *LangchaingoChatService) SubmitFeedback(ctx context.Context, messageID int, req *models.MessageFeedbackRequest) (*models.MessageFeedback, error) {
+	conversationID, err := s.db.GetMessageConversationID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	conversation, err := s.db.GetConversation(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := s.db.ListMessages(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	turn, ok := models.FindMessageTurn(messages, messageID)
+	if !ok {
+		return nil, fmt.Errorf("消息 %d 不属于任何一轮对话: %w", messageID, database.ErrNotFound)
+	}
+	feedback, err := models.NewMessageFeedbackGORM(conversationID, &conversation.ConversationSettings, messages, turn, messageID, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SaveMessageFeedback(feedback); err != nil {
+		return nil, err
+	}
+
+	utils.InfoWith("回答评价已保存", "conversation_id", conversationID, "message_id", messageID, "rating", req.Rating)
+	return feedback.ToMessageFeedback(), nil
+}
+
+// GetFeedbackReport 汇总本地保存的回答评价
+func (s *LangchaingoChatService) GetFeedbackReport(ctx context.Context, req *models.FeedbackReportRequest) (*models.FeedbackReport, error) {
+	feedback, err := s.db.ListMessageFeedback(req.Since, req.Until, req.ModelID)
+	if err != nil {
+		return nil, err
+	}
+	return models.NewFeedbackReport(req, feedback), nil
+}
+
+// ListConversations 获取对话列表
+func (s *LangchaingoChatService) ListConversations(ctx context.Context, req *models.ConversationListRequest) (*models.ConversationListResponse, error) {
+	utils.LogInfo("获取对话列表")
+
+	if err := req.Normalize(); err != nil {
+		return nil, err
+	}
+
+	conversations, total, err := s.db.ListConversations(req)
+	if err != nil {
+		return nil, err
 	}
 
 	return &models.ConversationListResponse{
-		Conversations: pagedConversations,
-		Total:         len(allConversations),
-		Page:          page,
-		PageSize:      pageSize,
+		Conversations: conversations,
+		Total:         int(total),
+		Page:          req.Page,
+		PageSize:      req.PageSize,
 	}, nil
 }
 
@@ -160,24 +418,51 @@ func (s *LangchaingoChatService) ListConversations(ctx context.Context, page, pa
 func (s *LangchaingoChatService) DeleteConversation(ctx context.Context, conversationID int) error {
 	utils.InfoWith("删除对话", "conversation_id", conversationID)
 
-	// TODO: 实现 SQLite 对话记录删除
-	// 这里需要删除对话相关的所有记录
+	if err := s.db.DeleteConversation(conversationID); err != nil {
+		return err
+	}
+	if _, err := s.db.DeleteConversationChatFiles(conversationID); err != nil {
+		utils.ErrorWith("删除对话附件失败", "conversation_id", conversationID, "error", err)
+	}
+	if err := s.db.DeleteMessages(conversationID); err != nil {
+		utils.ErrorWith("删除对话消息失败", "conversation_id", conversationID, "error", err)
+	}
+	if err := s.db.DeleteMessageVariants(conversationID); err != nil {
+		utils.ErrorWith("删除消息历史版本失败", "conversation_id", conversationID, "error", err)
+	}
 
 	utils.InfoWith("删除对话成功", "conversation_id", conversationID)
 	return nil
 }
 
 // GetConversations 获取对话列表 (别名方法)
-func (s *LangchaingoChatService) GetConversations(ctx context.Context, page, pageSize int) (*models.ConversationListResponse, error) {
-	return s.ListConversations(ctx, page, pageSize)
+func (s *LangchaingoChatService) GetConversations(ctx context.Context, req *models.ConversationListRequest) (*models.ConversationListResponse, error) {
+	return s.ListConversations(ctx, req)
 }
 
 // UpdateConversationSettings 更新对话设置
 func (s *LangchaingoChatService) UpdateConversationSettings(ctx context.Context, conversationID int, settings *models.ConversationSettings) error {
 	utils.InfoWith("更新对话设置", "conversation_id", conversationID)
 
-	// TODO: 实现 SQLite 对话设置更新
-	// 这里需要更新对话的配置信息
+	conversation, err := s.db.GetConversation(conversationID)
+	if err != nil {
+		return err
+	}
+
+	// 从助手创建的对话只能更新名称和描述，其他设置取自助手
+	if conversation.AssistantID != 0 {
+		assistant, err := s.db.GetAssistant(conversation.AssistantID)
+		if err != nil {
+			return err
+		}
+		if settings, err = assistant.UpdateConversationSettings(conversation.Name, settings); err != nil {
+			return err
+		}
+	}
+
+	if err := s.db.UpdateConversation(conversationID, settings); err != nil {
+		return err
+	}
 
 	utils.InfoWith("对话设置已更新", "conversation_id", conversationID)
 	return nil
@@ -187,11 +472,11 @@ func (s *LangchaingoChatService) UpdateConversationSettings(ctx context.Context,
 func (s *LangchaingoChatService) GetConversationSettings(ctx context.Context, conversationID int) (*models.ConversationSettings, error) {
 	utils.InfoWith("获取对话设置", "conversation_id", conversationID)
 
-	// TODO: 实现 SQLite 对话设置查询
-	// 暂时返回默认设置
-	settings := models.NewDefaultConversationSettings()
-	settings.Name = "Langchaingo 对话"
-	settings.ModelID = 1 // OpenAI 模型ID
+	conversation, err := s.db.GetConversation(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	settings := &conversation.ConversationSettings
 
 	utils.InfoWith("成功获取对话设置", "conversation_id", conversationID)
 	return settings, nil
@@ -201,11 +486,21 @@ func (s *LangchaingoChatService) GetConversationSettings(ctx context.Context, co
 func (s *LangchaingoChatService) GetConversationHistory(ctx context.Context, conversationID int) (*models.ConversationHistoryResponse, error) {
 	utils.InfoWith("获取对话历史", "conversation_id", conversationID)
 
-	// TODO: 实现 SQLite 对话历史查询
-	// 这里需要从 SQLite 中获取指定对话的消息历史
+	messages, err := s.db.ListMessages(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	variants, err := s.db.ListMessageVariants(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	models.ApplyMessageVersions(messages, variants)
 
-	// 暂时返回模拟数据
-	var messages []models.MessageRecord // 使用正确的消息类型
+	feedback, err := s.db.ListConversationFeedback(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	models.ApplyMessageFeedback(messages, feedback)
 
 	response := &models.ConversationHistoryResponse{
 		ConversationID: fmt.Sprintf("%d", conversationID),
@@ -217,6 +512,25 @@ func (s *LangchaingoChatService) GetConversationHistory(ctx context.Context, con
 	return response, nil
 }
 
+// SearchMessages 在所有对话的消息中搜索关键字
+func (s *LangchaingoChatService) SearchMessages(ctx context.Context, req *models.MessageSearchRequest) (*models.MessageSearchResponse, error) {
+	if err := req.Normalize(); err != nil {
+		return nil, err
+	}
+	utils.InfoWith("搜索消息", "query", req.Query, "limit", req.Limit)
+
+	results, total, err := s.db.SearchMessages(req.Query, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MessageSearchResponse{
+		Query:   req.Query,
+		Results: results,
+		Total:   int(total),
+	}, nil
+}
+
 // initializeLLM 初始化 LLM (OpenAI)
 func (s *LangchaingoChatService) initializeLLM(ctx context.Context) error {
 	// TODO: 实现 OpenAI LLM 初始化
@@ -256,3 +570,86 @@ func (s *LangchaingoChatService) createChatHistory(ctx context.Context, sessionI
 	utils.InfoWith("对话记忆创建完成", "session_id", sessionID, "db_path", s.config.SQLite.DBPath)
 	return nil
 }
+
+// sendEvent 发送SSE事件，ctx 被取消时放弃发送并返回 false
+func sendEvent(ctx context.Context, eventChan chan<- models.SSEChatEvent, event models.SSEChatEvent) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	select {
+	case eventChan <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// sleep 等待指定时间，ctx 被取消时提前返回 false
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// extractFileText 提取附件的文本内容，返回文本和文件类型
+// PDF、Office 文档使用 Docling 分块后拼接各块文本，其他文件按 UTF-8 文本读取
+func (s *LangchaingoChatService) extractFileText(ctx context.Context, filename string, data []byte) (string, string, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	contentType := mime.TypeByExtension(ext)
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+
+	if doclingFileExtensions[ext] {
+		chunks, err := doclingChunk(ctx, &s.config.Docling, filename, bytes.NewReader(data))
+		if err != nil {
+			return "", contentType, fmt.Errorf("解析附件 %s 失败: %w", filename, err)
+		}
+		texts := make([]string, 0, len(chunks))
+		for _, chunk := range chunks {
+			if text := strings.TrimSpace(chunk.Text); text != "" {
+				texts = append(texts, text)
+			}
+		}
+		if len(texts) == 0 {
+			return "", contentType, fmt.Errorf("%w: 未能从 %s 中提取到文本", models.ErrChatFileType, filename)
+		}
+		return strings.Join(texts, "\n\n"), contentType, nil
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return "", contentType, fmt.Errorf("%w: %s 不是 UTF-8 文本文件，仅支持文本文件和 PDF、Word、PowerPoint、Excel 文档", models.ErrChatFileType, filename)
+	}
+	return string(data), contentType, nil
+}
+
+// attachmentPrompt 将附件内容拼接在提问之前
+func attachmentPrompt(question string, files []models.ChatFileGORM) string {
+	var b strings.Builder
+	b.WriteString("以下是用户上传的文件内容：\n\n")
+	for _, file := range files {
+		content := file.Content
+		if utf8.RuneCountInString(content) > chatFileMaxPromptRunes {
+			content = string([]rune(content)[:chatFileMaxPromptRunes]) + "\n……（内容过长，已截断）"
+		}
+		fmt.Fprintf(&b, "<file name=%q>\n%s\n</file>\n\n", file.Name, content)
+	}
+	b.WriteString("请结合以上文件回答：\n")
+	b.WriteString(question)
+	return b.String()
+}
+
+// newChatFileID 生成随机的附件ID
+func newChatFileID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
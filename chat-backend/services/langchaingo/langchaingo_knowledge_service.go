@@ -3,13 +3,17 @@ package langchaingo
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"chat-backend/models"
@@ -22,12 +26,16 @@ import (
 type LangchaingoKnowledgeService struct {
 	config *LangchaingoConfig
 	db     *database.Database
+
+	reindexMu  sync.Mutex
+	reindexing map[uint]bool // 正在后台重建索引的文件
 }
 
 // NewLangchaingoKnowledgeService 创建 Langchaingo 知识库服务
 func NewLangchaingoKnowledgeService(config *LangchaingoConfig) interfaces.KnowledgeServiceInterface {
 	service := &LangchaingoKnowledgeService{
-		config: config,
+		config:     config,
+		reindexing: make(map[uint]bool),
 	}
 
 	// 初始化数据库连接
@@ -115,6 +123,11 @@ func (s *LangchaingoKnowledgeService) DeleteKnowledgeBase(ctx context.Context, i
 		return fmt.Errorf("删除知识库失败: %w", err)
 	}
 
+	// 删除保存文件原件的上传目录，记录已删除，失败时只记录日志
+	if err := os.RemoveAll(s.uploadDir(id)); err != nil {
+		utils.WarnWith("删除知识库上传目录失败", "id", id, "error", err.Error())
+	}
+
 	utils.InfoWith("删除知识库成功", "id", id)
 	return nil
 }
@@ -142,33 +155,33 @@ func (s *LangchaingoKnowledgeService) UploadFile(ctx context.Context, id int, fi
 		return nil, fmt.Errorf("知识库ID %d 不存在", id)
 	}
 
-	// 读取文件内容
-	content, err := io.ReadAll(reader)
+	// 将上传内容流式写入磁盘，避免整个文件驻留内存
+	storagePath, fileSize, err := s.saveUploadedFile(id, filename, reader)
 	if err != nil {
-		return nil, fmt.Errorf("读取文件内容失败: %w", err)
+		return nil, fmt.Errorf("保存文件失败: %w", err)
 	}
 
-	// 计算文件大小
-	fileSize := int64(len(content))
-
 	// TODO: 实现完整的文档分块和向量化流程
 	// 这里需要实现 KEY_PROCESS_AND_CODE.md 中的 chunkAndVectorize 流程
 
 	// 1. 使用 Docling API 进行文档分块
-	chunks, err := s.chunkDocument(ctx, filename, content)
+	chunks, err := s.chunkDocument(ctx, filename, storagePath)
 	if err != nil {
+		os.Remove(storagePath)
 		return nil, fmt.Errorf("文档分块失败: %w", err)
 	}
 
 	// 2. 将分块向量化并存储到 Qdrant
-	err = s.vectorizeAndStore(ctx, strconv.Itoa(id), chunks)
+	err = s.vectorizeAndStore(ctx, strconv.Itoa(id), storagePath, chunks)
 	if err != nil {
+		os.Remove(storagePath)
 		return nil, fmt.Errorf("向量化和存储失败: %w", err)
 	}
 
 	// 插入文件记录到数据库
-	knowledgeFile, err := s.db.CreateKnowledgeBaseFile(id, filename, fileSize)
+	knowledgeFile, err := s.db.CreateKnowledgeBaseFile(id, filename, fileSize, storagePath)
 	if err != nil {
+		os.Remove(storagePath)
 		return nil, fmt.Errorf("插入文件记录失败: %w", err)
 	}
 
@@ -221,48 +234,24 @@ func (s *LangchaingoKnowledgeService) BatchUploadFilesFromPath(ctx context.Conte
 
 	utils.InfoWith("开始批量上传文件到知识库", "id", id, "file_count", len(filePaths))
 
-	response := &models.BatchUploadResponse{
-		Total:   len(filePaths),
-		Results: make([]models.BatchUploadResult, 0, len(filePaths)),
-	}
-
-	// 创建超时上下文用于整个批量操作
-	batchCtx, cancel := context.WithTimeout(context.Background(), time.Duration(len(filePaths)*60)*time.Second)
-	defer cancel()
-
-	// 上传每个文件
-	for _, filePath := range filePaths {
-		result := models.BatchUploadResult{
-			FilePath: filePath,
-		}
-
-		// 为每个文件单独设置超时
-		fileCtx, fileCancel := context.WithTimeout(batchCtx, 60*time.Second)
-
-		uploadedFile, err := s.UploadFileFromPath(fileCtx, id, filePath)
-		fileCancel()
-
-		if err != nil {
-			result.Success = false
-			result.Message = "上传失败"
-			result.Error = err.Error()
-			response.FailureCount++
-			utils.ErrorWith("批量上传文件失败", "path", filePath, "error", err)
-		} else {
-			result.Success = true
-			result.Message = "上传成功"
-			result.File = uploadedFile
-			response.SuccessCount++
-			utils.InfoWith("批量上传文件成功", "path", filePath, "file_id", uploadedFile.ID)
-		}
-
-		response.Results = append(response.Results, result)
-	}
+	// 有限并发上传，结果顺序与 filePaths 一致
+	response := utils.RunBatchUpload(ctx, filePaths, utils.FileSizes(filePaths), func(fileCtx context.Context, i int) (*models.KnowledgeFile, error) {
+		return s.UploadFileFromPath(fileCtx, id, filePaths[i])
+	})
 
 	utils.InfoWith("批量上传完成", "知识库ID", id, "总数", response.Total, "成功", response.SuccessCount, "失败", response.FailureCount)
 	return response, nil
 }
 
+// GetFileKnowledgeBaseID 获取文件所属的知识库ID
+func (s *LangchaingoKnowledgeService) GetFileKnowledgeBaseID(ctx context.Context, fileID int) (int, error) {
+	file, err := s.db.GetKnowledgeBaseFileByID(fileID)
+	if err != nil {
+		return 0, err
+	}
+	return file.KnowledgeBaseID, nil
+}
+
 // DeleteFile 删除知识库文件
 func (s *LangchaingoKnowledgeService) DeleteFile(ctx context.Context, fileID int) error {
 	utils.InfoWith("删除知识库文件", "file_id", fileID)
@@ -272,12 +261,29 @@ func (s *LangchaingoKnowledgeService) DeleteFile(ctx context.Context, fileID int
 		return fmt.Errorf("无效的文件ID: %d", fileID)
 	}
 
+	file, err := s.db.GetKnowledgeBaseFileByID(fileID)
+	if err != nil {
+		return err
+	}
+
 	if err := s.db.DeleteKnowledgeBaseFile(fileID); err != nil {
 		return fmt.Errorf("删除知识库文件失败: %w", err)
 	}
 
-	// TODO: 实现 Qdrant 向量删除
-	// 暂时只是记录日志
+	// 删除保存的原件，记录已删除，失败时只记录日志
+	if file.StoragePath != "" {
+		if err := os.Remove(file.StoragePath); err != nil && !os.IsNotExist(err) {
+			utils.WarnWith("删除文件原件失败", "file_id", fileID, "path", file.StoragePath, "error", err.Error())
+		}
+	}
+
+	// 删除文件在 Qdrant 中的向量，记录已删除，失败时只记录日志
+	if file.StoragePath != "" {
+		if err := s.deleteFileVectors(ctx, strconv.Itoa(file.KnowledgeBaseID), file.StoragePath); err != nil {
+			utils.WarnWith("删除文件向量失败", "file_id", fileID, "error", err.Error())
+		}
+	}
+
 	utils.InfoWith("删除文件成功", "file_id", fileID)
 	return nil
 }
@@ -305,9 +311,203 @@ func (s *LangchaingoKnowledgeService) ToggleFileEnable(ctx context.Context, file
 	return nil
 }
 
+// reindexFileTimeout 单个文件重建索引的超时时间
+const reindexFileTimeout = 10 * time.Minute
+
+// ReindexFile 基于保存的原件重新执行提取、分块和向量化
+func (s *LangchaingoKnowledgeService) ReindexFile(ctx context.Context, fileID int) (*models.KnowledgeFile, error) {
+	utils.InfoWith("重建文件索引", "file_id", fileID)
+
+	file, err := s.db.GetKnowledgeBaseFileByID(fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.claimReindex(file.ID) {
+		return nil, fmt.Errorf("%w: %d", models.ErrFileReindexing, fileID)
+	}
+	if err := s.markReindexing(file); err != nil {
+		s.releaseReindex(file.ID)
+		return nil, err
+	}
+
+	// 后台执行，进度通过文件状态字段反映
+	go s.rebuildIndexes([]models.KnowledgeBaseFileGORM{*file})
+
+	return file.ToKnowledgeFile(), nil
+}
+
+// ReindexKnowledgeBase 重建知识库中所有文件的索引
+func (s *LangchaingoKnowledgeService) ReindexKnowledgeBase(ctx context.Context, id int) (*models.ReindexKnowledgeBaseResponse, error) {
+	utils.InfoWith("重建知识库索引", "id", id)
+
+	if _, err := s.db.GetKnowledgeBaseByID(id); err != nil {
+		return nil, fmt.Errorf("知识库ID %d 不存在", id)
+	}
+
+	files, err := s.db.GetKnowledgeBaseFileRecords(id)
+	if err != nil {
+		return nil, err
+	}
+
+	rebuilding := make([]models.KnowledgeBaseFileGORM, 0, len(files))
+	response := &models.ReindexKnowledgeBaseResponse{
+		KnowledgeFiles: make([]models.KnowledgeFile, 0, len(files)),
+		Failures:       []models.ReindexFailure{},
+	}
+	for i := range files {
+		// 已在重建中的文件不重复提交，返回其当前状态
+		if !s.claimReindex(files[i].ID) {
+			utils.InfoWith("文件正在重建索引，跳过", "file_id", files[i].ID)
+		} else if err := s.markReindexing(&files[i]); err != nil {
+			s.releaseReindex(files[i].ID)
+			utils.WarnWith("文件无法重建索引", "file_id", files[i].ID, "error", err)
+			response.Failures = append(response.Failures, models.ReindexFailure{FileID: int(files[i].ID), Name: files[i].Name, Error: err.Error()})
+		} else {
+			rebuilding = append(rebuilding, files[i])
+		}
+		response.KnowledgeFiles = append(response.KnowledgeFiles, *files[i].ToKnowledgeFile())
+	}
+
+	// 同一知识库的文件在后台依次重建，避免同时压垮 Docling 和嵌入服务
+	go s.rebuildIndexes(rebuilding)
+
+	utils.InfoWith("知识库索引重建已开始", "id", id, "file_count", len(rebuilding), "failure_count", len(response.Failures))
+	return response, nil
+}
+
+// claimReindex 登记文件为重建中，文件已在重建时返回 false
+func (s *LangchaingoKnowledgeService) claimReindex(fileID uint) bool {
+	s.reindexMu.Lock()
+	defer s.reindexMu.Unlock()
+	if s.reindexing[fileID] {
+		return false
+	}
+	s.reindexing[fileID] = true
+	return true
+}
+
+// releaseReindex 文件重建结束，允许再次重建
+func (s *LangchaingoKnowledgeService) releaseReindex(fileID uint) {
+	s.reindexMu.Lock()
+	defer s.reindexMu.Unlock()
+	delete(s.reindexing, fileID)
+}
+
+// markReindexing 检查原件是否存在并将文件状态置为构建中，原件缺失时将文件标记为失败
+func (s *LangchaingoKnowledgeService) markReindexing(file *models.KnowledgeBaseFileGORM) error {
+	file.Status, file.IndexPercent, file.ErrorMessage = 0, 0, ""
+	if file.StoragePath == "" {
+		file.Status, file.ErrorMessage = 2, "文件原件未保存，无法重建索引"
+	} else if _, err := os.Stat(file.StoragePath); err != nil {
+		file.Status, file.ErrorMessage = 2, fmt.Sprintf("文件原件不可用: %v", err)
+	}
+
+	if err := s.db.UpdateKnowledgeBaseFileStatus(int(file.ID), file.Status, file.IndexPercent, file.ErrorMessage); err != nil {
+		return err
+	}
+	if file.Status == 2 {
+		return fmt.Errorf("%s", file.ErrorMessage)
+	}
+	return nil
+}
+
+// rebuildIndexes 依次重建文件索引并更新文件状态，每个文件结束后解除其重建登记
+func (s *LangchaingoKnowledgeService) rebuildIndexes(files []models.KnowledgeBaseFileGORM) {
+	// 已解除登记的文件可能已被新的重建请求登记，中途退出时只解除尚未处理的文件
+	released := 0
+	defer func() {
+		if r := recover(); r != nil {
+			utils.ErrorWith("重建索引 panic", "error", r)
+		}
+		for i := released; i < len(files); i++ {
+			s.releaseReindex(files[i].ID)
+		}
+	}()
+
+	for _, file := range files {
+		fileID := int(file.ID)
+		err := s.rebuildIndex(&file)
+		s.releaseReindex(file.ID)
+		released++
+		if err != nil {
+			utils.ErrorWith("重建文件索引失败", "file_id", fileID, "error", err)
+			if updateErr := s.db.UpdateKnowledgeBaseFileStatus(fileID, 2, 0, err.Error()); updateErr != nil {
+				utils.ErrorWith("更新文件索引状态失败", "file_id", fileID, "error", updateErr)
+			}
+			continue
+		}
+
+		if err := s.db.UpdateKnowledgeBaseFileStatus(fileID, 1, 100, ""); err != nil {
+			utils.ErrorWith("更新文件索引状态失败", "file_id", fileID, "error", err)
+			continue
+		}
+		utils.InfoWith("重建文件索引成功", "file_id", fileID)
+	}
+}
+
+// rebuildIndex 对单个文件重新执行分块和向量化
+func (s *LangchaingoKnowledgeService) rebuildIndex(file *models.KnowledgeBaseFileGORM) error {
+	ctx, cancel := context.WithTimeout(context.Background(), reindexFileTimeout)
+	defer cancel()
+
+	fileID := int(file.ID)
+
+	// 1. 使用 Docling API 进行文档分块
+	chunks, err := s.chunkDocument(ctx, file.Name, file.StoragePath)
+	if err != nil {
+		return fmt.Errorf("文档分块失败: %w", err)
+	}
+	if err := s.db.UpdateKnowledgeBaseFileStatus(fileID, 0, 50, ""); err != nil {
+		return err
+	}
+
+	// 2. 删除该文件的旧向量，避免新旧分块同时被检索
+	collectionName := strconv.Itoa(file.KnowledgeBaseID)
+	if err := s.deleteFileVectors(ctx, collectionName, file.StoragePath); err != nil {
+		return fmt.Errorf("删除旧向量失败: %w", err)
+	}
+
+	// 3. 将分块向量化并存储到 Qdrant
+	if err := s.vectorizeAndStore(ctx, collectionName, file.StoragePath, chunks); err != nil {
+		return fmt.Errorf("向量化和存储失败: %w", err)
+	}
+	return nil
+}
+
+// uploadDir 返回知识库保存文件原件的上传目录
+func (s *LangchaingoKnowledgeService) uploadDir(id int) string {
+	return filepath.Join(s.config.Upload.Dir, strconv.Itoa(id))
+}
+
+// saveUploadedFile 将文件流写入知识库对应的上传目录，返回保存路径和文件大小
+func (s *LangchaingoKnowledgeService) saveUploadedFile(id int, filename string, reader io.Reader) (string, int64, error) {
+	dir := s.uploadDir(id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, fmt.Errorf("创建上传目录失败: %w", err)
+	}
+
+	file, err := os.CreateTemp(dir, "*_"+filepath.Base(filename))
+	if err != nil {
+		return "", 0, fmt.Errorf("创建文件失败: %w", err)
+	}
+
+	size, err := io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", 0, fmt.Errorf("写入文件失败: %w", err)
+	}
+
+	return file.Name(), size, nil
+}
+
 // DoclingChunkRequest Docling 分块请求
+// Files 字段在请求时从磁盘流式编码写入，序列化其余选项时留空
 type DoclingChunkRequest struct {
-	Files                    [][]byte `json:"files"`
+	Files                    [][]byte `json:"files,omitempty"`
 	ConvertDoOCR            bool      `json:"convertDoOCR"`
 	ConvertImageExportMode   string    `json:"convertImageExportMode"`
 	ConvertPDFBackend       string    `json:"convertPDFBackend"`
@@ -336,11 +536,21 @@ type DoclingChunk struct {
 	NumTokens   *int       `json:"numTokens"`
 }
 
-// chunkDocument 使用 Docling API 进行文档分块
-func (s *LangchaingoKnowledgeService) chunkDocument(ctx context.Context, filename string, content []byte) ([]DoclingChunk, error) {
+// chunkDocument 使用 Docling API 对保存在 filePath 的文档进行分块
+func (s *LangchaingoKnowledgeService) chunkDocument(ctx context.Context, filename string, filePath string) ([]DoclingChunk, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer file.Close()
+	return doclingChunk(ctx, &s.config.Docling, filename, file)
+}
+
+// doclingChunk 使用 Docling API 进行文档分块，content 为文档内容
+// 知识库文档和聊天附件共用该流程
+func doclingChunk(ctx context.Context, config *DoclingConfig, filename string, content io.Reader) ([]DoclingChunk, error) {
 	// 准备分块请求
 	req := DoclingChunkRequest{
-		Files:                    [][]byte{content},
 		ConvertDoOCR:             false,
 		ConvertImageExportMode:     "placeholder",
 		ConvertPDFBackend:         "dlparse_v4",
@@ -357,21 +567,28 @@ func (s *LangchaingoKnowledgeService) chunkDocument(ctx context.Context, filenam
 	}
 
 	// 调用 Docling API
-	url := s.config.Docling.BaseURL + "/chunk/hybrid"
+	url := config.BaseURL + "/chunk/hybrid"
 
-	jsonData, err := json.Marshal(req)
+	options, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("序列化请求失败: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	// 通过管道流式生成请求体，文件内容边读边做 base64 编码
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeDoclingChunkBody(pw, content, options))
+	}()
+	defer pr.Close()
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, pr)
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	if s.config.Docling.APIKey != "" {
-		httpReq.Header.Set("Authorization", "Bearer "+s.config.Docling.APIKey)
+	if config.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+config.APIKey)
 	}
 
 	client := &http.Client{Timeout: 30 * time.Second}
@@ -394,14 +611,88 @@ func (s *LangchaingoKnowledgeService) chunkDocument(ctx context.Context, filenam
 	return chunkResp.Chunks, nil
 }
 
+// writeDoclingChunkBody 写入 Docling 分块请求体: {"files":["<base64>"], ...options}
+func writeDoclingChunkBody(w io.Writer, content io.Reader, options []byte) error {
+	if _, err := io.WriteString(w, `{"files":["`); err != nil {
+		return err
+	}
+
+	encoder := base64.NewEncoder(base64.StdEncoding, w)
+	if _, err := io.Copy(encoder, content); err != nil {
+		return fmt.Errorf("读取文件内容失败: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, `"]`); err != nil {
+		return err
+	}
+
+	// options 是以 { 开头的 JSON 对象，拼接其余字段
+	if len(options) > 2 {
+		if _, err := io.WriteString(w, ","); err != nil {
+			return err
+		}
+		_, err := w.Write(options[1:])
+		return err
+	}
+
+	_, err := io.WriteString(w, "}")
+	return err
+}
+
 // vectorizeAndStore 向量化分块并存储到 Qdrant
-func (s *LangchaingoKnowledgeService) vectorizeAndStore(ctx context.Context, collectionName string, chunks []DoclingChunk) error {
+// 上传时文件记录尚未创建，分块以原件保存路径 storagePath 标识所属文件
+func (s *LangchaingoKnowledgeService) vectorizeAndStore(ctx context.Context, collectionName, storagePath string, chunks []DoclingChunk) error {
 	// TODO: 实现 Ollama 嵌入模型调用和 Qdrant 存储
 	// 这里需要：
 	// 1. 使用 Ollama bge-m3 模型生成嵌入向量
 	// 2. 将向量存储到 Qdrant 指定集合中
-	// 3. 添加适当的元数据
+	// 3. 添加适当的元数据，payload 的 qdrantFileKey 字段写入 storagePath，供 deleteFileVectors 删除
 
 	utils.InfoWith("向量化和存储完成", "collection", collectionName, "chunk_count", len(chunks))
 	return nil
 }
+
+// qdrantFileKey 向量 payload 中标识所属文件的字段，值为文件原件的保存路径
+const qdrantFileKey = "storage_path"
+
+// deleteFileVectors 删除 Qdrant 集合中属于指定文件的全部向量，集合不存在时视为已删除
+func (s *LangchaingoKnowledgeService) deleteFileVectors(ctx context.Context, collectionName, storagePath string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"filter": map[string]interface{}{
+			"must": []map[string]interface{}{
+				{"key": qdrantFileKey, "match": map[string]interface{}{"value": storagePath}},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	endpoint := strings.TrimRight(s.config.Qdrant.URL, "/") + "/collections/" + url.PathEscape(collectionName) + "/points/delete?wait=true"
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if s.config.Qdrant.APIKey != "" {
+		httpReq.Header.Set("api-key", s.config.Qdrant.APIKey)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("调用 Qdrant API 失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Qdrant API 返回错误状态码: %d", resp.StatusCode)
+	}
+	return nil
+}
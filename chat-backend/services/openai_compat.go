@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"chat-backend/models"
+	"chat-backend/pkg/database"
+	"chat-backend/services/interfaces"
+	"chat-backend/utils"
+)
+
+// OpenAI 兼容接口的错误
+var (
+	ErrOpenAIInvalidRequest = errors.New("无效的请求")
+	ErrOpenAIModelNotFound  = errors.New("模型不存在")
+)
+
+// openAIConversationTitleLength 新建对话标题截取的提问长度（字符）
+const openAIConversationTitleLength = 20
+
+// 按消息前缀复用对话的参数
+const (
+	openAIConversationTTL           = 24 * time.Hour // 登记的对话在此时间内未被继续则不再复用
+	openAIConversationPruneInterval = time.Hour      // 两次清理过期登记的最小间隔
+)
+
+// OpenAIConversationCache OpenAI 兼容接口的对话复用表，登记保存在数据库中，服务重启后仍可复用
+// OpenAI 客户端每次请求都携带完整的消息列表。回答结束后以「请求消息 + 回答」的摘要登记对话，
+// 之后的请求以最后一条用户消息之前的消息计算摘要，命中时在登记的对话中继续，而不是每次创建新对话
+type OpenAIConversationCache struct {
+	db *database.Database
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// NewOpenAIConversationCache 创建对话复用表
+func NewOpenAIConversationCache(db *database.Database) *OpenAIConversationCache {
+	return &OpenAIConversationCache{db: db}
+}
+
+// Remember 登记回答结束后的对话，modelID 为本次请求使用的模型，answer 为生成的完整回答
+func (c *OpenAIConversationCache) Remember(req *models.OpenAIChatCompletionRequest, modelID int, answer string, conversationID int) {
+	messages := make([]models.OpenAIChatMessage, 0, len(req.Messages)+1)
+	messages = append(messages, req.Messages...)
+	messages = append(messages, models.OpenAIChatMessage{Role: "assistant", Content: answer})
+	key := openAIConversationKey(req, modelID, messages)
+
+	now := time.Now()
+	if err := c.db.SaveOpenAIConversation(key, conversationID, now.Add(openAIConversationTTL)); err != nil {
+		utils.ErrorWith("登记 OpenAI 兼容接口的对话失败", "conversation_id", conversationID, "error", err)
+		return
+	}
+	c.prune(now)
+}
+
+// take 取出摘要对应的对话，同一前缀只继续一次，取出后删除登记
+func (c *OpenAIConversationCache) take(key string) (int, bool) {
+	conversationID, err := c.db.TakeOpenAIConversation(key, time.Now())
+	if err != nil {
+		if !errors.Is(err, database.ErrNotFound) {
+			utils.WarnWith("查询 OpenAI 兼容接口登记的对话失败", "error", err)
+		}
+		return 0, false
+	}
+	return conversationID, true
+}
+
+// prune 清理过期的登记，两次清理之间至少间隔 openAIConversationPruneInterval
+func (c *OpenAIConversationCache) prune(now time.Time) {
+	c.mu.Lock()
+	if now.Sub(c.lastPrune) < openAIConversationPruneInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.lastPrune = now
+	c.mu.Unlock()
+
+	if _, err := c.db.PruneOpenAIConversations(now); err != nil {
+		utils.WarnWith("清理 OpenAI 兼容接口过期的登记失败", "error", err)
+	}
+}
+
+// openAIConversationKey 计算对话复用的摘要，包含消息内容以及影响对话设置的请求参数
+func openAIConversationKey(req *models.OpenAIChatCompletionRequest, modelID int, messages []models.OpenAIChatMessage) string {
+	type keyMessage struct {
+		Role string
+		Text string
+	}
+	key := struct {
+		ModelID          int
+		Temperature      *float64
+		TopP             *float64
+		PresencePenalty  *float64
+		FrequencyPenalty *float64
+		KnowledgeBaseIDs []int
+		User             string
+		Messages         []keyMessage
+	}{
+		ModelID:          modelID,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		KnowledgeBaseIDs: req.KnowledgeBaseIDs,
+		User:             req.User,
+	}
+	for _, message := range messages {
+		key.Messages = append(key.Messages, keyMessage{Role: message.Role, Text: message.Text()})
+	}
+
+	data, _ := json.Marshal(key)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ResolveOpenAIModel 根据 OpenAI 请求中的 model 查找可用的聊天模型，依次匹配模型名称、符号和ID
+// model 为空时使用 fallbackID 对应的模型
+func ResolveOpenAIModel(ctx context.Context, modelService interfaces.ModelServiceInterface, model string, fallbackID int) (*models.ModelInfo, error) {
+	chatModels, err := modelService.ListAvailableChatModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取聊天模型列表失败: %w", err)
+	}
+
+	matchers := []func(m *models.ModelInfo) bool{
+		func(m *models.ModelInfo) bool { return m.Name == model },
+		func(m *models.ModelInfo) bool { return m.Symbol == model },
+		func(m *models.ModelInfo) bool { return strconv.Itoa(m.ID) == model },
+	}
+	if model == "" {
+		matchers = []func(m *models.ModelInfo) bool{
+			func(m *models.ModelInfo) bool { return m.ID == fallbackID },
+		}
+	}
+	for _, match := range matchers {
+		for i := range chatModels {
+			if match(&chatModels[i]) {
+				return &chatModels[i], nil
+			}
+		}
+	}
+
+	if model == "" {
+		return nil, fmt.Errorf("%w: 默认模型 %d 不可用", ErrOpenAIModelNotFound, fallbackID)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrOpenAIModelNotFound, model)
+}
+
+// PrepareOpenAIChat 将 OpenAI 格式的请求映射为一次提问，返回发送消息的请求和使用的模型
+// 指定 conversation_id 时在该对话中继续，请求中的 model 和采样参数写入对话设置，仅发送最后一条用户消息；
+// 消息前缀命中 conversations 中登记的对话时同样在该对话中继续；
+// 否则以 model 对应的模型和请求参数创建新对话，开头的 system 消息作为系统提示词，之后上下文限制内的最近消息作为历史导入
+func PrepareOpenAIChat(ctx context.Context, chatService interfaces.ChatServiceInterface, modelService interfaces.ModelServiceInterface, defaultSettingsService interfaces.DefaultSettingsServiceInterface, conversations *OpenAIConversationCache, req *models.OpenAIChatCompletionRequest) (*models.ChatRequest, *models.ModelInfo, error) {
+	if len(req.Messages) == 0 {
+		return nil, nil, fmt.Errorf("%w: messages 不能为空", ErrOpenAIInvalidRequest)
+	}
+	last := req.Messages[len(req.Messages)-1]
+	question := last.Text()
+	if last.Role != "user" || strings.TrimSpace(question) == "" {
+		return nil, nil, fmt.Errorf("%w: 最后一条消息须为非空的用户消息", ErrOpenAIInvalidRequest)
+	}
+
+	if req.ConversationID != 0 {
+		settings, err := chatService.GetConversationSettings(ctx, req.ConversationID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("获取对话 %d 失败: %w", req.ConversationID, err)
+		}
+		model, err := ResolveOpenAIModel(ctx, modelService, req.Model, settings.ModelID)
+		if err != nil {
+			return nil, nil, err
+		}
+		changed := applyOpenAIParams(settings, req)
+		if settings.ModelID != model.ID {
+			settings.ModelID = model.ID
+			changed = true
+		}
+		if changed {
+			if err := chatService.UpdateConversationSettings(ctx, req.ConversationID, settings); err != nil {
+				return nil, nil, fmt.Errorf("更新对话 %d 的设置失败: %w", req.ConversationID, err)
+			}
+		}
+		return &models.ChatRequest{ConversationID: req.ConversationID, Content: question}, model, nil
+	}
+
+	settings := defaultConversationSettings(defaultSettingsService)
+	model, err := ResolveOpenAIModel(ctx, modelService, req.Model, settings.ModelID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 消息前缀与之前某次回答结束后的对话一致时在该对话中继续
+	previous := req.Messages[:len(req.Messages)-1]
+	if conversations != nil {
+		if conversationID, ok := conversations.take(openAIConversationKey(req, model.ID, previous)); ok {
+			if _, err := chatService.GetConversationSettings(ctx, conversationID); err == nil {
+				return &models.ChatRequest{ConversationID: conversationID, Content: question}, model, nil
+			}
+		}
+	}
+
+	settings.Name = openAIConversationTitle(question)
+	settings.ModelID = model.ID
+	settings.Stream = req.Stream
+	applyOpenAIParams(settings, req)
+	if len(req.KnowledgeBaseIDs) > 0 {
+		settings.KnowledgeBaseIDs = req.KnowledgeBaseIDs
+	}
+
+	// 开头的 system 消息作为新对话的系统提示词，其余消息中最近的上下文作为历史导入
+	var systemPrompts []string
+	for len(previous) > 0 && previous[0].Role == "system" {
+		if text := previous[0].Text(); strings.TrimSpace(text) != "" {
+			systemPrompts = append(systemPrompts, text)
+		}
+		previous = previous[1:]
+	}
+	settings.SystemPrompt = strings.Join(systemPrompts, "\n\n")
+
+	var conversation *models.Conversation
+	if history := trimOpenAIHistory(openAIMessageRecords(previous, time.Now()), settings.ContextLimit); len(history) > 0 {
+		conversation, err = chatService.ImportConversation(ctx, settings, history)
+	} else {
+		conversation, err = chatService.CreateConversation(ctx, settings)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建对话失败: %w", err)
+	}
+
+	utils.InfoWith("OpenAI 兼容接口创建对话", "conversation_id", conversation.ID, "model", model.OpenAIModelID(), "user", req.User)
+	return &models.ChatRequest{ConversationID: conversation.ID, Content: question}, model, nil
+}
+
+// trimOpenAIHistory 保留最近 limit 条消息作为新对话导入的历史，并从用户消息开始，limit 不大于 0 时保留全部
+// 超出上下文限制的消息不会再作为上下文发送给模型，无需每次未命中登记时都导入完整的消息列表
+func trimOpenAIHistory(history []models.MessageRecord, limit int) []models.MessageRecord {
+	if limit <= 0 || len(history) <= limit {
+		return history
+	}
+	history = history[len(history)-limit:]
+	for len(history) > 0 && history[0].Role != "user" {
+		history = history[1:]
+	}
+	return history
+}
+
+// applyOpenAIParams 将请求中的采样参数写入对话设置，返回设置是否改变
+func applyOpenAIParams(settings *models.ConversationSettings, req *models.OpenAIChatCompletionRequest) bool {
+	changed := false
+	apply := func(target *float64, value *float64) {
+		if value != nil && *target != *value {
+			*target = *value
+			changed = true
+		}
+	}
+	apply(&settings.Temperature, req.Temperature)
+	apply(&settings.TopP, req.TopP)
+	apply(&settings.PresencePenalty, req.PresencePenalty)
+	apply(&settings.FrequencyPenalty, req.FrequencyPenalty)
+	return changed
+}
+
+// openAIConversationTitle 以提问开头作为新建对话的标题
+func openAIConversationTitle(question string) string {
+	title := strings.Join(strings.Fields(question), " ")
+	if utf8.RuneCountInString(title) > openAIConversationTitleLength {
+		title = string([]rune(title)[:openAIConversationTitleLength]) + "…"
+	}
+	return "API: " + title
+}
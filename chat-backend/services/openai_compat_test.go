@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"chat-backend/models"
+	"chat-backend/pkg/database"
+	"chat-backend/services/interfaces"
+)
+
+// fakeModelService 返回固定的聊天模型列表
+type fakeModelService struct {
+	interfaces.ModelServiceInterface
+
+	chatModels []models.ModelInfo
+}
+
+func (s *fakeModelService) ListAvailableChatModels(ctx context.Context) ([]models.ModelInfo, error) {
+	return s.chatModels, nil
+}
+
+// fakeDefaultSettingsService 返回固定的默认配置
+type fakeDefaultSettingsService struct {
+	interfaces.DefaultSettingsServiceInterface
+
+	settings models.DefaultSettings
+}
+
+func (s *fakeDefaultSettingsService) GetDefaultSettings() *models.DefaultSettings {
+	settings := s.settings
+	return &settings
+}
+
+func newFakeModelService() *fakeModelService {
+	return &fakeModelService{chatModels: []models.ModelInfo{
+		{ID: 1, Name: "通用模型", Symbol: "general"},
+		{ID: 2, Name: "推理模型", Symbol: "reasoning"},
+		{ID: 3, Name: "2", Symbol: "numeric-name"}, // 名称与模型2的ID相同
+	}}
+}
+
+func newFakeDefaultSettingsService() *fakeDefaultSettingsService {
+	return &fakeDefaultSettingsService{settings: models.DefaultSettings{
+		Models:       models.DefaultModelSettings{ChatModelID: 1},
+		Conversation: models.DefaultConversationConfig{Temperature: 0.7, TopP: 0.9},
+	}}
+}
+
+// newTestDatabase 在临时目录中创建数据库
+func newTestDatabase(t *testing.T) *database.Database {
+	t.Helper()
+	t.Chdir(t.TempDir())
+
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	return db
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func userMessage(text string) models.OpenAIChatMessage {
+	return models.OpenAIChatMessage{Role: "user", Content: text}
+}
+
+func TestResolveOpenAIModel(t *testing.T) {
+	modelService := newFakeModelService()
+
+	tests := []struct {
+		name       string
+		model      string
+		fallbackID int
+		wantID     int
+		wantErr    bool
+	}{
+		{name: "按名称", model: "推理模型", wantID: 2},
+		{name: "按符号", model: "general", wantID: 1},
+		{name: "按ID", model: "1", wantID: 1},
+		{name: "名称优先于ID", model: "2", wantID: 3},
+		{name: "为空时使用默认模型", model: "", fallbackID: 2, wantID: 2},
+		{name: "模型不存在", model: "unknown", wantErr: true},
+		{name: "默认模型不可用", model: "", fallbackID: 9, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := ResolveOpenAIModel(context.Background(), modelService, tt.model, tt.fallbackID)
+			if tt.wantErr {
+				if !errors.Is(err, ErrOpenAIModelNotFound) {
+					t.Errorf("ResolveOpenAIModel() error = %v, want ErrOpenAIModelNotFound", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveOpenAIModel() error = %v", err)
+			}
+			if model.ID != tt.wantID {
+				t.Errorf("ResolveOpenAIModel() = 模型 %d, want %d", model.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestPrepareOpenAIChatInvalidRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []models.OpenAIChatMessage
+	}{
+		{name: "消息为空"},
+		{name: "最后一条为助手消息", messages: []models.OpenAIChatMessage{userMessage("你好"), {Role: "assistant", Content: "你好"}}},
+		{name: "用户消息为空白", messages: []models.OpenAIChatMessage{userMessage("  ")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &models.OpenAIChatCompletionRequest{Messages: tt.messages}
+			_, _, err := PrepareOpenAIChat(context.Background(), newFakeChatService(), newFakeModelService(), newFakeDefaultSettingsService(), nil, req)
+			if !errors.Is(err, ErrOpenAIInvalidRequest) {
+				t.Errorf("PrepareOpenAIChat() error = %v, want ErrOpenAIInvalidRequest", err)
+			}
+		})
+	}
+}
+
+// TestPrepareOpenAIChatNewConversation 开头的 system 消息作为系统提示词，其余消息作为历史导入
+func TestPrepareOpenAIChatNewConversation(t *testing.T) {
+	chat := newFakeChatService()
+	req := &models.OpenAIChatCompletionRequest{
+		Model:       "reasoning",
+		Temperature: floatPtr(0.2),
+		Messages: []models.OpenAIChatMessage{
+			{Role: "system", Content: "你是助手"},
+			{Role: "system", Content: "使用中文回答"},
+			userMessage("第一个问题"),
+			{Role: "assistant", Content: "第一个回答"},
+			{Role: "user", Content: []interface{}{map[string]interface{}{"type": "text", "text": "第二个问题"}}},
+		},
+	}
+
+	chatReq, model, err := PrepareOpenAIChat(context.Background(), chat, newFakeModelService(), newFakeDefaultSettingsService(), nil, req)
+	if err != nil {
+		t.Fatalf("PrepareOpenAIChat() error = %v", err)
+	}
+	if model.ID != 2 || chatReq.ConversationID != 101 || chatReq.Content != "第二个问题" {
+		t.Errorf("PrepareOpenAIChat() = %+v, 模型 %d", chatReq, model.ID)
+	}
+
+	settings := chat.settings[101]
+	if settings.Name != "API: 第二个问题" || settings.ModelID != 2 || settings.SystemPrompt != "你是助手\n\n使用中文回答" {
+		t.Errorf("对话设置 = %+v", settings)
+	}
+	if settings.Temperature != 0.2 || settings.TopP != 0.9 {
+		t.Errorf("采样参数 = %v/%v, want 请求值 0.2 和默认值 0.9", settings.Temperature, settings.TopP)
+	}
+	want := []string{"user: 第一个问题", "assistant: 第一个回答"}
+	if got := messageRoles(chat.histories[101]); !reflect.DeepEqual(got, want) {
+		t.Errorf("导入的历史 = %v, want %v", got, want)
+	}
+}
+
+// TestPrepareOpenAIChatExistingConversation 指定 conversation_id 时请求参数写入对话设置
+func TestPrepareOpenAIChatExistingConversation(t *testing.T) {
+	tests := []struct {
+		name        string
+		model       string
+		temperature *float64
+		wantModelID int
+		wantUpdates int
+	}{
+		{name: "设置不变", wantModelID: 1, wantUpdates: 0},
+		{name: "切换模型", model: "reasoning", wantModelID: 2, wantUpdates: 1},
+		{name: "修改采样参数", temperature: floatPtr(1.2), wantModelID: 1, wantUpdates: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chat := newFakeChatService()
+			chat.settings[7] = models.ConversationSettings{ModelID: 1, Temperature: 0.7}
+			req := &models.OpenAIChatCompletionRequest{
+				Model:          tt.model,
+				Temperature:    tt.temperature,
+				ConversationID: 7,
+				Messages:       []models.OpenAIChatMessage{userMessage("旧问题"), userMessage("继续")},
+			}
+
+			chatReq, model, err := PrepareOpenAIChat(context.Background(), chat, newFakeModelService(), newFakeDefaultSettingsService(), nil, req)
+			if err != nil {
+				t.Fatalf("PrepareOpenAIChat() error = %v", err)
+			}
+			if chatReq.ConversationID != 7 || chatReq.Content != "继续" || model.ID != tt.wantModelID {
+				t.Errorf("PrepareOpenAIChat() = %+v, 模型 %d", chatReq, model.ID)
+			}
+			if chat.updates != tt.wantUpdates || chat.settings[7].ModelID != tt.wantModelID {
+				t.Errorf("更新 %d 次, 模型 %d, want %d 次, 模型 %d", chat.updates, chat.settings[7].ModelID, tt.wantUpdates, tt.wantModelID)
+			}
+			if tt.temperature != nil && chat.settings[7].Temperature != *tt.temperature {
+				t.Errorf("Temperature = %v, want %v", chat.settings[7].Temperature, *tt.temperature)
+			}
+		})
+	}
+
+	req := &models.OpenAIChatCompletionRequest{ConversationID: 8, Messages: []models.OpenAIChatMessage{userMessage("继续")}}
+	if _, _, err := PrepareOpenAIChat(context.Background(), newFakeChatService(), newFakeModelService(), newFakeDefaultSettingsService(), nil, req); err == nil {
+		t.Error("PrepareOpenAIChat() error = nil, want 对话不存在")
+	}
+}
+
+// TestPrepareOpenAIChatReuseConversation 消息前缀命中登记的对话时继续该对话，且只继续一次
+func TestPrepareOpenAIChatReuseConversation(t *testing.T) {
+	chat := newFakeChatService()
+	modelService := newFakeModelService()
+	defaults := newFakeDefaultSettingsService()
+	db := newTestDatabase(t)
+	cache := NewOpenAIConversationCache(db)
+
+	first := &models.OpenAIChatCompletionRequest{Messages: []models.OpenAIChatMessage{userMessage("你好")}}
+	chatReq, model, err := PrepareOpenAIChat(context.Background(), chat, modelService, defaults, cache, first)
+	if err != nil {
+		t.Fatalf("PrepareOpenAIChat() error = %v", err)
+	}
+	cache.Remember(first, model.ID, "你好，有什么可以帮你？", chatReq.ConversationID)
+
+	followUp := func(answer string) *models.OpenAIChatCompletionRequest {
+		return &models.OpenAIChatCompletionRequest{Messages: []models.OpenAIChatMessage{
+			userMessage("你好"),
+			{Role: "assistant", Content: answer},
+			userMessage("介绍一下你自己"),
+		}}
+	}
+
+	// 回答不同时前缀不匹配，创建新对话
+	other, _, err := PrepareOpenAIChat(context.Background(), chat, modelService, defaults, cache, followUp("其他回答"))
+	if err != nil {
+		t.Fatalf("PrepareOpenAIChat() error = %v", err)
+	}
+	if other.ConversationID == chatReq.ConversationID {
+		t.Errorf("前缀不匹配时继续了对话 %d", other.ConversationID)
+	}
+
+	// 登记保存在数据库中，服务重启后仍可继续
+	cache = NewOpenAIConversationCache(db)
+	second, _, err := PrepareOpenAIChat(context.Background(), chat, modelService, defaults, cache, followUp("你好，有什么可以帮你？"))
+	if err != nil {
+		t.Fatalf("PrepareOpenAIChat() error = %v", err)
+	}
+	if second.ConversationID != chatReq.ConversationID || second.Content != "介绍一下你自己" {
+		t.Errorf("PrepareOpenAIChat() = %+v, want 继续对话 %d", second, chatReq.ConversationID)
+	}
+
+	// 登记只使用一次，重复的请求创建新对话
+	third, _, err := PrepareOpenAIChat(context.Background(), chat, modelService, defaults, cache, followUp("你好，有什么可以帮你？"))
+	if err != nil {
+		t.Fatalf("PrepareOpenAIChat() error = %v", err)
+	}
+	if third.ConversationID == chatReq.ConversationID {
+		t.Errorf("登记的对话 %d 被重复继续", third.ConversationID)
+	}
+}
+
+// TestPrepareOpenAIChatReuseDeletedConversation 登记的对话已删除时创建新对话
+func TestPrepareOpenAIChatReuseDeletedConversation(t *testing.T) {
+	chat := newFakeChatService()
+	cache := NewOpenAIConversationCache(newTestDatabase(t))
+	first := &models.OpenAIChatCompletionRequest{Messages: []models.OpenAIChatMessage{userMessage("你好")}}
+	cache.Remember(first, 1, "你好", 50)
+
+	req := &models.OpenAIChatCompletionRequest{Messages: []models.OpenAIChatMessage{
+		userMessage("你好"), {Role: "assistant", Content: "你好"}, userMessage("再见"),
+	}}
+	chatReq, _, err := PrepareOpenAIChat(context.Background(), chat, newFakeModelService(), newFakeDefaultSettingsService(), cache, req)
+	if err != nil {
+		t.Fatalf("PrepareOpenAIChat() error = %v", err)
+	}
+	if chatReq.ConversationID == 50 {
+		t.Error("继续了已删除的对话")
+	}
+}
+
+// TestPrepareOpenAIChatImportRecentHistory 未命中登记时只导入上下文限制内的最近消息
+func TestPrepareOpenAIChatImportRecentHistory(t *testing.T) {
+	chat := newFakeChatService()
+	defaults := newFakeDefaultSettingsService()
+	defaults.settings.Conversation.ContextLimit = 3
+
+	req := &models.OpenAIChatCompletionRequest{Messages: []models.OpenAIChatMessage{
+		{Role: "system", Content: "你是助手"},
+		userMessage("问题一"), {Role: "assistant", Content: "回答一"},
+		userMessage("问题二"), {Role: "assistant", Content: "回答二"},
+		userMessage("问题三"),
+	}}
+	chatReq, _, err := PrepareOpenAIChat(context.Background(), chat, newFakeModelService(), defaults, nil, req)
+	if err != nil {
+		t.Fatalf("PrepareOpenAIChat() error = %v", err)
+	}
+
+	// 最近 3 条消息从助手消息开始，去掉后从用户消息开始
+	want := []string{"user: 问题二", "assistant: 回答二"}
+	if got := messageRoles(chat.histories[chatReq.ConversationID]); !reflect.DeepEqual(got, want) {
+		t.Errorf("导入的历史 = %v, want %v", got, want)
+	}
+	if settings := chat.settings[chatReq.ConversationID]; settings.SystemPrompt != "你是助手" {
+		t.Errorf("SystemPrompt = %q, want %q", settings.SystemPrompt, "你是助手")
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"chat-backend/models"
+	"chat-backend/pkg/database"
+)
+
+// PromptTemplateService 提示词模板服务，模板保存在本地数据库，与聊天后端无关
+type PromptTemplateService struct {
+	db *database.Database
+}
+
+// NewPromptTemplateService 创建提示词模板服务
+func NewPromptTemplateService(db *database.Database) *PromptTemplateService {
+	return &PromptTemplateService{db: db}
+}
+
+// ListTemplates 获取提示词模板列表及全部分类
+func (s *PromptTemplateService) ListTemplates(ctx context.Context, req *models.PromptTemplateListRequest) (*models.PromptTemplateListResponse, error) {
+	records, err := s.db.ListPromptTemplates(req)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := s.db.ListPromptTemplateCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]models.PromptTemplate, 0, len(records))
+	for i := range records {
+		templates = append(templates, *records[i].ToPromptTemplate())
+	}
+	return &models.PromptTemplateListResponse{
+		Templates:  templates,
+		Categories: categories,
+	}, nil
+}
+
+// GetTemplate 获取提示词模板
+func (s *PromptTemplateService) GetTemplate(ctx context.Context, id int) (*models.PromptTemplate, error) {
+	template, err := s.db.GetPromptTemplate(id)
+	if err != nil {
+		return nil, err
+	}
+	return template.ToPromptTemplate(), nil
+}
+
+// CreateTemplate 创建提示词模板
+func (s *PromptTemplateService) CreateTemplate(ctx context.Context, req *models.PromptTemplateRequest) (*models.PromptTemplate, error) {
+	if err := s.checkName(req.Name, 0); err != nil {
+		return nil, err
+	}
+	template, err := s.db.CreatePromptTemplate(req)
+	if err != nil {
+		return nil, err
+	}
+	return template.ToPromptTemplate(), nil
+}
+
+// UpdateTemplate 修改提示词模板，内容变化时生成新版本
+func (s *PromptTemplateService) UpdateTemplate(ctx context.Context, id int, req *models.PromptTemplateRequest) (*models.PromptTemplate, error) {
+	if err := s.checkName(req.Name, id); err != nil {
+		return nil, err
+	}
+	template, err := s.db.UpdatePromptTemplate(id, req)
+	if err != nil {
+		return nil, err
+	}
+	return template.ToPromptTemplate(), nil
+}
+
+// DeleteTemplate 删除提示词模板，已引用该模板的对话保留当时的系统提示词
+func (s *PromptTemplateService) DeleteTemplate(ctx context.Context, id int) error {
+	return s.db.DeletePromptTemplate(id)
+}
+
+// ListTemplateVersions 按版本号从新到旧获取提示词模板的历史版本
+func (s *PromptTemplateService) ListTemplateVersions(ctx context.Context, id int) ([]models.PromptTemplateVersion, error) {
+	if _, err := s.db.GetPromptTemplate(id); err != nil {
+		return nil, err
+	}
+	records, err := s.db.ListPromptTemplateVersions(id)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]models.PromptTemplateVersion, 0, len(records))
+	for i := range records {
+		versions = append(versions, *records[i].ToPromptTemplateVersion())
+	}
+	return versions, nil
+}
+
+// RenderTemplate 以给定变量渲染提示词模板，用于预览
+func (s *PromptTemplateService) RenderTemplate(ctx context.Context, id int, req *models.PromptRenderRequest) (*models.PromptRenderResponse, error) {
+	version, content, err := s.templateContent(id, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	return models.RenderPromptTemplate(version, content, req.Variables), nil
+}
+
+// ApplyTemplate 对话设置引用模板时，以模板内容作为系统提示词
+// 模板的变量须在 settings.PromptVars 中全部提供，变量由聊天服务在使用系统提示词时代入
+func (s *PromptTemplateService) ApplyTemplate(ctx context.Context, settings *models.ConversationSettings) error {
+	if settings.PromptTemplateID == 0 {
+		return nil
+	}
+
+	version, content, err := s.templateContent(settings.PromptTemplateID, settings.PromptTemplateVersion)
+	if err != nil {
+		return err
+	}
+	if missing := models.RenderPromptTemplate(version, content, settings.PromptVars).Missing; len(missing) > 0 {
+		return fmt.Errorf("%w: %s", models.ErrPromptVarsMissing, strings.Join(missing, ", "))
+	}
+
+	settings.SystemPrompt = content
+	return nil
+}
+
+// templateContent 获取模板指定版本的内容，version 为 0 时使用最新版本
+func (s *PromptTemplateService) templateContent(id, version int) (int, string, error) {
+	template, err := s.db.GetPromptTemplate(id)
+	if err != nil {
+		return 0, "", err
+	}
+	if version == 0 || version == template.Version {
+		return template.Version, template.Content, nil
+	}
+
+	record, err := s.db.GetPromptTemplateVersion(id, version)
+	if err != nil {
+		return 0, "", err
+	}
+	return record.Version, record.Content, nil
+}
+
+// checkName 检查模板名称是否与其他模板重复
+func (s *PromptTemplateService) checkName(name string, excludeID int) error {
+	exists, err := s.db.PromptTemplateNameExists(name, excludeID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%w: %s", models.ErrPromptTemplateNameExists, name)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"chat-backend/models"
+)
+
+// BatchUploadFunc 上传批次中下标为 index 的文件
+type BatchUploadFunc func(ctx context.Context, index int) (*models.KnowledgeFile, error)
+
+// RunBatchUpload 以有限并发执行批量上传，结果顺序与 names 保持一致。
+// sizes 为各文件的字节数（为 nil 或小于 0 时表示大小未知），用于计算单文件超时：
+// 在 UPLOAD_FILE_TIMEOUT 的基础上按 UPLOAD_MIN_SPEED 为文件内容预留传输时间，大小未知的文件不设置单文件超时。
+// 并发数由 UPLOAD_CONCURRENCY 配置；正在上传的文件数达到上限时不会再启动新的上传，ctx 取消后未开始的文件直接记为失败。
+func RunBatchUpload(ctx context.Context, names []string, sizes []int64, upload BatchUploadFunc) *models.BatchUploadResponse {
+	config := GetGlobalEnvConfig()
+	concurrency := config.GetInt("UPLOAD_CONCURRENCY", 4)
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	baseTimeout := time.Duration(config.GetInt("UPLOAD_FILE_TIMEOUT", 60)) * time.Second
+	if baseTimeout <= 0 {
+		baseTimeout = 60 * time.Second
+	}
+	minSpeed := int64(config.GetInt("UPLOAD_MIN_SPEED", 256)) * 1024
+	if minSpeed <= 0 {
+		minSpeed = 256 * 1024
+	}
+
+	results := make([]models.BatchUploadResult, len(names))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, name := range names {
+		// 获取并发令牌，令牌耗尽时阻塞以限制对后端的压力
+		if ctx.Err() == nil {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			results[i] = newBatchUploadResult(name, nil, err)
+			continue
+		}
+
+		wg.Add(1)
+		go func(index int, name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			// 为每个文件单独设置超时，大小未知时仅随 ctx 取消
+			fileCtx, cancel := context.WithCancel(ctx)
+			if size := batchFileSize(sizes, index); size >= 0 {
+				fileCtx, cancel = context.WithTimeout(ctx, uploadFileTimeout(baseTimeout, minSpeed, size))
+			}
+			defer cancel()
+
+			file, err := upload(fileCtx, index)
+			results[index] = newBatchUploadResult(name, file, err)
+		}(i, name)
+	}
+	wg.Wait()
+
+	response := &models.BatchUploadResponse{
+		Total:   len(names),
+		Results: results,
+	}
+	for _, result := range results {
+		if result.Success {
+			response.SuccessCount++
+		} else {
+			response.FailureCount++
+		}
+	}
+	return response
+}
+
+// batchFileSize 返回批次中下标为 index 的文件大小，未知时返回 -1
+func batchFileSize(sizes []int64, index int) int64 {
+	if index >= len(sizes) {
+		return -1
+	}
+	return sizes[index]
+}
+
+// uploadFileTimeout 计算单个文件的上传超时：基础超时加上以最低速度 bytesPerSecond 传输 size 字节所需的时间
+func uploadFileTimeout(base time.Duration, bytesPerSecond, size int64) time.Duration {
+	return base + time.Duration(size)*time.Second/time.Duration(bytesPerSecond)
+}
+
+// FileSizes 获取各路径对应文件的大小，无法获取时为 -1
+func FileSizes(paths []string) []int64 {
+	sizes := make([]int64, len(paths))
+	for i, path := range paths {
+		sizes[i] = -1
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			sizes[i] = info.Size()
+		}
+	}
+	return sizes
+}
+
+// newBatchUploadResult 根据上传结果构造单个文件的批量上传结果
+func newBatchUploadResult(name string, file *models.KnowledgeFile, err error) models.BatchUploadResult {
+	if err != nil {
+		ErrorWith("批量上传文件失败", "file", name, "error", err)
+		return models.BatchUploadResult{
+			FilePath: name,
+			Success:  false,
+			Message:  "上传失败",
+			Error:    err.Error(),
+		}
+	}
+
+	InfoWith("批量上传文件成功", "file", name, "file_id", file.ID)
+	return models.BatchUploadResult{
+		FilePath: name,
+		Success:  true,
+		Message:  "上传成功",
+		File:     file,
+	}
+}
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"chat-backend/models"
+)
+
+// setupBatchUpload 在临时目录中加载配置，限制并发数为 2，单文件超时使用默认值
+func setupBatchUpload(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	t.Setenv("UPLOAD_CONCURRENCY", "2")
+	t.Setenv("UPLOAD_FILE_TIMEOUT", "60")
+	t.Setenv("UPLOAD_MIN_SPEED", "256")
+	if got := GetGlobalEnvConfig().GetInt("UPLOAD_CONCURRENCY", 0); got != 2 {
+		t.Skipf("全局配置已在其他测试中加载，UPLOAD_CONCURRENCY = %d", got)
+	}
+}
+
+func TestRunBatchUploadOrderAndConcurrency(t *testing.T) {
+	setupBatchUpload(t)
+
+	names := []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt"}
+	var (
+		mu       sync.Mutex
+		running  int
+		maxAlive int
+	)
+	response := RunBatchUpload(context.Background(), names, nil, func(ctx context.Context, index int) (*models.KnowledgeFile, error) {
+		mu.Lock()
+		running++
+		if running > maxAlive {
+			maxAlive = running
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+
+		// 先开始的文件后完成，结果顺序仍应与 names 一致
+		time.Sleep(time.Duration(len(names)-index) * 5 * time.Millisecond)
+		if index == 2 {
+			return nil, errors.New("上传失败")
+		}
+		return &models.KnowledgeFile{ID: index + 1, Name: names[index]}, nil
+	})
+
+	if response.Total != len(names) || response.SuccessCount != 4 || response.FailureCount != 1 {
+		t.Fatalf("统计 = %d/%d/%d, want 5/4/1", response.Total, response.SuccessCount, response.FailureCount)
+	}
+	for i, result := range response.Results {
+		if result.FilePath != names[i] {
+			t.Errorf("Results[%d].FilePath = %q, want %q", i, result.FilePath, names[i])
+		}
+		if wantSuccess := i != 2; result.Success != wantSuccess {
+			t.Errorf("Results[%d].Success = %v, want %v", i, result.Success, wantSuccess)
+		}
+		if result.Success && result.File.ID != i+1 {
+			t.Errorf("Results[%d].File.ID = %d, want %d", i, result.File.ID, i+1)
+		}
+	}
+	if maxAlive > 2 {
+		t.Errorf("同时上传的文件数 = %d, want <= 2", maxAlive)
+	}
+}
+
+func TestRunBatchUploadCanceled(t *testing.T) {
+	setupBatchUpload(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	response := RunBatchUpload(ctx, []string{"a.txt", "b.txt"}, nil, func(ctx context.Context, index int) (*models.KnowledgeFile, error) {
+		called = true
+		return &models.KnowledgeFile{}, nil
+	})
+
+	if called {
+		t.Error("ctx 已取消时不应开始上传")
+	}
+	if response.FailureCount != 2 {
+		t.Errorf("FailureCount = %d, want 2", response.FailureCount)
+	}
+	for i, result := range response.Results {
+		if result.Success || result.Error != context.Canceled.Error() {
+			t.Errorf("Results[%d] = %+v, want 因取消失败", i, result)
+		}
+	}
+}
+
+func TestRunBatchUploadFileTimeout(t *testing.T) {
+	setupBatchUpload(t)
+
+	sizes := []int64{0, 100 << 20, -1}
+	deadlines := make([]time.Duration, len(sizes))
+	start := time.Now()
+	RunBatchUpload(context.Background(), []string{"small", "large", "unknown"}, sizes, func(ctx context.Context, index int) (*models.KnowledgeFile, error) {
+		if deadline, ok := ctx.Deadline(); ok {
+			deadlines[index] = deadline.Sub(start)
+		}
+		return &models.KnowledgeFile{}, nil
+	})
+
+	if deadlines[0] <= 0 || deadlines[0] > 61*time.Second {
+		t.Errorf("空文件的超时 = %v, want 约 60s", deadlines[0])
+	}
+	if deadlines[1] < 400*time.Second {
+		t.Errorf("100MB 文件的超时 = %v, want >= 400s", deadlines[1])
+	}
+	if deadlines[2] != 0 {
+		t.Errorf("大小未知的文件不应设置超时, got %v", deadlines[2])
+	}
+}
+
+func TestUploadFileTimeout(t *testing.T) {
+	tests := []struct {
+		size int64
+		want time.Duration
+	}{
+		{size: 0, want: time.Minute},
+		{size: 1024, want: time.Minute + 4*time.Millisecond},
+		{size: 256 << 10, want: time.Minute + time.Second},
+		{size: 1 << 30, want: time.Minute + 4096*time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.size), func(t *testing.T) {
+			got := uploadFileTimeout(time.Minute, 256<<10, tt.size)
+			if got.Round(time.Millisecond) != tt.want {
+				t.Errorf("uploadFileTimeout(%d) = %v, want %v", tt.size, got, tt.want)
+			}
+		})
+	}
+}
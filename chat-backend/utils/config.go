@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -21,11 +22,22 @@ var defaultConfigs = map[string]string{
 	"SERVICE_TYPE":     "flowy", // flowy 或 langchaingo
 	"SHORTCUT_API_URL": "http://10.18.13.157:26034",
 
+	// 跨域配置
+	"CORS_ALLOWED_ORIGINS": "", // 允许的来源，多个以逗号分隔，为空时HTTP接口允许任意来源、WebSocket仅允许同源
+
+	// 批量上传配置
+	"UPLOAD_CONCURRENCY":  "4",
+	"UPLOAD_FILE_TIMEOUT": "60",  // 单文件上传的基础超时（秒）
+	"UPLOAD_MIN_SPEED":    "256", // 计算单文件超时所用的最低上传速度（KB/s）
+
 	// Flowy SDK 配置
 	"FLOWY_BASE_URL": "http://10.18.13.10:8888/api/v1",
 	"FLOWY_API_KEY":  "",
 	"FLOWY_TOKEN":    "Basic c3dvcmQ6c3dvcmRfc2VjcmV0",
 
+	// Flowy 本地会话索引配置
+	"FLOWY_SQLITE_DB_PATH": "./flowy_sessions.db",
+
 	// Langchaingo - LLM 配置
 	"LANGCHAINO_LLM_BASE_URL": "https://api.openai.com/v1",
 	"LANGCHAINO_LLM_API_KEY":  "",
@@ -47,6 +59,9 @@ var defaultConfigs = map[string]string{
 	// Langchaingo - SQLite 配置
 	"LANGCHAINO_SQLITE_DB_PATH":  "./chat_history.db",
 	"LANGCHAINO_SQLITE_PASSWORD": "",
+
+	// Langchaingo - 文件存储配置
+	"LANGCHAINO_UPLOAD_DIR": "./uploads",
 }
 
 var globalEnvConfig *EnvConfig
@@ -158,6 +173,19 @@ func (c *EnvConfig) ensureEnvFile() {
 		fmt.Fprintf(file, "# 快捷方式服务配置\n")
 		fmt.Fprintf(file, "SHORTCUT_API_URL=%s\n\n", defaultConfigs["SHORTCUT_API_URL"])
 
+		fmt.Fprintf(file, "# 跨域配置\n")
+		fmt.Fprintf(file, "# 允许的来源，多个以逗号分隔，如 https://chat.example.com；* 表示任意来源\n")
+		fmt.Fprintf(file, "# 为空时HTTP接口允许任意来源，WebSocket仅允许同源和不携带 Origin 的客户端\n")
+		fmt.Fprintf(file, "CORS_ALLOWED_ORIGINS=%s\n\n", defaultConfigs["CORS_ALLOWED_ORIGINS"])
+
+		fmt.Fprintf(file, "# 批量上传配置\n")
+		fmt.Fprintf(file, "# 同时上传的文件数上限\n")
+		fmt.Fprintf(file, "UPLOAD_CONCURRENCY=%s\n", defaultConfigs["UPLOAD_CONCURRENCY"])
+		fmt.Fprintf(file, "# 单个文件上传的基础超时（秒），实际超时另按文件大小和最低上传速度增加\n")
+		fmt.Fprintf(file, "UPLOAD_FILE_TIMEOUT=%s\n", defaultConfigs["UPLOAD_FILE_TIMEOUT"])
+		fmt.Fprintf(file, "# 最低上传速度（KB/s），大小未知的文件不设置单文件超时\n")
+		fmt.Fprintf(file, "UPLOAD_MIN_SPEED=%s\n\n", defaultConfigs["UPLOAD_MIN_SPEED"])
+
 		fmt.Fprintf(file, "# ========================================\n")
 		fmt.Fprintf(file, "# Flowy SDK 配置 (当 SERVICE_TYPE=flowy 时使用)\n")
 		fmt.Fprintf(file, "# ========================================\n")
@@ -166,7 +194,9 @@ func (c *EnvConfig) ensureEnvFile() {
 		fmt.Fprintf(file, "# Flowy API 密钥\n")
 		fmt.Fprintf(file, "FLOWY_API_KEY=%s\n", defaultConfigs["FLOWY_API_KEY"])
 		fmt.Fprintf(file, "# Flowy 认证 Token\n")
-		fmt.Fprintf(file, "FLOWY_TOKEN=%s\n\n", defaultConfigs["FLOWY_TOKEN"])
+		fmt.Fprintf(file, "FLOWY_TOKEN=%s\n", defaultConfigs["FLOWY_TOKEN"])
+		fmt.Fprintf(file, "# Flowy 会话索引 SQLite 数据库路径\n")
+		fmt.Fprintf(file, "FLOWY_SQLITE_DB_PATH=%s\n\n", defaultConfigs["FLOWY_SQLITE_DB_PATH"])
 
 		fmt.Fprintf(file, "# ========================================\n")
 		fmt.Fprintf(file, "# Langchaingo 配置 (当 SERVICE_TYPE=langchaingo 时使用)\n")
@@ -204,7 +234,11 @@ func (c *EnvConfig) ensureEnvFile() {
 		fmt.Fprintf(file, "# SQLite 数据库路径\n")
 		fmt.Fprintf(file, "LANGCHAINO_SQLITE_DB_PATH=%s\n", defaultConfigs["LANGCHAINO_SQLITE_DB_PATH"])
 		fmt.Fprintf(file, "# SQLite 数据库密码\n")
-		fmt.Fprintf(file, "LANGCHAINO_SQLITE_PASSWORD=%s\n", defaultConfigs["LANGCHAINO_SQLITE_PASSWORD"])
+		fmt.Fprintf(file, "LANGCHAINO_SQLITE_PASSWORD=%s\n\n", defaultConfigs["LANGCHAINO_SQLITE_PASSWORD"])
+
+		fmt.Fprintf(file, "# 文件存储配置\n")
+		fmt.Fprintf(file, "# 上传文件原件保存目录\n")
+		fmt.Fprintf(file, "LANGCHAINO_UPLOAD_DIR=%s\n", defaultConfigs["LANGCHAINO_UPLOAD_DIR"])
 	}
 }
 
@@ -232,6 +266,15 @@ func (c *EnvConfig) GetAll() map[string]string {
 	return result
 }
 
+// GetInt 获取整数配置，未配置或解析失败时返回默认值
+func (c *EnvConfig) GetInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(strings.TrimSpace(c.Get(key)))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
 // GetEnvOrDefault 兼容原有接口的函数
 func GetEnvOrDefault(key, defaultValue string) string {
 	config := GetGlobalEnvConfig()
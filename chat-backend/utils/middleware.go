@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -112,3 +115,65 @@ func WrapHandler(handler HandlerFunc) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// CORSMiddleware 跨域中间件，CORS_ALLOWED_ORIGINS 为空或包含 * 时允许任意来源，否则仅允许列出的来源
+func CORSMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origins := allowedOrigins()
+		if origin := c.GetHeader("Origin"); len(origins) == 0 || originListed("*", origins) {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else if origin != "" && originListed(origin, origins) {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Vary", "Origin")
+		}
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "*")
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(204)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// OriginAllowed 判断 WebSocket 握手请求的来源是否允许
+// 不携带 Origin 的非浏览器客户端、同源页面以及 CORS_ALLOWED_ORIGINS 中的来源允许连接，
+// 未配置时不允许其他站点的页面连接，防止跨站 WebSocket 劫持
+func OriginAllowed(r *http.Request) bool {
+	return originAllowed(r, allowedOrigins())
+}
+
+// originAllowed 判断请求来源是否为空、同源或在列表中
+func originAllowed(r *http.Request, origins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return originListed(origin, origins)
+}
+
+// allowedOrigins 读取 CORS_ALLOWED_ORIGINS 配置的来源列表
+func allowedOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(GetGlobalEnvConfig().Get("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// originListed 判断来源是否在列表中，列表包含 * 时任意来源均在列表中
+func originListed(origin string, origins []string) bool {
+	for _, allowed := range origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
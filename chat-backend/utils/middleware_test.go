@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		origins []string
+		want    bool
+	}{
+		{name: "不携带 Origin", origin: "", want: true},
+		{name: "同源", origin: "http://chat.local:9090", want: true},
+		{name: "同源忽略大小写", origin: "http://CHAT.local:9090", want: true},
+		{name: "其他端口", origin: "http://chat.local:3000", want: false},
+		{name: "其他站点", origin: "https://evil.example", want: false},
+		{name: "null 来源", origin: "null", want: false},
+		{name: "配置的来源", origin: "https://app.example", origins: []string{"https://app.example"}, want: true},
+		{name: "未配置的来源", origin: "https://evil.example", origins: []string{"https://app.example"}, want: false},
+		{name: "允许任意来源", origin: "https://evil.example", origins: []string{"*"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://chat.local:9090/api/v1/chat/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := originAllowed(r, tt.origins); got != tt.want {
+				t.Errorf("originAllowed(%q, %v) = %v, want %v", tt.origin, tt.origins, got, tt.want)
+			}
+		})
+	}
+}
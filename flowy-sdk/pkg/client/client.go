@@ -26,14 +26,18 @@ type HTTPClient interface {
 	Put(ctx context.Context, path string, body interface{}) (*models.BaseResponse, error)
 	Delete(ctx context.Context, path string) (*models.BaseResponse, error)
 	Upload(ctx context.Context, path string, fieldName string, filename string, fileContent io.Reader, params map[string]string) (*models.BaseResponse, error)
+	UploadWithProgress(ctx context.Context, path string, fieldName string, filename string, fileContent io.Reader, params map[string]string, progress ProgressFunc) (*models.BaseResponse, error)
 	Download(ctx context.Context, path string) (io.ReadCloser, error)
 }
 
+// ProgressFunc 上传进度回调，uploaded 为已写入请求体的文件字节数
+type ProgressFunc func(uploaded int64)
+
 // Client FLOWY HTTP客户端实现
 type Client struct {
 	config        *config.Config
 	httpClient    *http.Client
-	httpClientSSE *http.Client // SSE 专用客户端，无超时限制
+	httpClientSSE *http.Client // SSE/流式上传专用客户端，无超时限制
 	baseURL       string
 }
 
@@ -197,40 +201,89 @@ func (c *Client) Delete(ctx context.Context, path string) (*models.BaseResponse,
 
 // Upload 上传文件
 func (c *Client) Upload(ctx context.Context, path string, fieldName string, filename string, fileContent io.Reader, params map[string]string) (*models.BaseResponse, error) {
+	return c.UploadWithProgress(ctx, path, fieldName, filename, fileContent, params, nil)
+}
+
+// UploadWithProgress 流式上传文件，并通过 progress 回调报告已上传字节数
+// multipart 请求体通过 io.Pipe 边读边写，不会在内存中缓冲整个文件
+func (c *Client) UploadWithProgress(ctx context.Context, path string, fieldName string, filename string, fileContent io.Reader, params map[string]string, progress ProgressFunc) (*models.BaseResponse, error) {
 	url := c.buildURL(path, nil)
 
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	// 在独立的 goroutine 中写入 multipart 数据，写入失败时通过 CloseWithError 传递给请求方
+	go func() {
+		pw.CloseWithError(writeMultipart(writer, fieldName, filename, fileContent, params, progress))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, pr)
+	if err != nil {
+		pr.Close()
+		return nil, errors.New(errors.ErrCodeInvalidRequest, "failed to create request").WithDetails(err.Error())
+	}
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	c.setAuthHeaders(req)
+
+	// 流式请求体无法重放，因此不走重试逻辑；大文件上传耗时较长，使用无超时客户端并依赖 ctx 控制
+	resp, err := c.httpClientSSE.Do(req)
+	// 确保写入 goroutine 在请求提前结束时能够退出
+	pr.Close()
+	if err != nil {
+		return nil, errors.New(errors.ErrCodeNetworkError, "network request failed").WithDetails(err.Error())
+	}
+	defer resp.Body.Close()
+
+	return c.parseResponse(resp)
+}
 
+// writeMultipart 将文件和表单参数写入 multipart writer
+func writeMultipart(writer *multipart.Writer, fieldName string, filename string, fileContent io.Reader, params map[string]string, progress ProgressFunc) error {
 	// 添加文件
 	part, err := writer.CreateFormFile(fieldName, filename)
 	if err != nil {
-		return nil, errors.New(errors.ErrCodeInvalidRequest, "failed to create form file").WithDetails(err.Error())
+		return errors.New(errors.ErrCodeInvalidRequest, "failed to create form file").WithDetails(err.Error())
+	}
+
+	var dst io.Writer = part
+	if progress != nil {
+		dst = &progressWriter{w: part, progress: progress}
 	}
 
-	if _, err := io.Copy(part, fileContent); err != nil {
-		return nil, errors.New(errors.ErrCodeInvalidRequest, "failed to copy file content").WithDetails(err.Error())
+	if _, err := io.Copy(dst, fileContent); err != nil {
+		return errors.New(errors.ErrCodeInvalidRequest, "failed to copy file content").WithDetails(err.Error())
 	}
 
 	// 添加其他参数
 	for key, value := range params {
 		if err := writer.WriteField(key, value); err != nil {
-			return nil, errors.New(errors.ErrCodeInvalidRequest, "failed to write field").WithDetails(err.Error())
+			return errors.New(errors.ErrCodeInvalidRequest, "failed to write field").WithDetails(err.Error())
 		}
 	}
 
 	if err := writer.Close(); err != nil {
-		return nil, errors.New(errors.ErrCodeInvalidRequest, "failed to close writer").WithDetails(err.Error())
+		return errors.New(errors.ErrCodeInvalidRequest, "failed to close writer").WithDetails(err.Error())
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &buf)
-	if err != nil {
-		return nil, errors.New(errors.ErrCodeInvalidRequest, "failed to create request").WithDetails(err.Error())
-	}
+	return nil
+}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+// progressWriter 统计写入字节数并回调上传进度
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	progress ProgressFunc
+}
 
-	return c.doRequest(req)
+// Write 实现 io.Writer 接口
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	if n > 0 {
+		p.progress(p.written)
+	}
+	return n, err
 }
 
 // Download 下载文件
@@ -0,0 +1,139 @@
+﻿package sse
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event SSE 事件
+type Event struct {
+	ID    string        // 最近一次 id 字段的值，未设置过时为空
+	Type  string        // event 字段，为空表示默认的 message 类型
+	Data  string        // 多个 data 行以 "\n" 连接
+	Retry time.Duration // 最近一次 retry 字段指定的重连间隔，未设置过时为 0
+}
+
+// Reader SSE 流读取器
+// 按 WHATWG EventSource 规范解析 event/data/id/retry 字段：支持 "\r\n"、"\r"、"\n" 三种换行，
+// 忽略注释行（心跳），data 为空的事件不分发；按完整行解码，UTF-8 字符跨越读取边界时不会被截断
+type Reader struct {
+	br          *bufio.Reader
+	started     bool // 是否已跳过开头的 BOM
+	skipLF      bool // 上一行以 "\r" 结尾，下一字节若为 "\n" 则属于同一换行
+	lastEventID string
+	retry       time.Duration
+}
+
+// NewReader 创建 SSE 流读取器
+func NewReader(r io.Reader) *Reader {
+	return &Reader{br: bufio.NewReader(r)}
+}
+
+// Next 读取下一个事件，流结束时返回 io.EOF
+// 按规范，流在事件中途结束（缺少结尾空行）时，未完成的事件被丢弃
+func (r *Reader) Next() (*Event, error) {
+	var (
+		eventType string
+		data      strings.Builder
+		hasData   bool
+	)
+
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		// 空行：分发事件
+		if line == "" {
+			if !hasData {
+				eventType = ""
+				continue
+			}
+			return &Event{
+				ID:    r.lastEventID,
+				Type:  eventType,
+				Data:  strings.TrimSuffix(data.String(), "\n"),
+				Retry: r.retry,
+			}, nil
+		}
+
+		// 注释行，常用作心跳
+		if line[0] == ':' {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				r.lastEventID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				r.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+// LastEventID 最近一次 id 字段的值，可用于断线重连时的 Last-Event-ID 请求头
+func (r *Reader) LastEventID() string {
+	return r.lastEventID
+}
+
+// Retry 服务端通过 retry 字段指定的重连间隔，未指定时为 0
+func (r *Reader) Retry() time.Duration {
+	return r.retry
+}
+
+// readLine 读取一行（不含换行符），无效的 UTF-8 序列替换为 U+FFFD
+// 流结束时未以换行结尾的最后一行被丢弃
+func (r *Reader) readLine() (string, error) {
+	var line []byte
+	for {
+		b, err := r.br.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if r.skipLF {
+			r.skipLF = false
+			if b == '\n' {
+				continue
+			}
+		}
+
+		switch b {
+		case '\n':
+			return r.decode(line), nil
+		case '\r':
+			// 不等待下一字节，避免以 "\r" 换行的流在行尾阻塞
+			r.skipLF = true
+			return r.decode(line), nil
+		}
+		line = append(line, b)
+	}
+}
+
+// decode 去除流开头的 BOM 并将行转换为有效的 UTF-8 字符串
+func (r *Reader) decode(line []byte) string {
+	if !r.started {
+		r.started = true
+		line = bytes.TrimPrefix(line, []byte("\xef\xbb\xbf"))
+	}
+	return strings.ToValidUTF8(string(line), "\uFFFD")
+}
@@ -0,0 +1,254 @@
+﻿package sse
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+	"unicode/utf8"
+)
+
+// readAll 读取流中的全部事件
+func readAll(t testing.TB, r io.Reader) []Event {
+	t.Helper()
+	reader := NewReader(r)
+	var events []Event
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		events = append(events, *event)
+	}
+}
+
+// chunkReader 按固定的分片依次返回数据，模拟网络读取边界
+type chunkReader struct {
+	chunks [][]byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	if n == len(r.chunks[0]) {
+		r.chunks = r.chunks[1:]
+	} else {
+		r.chunks[0] = r.chunks[0][n:]
+	}
+	return n, nil
+}
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Event
+	}{
+		{
+			name:  "single event",
+			input: "data: hello\n\n",
+			want:  []Event{{Data: "hello"}},
+		},
+		{
+			name:  "event type",
+			input: "event: resp_increment\ndata: {\"message\":\"hi\"}\n\n",
+			want:  []Event{{Type: "resp_increment", Data: `{"message":"hi"}`}},
+		},
+		{
+			name:  "event type resets between events",
+			input: "event: a\ndata: 1\n\ndata: 2\n\n",
+			want:  []Event{{Type: "a", Data: "1"}, {Data: "2"}},
+		},
+		{
+			name:  "multi-line data",
+			input: "data: line1\ndata: line2\ndata:\n\n",
+			want:  []Event{{Data: "line1\nline2\n"}},
+		},
+		{
+			name:  "only one leading space removed",
+			input: "data:  two spaces\ndata:none\n\n",
+			want:  []Event{{Data: " two spaces\nnone"}},
+		},
+		{
+			name:  "field without colon",
+			input: "data\n\n",
+			want:  []Event{{Data: ""}},
+		},
+		{
+			name:  "CRLF line endings",
+			input: "event: x\r\ndata: a\r\ndata: b\r\n\r\n",
+			want:  []Event{{Type: "x", Data: "a\nb"}},
+		},
+		{
+			name:  "CR line endings",
+			input: "data: a\rdata: b\r\rdata: c\r\r",
+			want:  []Event{{Data: "a\nb"}, {Data: "c"}},
+		},
+		{
+			name:  "comments and heartbeats",
+			input: ": ping\n\n:\ndata: x\n: keep-alive\n\n",
+			want:  []Event{{Data: "x"}},
+		},
+		{
+			name:  "empty events are not dispatched",
+			input: "event: heartbeat\n\n\n\ndata: x\n\n",
+			want:  []Event{{Data: "x"}},
+		},
+		{
+			name:  "id persists across events",
+			input: "id: 1\ndata: a\n\ndata: b\n\nid\ndata: c\n\n",
+			want:  []Event{{ID: "1", Data: "a"}, {ID: "1", Data: "b"}, {ID: "", Data: "c"}},
+		},
+		{
+			name:  "id with NUL is ignored",
+			input: "id: 1\ndata: a\n\nid: 2\x003\ndata: b\n\n",
+			want:  []Event{{ID: "1", Data: "a"}, {ID: "1", Data: "b"}},
+		},
+		{
+			name:  "retry",
+			input: "retry: 3000\ndata: a\n\nretry: 1.5\ndata: b\n\nretry: -1\nretry: abc\ndata: c\n\n",
+			want: []Event{
+				{Data: "a", Retry: 3 * time.Second},
+				{Data: "b", Retry: 3 * time.Second},
+				{Data: "c", Retry: 3 * time.Second},
+			},
+		},
+		{
+			name:  "unknown fields are ignored",
+			input: "foo: bar\ndata: a\n\n",
+			want:  []Event{{Data: "a"}},
+		},
+		{
+			name:  "leading BOM",
+			input: "\xef\xbb\xbfdata: a\n\n",
+			want:  []Event{{Data: "a"}},
+		},
+		{
+			name:  "incomplete event at EOF is discarded",
+			input: "data: a\n\ndata: b\n",
+			want:  []Event{{Data: "a"}},
+		},
+		{
+			name:  "incomplete line at EOF is discarded",
+			input: "data: a\n\ndata: b",
+			want:  []Event{{Data: "a"}},
+		},
+		{
+			name:  "invalid UTF-8 replaced",
+			input: "data: a\xffb\n\n",
+			want:  []Event{{Data: "a\uFFFDb"}},
+		},
+		{
+			name:  "Chinese text",
+			input: "data: {\"message\":\"你好，世界\"}\n\n",
+			want:  []Event{{Data: `{"message":"你好，世界"}`}},
+		},
+		{
+			name:  "empty stream",
+			input: "",
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readAll(t, strings.NewReader(tt.input))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %#v, want %#v", got, tt.want)
+			}
+
+			// 逐字节读取时结果应完全一致
+			got = readAll(t, iotest.OneByteReader(strings.NewReader(tt.input)))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("one byte reads: events = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReaderRuneSplitAcrossReads(t *testing.T) {
+	input := []byte("data: {\"message\":\"中文字符\"}\n\n")
+	split := strings.Index(string(input), "文") + 1 // 在“文”的第二个字节前切分
+
+	got := readAll(t, &chunkReader{chunks: [][]byte{input[:split], input[split:]}})
+	want := []Event{{Data: `{"message":"中文字符"}`}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %#v, want %#v", got, want)
+	}
+}
+
+func TestReaderCRLFSplitAcrossReads(t *testing.T) {
+	got := readAll(t, &chunkReader{chunks: [][]byte{
+		[]byte("data: a\r"),
+		[]byte("\ndata: b\r"),
+		[]byte("\n\r"),
+		[]byte("\n"),
+	}})
+	want := []Event{{Data: "a\nb"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %#v, want %#v", got, want)
+	}
+}
+
+func TestReaderLastEventID(t *testing.T) {
+	reader := NewReader(strings.NewReader("id: 42\nretry: 500\ndata: a\n\n"))
+	if _, err := reader.Next(); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if got := reader.LastEventID(); got != "42" {
+		t.Errorf("LastEventID() = %q, want %q", got, "42")
+	}
+	if got := reader.Retry(); got != 500*time.Millisecond {
+		t.Errorf("Retry() = %v, want %v", got, 500*time.Millisecond)
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Next() at end error = %v, want io.EOF", err)
+	}
+}
+
+func FuzzReader(f *testing.F) {
+	seeds := []string{
+		"data: hello\n\n",
+		"event: resp_increment\r\ndata: {\"message\":\"你好\"}\r\n\r\n",
+		"id: 1\rretry: 100\rdata: a\rdata: b\r\r",
+		": ping\n\ndata\n\n",
+		"\xef\xbb\xbfdata: \xff\xfe\n\n",
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		whole := readAll(t, strings.NewReader(string(input)))
+
+		// 读取边界不应影响解析结果
+		oneByte := readAll(t, iotest.OneByteReader(strings.NewReader(string(input))))
+		if !reflect.DeepEqual(whole, oneByte) {
+			t.Fatalf("one byte reads differ:\n%#v\n%#v", whole, oneByte)
+		}
+
+		for _, event := range whole {
+			for _, s := range []string{event.ID, event.Type, event.Data} {
+				if !utf8.ValidString(s) {
+					t.Fatalf("invalid UTF-8 in event %#v", event)
+				}
+			}
+			if strings.ContainsAny(event.Type, "\r\n") || strings.ContainsAny(event.ID, "\r\n") {
+				t.Fatalf("line break in event type or id: %#v", event)
+			}
+			if strings.Contains(event.Data, "\r") {
+				t.Fatalf("CR in event data: %#v", event)
+			}
+			if event.Retry < 0 {
+				t.Fatalf("negative retry: %#v", event)
+			}
+		}
+	})
+}
@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"io"
 	"strings"
+	"sync"
 
 	"flowy-sdk/pkg/client"
 	"flowy-sdk/pkg/errors"
 	"flowy-sdk/pkg/models"
+	"flowy-sdk/pkg/sse"
 )
 
 // ==================== 请求和响应类型定义 ====================
@@ -569,10 +571,19 @@ type UsageInfo struct {
 
 // PluginsInfo 插件信息
 type PluginsInfo struct {
-	FileAnalysis []interface{} `json:"file_analysis"` // 文件分析
-	Knowledge    []interface{} `json:"knowledge"`     // 知识库
-	NL2SQL       []interface{} `json:"nl2sql"`        // NL2SQL
-	OnlineSearch []interface{} `json:"onlineSearch"`  // 在线搜索
+	FileAnalysis []interface{}        `json:"file_analysis"` // 文件分析
+	Knowledge    []KnowledgeReference `json:"knowledge"`     // 知识库检索结果
+	NL2SQL       []interface{}        `json:"nl2sql"`        // NL2SQL
+	OnlineSearch []interface{}        `json:"onlineSearch"`  // 在线搜索
+}
+
+// KnowledgeReference 知识库插件返回的一条检索结果
+type KnowledgeReference struct {
+	FileID     int     `json:"fileId"`     // 文件ID
+	FileName   string  `json:"fileName"`   // 文件名称
+	Content    string  `json:"content"`    // 命中的分块内容
+	Score      float64 `json:"score"`      // 相似度
+	ChunkIndex int     `json:"chunkIndex"` // 分块索引
 }
 
 // ExtraInfo 额外信息
@@ -594,6 +605,13 @@ type StructData struct {
 	MarkMap interface{} `json:"markMap"` // 思维导图数据
 }
 
+// ToolCall 流事件中的一次工具调用
+type ToolCall struct {
+	Name      string      `json:"name"`      // 工具名称
+	Arguments interface{} `json:"arguments"` // 调用参数
+	Result    interface{} `json:"result"`    // 调用结果
+}
+
 // StreamEvent SSE流事件
 // swagger:model
 type StreamEvent struct {
@@ -605,8 +623,8 @@ type StreamEvent struct {
 	RequestID          string                 `json:"requestId"`           // 请求ID
 	Index              int                    `json:"index"`               // 索引
 	Error              bool                   `json:"error"`               // 是否错误
-	Tools              []interface{}          `json:"tools"`               // 工具列表
-	Plugins            map[string]interface{} `json:"plugins"`             // 插件信息
+	Tools              []ToolCall             `json:"tools"`               // 工具调用列表
+	Plugins            PluginsInfo            `json:"plugins"`             // 插件信息
 	Pending            bool                   `json:"pending"`             // 是否等待中
 	AgentID            int                    `json:"agentId"`             // Agent ID
 	SessionID          int                    `json:"sessionId"`           // 会话ID
@@ -630,6 +648,10 @@ type Service interface {
 	// API: POST /agent/listByPage
 	ListAgentsByPage(ctx context.Context, current, size int) (*AgentListResponse, error)
 
+	// 获取全部Agent(自动分页，并发拉取剩余页)
+	// API: POST /agent/listByPage
+	ListAllAgents(ctx context.Context) ([]AgentInfo, error)
+
 	// Agent详情
 	// API: POST /agent/detail
 	GetAgentDetail(ctx context.Context, agentID string) (*AgentDetailResponse, error)
@@ -681,6 +703,10 @@ type Service interface {
 	// API: POST /agent/chatAsync (SSE)
 	ChatAsync(ctx context.Context, req *AsyncChatRequest, eventChan chan<- StreamEvent) error
 
+	// 上传对话附件，返回的 OSS 名称用作 AsyncChatRequest.Files，需在配置中开启文件分析插件
+	// API: POST /agent/file/upload
+	UploadChatFile(ctx context.Context, file io.Reader, filename string) (*models.FileUploadResponse, error)
+
 	// 赞
 	// API: POST /blade-flowy/agent/session/record/pros
 	LikeMessage(ctx context.Context, messageID string) error
@@ -725,6 +751,111 @@ func (s *ServiceImpl) ListAgentsByPage(ctx context.Context, current, size int) (
 	return &result, nil
 }
 
+// 自动分页参数
+const (
+	AllAgentsPageSize    = 100 // 每页拉取的Agent数量
+	AllAgentsConcurrency = 4   // 同时拉取的最大页数
+)
+
+// ListAllAgents 获取全部Agent
+// 先拉取第一页，以实际返回的数量作为页大小（服务端可能限制每页数量），按总数以有限并发拉取剩余页；
+// 总数不准确时最后一页仍满页，继续逐页拉取直到遇到不满一页。结果按分页顺序返回
+// API: POST /agent/listByPage
+func (s *ServiceImpl) ListAllAgents(ctx context.Context) ([]AgentInfo, error) {
+	first, err := s.ListAgentsByPage(ctx, 1, AllAgentsPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := len(first.Records)
+	if pageSize == 0 || (pageSize < AllAgentsPageSize && first.Total <= pageSize) {
+		return first.Records, nil
+	}
+
+	pages := (first.Total + pageSize - 1) / pageSize
+	if pages < 1 {
+		pages = 1
+	}
+	results, err := s.listAgentPages(ctx, pages)
+	if err != nil {
+		return nil, err
+	}
+	results[0] = first.Records
+
+	for last := results[len(results)-1]; len(last) == pageSize; {
+		resp, err := s.ListAgentsByPage(ctx, len(results)+1, AllAgentsPageSize)
+		if err != nil {
+			return nil, err
+		}
+		// 服务端忽略页码时会重复返回同一页，此时停止拉取
+		if len(resp.Records) > 0 && resp.Records[0].ID == last[0].ID {
+			break
+		}
+		results = append(results, resp.Records)
+		last = resp.Records
+	}
+
+	agents := make([]AgentInfo, 0, len(results)*pageSize)
+	for _, records := range results {
+		agents = append(agents, records...)
+	}
+	return agents, nil
+}
+
+// listAgentPages 以有限并发拉取第 2 至 pages 页，返回按页码排列的结果（第一页留空）
+func (s *ServiceImpl) listAgentPages(ctx context.Context, pages int) ([][]AgentInfo, error) {
+	results := make([][]AgentInfo, pages)
+	if pages <= 1 {
+		return results, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, AllAgentsConcurrency)
+
+	for page := 2; page <= pages; page++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(page int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			resp, err := s.ListAgentsByPage(ctx, page, AllAgentsPageSize)
+			if err != nil {
+				// 任意一页失败即取消其余请求
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			results[page-1] = resp.Records
+		}(page)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 // GetAgentDetail 获取Agent详情
 // API: POST /agent/detail
 func (s *ServiceImpl) GetAgentDetail(ctx context.Context, agentID string) (*AgentDetailResponse, error) {
@@ -999,94 +1130,78 @@ func (s *ServiceImpl) ChatAsync(ctx context.Context, req *AsyncChatRequest, even
 	return s.parseSSEStream(ctx, stream, eventChan)
 }
 
-// parseSSEStream 解析 SSE 流
-func (s *ServiceImpl) parseSSEStream(ctx context.Context, stream io.ReadCloser, eventChan chan<- StreamEvent) error {
-	buf := make([]byte, 4096)
-	var line string
-	var currentEventType string
-
+// parseSSEStream 解析 SSE 流，ctx 取消时停止读取和发送
+func (s *ServiceImpl) parseSSEStream(ctx context.Context, stream io.Reader, eventChan chan<- StreamEvent) error {
+	reader := sse.NewReader(stream)
 	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
-
-		n, err := stream.Read(buf)
-		if n > 0 {
-			data := string(buf[:n])
-			lines := strings.Split(line+data, "\n")
-
-			for i := 0; i < len(lines)-1; i++ {
-				trimmedLine := strings.TrimSpace(lines[i])
-
-				// 检查是否是 event: 行
-				if strings.HasPrefix(trimmedLine, "event:") {
-					currentEventType = strings.TrimSpace(strings.TrimPrefix(trimmedLine, "event:"))
-					continue
-				}
-
-				// 处理 data: 行
-				if err := s.processSSELine(lines[i], currentEventType, eventChan); err != nil {
-					return err
-				}
-
-				// 空行表示事件结束，重置事件类型
-				if trimmedLine == "" {
-					currentEventType = ""
-				}
-			}
-
-			line = lines[len(lines)-1]
-		}
-
+		event, err := reader.Next()
 		if err != nil {
 			if err == io.EOF {
-				break
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
 			}
 			return err
 		}
-	}
 
-	return nil
-}
-
-// processSSELine 处理单行 SSE 数据
-func (s *ServiceImpl) processSSELine(line string, eventType string, eventChan chan<- StreamEvent) error {
-	line = strings.TrimSpace(line)
-
-	if line == "" || !strings.HasPrefix(line, "data:") {
-		return nil
+		select {
+		case eventChan <- s.parseSSEEvent(event):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
+}
 
-	// 提取 data: 后面的内容
-	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+// parseSSEEvent 将 SSE 事件转换为流事件
+func (s *ServiceImpl) parseSSEEvent(event *sse.Event) StreamEvent {
+	data := strings.TrimSpace(event.Data)
 	if data == "" || data == "[DONE]" {
-		// 发送完成事件
-		eventChan <- StreamEvent{
-			EventType:    eventType,
+		// 完成事件
+		return StreamEvent{
+			EventType:    event.Type,
 			FinishReason: "stop",
 			Pending:      false,
 		}
-		return nil
 	}
 
 	// 解析 JSON 数据
-	var event StreamEvent
-	if err := json.Unmarshal([]byte(data), &event); err != nil {
+	var streamEvent StreamEvent
+	if err := json.Unmarshal([]byte(data), &streamEvent); err != nil {
 		// 如果解析失败，将原始数据作为消息发送
-		eventChan <- StreamEvent{
-			EventType: eventType,
+		return StreamEvent{
+			EventType: event.Type,
 			Message:   data,
 			Error:     true,
 		}
-		return nil
 	}
 
 	// 设置事件类型
-	event.EventType = eventType
-	eventChan <- event
-	return nil
+	streamEvent.EventType = event.Type
+	return streamEvent
+}
+
+// UploadChatFile 上传对话附件
+func (s *ServiceImpl) UploadChatFile(ctx context.Context, file io.Reader, filename string) (*models.FileUploadResponse, error) {
+	if file == nil {
+		return nil, errors.New(errors.ErrCodeInvalidRequest, "file is required")
+	}
+
+	if filename == "" {
+		return nil, errors.New(errors.ErrCodeInvalidRequest, "filename is required")
+	}
+
+	resp, err := s.client.Upload(ctx, "/agent/file/upload", "file", filename, file, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result models.FileUploadResponse
+	if err := s.parseResponseData(resp, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
 }
 
 // LikeMessage 点赞对话记录
@@ -0,0 +1,143 @@
+﻿package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"flowy-sdk/pkg/client"
+	"flowy-sdk/pkg/models"
+	"flowy-sdk/pkg/sse"
+)
+
+// fakeAgentClient 模拟 /agent/listByPage 分页接口
+type fakeAgentClient struct {
+	client.HTTPClient
+
+	agents  []AgentInfo
+	maxSize int // 服务端每页数量上限，0 表示不限制
+	total   int // 返回的总数，小于 0 时返回实际数量
+
+	mu    sync.Mutex
+	pages []int
+}
+
+func (c *fakeAgentClient) Post(ctx context.Context, path string, body interface{}) (*models.BaseResponse, error) {
+	req := body.(map[string]interface{})
+	current, size := req["current"].(int), req["size"].(int)
+	if c.maxSize > 0 && size > c.maxSize {
+		size = c.maxSize
+	}
+
+	c.mu.Lock()
+	c.pages = append(c.pages, current)
+	c.mu.Unlock()
+
+	records := []AgentInfo{}
+	if start := (current - 1) * size; start < len(c.agents) {
+		end := start + size
+		if end > len(c.agents) {
+			end = len(c.agents)
+		}
+		records = c.agents[start:end]
+	}
+	total := c.total
+	if total < 0 {
+		total = len(c.agents)
+	}
+	return &models.BaseResponse{Success: true, Data: AgentListResponse{Total: total, Records: records}}, nil
+}
+
+// newAgents 生成ID为 1..n 的Agent
+func newAgents(n int) []AgentInfo {
+	agents := make([]AgentInfo, n)
+	for i := range agents {
+		agents[i] = AgentInfo{ID: i + 1}
+	}
+	return agents
+}
+
+func TestListAllAgents(t *testing.T) {
+	tests := []struct {
+		name    string
+		count   int
+		maxSize int
+		total   int
+		pages   int
+	}{
+		{name: "单页", count: 30, total: -1, pages: 1},
+		{name: "多页", count: 250, total: -1, pages: 3},
+		{name: "整页", count: 200, total: -1, pages: 3},
+		{name: "服务端限制每页数量", count: 120, maxSize: 50, total: -1, pages: 3},
+		{name: "总数偏小", count: 230, total: 100, pages: 3},
+		{name: "缺少总数", count: 150, total: 0, pages: 2},
+		{name: "没有Agent", count: 0, total: -1, pages: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeAgentClient{agents: newAgents(tt.count), maxSize: tt.maxSize, total: tt.total}
+			svc := NewService(fake)
+
+			agents, err := svc.ListAllAgents(context.Background())
+			if err != nil {
+				t.Fatalf("ListAllAgents() error = %v", err)
+			}
+			if len(agents) != tt.count {
+				t.Fatalf("ListAllAgents() 返回 %d 个Agent, want %d", len(agents), tt.count)
+			}
+			for i, agent := range agents {
+				if agent.ID != i+1 {
+					t.Fatalf("agents[%d].ID = %d, want %d", i, agent.ID, i+1)
+				}
+			}
+			if len(fake.pages) < tt.pages {
+				t.Errorf("请求了 %d 页, want >= %d", len(fake.pages), tt.pages)
+			}
+		})
+	}
+}
+
+// TestListAllAgentsRepeatedPage 服务端忽略页码时不会无限拉取
+func TestListAllAgentsRepeatedPage(t *testing.T) {
+	fake := &repeatingAgentClient{records: newAgents(AllAgentsPageSize)}
+	svc := NewService(fake)
+
+	agents, err := svc.ListAllAgents(context.Background())
+	if err != nil {
+		t.Fatalf("ListAllAgents() error = %v", err)
+	}
+	if len(agents) != AllAgentsPageSize {
+		t.Fatalf("ListAllAgents() 返回 %d 个Agent, want %d", len(agents), AllAgentsPageSize)
+	}
+}
+
+// repeatingAgentClient 总是返回同一页且不返回总数
+type repeatingAgentClient struct {
+	client.HTTPClient
+
+	records []AgentInfo
+}
+
+func (c *repeatingAgentClient) Post(ctx context.Context, path string, body interface{}) (*models.BaseResponse, error) {
+	return &models.BaseResponse{Success: true, Data: AgentListResponse{Records: c.records}}, nil
+}
+
+func TestParseSSEEventPlugins(t *testing.T) {
+	s := &ServiceImpl{}
+	event := s.parseSSEEvent(&sse.Event{
+		Type: "resp_increment",
+		Data: `{"message":"好","plugins":{"knowledge":[{"fileId":3,"fileName":"手册.pdf","content":"片段","score":0.9,"chunkIndex":2}]},` +
+			`"tools":[{"name":"search","arguments":{"q":"天气"},"result":"晴"}]}`,
+	})
+	if event.Error {
+		t.Fatalf("parseSSEEvent() 解析失败: %s", event.Message)
+	}
+
+	wantKnowledge := KnowledgeReference{FileID: 3, FileName: "手册.pdf", Content: "片段", Score: 0.9, ChunkIndex: 2}
+	if len(event.Plugins.Knowledge) != 1 || event.Plugins.Knowledge[0] != wantKnowledge {
+		t.Errorf("Plugins.Knowledge = %+v, want [%+v]", event.Plugins.Knowledge, wantKnowledge)
+	}
+	if len(event.Tools) != 1 || event.Tools[0].Name != "search" || event.Tools[0].Result != "晴" {
+		t.Errorf("Tools = %+v", event.Tools)
+	}
+}
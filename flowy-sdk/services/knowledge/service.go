@@ -525,6 +525,10 @@ type Service interface {
 	// API: POST /knowledge/file/upload (multipart/form-data)
 	UploadFile(ctx context.Context, file io.Reader, filename string, knowledgeID, pid int, lang string) (*FileUploadData, error)
 
+	// 文件上传（流式，带进度回调）
+	// API: POST /knowledge/file/upload (multipart/form-data)
+	UploadFileWithProgress(ctx context.Context, file io.Reader, filename string, knowledgeID, pid int, lang string, progress client.ProgressFunc) (*FileUploadData, error)
+
 	// 文件删除
 	// API: POST /knowledge/file/delete
 	DeleteFile(ctx context.Context, id int) error
@@ -790,6 +794,11 @@ func (s *ServiceImpl) ListFiles(ctx context.Context, knowledgeID int, lang strin
 
 // UploadFile 文件上传
 func (s *ServiceImpl) UploadFile(ctx context.Context, file io.Reader, filename string, knowledgeID, pid int, lang string) (*FileUploadData, error) {
+	return s.UploadFileWithProgress(ctx, file, filename, knowledgeID, pid, lang, nil)
+}
+
+// UploadFileWithProgress 文件上传（流式，带进度回调）
+func (s *ServiceImpl) UploadFileWithProgress(ctx context.Context, file io.Reader, filename string, knowledgeID, pid int, lang string, progress client.ProgressFunc) (*FileUploadData, error) {
 	if file == nil {
 		return nil, errors.New(errors.ErrCodeInvalidRequest, "file is required")
 	}
@@ -808,7 +817,7 @@ func (s *ServiceImpl) UploadFile(ctx context.Context, file io.Reader, filename s
 		"lang":        lang,
 	}
 
-	resp, err := s.client.Upload(ctx, "/knowledge/file/upload", "file", filename, file, params)
+	resp, err := s.client.UploadWithProgress(ctx, "/knowledge/file/upload", "file", filename, file, params, progress)
 	if err != nil {
 		return nil, err
 	}
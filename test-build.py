@@ -35,7 +35,7 @@ def main():
     print("=" * 60)
     
     # 1. 编译当前平台版本
-    print("\n[1/3] 编译当前平台版本...")
+    print("\n[1/4] 编译当前平台版本...")
     build_cmd = [sys.executable, "build.py", "-p", "current", "-o", "test-build", "-c"]
     returncode, stdout, stderr = run_command(build_cmd, cwd=script_dir)
     
@@ -46,7 +46,7 @@ def main():
     print("✅ 编译成功")
     
     # 2. 测试 --version 参数
-    print("\n[2/3] 测试 --version 参数...")
+    print("\n[2/4] 测试 --version 参数...")
     test_build_dir = script_dir / "test-build"
     
     if platform.system() == 'Windows':
@@ -71,7 +71,7 @@ def main():
     print("-" * 40)
     
     # 3. 验证版本信息包含必要字段
-    print("\n[3/3] 验证版本信息...")
+    print("\n[3/4] 验证版本信息...")
     required_fields = ["Version:", "Build Time:", "Git Commit:"]
     missing_fields = []
     
@@ -84,6 +84,17 @@ def main():
         sys.exit(1)
     
     print("✅ 版本信息验证通过")
+
+    # 4. 验证 SQLite FTS5 已启用（消息全文搜索），与 build.py 使用相同的编译标签
+    print("\n[4/4] 验证消息全文索引 (FTS5)...")
+    fts_cmd = ["go", "test", "-tags", "sqlite_fts5", "-run", "TestMessageSearchFTS5", "./pkg/database/"]
+    returncode, stdout, stderr = run_command(fts_cmd, cwd=script_dir / "chat-backend")
+
+    if returncode != 0:
+        print(f"❌ FTS5 验证失败: {stdout}{stderr}")
+        sys.exit(1)
+
+    print("✅ FTS5 可用")
     
     # 总结
     print("\n" + "=" * 60)